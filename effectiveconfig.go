@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	appconfig "github.com/jz-wilson/cloud-price-exporter/exporter/config"
+)
+
+// redacted replaces secret values in the effective configuration.
+const redacted = "<redacted>"
+
+// secretFlags are the flags whose values are redacted entirely, e.g. the
+// URL of a Slack incoming webhook is its credential.
+var secretFlags = map[string]bool{"notify.webhook-url": true}
+
+// configEnvPrefixes and configEnvVars select the environment variables read
+// by the exporter and the SDKs it uses.
+var (
+	configEnvPrefixes = []string{"AWS_", "AZURE_"}
+	configEnvVars     = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy", "KUBERNETES_SERVICE_HOST", "KUBERNETES_SERVICE_PORT"}
+)
+
+// secretEnv matches the names of environment variables holding credentials.
+var secretEnv = regexp.MustCompile(`SECRET|TOKEN|PASSWORD|ACCESS_KEY`)
+
+// effectiveConfig is the configuration an exporter runs with once flags,
+// region detection and discovery, the environment and -config-file are
+// resolved, served as JSON at -web.config-path.
+type effectiveConfig struct {
+	// Flags are the values of all flags by their current names.
+	Flags map[string]string `json:"flags"`
+	// SetFlags are the flags set on the command line, by any name, or by
+	// region detection.
+	SetFlags []string `json:"setFlags"`
+	// AWSRegions and AzureRegions are the region codes scraped, after
+	// discovery and -aws.regions-exclude.
+	AWSRegions   []string `json:"awsRegions"`
+	AzureRegions []string `json:"azureRegions"`
+	// Environment are the variables of configEnvPrefixes and configEnvVars
+	// that are set.
+	Environment map[string]string `json:"environment"`
+	// ConfigFile is the content of -config-file, if set.
+	ConfigFile *appconfig.Config `json:"configFile,omitempty"`
+}
+
+// newEffectiveConfig returns the effective configuration of the flags of fs,
+// except aliases, the scraped regions, the environment environ (as returned
+// by os.Environ) and the configuration file, with secrets redacted.
+func newEffectiveConfig(fs *flag.FlagSet, aliases map[string]string, awsRegions, azureRegions, environ []string, file *appconfig.Config) effectiveConfig {
+	cfg := effectiveConfig{
+		Flags:        make(map[string]string),
+		SetFlags:     []string{},
+		AWSRegions:   append([]string{}, awsRegions...),
+		AzureRegions: append([]string{}, azureRegions...),
+		Environment:  make(map[string]string),
+		ConfigFile:   file,
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := aliases[f.Name]; !ok {
+			cfg.Flags[f.Name] = redactFlag(f.Name, f.Value.String())
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if canonical, ok := aliases[name]; ok {
+			name = canonical
+		}
+		if !slices.Contains(cfg.SetFlags, name) {
+			cfg.SetFlags = append(cfg.SetFlags, name)
+		}
+	})
+	slices.Sort(cfg.SetFlags)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if configEnv(name) {
+			cfg.Environment[name] = redactEnv(name, value)
+		}
+	}
+	return cfg
+}
+
+// configEnv reports whether the environment variable name is part of the
+// effective configuration.
+func configEnv(name string) bool {
+	if slices.Contains(configEnvVars, name) {
+		return true
+	}
+	for _, prefix := range configEnvPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactFlag returns the value of the flag name with secrets redacted.
+func redactFlag(name, value string) string {
+	if secretFlags[name] && value != "" {
+		return redacted
+	}
+	return redactURL(value)
+}
+
+// redactEnv returns the value of the environment variable name with secrets
+// redacted.
+func redactEnv(name, value string) string {
+	if secretEnv.MatchString(name) && value != "" {
+		return redacted
+	}
+	return redactURL(value)
+}
+
+// redactURL returns value with the password redacted if it's a URL with
+// one, e.g. of a proxy.
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+// configHandler serves cfg as JSON.
+func configHandler(cfg effectiveConfig) (http.Handler, error) {
+	body, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), nil
+}
@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+)
+
+// regionAccessible reports whether an AWS region may be scraped, i.e. it
+// hasn't been skipped for an authorization failure.
+func (e *Exporter) regionAccessible(region string) bool {
+	e.accessMu.Lock()
+	defer e.accessMu.Unlock()
+	accessible, checked := e.regionAccess[region]
+	return !checked || accessible
+}
+
+// checkRegionAccess checks a region for access before its first scrape when
+// unauthorized regions are skipped. It returns false, logging once, if the
+// region's credentials aren't authorized. Other errors are left to the scrape
+// itself and the check is repeated next time.
+func (e *Exporter) checkRegionAccess(ctx context.Context, region string, client aws.EC2DescribeAZsAPI) bool {
+	if !e.skipUnauthorized {
+		return true
+	}
+	e.accessMu.Lock()
+	accessible, checked := e.regionAccess[region]
+	e.accessMu.Unlock()
+	if checked {
+		return accessible
+	}
+
+	err := aws.CheckRegionAccess(ctx, client)
+	code, denied := aws.AuthErrorCode(err)
+	if err != nil && !denied {
+		return true
+	}
+
+	e.accessMu.Lock()
+	defer e.accessMu.Unlock()
+	if e.regionAccess == nil {
+		e.regionAccess = make(map[string]bool)
+	}
+	e.regionAccess[region] = !denied
+	if denied {
+		log.WithError(err).Warnf("not authorized to call region, skipping it from now on [region=%s, reason=%s]", region, code)
+		e.regionSkipped.WithLabelValues("aws", region, code).Set(1)
+	}
+	return !denied
+}
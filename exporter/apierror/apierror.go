@@ -0,0 +1,264 @@
+// Package apierror classifies the errors of AWS and Azure API requests into
+// categories an operator can act on, e.g. a missing IAM permission or
+// throttling, each with a remediation hint instead of the raw SDK message.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Category is the kind of an API error, deciding what fixes it.
+type Category string
+
+// Categories of API errors.
+const (
+	CategoryPermission  Category = "permission"  // the credentials lack a permission
+	CategoryCredentials Category = "credentials" // no, expired or invalid credentials
+	CategoryRegion      Category = "region"      // the region isn't enabled for the account
+	CategoryThrottling  Category = "throttling"  // too many requests
+	CategoryNetwork     Category = "network"     // the endpoint couldn't be reached
+	CategoryServer      Category = "server"      // an error of the provider, gone on retry
+	CategoryOther       Category = "other"       // anything else, e.g. a malformed response
+)
+
+// Categories are all the categories.
+var Categories = []Category{CategoryPermission, CategoryCredentials, CategoryRegion, CategoryThrottling, CategoryNetwork, CategoryServer, CategoryOther}
+
+// API error codes of AWS by category.
+var awsCodes = map[string]Category{
+	"UnauthorizedOperation":       CategoryPermission,
+	"AccessDenied":                CategoryPermission,
+	"AccessDeniedException":       CategoryPermission,
+	"AuthFailure":                 CategoryCredentials,
+	"InvalidClientTokenId":        CategoryCredentials,
+	"UnrecognizedClientException": CategoryCredentials,
+	"ExpiredToken":                CategoryCredentials,
+	"ExpiredTokenException":       CategoryCredentials,
+	"RequestExpired":              CategoryCredentials,
+	"SignatureDoesNotMatch":       CategoryCredentials,
+	"InvalidSignatureException":   CategoryCredentials,
+	"OptInRequired":               CategoryRegion,
+	"Throttling":                  CategoryThrottling,
+	"ThrottlingException":         CategoryThrottling,
+	"RequestLimitExceeded":        CategoryThrottling,
+	"TooManyRequestsException":    CategoryThrottling,
+	"SlowDown":                    CategoryThrottling,
+	"InternalError":               CategoryServer,
+	"InternalFailure":             CategoryServer,
+	"ServiceUnavailable":          CategoryServer,
+	"Unavailable":                 CategoryServer,
+}
+
+// iamPrefixes are the IAM action prefixes of the AWS services by SDK
+// service ID.
+var iamPrefixes = map[string]string{
+	"EC2":           "ec2",
+	"Pricing":       "pricing",
+	"savingsplans":  "savingsplans",
+	"S3":            "s3",
+	"Cost Explorer": "ce",
+	"STS":           "sts",
+}
+
+// iamActions are the IAM actions of the operations not named after them.
+var iamActions = map[string]string{
+	"S3/ListObjectsV2": "s3:ListBucket",
+}
+
+// Error is a classified API error of a provider.
+type Error struct {
+	Provider string // "aws" or "azure"
+	Category Category
+	// Permission is the IAM action (AWS) or the Azure RBAC operation the
+	// failed request needs, e.g. "ec2:DescribeSpotPriceHistory" or
+	// "Microsoft.Compute/skus/read", if known.
+	Permission string
+	// Code is the API error code, e.g. "UnauthorizedOperation", if any.
+	Code string
+	Err  error
+}
+
+// Error returns the hint of e and the error code or, lacking one, the
+// message of the underlying error.
+func (e *Error) Error() string {
+	hint := e.Hint()
+	if hint == "" {
+		return e.Err.Error()
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%s)", hint, e.Code)
+	}
+	return fmt.Sprintf("%s: %v", hint, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Hint returns what fixes e, or "" for CategoryOther.
+func (e *Error) Hint() string {
+	switch e.Category {
+	case CategoryPermission:
+		if e.Permission == "" {
+			return "not authorized, grant the exporter the permissions listed in the README"
+		}
+		return fmt.Sprintf("missing %s permission", e.Permission)
+	case CategoryCredentials:
+		if e.Provider == "azure" {
+			return "invalid Azure credentials, check AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET"
+		}
+		return "no valid AWS credentials, set up IRSA, EKS Pod Identity, an instance profile or AWS_ACCESS_KEY_ID"
+	case CategoryRegion:
+		return "region not enabled for the account, enable it or drop it with -aws.regions-exclude or -aws.skip-unauthorized-regions"
+	case CategoryThrottling:
+		if e.Provider == "azure" {
+			return "throttled, lower -azure.rate-limit or -scrape.concurrency"
+		}
+		return "throttled, set -aws.retry-mode=adaptive or lower -scrape.concurrency"
+	case CategoryNetwork:
+		return "endpoint unreachable, check the egress rules, -http.proxy and -http.ca-bundle"
+	case CategoryServer:
+		return "provider server error, retried next scrape"
+	}
+	return ""
+}
+
+// Policy returns the minimal policy granting the permission e misses, as
+// JSON: an IAM policy for AWS, the permissions of a custom role for Azure.
+// It's "" unless e is a CategoryPermission error with a known permission.
+func (e *Error) Policy() string {
+	if e.Category != CategoryPermission || e.Permission == "" {
+		return ""
+	}
+	var policy any
+	switch e.Provider {
+	case "azure":
+		policy = map[string]any{"Actions": []string{e.Permission}}
+	default:
+		policy = map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{"Effect": "Allow", "Action": []string{e.Permission}, "Resource": "*"},
+			},
+		}
+	}
+	data, _ := json.Marshal(policy)
+	return string(data)
+}
+
+// Missing returns the permission e misses, or "" if it isn't a
+// CategoryPermission error.
+func (e *Error) Missing() string {
+	if e.Category != CategoryPermission {
+		return ""
+	}
+	return e.Permission
+}
+
+// Fields returns the log fields of e: its category and, for permission
+// errors, the missing permission and the policy granting it.
+func (e *Error) Fields() log.Fields {
+	fields := log.Fields{"category": e.Category}
+	if policy := e.Policy(); policy != "" {
+		fields["permission"] = e.Permission
+		fields["policy"] = policy
+	}
+	return fields
+}
+
+// StatusError is an error response of an HTTP API without typed errors,
+// such as the Azure REST APIs.
+type StatusError struct {
+	API        string // e.g. "azure resource SKUs API"
+	StatusCode int
+	// Permission is the permission the request needs, if any.
+	Permission string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.API, e.StatusCode)
+}
+
+// HTTPStatusCode returns the status code of the response.
+func (e *StatusError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// Classify returns err of a request to the API of provider ("aws" or
+// "azure") as an *Error. Errors that already are one are returned as is;
+// nil stays nil.
+func Classify(provider string, err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+	e := &Error{Provider: provider, Category: CategoryOther, Err: err}
+
+	var opErr *smithy.OperationError
+	if errors.As(err, &opErr) {
+		e.Permission = iamAction(opErr.ServiceID, opErr.OperationName)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		e.Permission = statusErr.Permission
+	}
+
+	var apiErr smithy.APIError
+	var signingErr *v4.SigningError
+	var status interface{ HTTPStatusCode() int }
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+	case errors.As(err, &apiErr) && awsCodes[apiErr.ErrorCode()] != "":
+		e.Code = apiErr.ErrorCode()
+		e.Category = awsCodes[e.Code]
+	case errors.As(err, &signingErr):
+		e.Category = CategoryCredentials
+	case errors.As(err, &status) && status.HTTPStatusCode() > 0:
+		e.Category = statusCategory(status.HTTPStatusCode())
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr), errors.As(err, &urlErr):
+		e.Category = CategoryNetwork
+	}
+	return e
+}
+
+// statusCategory returns the category of an HTTP error response.
+func statusCategory(code int) Category {
+	switch {
+	case code == 401:
+		return CategoryCredentials
+	case code == 403:
+		return CategoryPermission
+	case code == 429:
+		return CategoryThrottling
+	case code >= 500:
+		return CategoryServer
+	}
+	return CategoryOther
+}
+
+// iamAction returns the IAM action of the operation of an AWS service, or ""
+// if the service is unknown.
+func iamAction(serviceID, operation string) string {
+	if action, ok := iamActions[serviceID+"/"+operation]; ok {
+		return action
+	}
+	prefix, ok := iamPrefixes[serviceID]
+	if !ok {
+		return ""
+	}
+	return prefix + ":" + operation
+}
@@ -0,0 +1,119 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+// operationError wraps err as the AWS SDK does for a failed operation.
+func operationError(service, operation string, err error) error {
+	return &smithy.OperationError{ServiceID: service, OperationName: operation, Err: err}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		err        error
+		category   Category
+		permission string
+	}{
+		{"spot permission", "aws", operationError("EC2", "DescribeSpotPriceHistory", &smithy.GenericAPIError{Code: "UnauthorizedOperation"}), CategoryPermission, "ec2:DescribeSpotPriceHistory"},
+		{"list bucket", "aws", operationError("S3", "ListObjectsV2", &smithy.GenericAPIError{Code: "AccessDenied"}), CategoryPermission, "s3:ListBucket"},
+		{"expired token", "aws", operationError("Pricing", "GetProducts", &smithy.GenericAPIError{Code: "ExpiredTokenException"}), CategoryCredentials, "pricing:GetProducts"},
+		{"no credentials", "aws", operationError("EC2", "DescribeSpotPriceHistory", &v4.SigningError{Err: errors.New("failed to retrieve credentials")}), CategoryCredentials, "ec2:DescribeSpotPriceHistory"},
+		{"opt-in region", "aws", operationError("EC2", "DescribeSpotPriceHistory", &smithy.GenericAPIError{Code: "OptInRequired"}), CategoryRegion, "ec2:DescribeSpotPriceHistory"},
+		{"throttling", "aws", operationError("savingsplans", "DescribeSavingsPlansOfferingRates", &smithy.GenericAPIError{Code: "ThrottlingException"}), CategoryThrottling, "savingsplans:DescribeSavingsPlansOfferingRates"},
+		{"dns", "aws", fmt.Errorf("fetching: %w", &net.DNSError{Err: "no such host", Name: "pricing.us-east-1.amazonaws.com"}), CategoryNetwork, ""},
+		{"timeout", "aws", fmt.Errorf("fetching: %w", context.DeadlineExceeded), CategoryNetwork, ""},
+		{"unknown code", "aws", &smithy.GenericAPIError{Code: "InvalidParameterValue"}, CategoryOther, ""},
+		{"canceled", "aws", context.Canceled, CategoryOther, ""},
+		{"azure permission", "azure", fmt.Errorf("listing: %w", &StatusError{API: "azure resource SKUs API", StatusCode: 403, Permission: "Microsoft.Compute/skus/read"}), CategoryPermission, "Microsoft.Compute/skus/read"},
+		{"azure throttling", "azure", fmt.Errorf("azure API failed after 3 attempts: %w", &StatusError{API: "azure API", StatusCode: 429}), CategoryThrottling, ""},
+		{"azure server", "azure", &StatusError{API: "azure API", StatusCode: 503}, CategoryServer, ""},
+		{"azure credentials", "azure", &StatusError{API: "azure resource SKUs API", StatusCode: 401}, CategoryCredentials, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Classify(tt.provider, tt.err)
+			if e.Category != tt.category || e.Permission != tt.permission || e.Provider != tt.provider {
+				t.Errorf("Classify = %+v, want category %s, permission %q", e, tt.category, tt.permission)
+			}
+			if !errors.Is(e, tt.err) {
+				t.Error("the classified error should wrap the original one")
+			}
+		})
+	}
+}
+
+func TestClassify_Nil(t *testing.T) {
+	if e := Classify("aws", nil); e != nil {
+		t.Errorf("Classify(nil) = %v, want nil", e)
+	}
+}
+
+func TestClassify_AlreadyClassified(t *testing.T) {
+	want := &Error{Provider: "azure", Category: CategoryCredentials, Err: errors.New("bad secret")}
+	if got := Classify("azure", fmt.Errorf("token: %w", want)); got != want {
+		t.Errorf("Classify = %v, want the classified error %v", got, want)
+	}
+}
+
+func TestError_Message(t *testing.T) {
+	e := Classify("aws", operationError("EC2", "DescribeSpotPriceHistory", &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "You are not authorized to perform this operation. Encoded authorization failure message: AbC123..."}))
+	if got, want := e.Error(), "missing ec2:DescribeSpotPriceHistory permission (UnauthorizedOperation)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	other := Classify("aws", errors.New("unexpected EOF"))
+	if got := other.Error(); got != "unexpected EOF" {
+		t.Errorf("Error() of an unclassified error = %q, want the original message", got)
+	}
+
+	network := Classify("aws", &net.DNSError{Err: "no such host", Name: "example.com"})
+	if got := network.Error(); !strings.HasPrefix(got, network.Hint()+": ") || !strings.Contains(got, "no such host") {
+		t.Errorf("Error() of a network error = %q, want the hint and the original message", got)
+	}
+}
+
+func TestError_Policy(t *testing.T) {
+	e := Classify("aws", operationError("Cost Explorer", "GetCostAndUsage", &smithy.GenericAPIError{Code: "AccessDeniedException"}))
+	want := `{"Statement":[{"Action":["ce:GetCostAndUsage"],"Effect":"Allow","Resource":"*"}],"Version":"2012-10-17"}`
+	if got := e.Policy(); got != want {
+		t.Errorf("Policy() = %s, want %s", got, want)
+	}
+	if fields := e.Fields(); fields["permission"] != "ce:GetCostAndUsage" || fields["policy"] != want {
+		t.Errorf("Fields() = %v", fields)
+	}
+
+	azure := Classify("azure", &StatusError{API: "azure resource SKUs API", StatusCode: 403, Permission: "Microsoft.Compute/skus/read"})
+	if got, want := azure.Policy(), `{"Actions":["Microsoft.Compute/skus/read"]}`; got != want {
+		t.Errorf("Policy() = %s, want %s", got, want)
+	}
+
+	throttled := Classify("aws", operationError("EC2", "DescribeSpotPriceHistory", &smithy.GenericAPIError{Code: "RequestLimitExceeded"}))
+	if throttled.Policy() != "" || throttled.Missing() != "" {
+		t.Errorf("a throttling error misses no permission, got policy %q", throttled.Policy())
+	}
+	if _, ok := throttled.Fields()["permission"]; ok {
+		t.Errorf("Fields() of a throttling error = %v, want no permission", throttled.Fields())
+	}
+}
+
+func TestError_Hint(t *testing.T) {
+	for _, category := range Categories {
+		for _, provider := range []string{"aws", "azure"} {
+			hint := (&Error{Provider: provider, Category: category}).Hint()
+			if (hint == "") != (category == CategoryOther) {
+				t.Errorf("Hint of %s %s = %q", provider, category, hint)
+			}
+		}
+	}
+}
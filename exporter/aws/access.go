@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// authErrorCodes are the API error codes of requests the credentials may not
+// make at all in a region, e.g. an opt-in region that isn't enabled for the
+// account or a region denied by a service control policy. Unlike throttling
+// or server errors they don't go away by retrying.
+var authErrorCodes = map[string]bool{
+	"AuthFailure":                 true,
+	"UnauthorizedOperation":       true,
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"OptInRequired":               true,
+	"InvalidClientTokenId":        true,
+	"UnrecognizedClientException": true,
+}
+
+// AuthErrorCode returns the API error code of err if it's an authorization
+// failure. ok is false for any other error.
+func AuthErrorCode(err error) (code string, ok bool) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || !authErrorCodes[apiErr.ErrorCode()] {
+		return "", false
+	}
+	return apiErr.ErrorCode(), true
+}
+
+// CheckRegionAccess makes a cheap DescribeAvailabilityZones call to find out
+// whether the client's credentials can call EC2 in its region.
+func CheckRegionAccess(ctx context.Context, client EC2DescribeAZsAPI) error {
+	_, err := client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{})
+	return err
+}
+
+// CheckSpotAccess requests a single spot price to find out whether the
+// client's credentials can read spot prices in its region.
+func CheckSpotAccess(ctx context.Context, client ec2.DescribeSpotPriceHistoryAPIClient) error {
+	_, err := client.DescribeSpotPriceHistory(ctx, &ec2.DescribeSpotPriceHistoryInput{MaxResults: awssdk.Int32(1)})
+	return err
+}
+
+// CheckOfferingsAccess requests the smallest page of instance type offerings
+// to find out whether the client's credentials can list them in its region.
+func CheckOfferingsAccess(ctx context.Context, client ec2.DescribeInstanceTypeOfferingsAPIClient) error {
+	_, err := client.DescribeInstanceTypeOfferings(ctx, &ec2.DescribeInstanceTypeOfferingsInput{MaxResults: awssdk.Int32(5)})
+	return err
+}
+
+// apiError classifies err of an AWS request of a scrape of region, counts it
+// in errorCount and reports it to scrapes. It returns the entry of logger to
+// log it with, which carries the remediation hint and, for permission
+// errors, the missing permission and the policy granting it.
+func apiError(logger log.FieldLogger, region string, err error, errorCount *uint64, scrapes chan<- provider.ScrapeResult) *log.Entry {
+	classified := apierror.Classify("aws", err)
+	atomic.AddUint64(errorCount, 1)
+	scrapes <- provider.Failed(region, classified)
+	return logger.WithError(classified).WithFields(classified.Fields())
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+)
+
+func TestAuthErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+		ok   bool
+	}{
+		{"auth failure", &smithy.GenericAPIError{Code: "AuthFailure"}, "AuthFailure", true},
+		{"opt-in", fmt.Errorf("operation error: %w", &smithy.GenericAPIError{Code: "OptInRequired"}), "OptInRequired", true},
+		{"throttling", &smithy.GenericAPIError{Code: "RequestLimitExceeded"}, "", false},
+		{"plain", fmt.Errorf("connection reset"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, ok := AuthErrorCode(tt.err)
+			if code != tt.code || ok != tt.ok {
+				t.Errorf("AuthErrorCode() = %q, %v; want %q, %v", code, ok, tt.code, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckRegionAccess(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "AuthFailure"}
+		},
+	}
+	if _, ok := AuthErrorCode(CheckRegionAccess(context.Background(), client)); !ok {
+		t.Error("expected an authorization error")
+	}
+}
+
+func TestCheckSpotAccess(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			if params.MaxResults == nil || *params.MaxResults != 1 {
+				t.Errorf("expected a single result to be requested, got %v", params.MaxResults)
+			}
+			return nil, &smithy.GenericAPIError{Code: "UnauthorizedOperation"}
+		},
+	}
+	if _, ok := AuthErrorCode(CheckSpotAccess(context.Background(), client)); !ok {
+		t.Error("expected an authorization error")
+	}
+}
+
+func TestCheckOfferingsAccess(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeInstanceTypeOfferingsFn: func(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+			return &ec2.DescribeInstanceTypeOfferingsOutput{}, nil
+		},
+	}
+	if err := CheckOfferingsAccess(context.Background(), client); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RegionIndexURL is the AWS bulk pricing version index listing the current
+// regional offer file of every region. Empty disables the lookup and uses
+// BulkPricingURLFormat directly.
+var RegionIndexURL = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonEC2/current/region_index.json"
+
+// regionIndex is the structure of region_index.json.
+type regionIndex struct {
+	Regions map[string]struct {
+		CurrentVersionURL string `json:"currentVersionUrl"`
+	} `json:"regions"`
+}
+
+// regionIndexTTL is how long a fetched version index is reused. AWS publishes
+// new offer file versions at most a few times a day, so every region of a
+// scrape and the following scrapes share one fetch.
+const regionIndexTTL = time.Hour
+
+// regionIndexRetry is how long a failed index fetch is remembered, so the
+// remaining regions of the scrape use BulkPricingURLFormat instead of each
+// waiting for the index again.
+const regionIndexRetry = time.Minute
+
+// regionIndexTimeout bounds an index fetch, leaving the scrape's deadline to
+// the regional offer file.
+const regionIndexTimeout = 10 * time.Second
+
+// regionIndexCache holds the last version index fetched from RegionIndexURL.
+var regionIndexCache struct {
+	mu      sync.Mutex
+	url     string // RegionIndexURL the entry was fetched from
+	index   regionIndex
+	err     error
+	expires time.Time
+}
+
+// bulkPricingURL resolves the regional offer file of region through the
+// version index, falling back to BulkPricingURLFormat when the index is
+// disabled, unavailable or doesn't list the region.
+func bulkPricingURL(ctx context.Context, httpClient *http.Client, region string) string {
+	fallback := fmt.Sprintf(BulkPricingURLFormat, region)
+	if RegionIndexURL == "" {
+		return fallback
+	}
+	resolved, err := resolveRegionOfferURL(ctx, httpClient, region)
+	if err != nil {
+		log.WithError(err).Warnf("could not resolve regional offer file from version index, using %s [region=%s]", fallback, region)
+		return fallback
+	}
+	return resolved
+}
+
+func resolveRegionOfferURL(ctx context.Context, httpClient *http.Client, region string) (string, error) {
+	index, err := cachedRegionIndex(ctx, httpClient)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := index.Regions[region]
+	if !ok || entry.CurrentVersionURL == "" {
+		return "", fmt.Errorf("region %s not listed in region index", region)
+	}
+	base, err := url.Parse(RegionIndexURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(entry.CurrentVersionURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// cachedRegionIndex returns the version index, fetching it when the cached
+// entry expired. Concurrent callers wait for a single fetch.
+func cachedRegionIndex(ctx context.Context, httpClient *http.Client) (regionIndex, error) {
+	c := &regionIndexCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.url == RegionIndexURL && time.Now().Before(c.expires) {
+		return c.index, c.err
+	}
+	index, err := fetchRegionIndex(ctx, httpClient)
+	if err != nil && ctx.Err() != nil {
+		// The scrape was cancelled, the index may well be available.
+		return index, err
+	}
+	c.url, c.index, c.err = RegionIndexURL, index, err
+	if err != nil {
+		c.expires = time.Now().Add(regionIndexRetry)
+	} else {
+		c.expires = time.Now().Add(regionIndexTTL)
+	}
+	return c.index, c.err
+}
+
+func fetchRegionIndex(ctx context.Context, httpClient *http.Client) (regionIndex, error) {
+	ctx, cancel := context.WithTimeout(ctx, regionIndexTimeout)
+	defer cancel()
+	var index regionIndex
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, RegionIndexURL, nil)
+	if err != nil {
+		return index, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return index, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return index, fmt.Errorf("region index returned status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&index)
+	return index, err
+}
+
+// decodeBulkPricing stream-decodes a regional EC2 offer file, keeping only
+// "Compute Instance" and "Dedicated Host" products accepted by keep and the
+// terms of those products. Reserved terms are only decoded when reserved is set.
+func decodeBulkPricing(r io.Reader, keep func(BulkProduct) bool, reserved bool) (BulkPricingResponse, error) {
+	return decodeOfferFile(r, func(product BulkProduct) bool {
+		return (product.ProductFamily == productFamilyCompute || product.ProductFamily == productFamilyHost) && keep(product)
+	}, reserved)
+}
+
+// decodeOfferFile stream-decodes the offer file of any service, keeping only
+// the products accepted by keep and their terms. Everything else is skipped
+// token by token, so memory use is bounded by the kept products rather than
+// the multi-hundred-megabyte file.
+func decodeOfferFile(r io.Reader, keep func(BulkProduct) bool, reserved bool) (BulkPricingResponse, error) {
+	bulk := BulkPricingResponse{
+		Products: make(map[string]BulkProduct),
+		Terms: BulkTerms{
+			OnDemand: make(map[string]map[string]BulkOfferTerm),
+			Reserved: make(map[string]map[string]BulkOfferTerm),
+		},
+	}
+	dec := json.NewDecoder(r)
+
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "products":
+			return decodeObject(dec, func(sku string) error {
+				var product BulkProduct
+				if err := dec.Decode(&product); err != nil {
+					return err
+				}
+				if keep(product) {
+					bulk.Products[sku] = product
+				}
+				return nil
+			})
+		case "terms":
+			return decodeObject(dec, func(termType string) error {
+				var terms map[string]map[string]BulkOfferTerm
+				switch {
+				case termType == "OnDemand":
+					terms = bulk.Terms.OnDemand
+				case termType == "Reserved" && reserved:
+					terms = bulk.Terms.Reserved
+				default:
+					return skipValue(dec)
+				}
+				return decodeObject(dec, func(sku string) error {
+					if _, ok := bulk.Products[sku]; !ok {
+						return skipValue(dec)
+					}
+					var offers map[string]BulkOfferTerm
+					if err := dec.Decode(&offers); err != nil {
+						return err
+					}
+					terms[sku] = offers
+					return nil
+				})
+			})
+		}
+		return skipValue(dec)
+	})
+	return bulk, err
+}
+
+// decodeObject reads a JSON object from dec, calling fn for every key with
+// the decoder positioned at the key's value. fn must consume the value.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected JSON object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected JSON object key, got %v", tok)
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // closing '}'
+	return err
+}
+
+// skipValue consumes the next JSON value from dec without materializing it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
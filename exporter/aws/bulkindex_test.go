@@ -0,0 +1,117 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBulkPricingURL_RegionIndex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"regions": {"us-east-1": {"regionCode": "us-east-1", "currentVersionUrl": "/offers/v1.0/aws/AmazonEC2/20260101000000/us-east-1/index.json"}}}`))
+	}))
+	defer ts.Close()
+	orig := RegionIndexURL
+	RegionIndexURL = ts.URL + "/offers/v1.0/aws/AmazonEC2/current/region_index.json"
+	t.Cleanup(func() { RegionIndexURL = orig })
+
+	if got, want := bulkPricingURL(context.Background(), ts.Client(), "us-east-1"), ts.URL+"/offers/v1.0/aws/AmazonEC2/20260101000000/us-east-1/index.json"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	// Regions missing from the index fall back to BulkPricingURLFormat.
+	if got := bulkPricingURL(context.Background(), ts.Client(), "xx-west-9"); !strings.Contains(got, "/current/xx-west-9/index.json") {
+		t.Errorf("expected fallback URL, got %s", got)
+	}
+}
+
+func TestBulkPricingURL_RegionIndexCached(t *testing.T) {
+	var requests atomic.Int32
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"regions": {"us-east-1": {"currentVersionUrl": "/v1/us-east-1/index.json"}, "eu-west-1": {"currentVersionUrl": "/v1/eu-west-1/index.json"}}}`))
+	}))
+	defer ts.Close()
+	orig := RegionIndexURL
+	RegionIndexURL = ts.URL + "/region_index.json"
+	t.Cleanup(func() { RegionIndexURL = orig })
+
+	for _, region := range []string{"us-east-1", "eu-west-1", "us-east-1"} {
+		if got := bulkPricingURL(context.Background(), ts.Client(), region); got != ts.URL+"/v1/"+region+"/index.json" {
+			t.Errorf("unexpected URL for %s: %s", region, got)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the index to be fetched once, got %d fetches", n)
+	}
+
+	// A failed fetch is remembered, the other regions fall back directly.
+	status = http.StatusServiceUnavailable
+	RegionIndexURL = ts.URL + "/unavailable/region_index.json"
+	requests.Store(0)
+	for _, region := range []string{"us-east-1", "eu-west-1"} {
+		if got := bulkPricingURL(context.Background(), ts.Client(), region); !strings.Contains(got, "/current/"+region+"/index.json") {
+			t.Errorf("expected fallback URL for %s, got %s", region, got)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected one fetch of the failing index, got %d fetches", n)
+	}
+}
+
+func TestDecodeBulkPricing(t *testing.T) {
+	body := `{
+		"formatVersion": "v1.0",
+		"products": {
+			"SKU1": {"sku": "SKU1", "productFamily": "Compute Instance", "attributes": {"instanceType": "m5.large"}},
+			"SKU2": {"sku": "SKU2", "productFamily": "Compute Instance", "attributes": {"instanceType": "m5.xlarge"}},
+			"SKU3": {"sku": "SKU3", "productFamily": "Storage", "attributes": {"volumeType": "gp3"}}
+		},
+		"terms": {
+			"OnDemand": {
+				"SKU1": {"SKU1.JRTCKXETXF": {"offerTermCode": "JRTCKXETXF", "priceDimensions": {}}},
+				"SKU2": {"SKU2.JRTCKXETXF": {"offerTermCode": "JRTCKXETXF", "priceDimensions": {}}},
+				"SKU3": {"SKU3.JRTCKXETXF": {"offerTermCode": "JRTCKXETXF", "priceDimensions": {}}}
+			},
+			"Reserved": {
+				"SKU1": {"SKU1.STD": {"offerTermCode": "STD", "priceDimensions": {}}}
+			}
+		}
+	}`
+	keep := func(p BulkProduct) bool { return p.Attributes["instanceType"] == "m5.large" }
+
+	bulk, err := decodeBulkPricing(strings.NewReader(body), keep, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bulk.Products) != 1 || bulk.Products["SKU1"].SKU != "SKU1" {
+		t.Errorf("expected only SKU1 to be kept, got %v", bulk.Products)
+	}
+	if len(bulk.Terms.OnDemand) != 1 || bulk.Terms.OnDemand["SKU1"] == nil {
+		t.Errorf("expected only SKU1 on-demand terms, got %v", bulk.Terms.OnDemand)
+	}
+	if len(bulk.Terms.Reserved) != 0 {
+		t.Errorf("expected reserved terms to be skipped, got %v", bulk.Terms.Reserved)
+	}
+
+	bulk, err = decodeBulkPricing(strings.NewReader(body), keep, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bulk.Terms.Reserved) != 1 {
+		t.Errorf("expected SKU1 reserved terms, got %v", bulk.Terms.Reserved)
+	}
+}
+
+func TestDecodeBulkPricing_Malformed(t *testing.T) {
+	keep := func(BulkProduct) bool { return true }
+	for _, body := range []string{`[]`, `{"products": {"SKU1": `, `not json`} {
+		if _, err := decodeBulkPricing(strings.NewReader(body), keep, false); err == nil {
+			t.Errorf("expected error for %q, got nil", body)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Unlimited-mode surplus CPU credit prices, per vCPU-hour.
+// https://aws.amazon.com/ec2/pricing/on-demand/#T2.2FT3.2FT4g_Unlimited_Mode_Pricing
+const (
+	surplusCreditPriceLinux   = 0.05
+	surplusCreditPriceWindows = 0.096
+)
+
+// burstableBaselines holds the baseline utilization per vCPU (as a fraction)
+// of each burstable size. t3, t3a and t4g share the same baselines.
+var burstableBaselines = map[string]map[string]float64{
+	"t2": {
+		"nano": 0.05, "micro": 0.10, "small": 0.20, "medium": 0.20,
+		"large": 0.30, "xlarge": 0.225, "2xlarge": 0.17,
+	},
+	"t3": {
+		"nano": 0.05, "micro": 0.10, "small": 0.20, "medium": 0.20,
+		"large": 0.30, "xlarge": 0.40, "2xlarge": 0.40,
+	},
+}
+
+// BurstableBaseline returns the per-vCPU baseline utilization of a burstable
+// (t2, t3, t3a, t4g) instance type. ok is false for non-burstable types.
+func BurstableBaseline(instanceType string) (baseline float64, ok bool) {
+	family, size, _ := strings.Cut(instanceType, ".")
+	switch family {
+	case "t3a", "t4g":
+		family = "t3"
+	}
+	sizes, ok := burstableBaselines[family]
+	if !ok {
+		return 0, false
+	}
+	baseline, ok = sizes[size]
+	return baseline, ok
+}
+
+// BurstableEffectivePrice returns the hourly price of a burstable instance in
+// unlimited mode running at the given average CPU utilization (0-1), including
+// the surplus credit surcharge above its baseline. ok is false for
+// non-burstable or unknown instance types.
+func BurstableEffectivePrice(instanceType string, vcpu int32, price, utilization float64, windows bool) (effective float64, ok bool) {
+	baseline, ok := BurstableBaseline(instanceType)
+	if !ok || vcpu == 0 {
+		return 0, false
+	}
+	return surplusPrice(baseline, vcpu, price, utilization, windows), true
+}
+
+// instanceBaseline returns the per-vCPU baseline of a burstable instance,
+// preferring the instance store's baseline over the built-in table so newer
+// burstable types are covered without a code change.
+func instanceBaseline(instanceType string, inst Instance) (float64, bool) {
+	if inst.BaselineVCpu > 0 && inst.VCpu > 0 {
+		return inst.BaselineVCpu / float64(inst.VCpu), true
+	}
+	return BurstableBaseline(instanceType)
+}
+
+// surplusPrice adds the surplus credit surcharge above baseline to price.
+func surplusPrice(baseline float64, vcpu int32, price, utilization float64, windows bool) float64 {
+	surplus := utilization - baseline
+	if surplus <= 0 {
+		return price
+	}
+	creditPrice := surplusCreditPriceLinux
+	if windows {
+		creditPrice = surplusCreditPriceWindows
+	}
+	return price + surplus*float64(vcpu)*creditPrice
+}
+
+// burstableResult derives the ec2_burstable_effective result for an ec2 price
+// result. ok is false when the feature is disabled (utilization 0) or the
+// instance type isn't burstable.
+func burstableResult(r provider.ScrapeResult, utilization float64, instances *InstanceStore) (provider.ScrapeResult, bool) {
+	if utilization <= 0 {
+		return provider.ScrapeResult{}, false
+	}
+	inst, ok := instances.Get(r.InstanceType)
+	if !ok || inst.VCpu == 0 {
+		return provider.ScrapeResult{}, false
+	}
+	baseline, ok := instanceBaseline(r.InstanceType, inst)
+	if !ok {
+		return provider.ScrapeResult{}, false
+	}
+	windows := strings.Contains(r.OperatingSystem, "Windows") || strings.Contains(r.ProductDescription, "Windows")
+	r.Name = "ec2_burstable_effective"
+	r.Value = surplusPrice(baseline, inst.VCpu, r.Value, utilization, windows)
+	r.Memory = ""
+	r.VCpu = ""
+	return r, true
+}
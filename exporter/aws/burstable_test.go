@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestBurstableBaseline(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		want         float64
+		wantOK       bool
+	}{
+		{"t3.micro", 0.10, true},
+		{"t3a.large", 0.30, true},
+		{"t4g.xlarge", 0.40, true},
+		{"t2.xlarge", 0.225, true},
+		{"m5.large", 0, false},
+		{"t3.metal", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instanceType, func(t *testing.T) {
+			got, ok := BurstableBaseline(tt.instanceType)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("BurstableBaseline(%q) = (%v, %v), want (%v, %v)", tt.instanceType, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBurstableEffectivePrice(t *testing.T) {
+	// t3.large: 2 vCPU, 30% baseline. At 50% utilization the surplus is
+	// 0.2 × 2 vCPU × $0.05 = $0.02/hour on top of the hourly price.
+	got, ok := BurstableEffectivePrice("t3.large", 2, 0.0832, 0.5, false)
+	if !ok {
+		t.Fatal("expected t3.large to be burstable")
+	}
+	if math.Abs(got-(0.0832+0.02)) > 1e-9 {
+		t.Errorf("expected %v, got %v", 0.0832+0.02, got)
+	}
+
+	// Below the baseline there is no surcharge
+	got, _ = BurstableEffectivePrice("t3.large", 2, 0.0832, 0.1, false)
+	if got != 0.0832 {
+		t.Errorf("expected hourly price below baseline, got %v", got)
+	}
+
+	// Windows surplus credits cost more
+	got, _ = BurstableEffectivePrice("t3.large", 2, 0.1108, 0.5, true)
+	if math.Abs(got-(0.1108+0.2*2*0.096)) > 1e-9 {
+		t.Errorf("unexpected Windows effective price %v", got)
+	}
+
+	if _, ok := BurstableEffectivePrice("m5.large", 2, 0.096, 0.5, false); ok {
+		t.Error("expected m5.large to be non-burstable")
+	}
+}
+
+func TestBurstableResult(t *testing.T) {
+	instances := NewInstanceStoreFromMap(map[string]Instance{"t3.large": {Memory: 8192, VCpu: 2}})
+	base := provider.ScrapeResult{Name: "ec2", Value: 0.0832, InstanceType: "t3.large", OperatingSystem: "Linux", Memory: "8192", VCpu: "2"}
+
+	if _, ok := burstableResult(base, 0, instances); ok {
+		t.Error("expected no result when utilization is 0")
+	}
+
+	r, ok := burstableResult(base, 0.5, instances)
+	if !ok {
+		t.Fatal("expected a burstable result")
+	}
+	if r.Name != "ec2_burstable_effective" || r.Memory != "" || r.VCpu != "" {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	base.InstanceType = "t3.unknown"
+	if _, ok := burstableResult(base, 0.5, instances); ok {
+		t.Error("expected no result for instance types missing from the store")
+	}
+}
+
+func TestBurstableResult_StoreBaseline(t *testing.T) {
+	// t5 isn't in the built-in table; the store's baseline (0.4 of 2 vCPUs = 20%) is used.
+	instances := NewInstanceStoreFromMap(map[string]Instance{"t5.large": {Memory: 8192, VCpu: 2, BaselineVCpu: 0.4}})
+	base := provider.ScrapeResult{Name: "ec2", Value: 0.1, InstanceType: "t5.large", OperatingSystem: "Linux"}
+
+	r, ok := burstableResult(base, 0.5, instances)
+	if !ok {
+		t.Fatal("expected a burstable result from the store baseline")
+	}
+	if want := 0.1 + 0.3*2*surplusCreditPriceLinux; math.Abs(r.Value-want) > 1e-9 {
+		t.Errorf("expected %v, got %v", want, r.Value)
+	}
+}
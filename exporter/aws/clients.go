@@ -3,17 +3,13 @@ package aws
 import (
 	"context"
 
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
 )
 
-// NOTE: ec2.DescribeInstanceTypesAPIClient was removed from EC2Client because
-// instance type data is now fetched from ec2instances.info via HTTP, not the
-// AWS DescribeInstanceTypes API.
-
-// NOTE: NewPricingClient was removed from ClientFactory because on-demand pricing
-// is now fetched from the public AWS bulk pricing URL via HTTP, not the Pricing API.
-
 // EC2DescribeAZsAPI wraps the DescribeAvailabilityZones call (no SDK paginator interface exists).
 type EC2DescribeAZsAPI interface {
 	DescribeAvailabilityZones(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
@@ -24,9 +20,31 @@ type SavingsPlansAPI interface {
 	DescribeSavingsPlansOfferingRates(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error)
 }
 
+// PricingAPI wraps the GetProducts call of the Pricing Query API, used by the
+// optional "api" on-demand backend.
+type PricingAPI interface {
+	pricing.GetProductsAPIClient
+}
+
+// S3API wraps the calls used to read the spot data feed and to write
+// Kubecost custom pricing files.
+type S3API interface {
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// CostExplorerAPI wraps the GetCostAndUsage call used for effective rates
+// (no SDK paginator interface exists).
+type CostExplorerAPI interface {
+	GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+}
+
 // EC2Client combines the EC2 API interfaces needed by this exporter.
 type EC2Client interface {
 	ec2.DescribeSpotPriceHistoryAPIClient
+	ec2.DescribeInstanceTypeOfferingsAPIClient
+	ec2.DescribeInstanceTypesAPIClient // instance data source "api"
 	EC2DescribeAZsAPI
 }
 
@@ -34,4 +52,7 @@ type EC2Client interface {
 type ClientFactory interface {
 	NewEC2Client(region string) (EC2Client, error)
 	NewSavingsPlansClient() (SavingsPlansAPI, error)
+	NewS3Client(region string) (S3API, error)
+	NewPricingClient() (PricingAPI, error)
+	NewCostExplorerClient() (CostExplorerAPI, error)
 }
@@ -0,0 +1,99 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// CloudFrontOfferURL is the offer file of CloudFront, which isn't regional.
+var CloudFrontOfferURL = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonCloudFront/current/index.json"
+
+// CloudFrontRegion is the region of the CloudFront scrape results and of its
+// scrape errors; CloudFront is priced per edge location group instead.
+const CloudFrontRegion = "global"
+
+// Names of the CloudFront scrape results.
+const (
+	CloudFrontTransferMetric = "cloudfront_data_transfer_gb"
+	CloudFrontRequestMetric  = "cloudfront_request"
+)
+
+// cloudFrontUsageTypeRE matches the usage types of the CloudFront prices that
+// are exported, e.g. "EU-DataTransfer-Out-Bytes" (to the internet),
+// "EU-DataTransfer-Out-OBytes" (to the origin) or "JP-Requests-Tier2-HTTPS".
+var cloudFrontUsageTypeRE = regexp.MustCompile(`^[A-Z0-9]+-(DataTransfer-Out-Bytes|DataTransfer-Out-OBytes|Requests-Tier1|Requests-Tier2-HTTPS)$`)
+
+// cloudFrontPrices maps the usage types matched by cloudFrontUsageTypeRE to
+// the metric and the label telling their prices apart.
+var cloudFrontPrices = map[string]struct{ metric, label, value string }{
+	"DataTransfer-Out-Bytes":  {CloudFrontTransferMetric, "destination", "internet"},
+	"DataTransfer-Out-OBytes": {CloudFrontTransferMetric, "destination", "origin"},
+	"Requests-Tier1":          {CloudFrontRequestMetric, "protocol", "http"},
+	"Requests-Tier2-HTTPS":    {CloudFrontRequestMetric, "protocol", "https"},
+}
+
+// cloudFrontPriceClasses maps the edge location groups of the offer file to
+// the cheapest price class serving them; groups missing here are only served
+// by PriceClass_All.
+var cloudFrontPriceClasses = map[string]string{
+	"United States": "PriceClass_100",
+	"Canada":        "PriceClass_100",
+	"Mexico":        "PriceClass_100",
+	"Europe":        "PriceClass_100",
+	"Israel":        "PriceClass_100",
+	"Japan":         "PriceClass_200",
+	"Asia Pacific":  "PriceClass_200",
+	"India":         "PriceClass_200",
+	"Indonesia":     "PriceClass_200",
+	"Middle East":   "PriceClass_200",
+	"South Africa":  "PriceClass_200",
+}
+
+// GetCloudFrontPricing fetches the CloudFront offer file and sends the USD
+// price per GB transferred to the internet and to the origin, and per HTTP and
+// HTTPS request, of every edge location group to scrapes, labelled with the
+// group and the cheapest price class serving it. Results are in
+// CloudFrontRegion. Transfer prices are those of the first tier. No AWS
+// credentials are required. If httpClient is nil, http.DefaultClient is used.
+func GetCloudFrontPricing(ctx context.Context, httpClient *http.Client, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	bulk, err := fetchOffer(ctx, httpClient, CloudFrontOfferURL, func(product BulkProduct) bool {
+		_, ok := cloudFrontPrice(product)
+		return ok
+	})
+	if err != nil {
+		apiError(log.StandardLogger(), CloudFrontRegion, err, errorCount, scrapes).Error("error fetching CloudFront offer file")
+		return
+	}
+	sendServicePrices(CloudFrontRegion, "CloudFront", bulk, cloudFrontPrice, errorCount, scrapes)
+}
+
+// cloudFrontPrice maps the data transfer and request products of the
+// CloudFront offer file to their series.
+func cloudFrontPrice(product BulkProduct) (servicePrice, bool) {
+	attrs := product.Attributes
+	m := cloudFrontUsageTypeRE.FindStringSubmatch(attrs["usagetype"])
+	if m == nil {
+		return servicePrice{}, false
+	}
+	group := attrs["fromLocation"]
+	if group == "" {
+		group = attrs["location"]
+	}
+	if group == "" {
+		return servicePrice{}, false
+	}
+	priceClass, ok := cloudFrontPriceClasses[group]
+	if !ok {
+		priceClass = "PriceClass_All"
+	}
+	price := cloudFrontPrices[m[1]]
+	return servicePrice{
+		metric: price.metric,
+		labels: map[string]string{"region_group": group, "price_class": priceClass, price.label: price.value},
+	}, true
+}
@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetCloudFrontPricing(t *testing.T) {
+	transfer := func(location, usageType string) BulkProduct {
+		return BulkProduct{ProductFamily: "Data Transfer", Attributes: map[string]string{"fromLocation": location, "usagetype": usageType}}
+	}
+	request := func(location, usageType string) BulkProduct {
+		return BulkProduct{ProductFamily: "Request", Attributes: map[string]string{"location": location, "usagetype": usageType}}
+	}
+	offer := BulkPricingResponse{
+		Products: map[string]BulkProduct{
+			"EU-OUT":    transfer("Europe", "EU-DataTransfer-Out-Bytes"),
+			"EU-ORIGIN": transfer("Europe", "EU-DataTransfer-Out-OBytes"),
+			"SA-OUT":    transfer("South America", "SA-DataTransfer-Out-Bytes"),
+			"JP-HTTP":   request("Japan", "JP-Requests-Tier1"),
+			"JP-HTTPS":  request("Japan", "JP-Requests-Tier2-HTTPS"),
+			"EU-INVAL":  request("Europe", "EU-Invalidations"),
+		},
+		Terms: BulkTerms{OnDemand: map[string]map[string]BulkOfferTerm{
+			"EU-OUT":    tieredOffer("GB", map[string]string{"0": "0.085", "10240": "0.08"}),
+			"EU-ORIGIN": tieredOffer("GB", map[string]string{"0": "0.02"}),
+			"SA-OUT":    tieredOffer("GB", map[string]string{"0": "0.11"}),
+			"JP-HTTP":   tieredOffer("Requests", map[string]string{"0": "0.0000009"}),
+			"JP-HTTPS":  tieredOffer("Requests", map[string]string{"0": "0.0000012"}),
+			"EU-INVAL":  tieredOffer("URL", map[string]string{"0": "0.005"}),
+		}},
+	}
+	body, _ := json.Marshal(offer)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer ts.Close()
+	orig := CloudFrontOfferURL
+	CloudFrontOfferURL = ts.URL
+	defer func() { CloudFrontOfferURL = orig }()
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	var errorCount uint64
+	GetCloudFrontPricing(context.Background(), nil, &errorCount, scrapes)
+	close(scrapes)
+
+	got := map[string]float64{}
+	for _, r := range drainScrapes(t, scrapes) {
+		if r.Region != CloudFrontRegion {
+			t.Errorf("unexpected region %q", r.Region)
+		}
+		got[r.Name+"/"+r.Labels["region_group"]+"/"+r.Labels["price_class"]+"/"+r.Labels["destination"]+r.Labels["protocol"]] = r.Value
+	}
+	want := map[string]float64{
+		CloudFrontTransferMetric + "/Europe/PriceClass_100/internet":        0.085,
+		CloudFrontTransferMetric + "/Europe/PriceClass_100/origin":          0.02,
+		CloudFrontTransferMetric + "/South America/PriceClass_All/internet": 0.11,
+		CloudFrontRequestMetric + "/Japan/PriceClass_200/http":              0.0000009,
+		CloudFrontRequestMetric + "/Japan/PriceClass_200/https":             0.0000012,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %g, want %g", k, got[k], v)
+		}
+	}
+	if errorCount != 0 {
+		t.Errorf("unexpected errors: %d", errorCount)
+	}
+}
@@ -0,0 +1,69 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the DynamoDB scrape results.
+const (
+	DynamoDBCapacityMetric = "dynamodb_provisioned_capacity_unit_hour"
+	DynamoDBRequestMetric  = "dynamodb_ondemand_request_unit"
+	DynamoDBStorageMetric  = "dynamodb_storage_gb_month"
+)
+
+// DynamoDB table classes, the values of the table_class label.
+const (
+	DynamoDBTableClassStandard   = "standard"
+	DynamoDBTableClassStandardIA = "standard_infrequent_access"
+)
+
+// dynamoDBUsageTypeRE matches the usage types of the DynamoDB prices that are
+// exported, e.g. "USE1-IA-ReadCapacityUnit-Hrs" or "WriteRequestUnits" (no
+// region prefix in us-east-1). Replicated and reserved capacity, streams,
+// backups and the like don't match.
+var dynamoDBUsageTypeRE = regexp.MustCompile(`^(?:[A-Z0-9]+-)??(IA-)?(ReadCapacityUnit-Hrs|WriteCapacityUnit-Hrs|ReadRequestUnits|WriteRequestUnits|TimedStorage-ByteHrs)$`)
+
+// dynamoDBPrices maps the usage types matched by dynamoDBUsageTypeRE to the
+// metric and operation label of their price.
+var dynamoDBPrices = map[string]struct{ metric, operation string }{
+	"ReadCapacityUnit-Hrs":  {DynamoDBCapacityMetric, "read"},
+	"WriteCapacityUnit-Hrs": {DynamoDBCapacityMetric, "write"},
+	"ReadRequestUnits":      {DynamoDBRequestMetric, "read"},
+	"WriteRequestUnits":     {DynamoDBRequestMetric, "write"},
+	"TimedStorage-ByteHrs":  {DynamoDBStorageMetric, ""},
+}
+
+// GetDynamoDBPricing fetches the AmazonDynamoDB offer file of a region and
+// sends the USD prices of provisioned read and write capacity units per hour,
+// on-demand read and write request units and storage per GB-month of both
+// table classes to scrapes. Free tiers are skipped. No AWS credentials are
+// required. If httpClient is nil, http.DefaultClient is used.
+func GetDynamoDBPricing(ctx context.Context, region string, httpClient *http.Client, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	bulk, err := fetchServiceOffer(ctx, httpClient, "AmazonDynamoDB", region, func(product BulkProduct) bool {
+		return dynamoDBUsageTypeRE.MatchString(product.Attributes["usagetype"])
+	})
+	if err != nil {
+		apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error fetching DynamoDB offer file [region=%s]", region)
+		return
+	}
+
+	sendServicePrices(region, "DynamoDB", bulk, func(product BulkProduct) (servicePrice, bool) {
+		m := dynamoDBUsageTypeRE.FindStringSubmatch(product.Attributes["usagetype"])
+		tableClass := DynamoDBTableClassStandard
+		if m[1] != "" {
+			tableClass = DynamoDBTableClassStandardIA
+		}
+		price := dynamoDBPrices[m[2]]
+		labels := map[string]string{"table_class": tableClass}
+		if price.operation != "" {
+			labels["operation"] = price.operation
+		}
+		return servicePrice{metric: price.metric, labels: labels}, true
+	}, errorCount, scrapes)
+}
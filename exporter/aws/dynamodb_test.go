@@ -0,0 +1,158 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// setupServiceOfferServer serves offer as the offer file of every service and
+// region for the duration of the test, recording the requested paths.
+func setupServiceOfferServer(t *testing.T, offer BulkPricingResponse) *[]string {
+	t.Helper()
+	body, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write(body)
+	}))
+	t.Cleanup(ts.Close)
+	orig := ServiceOfferURLFormat
+	ServiceOfferURLFormat = ts.URL + "/%s/%s"
+	t.Cleanup(func() { ServiceOfferURLFormat = orig })
+	return &paths
+}
+
+// tieredOffer returns the on-demand term of a product priced per tier, by
+// begin range.
+func tieredOffer(unit string, tiers map[string]string) map[string]BulkOfferTerm {
+	dims := make(map[string]BulkPriceDimension, len(tiers))
+	for begin, usd := range tiers {
+		dims[begin] = BulkPriceDimension{Unit: unit, BeginRange: begin, PricePerUnit: map[string]string{"USD": usd}}
+	}
+	return map[string]BulkOfferTerm{"term": {OfferTermCode: TermOnDemand, PriceDimensions: dims}}
+}
+
+func TestGetDynamoDBPricing(t *testing.T) {
+	usageTypes := map[string]string{
+		"RCU":    "EUC1-ReadCapacityUnit-Hrs",
+		"WCU":    "EUC1-WriteCapacityUnit-Hrs",
+		"IA-RCU": "EUC1-IA-ReadCapacityUnit-Hrs",
+		"RRU":    "EUC1-ReadRequestUnits",
+		"WRU":    "EUC1-IA-WriteRequestUnits",
+		"GB":     "EUC1-TimedStorage-ByteHrs",
+		"IA-GB":  "EUC1-IA-TimedStorage-ByteHrs",
+		"REPL":   "EUC1-ReplWriteCapacityUnit-Hrs",
+		"BAD":    "EUC1-WriteRequestUnits",
+	}
+	offer := BulkPricingResponse{
+		Products: map[string]BulkProduct{},
+		Terms: BulkTerms{OnDemand: map[string]map[string]BulkOfferTerm{
+			"RCU":    tieredOffer("ReadCapacityUnit-Hrs", map[string]string{"0": "0", "18600": "0.0001544"}),
+			"WCU":    tieredOffer("WriteCapacityUnit-Hrs", map[string]string{"0": "0", "18600": "0.000772"}),
+			"IA-RCU": tieredOffer("ReadCapacityUnit-Hrs", map[string]string{"0": "0.000186"}),
+			"RRU":    tieredOffer("ReadRequestUnits", map[string]string{"0": "0.000000152"}),
+			"WRU":    tieredOffer("WriteRequestUnits", map[string]string{"0": "0.00000095"}),
+			"GB":     tieredOffer("GB-Mo", map[string]string{"0": "0", "25": "0.306"}),
+			"IA-GB":  tieredOffer("GB-Mo", map[string]string{"0": "0.1224"}),
+			"REPL":   tieredOffer("WriteCapacityUnit-Hrs", map[string]string{"0": "0.00116"}),
+			"BAD":    tieredOffer("WriteRequestUnits", map[string]string{"0": "n/a"}),
+		}},
+	}
+	for sku, usageType := range usageTypes {
+		offer.Products[sku] = BulkProduct{SKU: sku, ProductFamily: "Amazon DynamoDB", Attributes: map[string]string{"usagetype": usageType}}
+	}
+	paths := setupServiceOfferServer(t, offer)
+
+	scrapes := make(chan provider.ScrapeResult, 20)
+	var errorCount uint64
+	GetDynamoDBPricing(context.Background(), "eu-central-1", nil, &errorCount, scrapes)
+	close(scrapes)
+
+	type series struct{ metric, operation, tableClass string }
+	got := map[series]float64{}
+	skipped := map[string]int{}
+	for r := range scrapes {
+		if r.Name == provider.SkippedName {
+			skipped[r.Labels["reason"]]++
+			continue
+		}
+		if r.Region != "eu-central-1" {
+			t.Errorf("unexpected region %q", r.Region)
+		}
+		got[series{r.Name, r.Labels["operation"], r.Labels["table_class"]}] = r.Value
+	}
+	want := map[series]float64{
+		{DynamoDBCapacityMetric, "read", DynamoDBTableClassStandard}:   0.0001544,
+		{DynamoDBCapacityMetric, "write", DynamoDBTableClassStandard}:  0.000772,
+		{DynamoDBCapacityMetric, "read", DynamoDBTableClassStandardIA}: 0.000186,
+		{DynamoDBRequestMetric, "read", DynamoDBTableClassStandard}:    0.000000152,
+		{DynamoDBRequestMetric, "write", DynamoDBTableClassStandardIA}: 0.00000095,
+		{DynamoDBStorageMetric, "", DynamoDBTableClassStandard}:        0.306,
+		{DynamoDBStorageMetric, "", DynamoDBTableClassStandardIA}:      0.1224,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d series, want %d: %v", len(got), len(want), got)
+	}
+	for s, v := range want {
+		if got[s] != v {
+			t.Errorf("%+v = %g, want %g", s, got[s], v)
+		}
+	}
+	if errorCount != 1 || skipped[provider.SkipUnparsablePrice] != 1 {
+		t.Errorf("expected the unparsable price to be counted, got %d errors and skips %v", errorCount, skipped)
+	}
+	if len(*paths) != 1 || (*paths)[0] != "/AmazonDynamoDB/eu-central-1" {
+		t.Errorf("unexpected offer file requests %v", *paths)
+	}
+}
+
+func TestDynamoDBUsageTypeRE(t *testing.T) {
+	for usageType, want := range map[string][]string{
+		"ReadCapacityUnit-Hrs":            {"", "ReadCapacityUnit-Hrs"},
+		"IA-TimedStorage-ByteHrs":         {"IA-", "TimedStorage-ByteHrs"},
+		"EU-WriteRequestUnits":            {"", "WriteRequestUnits"},
+		"APN1-IA-WriteCapacityUnit-Hrs":   {"IA-", "WriteCapacityUnit-Hrs"},
+		"USE1-ReplWriteCapacityUnit-Hrs":  nil,
+		"USE1-StreamsReadRequestUnits":    nil,
+		"USE1-TimedBackupStorage-ByteHrs": nil,
+	} {
+		m := dynamoDBUsageTypeRE.FindStringSubmatch(usageType)
+		if want == nil {
+			if m != nil {
+				t.Errorf("%s: expected no match, got %q", usageType, m)
+			}
+			continue
+		}
+		if m == nil || m[1] != want[0] || m[2] != want[1] {
+			t.Errorf("%s: got %q, want %q", usageType, m, want)
+		}
+	}
+}
+
+func TestGetDynamoDBPricing_Unavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+	orig := ServiceOfferURLFormat
+	ServiceOfferURLFormat = ts.URL + "/%s/%s"
+	defer func() { ServiceOfferURLFormat = orig }()
+
+	scrapes := make(chan provider.ScrapeResult, 1)
+	var errorCount uint64
+	GetDynamoDBPricing(context.Background(), "us-east-1", ts.Client(), &errorCount, scrapes)
+	if errorCount != 1 || len(scrapes) != 1 {
+		t.Fatalf("expected one error and its failed request result, got %d errors and %d results", errorCount, len(scrapes))
+	}
+	if r := <-scrapes; r.Name != provider.FailedName {
+		t.Errorf("expected a failed request result, got %q", r.Name)
+	}
+}
@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	ceTypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// effectiveUsage accumulates cost and running hours of one instance type in one region.
+type effectiveUsage struct {
+	region, instanceType string
+	cost, hours          float64
+}
+
+// GetEffectivePricing derives the account's effective hourly rate per instance
+// type and region from Cost Explorer: net amortized cost divided by running
+// hours over the trailing window. Unlike public prices this includes EDP
+// discounts, private pricing, RIs and savings plans. Cost Explorer is global
+// and billed per request, so this is called for all regions at once and its
+// results are cached by the caller.
+func GetEffectivePricing(ctx context.Context, regions []string, client CostExplorerAPI, window time.Duration, filter InstanceFilter, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	start := end.Add(-window)
+	input := &costexplorer.GetCostAndUsageInput{
+		TimePeriod: &ceTypes.DateInterval{
+			Start: awssdk.String(start.Format(time.DateOnly)),
+			End:   awssdk.String(end.Format(time.DateOnly)),
+		},
+		Granularity: ceTypes.GranularityDaily,
+		Metrics:     []string{"NetAmortizedCost", "UsageQuantity"},
+		Filter: &ceTypes.Expression{
+			Dimensions: &ceTypes.DimensionValues{
+				Key:    ceTypes.DimensionUsageTypeGroup,
+				Values: []string{"EC2: Running Hours"},
+			},
+		},
+		GroupBy: []ceTypes.GroupDefinition{
+			{Type: ceTypes.GroupDefinitionTypeDimension, Key: awssdk.String(string(ceTypes.DimensionInstanceType))},
+			{Type: ceTypes.GroupDefinitionTypeDimension, Key: awssdk.String(string(ceTypes.DimensionRegion))},
+		},
+	}
+
+	usage := make(map[string]*effectiveUsage)
+	var order []string
+	for {
+		resp, err := client.GetCostAndUsage(ctx, input)
+		if err != nil {
+			apiError(log.StandardLogger(), "", err, errorCount, scrapes).Error("error while fetching cost and usage from Cost Explorer")
+			return
+		}
+		for _, result := range resp.ResultsByTime {
+			for _, group := range result.Groups {
+				if len(group.Keys) != 2 {
+					continue
+				}
+				cost, err := strconv.ParseFloat(awssdk.ToString(group.Metrics["NetAmortizedCost"].Amount), 64)
+				if err != nil {
+					continue
+				}
+				hours, err := strconv.ParseFloat(awssdk.ToString(group.Metrics["UsageQuantity"].Amount), 64)
+				if err != nil {
+					continue
+				}
+				key := group.Keys[0] + "/" + group.Keys[1]
+				u, ok := usage[key]
+				if !ok {
+					u = &effectiveUsage{instanceType: group.Keys[0], region: group.Keys[1]}
+					usage[key] = u
+					order = append(order, key)
+				}
+				u.cost += cost
+				u.hours += hours
+			}
+		}
+		if resp.NextPageToken == nil || *resp.NextPageToken == "" {
+			break
+		}
+		input.NextPageToken = resp.NextPageToken
+	}
+
+	for _, key := range order {
+		u := usage[key]
+		if u.hours <= 0 || !provider.Contains(regions, u.region) {
+			continue
+		}
+		if !filter.Match(instances, u.instanceType) {
+			log.Debugf("Skipping instance type: %s", u.instanceType)
+			continue
+		}
+		value := u.cost / u.hours
+		log.Debugf("Creating new metric: ec2_effective{region=%s, instance_type=%s} = %v.", u.region, u.instanceType, value)
+		scrapes <- provider.ScrapeResult{
+			Name:         "ec2_effective",
+			Value:        value,
+			Region:       u.region,
+			InstanceType: u.instanceType,
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	ceTypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func costGroup(instanceType, region, cost, hours string) ceTypes.Group {
+	return ceTypes.Group{
+		Keys: []string{instanceType, region},
+		Metrics: map[string]ceTypes.MetricValue{
+			"NetAmortizedCost": {Amount: awssdk.String(cost), Unit: awssdk.String("USD")},
+			"UsageQuantity":    {Amount: awssdk.String(hours), Unit: awssdk.String("Hrs")},
+		},
+	}
+}
+
+func TestGetEffectivePricing(t *testing.T) {
+	var calls int
+	client := &mockCostExplorerClient{
+		GetCostAndUsageFn: func(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+			calls++
+			if calls == 1 {
+				if params.NextPageToken != nil {
+					t.Errorf("expected no page token on first call")
+				}
+				return &costexplorer.GetCostAndUsageOutput{
+					ResultsByTime: []ceTypes.ResultByTime{{Groups: []ceTypes.Group{
+						costGroup("m5.large", "us-east-1", "1.5", "24"),
+						costGroup("m5.large", "eu-west-1", "2", "24"),
+						costGroup("c5.large", "us-east-1", "0", "0"),
+					}}},
+					NextPageToken: awssdk.String("page2"),
+				}, nil
+			}
+			if awssdk.ToString(params.NextPageToken) != "page2" {
+				t.Errorf("expected page token page2, got %v", awssdk.ToString(params.NextPageToken))
+			}
+			return &costexplorer.GetCostAndUsageOutput{
+				ResultsByTime: []ceTypes.ResultByTime{{Groups: []ceTypes.Group{
+					costGroup("m5.large", "us-east-1", "0.5", "16"),
+				}}},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}
+	GetEffectivePricing(context.Background(), []string{"us-east-1"}, client, 7*24*time.Hour, filter, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// eu-west-1 isn't configured and c5.large has no running hours.
+	requireScrapeCount(t, results, 1)
+	r := results[0]
+	if r.Name != "ec2_effective" || r.InstanceType != "m5.large" || r.Region != "us-east-1" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r.Value != 0.05 {
+		t.Errorf("expected effective rate 2/40 = 0.05, got %v", r.Value)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetEffectivePricing_Error(t *testing.T) {
+	client := &mockCostExplorerClient{
+		GetCostAndUsageFn: func(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetEffectivePricing(context.Background(), []string{"us-east-1"}, client, 24*time.Hour, InstanceFilter{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+	if errorCount != 1 {
+		t.Errorf("expected errorCount=1, got %d", errorCount)
+	}
+}
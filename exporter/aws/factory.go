@@ -2,18 +2,117 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
 )
 
 // SDKClientFactory creates real AWS SDK clients. Implements ClientFactory.
-type SDKClientFactory struct{}
+type SDKClientFactory struct {
+	// RoleARN, if set, is assumed through STS with the default credentials
+	// and used for every client.
+	RoleARN string
+	// Endpoint, if set, overrides the endpoint of every client, e.g. to
+	// point the exporter at LocalStack. AWS_ENDPOINT_URL is honored by the
+	// SDK itself.
+	Endpoint string
+	// RetryMode and RetryMaxAttempts override the SDK retry behaviour; zero
+	// values keep the SDK defaults (AWS_RETRY_MODE, AWS_MAX_ATTEMPTS or standard/3).
+	RetryMode        awssdk.RetryMode
+	RetryMaxAttempts int
+	// HTTPClient, if set, replaces the SDK's HTTP client, e.g. to send
+	// requests through a proxy.
+	HTTPClient *http.Client
+	// Credentials, if set, replace the default credential chain, e.g. with
+	// static placeholders when replaying recorded fixtures.
+	Credentials awssdk.CredentialsProvider
+
+	roleCredentials *roleCredentials // shared by copies; set by NewAssumeRoleAccount
+}
+
+// roleCredentials holds the credentials of an assumed role, built on first
+// use so that every client of a factory shares one cache and the role is
+// only assumed again when its credentials expire.
+type roleCredentials struct {
+	once     sync.Once
+	provider awssdk.CredentialsProvider
+}
+
+// Account is an AWS account scraped for account-specific data (spot prices,
+// savings plan rates) through its own ClientFactory.
+type Account struct {
+	ID            string
+	ClientFactory ClientFactory
+}
+
+// NewAssumeRoleAccount returns an Account that scrapes through roleARN with
+// the remaining settings of base. The account ID is taken from the ARN.
+func NewAssumeRoleAccount(base SDKClientFactory, roleARN string) (Account, error) {
+	parsed, err := arn.Parse(roleARN)
+	if err != nil {
+		return Account{}, fmt.Errorf("invalid role ARN %q: %w", roleARN, err)
+	}
+	if parsed.Service != "iam" || parsed.AccountID == "" {
+		return Account{}, fmt.Errorf("invalid role ARN %q: expected arn:aws:iam::<account-id>:role/<name>", roleARN)
+	}
+	base.RoleARN = roleARN
+	base.roleCredentials = &roleCredentials{}
+	return Account{ID: parsed.AccountID, ClientFactory: &base}, nil
+}
+
+func (f *SDKClientFactory) loadConfig(region string) (awssdk.Config, error) {
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+		config.WithRetryMode(f.RetryMode),
+		config.WithRetryMaxAttempts(f.RetryMaxAttempts),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	if f.Endpoint != "" {
+		cfg.BaseEndpoint = awssdk.String(f.Endpoint)
+	}
+	if f.HTTPClient != nil {
+		cfg.HTTPClient = f.HTTPClient
+	}
+	if f.Credentials != nil {
+		cfg.Credentials = f.Credentials
+	}
+	if f.RoleARN != "" {
+		cfg.Credentials = f.assumeRoleCredentials(cfg)
+	}
+	return cfg, nil
+}
+
+// assumeRoleCredentials returns the cached credentials of RoleARN, assumed
+// with the credentials of cfg.
+func (f *SDKClientFactory) assumeRoleCredentials(cfg awssdk.Config) awssdk.CredentialsProvider {
+	newProvider := func() awssdk.CredentialsProvider {
+		return awssdk.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), f.RoleARN))
+	}
+	if f.roleCredentials == nil {
+		return newProvider()
+	}
+	f.roleCredentials.once.Do(func() { f.roleCredentials.provider = newProvider() })
+	return f.roleCredentials.provider
+}
 
 func (f *SDKClientFactory) NewEC2Client(region string) (EC2Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	cfg, err := f.loadConfig(region)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config for EC2 [region=%s]: %w", region, err)
 	}
@@ -21,9 +120,64 @@ func (f *SDKClientFactory) NewEC2Client(region string) (EC2Client, error) {
 }
 
 func (f *SDKClientFactory) NewSavingsPlansClient() (SavingsPlansAPI, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
+	cfg, err := f.loadConfig("us-east-1")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config for SavingsPlans API: %w", err)
 	}
 	return savingsplans.NewFromConfig(cfg), nil
 }
+
+func (f *SDKClientFactory) NewS3Client(region string) (S3API, error) {
+	cfg, err := f.loadConfig(region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for S3 [region=%s]: %w", region, err)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// Emulators such as LocalStack don't serve virtual-hosted buckets.
+		o.UsePathStyle = cfg.BaseEndpoint != nil
+	}), nil
+}
+
+// NewPricingClient returns a Pricing Query API client. The API is only served
+// from us-east-1 and a few other regions, independent of the priced region.
+func (f *SDKClientFactory) NewPricingClient() (PricingAPI, error) {
+	cfg, err := f.loadConfig("us-east-1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for Pricing API: %w", err)
+	}
+	return pricing.NewFromConfig(cfg), nil
+}
+
+func (f *SDKClientFactory) NewCostExplorerClient() (CostExplorerAPI, error) {
+	cfg, err := f.loadConfig("us-east-1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for Cost Explorer API: %w", err)
+	}
+	return costexplorer.NewFromConfig(cfg), nil
+}
+
+// CheckCredentials resolves the credentials the clients of region are signed
+// with, assuming RoleARN if set, and returns their source, e.g.
+// "EnvConfigCredentials" or "AssumeRoleProvider". Errors are classified as
+// CategoryCredentials, or CategoryPermission if RoleARN may not be assumed.
+func (f *SDKClientFactory) CheckCredentials(ctx context.Context, region string) (string, error) {
+	cfg, err := f.loadConfig(region)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config [region=%s]: %w", region, err)
+	}
+	if cfg.Credentials == nil {
+		return "", &apierror.Error{Provider: "aws", Category: apierror.CategoryCredentials, Err: errors.New("no credentials provider configured")}
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		// E.g. an unreachable IMDS means there are no credentials; only a
+		// role that may not be assumed is a missing permission.
+		classified := apierror.Classify("aws", err)
+		if classified.Category != apierror.CategoryPermission {
+			classified.Category = apierror.CategoryCredentials
+			classified.Code = ""
+		}
+		return "", classified
+	}
+	return creds.Source, nil
+}
@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+)
+
+func TestNewAssumeRoleAccount(t *testing.T) {
+	account, err := NewAssumeRoleAccount(SDKClientFactory{Endpoint: "http://localhost:4566"}, "arn:aws:iam::123456789012:role/price-exporter")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if account.ID != "123456789012" {
+		t.Errorf("expected account ID 123456789012, got %q", account.ID)
+	}
+	factory, ok := account.ClientFactory.(*SDKClientFactory)
+	if !ok || factory.RoleARN != "arn:aws:iam::123456789012:role/price-exporter" {
+		t.Errorf("expected SDKClientFactory with the role ARN, got %#v", account.ClientFactory)
+	}
+	if ok && factory.Endpoint != "http://localhost:4566" {
+		t.Errorf("expected endpoint to be kept from base, got %q", factory.Endpoint)
+	}
+}
+
+func TestNewAssumeRoleAccount_Invalid(t *testing.T) {
+	for _, roleARN := range []string{
+		"123456789012",
+		"arn:aws:s3:::bucket",
+		"arn:aws:iam:::role/no-account",
+	} {
+		if _, err := NewAssumeRoleAccount(SDKClientFactory{}, roleARN); err == nil {
+			t.Errorf("expected error for %q, got nil", roleARN)
+		}
+	}
+}
+
+func TestSDKClientFactory_Endpoint(t *testing.T) {
+	f := &SDKClientFactory{Endpoint: "http://localhost:4566"}
+	cfg, err := f.loadConfig("us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BaseEndpoint == nil || *cfg.BaseEndpoint != "http://localhost:4566" {
+		t.Errorf("expected base endpoint http://localhost:4566, got %v", cfg.BaseEndpoint)
+	}
+}
+
+func TestSDKClientFactory_Retry(t *testing.T) {
+	f := &SDKClientFactory{RetryMode: awssdk.RetryModeAdaptive, RetryMaxAttempts: 10}
+	cfg, err := f.loadConfig("us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RetryMode != awssdk.RetryModeAdaptive || cfg.RetryMaxAttempts != 10 {
+		t.Errorf("expected adaptive retry with 10 attempts, got %s/%d", cfg.RetryMode, cfg.RetryMaxAttempts)
+	}
+}
+
+func TestSDKClientFactory_CheckCredentials(t *testing.T) {
+	f := &SDKClientFactory{Credentials: credentials.NewStaticCredentialsProvider("key", "secret", "")}
+	source, err := f.CheckCredentials(context.Background(), "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source != credentials.StaticCredentialsName {
+		t.Errorf("expected source %s, got %q", credentials.StaticCredentialsName, source)
+	}
+
+	f.Credentials = credentials.NewStaticCredentialsProvider("", "", "")
+	_, err = f.CheckCredentials(context.Background(), "us-east-1")
+	if e := apierror.Classify("aws", err); e == nil || e.Category != apierror.CategoryCredentials {
+		t.Errorf("expected a credentials error, got %v", err)
+	}
+}
+
+func TestSDKClientFactory_AssumeRoleOnce(t *testing.T) {
+	var assumed atomic.Int32
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assumed.Add(1)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>` +
+			`<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`<Expiration>` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer sts.Close()
+	base := SDKClientFactory{Endpoint: sts.URL, Credentials: credentials.NewStaticCredentialsProvider("key", "secret", "")}
+	account, err := NewAssumeRoleAccount(base, "arn:aws:iam::123456789012:role/price-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := account.ClientFactory.(*SDKClientFactory)
+
+	for _, region := range []string{"us-east-1", "eu-west-1", "us-east-1"} {
+		cfg, err := factory.loadConfig(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds, err := cfg.Credentials.Retrieve(context.Background())
+		if err != nil || creds.AccessKeyID != "ASIAEXAMPLE" {
+			t.Fatalf("expected the assumed role's credentials, got %v, %v", creds.AccessKeyID, err)
+		}
+	}
+	if n := assumed.Load(); n != 1 {
+		t.Errorf("expected the role to be assumed once, got %d AssumeRole calls", n)
+	}
+}
@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// InstanceFilter selects which EC2 instance types and availability zones are exported.
+// Zero-valued vCPU and memory bounds are ignored.
+type InstanceFilter struct {
+	Regexes           []*regexp.Regexp
+	InstanceTypes     []string // exact types, e.g. "m5.large"; empty = all types
+	Families          []string // e.g. "m5", "c6g"; empty = all families
+	AvailabilityZones []string // e.g. "us-east-1a"; empty = all zones
+	Architectures     []string // e.g. "arm64", "x86_64"; empty = all architectures
+	MinVCpu           int32
+	MaxVCpu           int32
+	MinMemoryGiB      float64
+	MaxMemoryGiB      float64
+}
+
+// needsInstanceData reports whether any criterion requires InstanceStore data.
+func (f InstanceFilter) needsInstanceData() bool {
+	return f.MinVCpu > 0 || f.MaxVCpu > 0 || f.MinMemoryGiB > 0 || f.MaxMemoryGiB > 0 || len(f.Architectures) > 0
+}
+
+// Match reports whether instanceType matches the regexes, types, families and
+// architectures and falls within the vCPU and memory bounds. Architectures and
+// bounds are checked against the InstanceStore, so instance types missing from
+// the store never match while one of them is set.
+func (f InstanceFilter) Match(instances *InstanceStore, instanceType string) bool {
+	return f.Reject(instances, instanceType) == ""
+}
+
+// Reject returns why instanceType doesn't Match: provider.SkipFiltered, or
+// provider.SkipUnknownInstanceType if it's missing from the InstanceStore.
+// It returns "" for matching types.
+func (f InstanceFilter) Reject(instances *InstanceStore, instanceType string) string {
+	if !f.MatchName(instanceType) {
+		return provider.SkipFiltered
+	}
+	if !f.needsInstanceData() {
+		return ""
+	}
+
+	inst, ok := instances.Get(instanceType)
+	if !ok {
+		return provider.SkipUnknownInstanceType
+	}
+	if len(f.Architectures) > 0 && !matchAnyArchitecture(f.Architectures, inst.Architectures) {
+		return provider.SkipFiltered
+	}
+	memoryGiB := float64(inst.Memory) / 1024
+	switch {
+	case f.MinVCpu > 0 && inst.VCpu < f.MinVCpu,
+		f.MaxVCpu > 0 && inst.VCpu > f.MaxVCpu,
+		f.MinMemoryGiB > 0 && memoryGiB < f.MinMemoryGiB,
+		f.MaxMemoryGiB > 0 && memoryGiB > f.MaxMemoryGiB:
+		return provider.SkipFiltered
+	}
+	return ""
+}
+
+// MatchName reports whether instanceType matches the regexes, types and
+// families, the criteria that don't need InstanceStore data.
+func (f InstanceFilter) MatchName(instanceType string) bool {
+	if !provider.IsMatchAny(f.Regexes, instanceType) {
+		return false
+	}
+	if len(f.Families) > 0 && !provider.Contains(f.Families, InstanceFamily(instanceType)) {
+		return false
+	}
+	return len(f.InstanceTypes) == 0 || provider.Contains(f.InstanceTypes, instanceType)
+}
+
+func matchAnyArchitecture(wanted, supported []string) bool {
+	for _, arch := range supported {
+		if provider.Contains(wanted, arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchZone reports whether az is in the availability zone allowlist.
+// An empty allowlist matches every zone.
+func (f InstanceFilter) MatchZone(az string) bool {
+	return len(f.AvailabilityZones) == 0 || provider.Contains(f.AvailabilityZones, az)
+}
+
+// filterZones returns the entries of azs that pass the availability zone allowlist.
+func (f InstanceFilter) filterZones(azs []string) []string {
+	if len(f.AvailabilityZones) == 0 {
+		return azs
+	}
+	kept := make([]string, 0, len(azs))
+	for _, az := range azs {
+		if f.MatchZone(az) {
+			kept = append(kept, az)
+		}
+	}
+	return kept
+}
+
+// InstanceFamily returns the family prefix of an instance type, e.g. "m5" for "m5.large".
+func InstanceFamily(instanceType string) string {
+	family, _, _ := strings.Cut(instanceType, ".")
+	return family
+}
+
+// spotInstanceTypePatterns converts families into DescribeSpotPriceHistory
+// instance-type filter values ("m5" -> "m5.*").
+func spotInstanceTypePatterns(families []string) []string {
+	patterns := make([]string, len(families))
+	for i, family := range families {
+		patterns[i] = family + ".*"
+	}
+	return patterns
+}
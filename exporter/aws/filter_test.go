@@ -0,0 +1,80 @@
+package aws
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestInstanceFilter_Match(t *testing.T) {
+	instances := NewInstanceStoreFromMap(map[string]Instance{
+		"m5.large":  {Memory: 8192, VCpu: 2, Architectures: []string{"x86_64"}},
+		"m5.xlarge": {Memory: 16384, VCpu: 4, Architectures: []string{"x86_64"}},
+		"m6g.large": {Memory: 8192, VCpu: 2, Architectures: []string{"arm64"}},
+	})
+	all := []*regexp.Regexp{regexp.MustCompile(".*")}
+
+	tests := []struct {
+		name         string
+		filter       InstanceFilter
+		instanceType string
+		want         bool
+	}{
+		{name: "no bounds", filter: InstanceFilter{Regexes: all}, instanceType: "m5.large", want: true},
+		{name: "no bounds unknown type", filter: InstanceFilter{Regexes: all}, instanceType: "x9.huge", want: true},
+		{name: "regex mismatch", filter: InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`^c5\.`)}}, instanceType: "m5.large", want: false},
+		{name: "family match", filter: InstanceFilter{Regexes: all, Families: []string{"c6g", "m5"}}, instanceType: "m5.large", want: true},
+		{name: "family mismatch", filter: InstanceFilter{Regexes: all, Families: []string{"m5"}}, instanceType: "m5a.large", want: false},
+		{name: "type match", filter: InstanceFilter{Regexes: all, InstanceTypes: []string{"m5.large"}}, instanceType: "m5.large", want: true},
+		{name: "type mismatch", filter: InstanceFilter{Regexes: all, InstanceTypes: []string{"m5.large"}}, instanceType: "m5.xlarge", want: false},
+		{name: "min vcpu satisfied", filter: InstanceFilter{Regexes: all, MinVCpu: 4}, instanceType: "m5.xlarge", want: true},
+		{name: "min vcpu not satisfied", filter: InstanceFilter{Regexes: all, MinVCpu: 4}, instanceType: "m5.large", want: false},
+		{name: "max vcpu not satisfied", filter: InstanceFilter{Regexes: all, MaxVCpu: 2}, instanceType: "m5.xlarge", want: false},
+		{name: "min memory not satisfied", filter: InstanceFilter{Regexes: all, MinMemoryGiB: 16}, instanceType: "m5.large", want: false},
+		{name: "max memory satisfied", filter: InstanceFilter{Regexes: all, MaxMemoryGiB: 8}, instanceType: "m5.large", want: true},
+		{name: "max memory not satisfied", filter: InstanceFilter{Regexes: all, MaxMemoryGiB: 8}, instanceType: "m5.xlarge", want: false},
+		{name: "architecture match", filter: InstanceFilter{Regexes: all, Architectures: []string{"arm64"}}, instanceType: "m6g.large", want: true},
+		{name: "architecture mismatch", filter: InstanceFilter{Regexes: all, Architectures: []string{"arm64"}}, instanceType: "m5.large", want: false},
+		{name: "architecture unknown type", filter: InstanceFilter{Regexes: all, Architectures: []string{"x86_64"}}, instanceType: "x9.huge", want: false},
+		{name: "bounds with unknown type", filter: InstanceFilter{Regexes: all, MinVCpu: 1}, instanceType: "x9.huge", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(instances, tt.instanceType); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.instanceType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceFilter_Reject(t *testing.T) {
+	instances := NewInstanceStoreFromMap(map[string]Instance{
+		"m5.large": {Memory: 8192, VCpu: 2, Architectures: []string{"x86_64"}},
+	})
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`^m`)}, MinVCpu: 2}
+	for instanceType, want := range map[string]string{
+		"m5.large": "",
+		"c5.large": provider.SkipFiltered,
+		"m9.large": provider.SkipUnknownInstanceType,
+	} {
+		if got := filter.Reject(instances, instanceType); got != want {
+			t.Errorf("Reject(%q) = %q, want %q", instanceType, got, want)
+		}
+	}
+}
+
+func TestInstanceFamily(t *testing.T) {
+	tests := map[string]string{
+		"m5.large":     "m5",
+		"c6g.2xlarge":  "c6g",
+		"u-6tb1.metal": "u-6tb1",
+		"m5":           "m5",
+	}
+	for instanceType, want := range tests {
+		if got := InstanceFamily(instanceType); got != want {
+			t.Errorf("InstanceFamily(%q) = %q, want %q", instanceType, got, want)
+		}
+	}
+}
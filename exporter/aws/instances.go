@@ -1,30 +1,63 @@
 package aws
 
 import (
+	"bytes"
 	"context"
+	_ "embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"sync"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	log "github.com/sirupsen/logrus"
 )
 
+// Instance data sources.
+const (
+	InstanceDataSourceHTTP     = "http"     // ec2instances.info, falling back to the bundled snapshot
+	InstanceDataSourceAPI      = "api"      // EC2 DescribeInstanceTypes, falling back to the bundled snapshot
+	InstanceDataSourceEmbedded = "embedded" // bundled snapshot only
+)
+
 // EC2InstancesInfoURL is the default URL to fetch EC2 instance type data from.
 // Exported so tests in other packages can override it.
 var EC2InstancesInfoURL = "https://ec2instances.info/instances.json"
 
+// embeddedInstances is a snapshot of instance type specifications bundled into
+// the binary as a fallback for when ec2instances.info is unreachable.
+// Regenerate it with `make update-instance-data`.
+//
+//go:embed data/instances.json
+var embeddedInstances []byte
+
 // ec2InstanceInfo represents a single entry from the ec2instances.info JSON API.
 type ec2InstanceInfo struct {
-	InstanceType string  `json:"instance_type"`
-	VCpu         int     `json:"vcpu"`
-	Memory       float64 `json:"memory"` // GiB
+	InstanceType       string   `json:"instance_type"`
+	VCpu               int      `json:"vcpu"`
+	Memory             float64  `json:"memory"` // GiB
+	Arch               []string `json:"arch"`
+	NetworkPerformance string   `json:"network_performance"`
+	Storage            *struct {
+		Devices int     `json:"devices"`
+		Size    float64 `json:"size"` // GB per device
+	} `json:"storage"`
+	GPU             int     `json:"GPU"`
+	GPUModel        string  `json:"GPU_model"`
+	BasePerformance float64 `json:"base_performance"` // vCPUs
 }
 
-// InstanceStore caches EC2 instance type specifications (vCPU, memory).
+// InstanceStore caches EC2 instance type specifications (vCPU, memory,
+// architecture, network, instance storage, GPUs and burstable baseline).
+// It's safe for concurrent use; Load swaps in the new data atomically.
 type InstanceStore struct {
-	instances map[string]Instance
-	url       string // override URL for testing; empty = use EC2InstancesInfoURL
+	mu          sync.RWMutex
+	instances   map[string]Instance
+	cpuMemRatio float64 // 0 = CpuMemRelation
+	url         string  // override URL for testing; empty = use EC2InstancesInfoURL
 }
 
 // NewInstanceStore returns an empty InstanceStore.
@@ -64,52 +97,171 @@ func (s *InstanceStore) Load(ctx context.Context, httpClient *http.Client) error
 		return fmt.Errorf("unexpected status %d fetching instance data from %s", resp.StatusCode, url)
 	}
 
+	return s.load(resp.Body)
+}
+
+// LoadEmbedded populates the store from the snapshot bundled into the binary.
+func (s *InstanceStore) LoadEmbedded() error {
+	return s.load(bytes.NewReader(embeddedInstances))
+}
+
+// LoadFromAPI populates the store from the EC2 DescribeInstanceTypes API, for
+// environments that can't reach ec2instances.info (air-gapped, GovCloud).
+func (s *InstanceStore) LoadFromAPI(ctx context.Context, client ec2.DescribeInstanceTypesAPIClient) error {
+	instances := make(map[string]Instance)
+	pag := ec2.NewDescribeInstanceTypesPaginator(client, &ec2.DescribeInstanceTypesInput{})
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error describing instance types: %w", err)
+		}
+		for _, info := range page.InstanceTypes {
+			var inst Instance
+			if info.VCpuInfo != nil {
+				inst.VCpu = awssdk.ToInt32(info.VCpuInfo.DefaultVCpus)
+			}
+			if info.MemoryInfo != nil {
+				inst.Memory = awssdk.ToInt64(info.MemoryInfo.SizeInMiB)
+			}
+			if info.ProcessorInfo != nil {
+				for _, arch := range info.ProcessorInfo.SupportedArchitectures {
+					inst.Architectures = append(inst.Architectures, string(arch))
+				}
+			}
+			if info.NetworkInfo != nil {
+				inst.NetworkPerformance = awssdk.ToString(info.NetworkInfo.NetworkPerformance)
+			}
+			if info.InstanceStorageInfo != nil {
+				inst.StorageGiB = float64(awssdk.ToInt64(info.InstanceStorageInfo.TotalSizeInGB))
+				for _, disk := range info.InstanceStorageInfo.Disks {
+					inst.StorageDevices += awssdk.ToInt32(disk.Count)
+				}
+			}
+			if info.GpuInfo != nil {
+				for _, gpu := range info.GpuInfo.Gpus {
+					inst.GPU += awssdk.ToInt32(gpu.Count)
+					if inst.GPUModel == "" {
+						inst.GPUModel = awssdk.ToString(gpu.Name)
+					}
+				}
+			}
+			// DescribeInstanceTypes only flags burstable types, their
+			// baseline comes from the built-in table.
+			if awssdk.ToBool(info.BurstablePerformanceSupported) {
+				if baseline, ok := BurstableBaseline(string(info.InstanceType)); ok {
+					inst.BaselineVCpu = baseline * float64(inst.VCpu)
+				}
+			}
+			instances[string(info.InstanceType)] = inst
+		}
+	}
+
+	s.mu.Lock()
+	s.instances = instances
+	s.mu.Unlock()
+
+	log.Infof("loaded %d instance types from DescribeInstanceTypes", len(instances))
+	return nil
+}
+
+// load parses ec2instances.info JSON from r and replaces the store's data.
+func (s *InstanceStore) load(r io.Reader) error {
 	var items []ec2InstanceInfo
-	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
 		return fmt.Errorf("error parsing instance data: %w", err)
 	}
 
-	s.instances = make(map[string]Instance, len(items))
+	instances := make(map[string]Instance, len(items))
 	for _, item := range items {
-		s.instances[item.InstanceType] = Instance{
-			Memory: int64(item.Memory * 1024), // GiB -> MiB
-			VCpu:   int32(item.VCpu),
+		inst := Instance{
+			Memory:             int64(item.Memory * 1024), // GiB -> MiB
+			VCpu:               int32(item.VCpu),
+			Architectures:      item.Arch,
+			NetworkPerformance: item.NetworkPerformance,
+			GPU:                int32(item.GPU),
+			GPUModel:           item.GPUModel,
+			BaselineVCpu:       item.BasePerformance,
+		}
+		if item.Storage != nil {
+			inst.StorageDevices = int32(item.Storage.Devices)
+			inst.StorageGiB = float64(item.Storage.Devices) * item.Storage.Size
 		}
+		instances[item.InstanceType] = inst
 	}
 
-	log.Infof("loaded %d instance types", len(s.instances))
+	s.mu.Lock()
+	s.instances = instances
+	s.mu.Unlock()
+
+	log.Infof("loaded %d instance types", len(instances))
 	return nil
 }
 
 // Len returns the number of cached instance types.
 func (s *InstanceStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return len(s.instances)
 }
 
+// Get returns the specification of the named instance type and whether it is known.
+func (s *InstanceStore) Get(instanceType string) (Instance, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inst, ok := s.instances[instanceType]
+	return inst, ok
+}
+
 // GetMemory returns the memory (MiB) of the named instance type as a string.
 func (s *InstanceStore) GetMemory(instanceType string) string {
-	return strconv.Itoa(int(s.instances[instanceType].Memory))
+	inst, _ := s.Get(instanceType)
+	return strconv.Itoa(int(inst.Memory))
 }
 
 // GetVCpu returns the vCPU count of the named instance type as a string.
 func (s *InstanceStore) GetVCpu(instanceType string) string {
-	return strconv.Itoa(int(s.instances[instanceType].VCpu))
+	inst, _ := s.Get(instanceType)
+	return strconv.Itoa(int(inst.VCpu))
+}
+
+// SetCPUMemRatio sets the CPU-to-memory cost ratio used by GetNormalizedCost:
+// one vCPU costs as much as ratio GB of memory. Zero restores CpuMemRelation.
+func (s *InstanceStore) SetCPUMemRatio(ratio float64) {
+	s.mu.Lock()
+	s.cpuMemRatio = ratio
+	s.mu.Unlock()
+}
+
+// CPUMemRatio returns the CPU-to-memory cost ratio used by GetNormalizedCost.
+func (s *InstanceStore) CPUMemRatio() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cpuMemRatio == 0 {
+		return CpuMemRelation
+	}
+	return s.cpuMemRatio
 }
 
 // GetNormalizedCost computes per-vCPU and per-GB-memory costs using the
-// 7.2 CPU-to-memory ratio. Returns (0, 0) for unknown instances.
+// configured CPU-to-memory ratio (7.2 by default). Returns (0, 0) for unknown
+// instances.
 func (s *InstanceStore) GetNormalizedCost(value float64, instanceType string) (vcpuCost, memoryCost float64) {
-	inst, ok := s.instances[instanceType]
+	inst, ok := s.Get(instanceType)
 	if !ok {
 		return 0, 0
 	}
-	vcpu := inst.VCpu
-	memory := inst.Memory / 1024
-	denom := CpuMemRelation*float64(vcpu) + float64(memory)
+	return SplitCost(value, inst.VCpu, float64(inst.Memory)/1024, s.CPUMemRatio())
+}
+
+// SplitCost splits the hourly price of an instance with vcpu vCPUs and
+// memoryGiB of memory into a per-vCPU and a per-GB cost, where one vCPU costs
+// as much as ratio GB of memory. Returns (0, 0) without resources.
+func SplitCost(value float64, vcpu int32, memoryGiB, ratio float64) (vcpuCost, memoryCost float64) {
+	denom := ratio*float64(vcpu) + memoryGiB
 	if denom == 0 {
 		return 0, 0
 	}
 	memoryCost = value / denom
-	vcpuCost = CpuMemRelation * memoryCost
+	vcpuCost = ratio * memoryCost
 	return vcpuCost, memoryCost
 }
@@ -2,10 +2,15 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"math"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
 func newTestServer(handler http.HandlerFunc) *httptest.Server {
@@ -16,8 +21,8 @@ func TestInstanceStore_Load_Success(t *testing.T) {
 	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`[
-			{"instance_type": "m5.large",  "vcpu": 2, "memory": 8.0},
-			{"instance_type": "m5.xlarge", "vcpu": 4, "memory": 16.0}
+			{"instance_type": "m5.large",  "vcpu": 2, "memory": 8.0, "arch": ["x86_64"]},
+			{"instance_type": "m5.xlarge", "vcpu": 4, "memory": 16.0, "arch": ["x86_64"]}
 		]`))
 	})
 	defer ts.Close()
@@ -45,6 +50,40 @@ func TestInstanceStore_Load_Success(t *testing.T) {
 	if got := store.GetVCpu("m5.xlarge"); got != "4" {
 		t.Errorf("m5.xlarge vcpu: expected 4, got %s", got)
 	}
+	if inst, _ := store.Get("m5.large"); len(inst.Architectures) != 1 || inst.Architectures[0] != "x86_64" {
+		t.Errorf("m5.large arch: expected [x86_64], got %v", inst.Architectures)
+	}
+}
+
+func TestInstanceStore_Load_ExtendedAttributes(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"instance_type": "g5.xlarge", "vcpu": 4, "memory": 16.0, "arch": ["x86_64"],
+			 "network_performance": "Up to 10 Gigabit", "storage": {"devices": 1, "size": 250, "nvme_ssd": true},
+			 "GPU": 1, "GPU_model": "NVIDIA A10G", "base_performance": null},
+			{"instance_type": "t3.micro", "vcpu": 2, "memory": 1.0, "arch": ["x86_64"],
+			 "network_performance": "Up to 5 Gigabit", "storage": null, "GPU": 0, "base_performance": 0.2}
+		]`))
+	})
+	defer ts.Close()
+
+	store := NewInstanceStore()
+	store.url = ts.URL
+	if err := store.Load(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g5, _ := store.Get("g5.xlarge")
+	if g5.NetworkPerformance != "Up to 10 Gigabit" || g5.StorageDevices != 1 || g5.StorageGiB != 250 || g5.GPU != 1 || g5.GPUModel != "NVIDIA A10G" || g5.BaselineVCpu != 0 {
+		t.Errorf("unexpected g5.xlarge attributes: %+v", g5)
+	}
+	t3, _ := store.Get("t3.micro")
+	if t3.StorageGiB != 0 || t3.GPU != 0 || t3.BaselineVCpu != 0.2 {
+		t.Errorf("unexpected t3.micro attributes: %+v", t3)
+	}
+	if got := t3.CPUCreditsPerHour(); math.Abs(got-12) > 1e-9 {
+		t.Errorf("t3.micro credits per hour: expected 12, got %v", got)
+	}
 }
 
 func TestInstanceStore_Load_HTTPError(t *testing.T) {
@@ -134,6 +173,30 @@ func TestInstanceStore_GetNormalizedCost(t *testing.T) {
 	}
 }
 
+func TestInstanceStore_GetNormalizedCost_CustomRatio(t *testing.T) {
+	store := testInstanceStore()
+	store.SetCPUMemRatio(4)
+
+	// m5.large: memoryCost = 0.096 / (4*2 + 8), vcpuCost = 4 * memoryCost
+	vcpu, memory := store.GetNormalizedCost(0.096, "m5.large")
+	if math.Abs(memory-0.006) > 1e-10 {
+		t.Errorf("memory cost: expected 0.006, got %v", memory)
+	}
+	if math.Abs(vcpu-0.024) > 1e-10 {
+		t.Errorf("vcpu cost: expected 0.024, got %v", vcpu)
+	}
+}
+
+func TestInstanceStore_GetNormalizedCost_FractionalMemory(t *testing.T) {
+	store := NewInstanceStoreFromMap(map[string]Instance{"t3.nano": {Memory: 512, VCpu: 2}})
+
+	// t3.nano: 2 vCPUs, 0.5 GiB; memoryCost = 0.0052 / (7.2*2 + 0.5)
+	_, memory := store.GetNormalizedCost(0.0052, "t3.nano")
+	if expected := 0.0052 / (7.2*2 + 0.5); math.Abs(memory-expected) > 1e-12 {
+		t.Errorf("memory cost: expected %v, got %v", expected, memory)
+	}
+}
+
 func TestInstanceStore_GetNormalizedCost_UnknownInstance(t *testing.T) {
 	store := NewInstanceStore()
 
@@ -171,3 +234,88 @@ func TestInstanceStore_GetVCpu(t *testing.T) {
 		t.Errorf("expected 0 for unknown instance, got %s", got)
 	}
 }
+
+func TestInstanceStore_LoadEmbedded(t *testing.T) {
+	store := NewInstanceStore()
+	if err := store.LoadEmbedded(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inst, ok := store.Get("m5.large")
+	if !ok {
+		t.Fatal("expected m5.large in bundled snapshot")
+	}
+	if inst.VCpu != 2 || inst.Memory != 8192 {
+		t.Errorf("m5.large: expected 2 vCPU / 8192 MiB, got %d / %d", inst.VCpu, inst.Memory)
+	}
+}
+
+func TestInstanceStore_LoadFromAPI(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeInstanceTypesFn: func(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+			if params.NextToken == nil {
+				return &ec2.DescribeInstanceTypesOutput{
+					InstanceTypes: []ec2types.InstanceTypeInfo{{
+						InstanceType:  ec2types.InstanceTypeM5Large,
+						VCpuInfo:      &ec2types.VCpuInfo{DefaultVCpus: awssdk.Int32(2)},
+						MemoryInfo:    &ec2types.MemoryInfo{SizeInMiB: awssdk.Int64(8192)},
+						ProcessorInfo: &ec2types.ProcessorInfo{SupportedArchitectures: []ec2types.ArchitectureType{ec2types.ArchitectureTypeX8664}},
+					}},
+					NextToken: awssdk.String("page2"),
+				}, nil
+			}
+			return &ec2.DescribeInstanceTypesOutput{
+				InstanceTypes: []ec2types.InstanceTypeInfo{{
+					InstanceType: ec2types.InstanceTypeC6gXlarge,
+					VCpuInfo:     &ec2types.VCpuInfo{DefaultVCpus: awssdk.Int32(4)},
+					MemoryInfo:   &ec2types.MemoryInfo{SizeInMiB: awssdk.Int64(8192)},
+				}, {
+					InstanceType:                  ec2types.InstanceTypeT3Large,
+					VCpuInfo:                      &ec2types.VCpuInfo{DefaultVCpus: awssdk.Int32(2)},
+					MemoryInfo:                    &ec2types.MemoryInfo{SizeInMiB: awssdk.Int64(8192)},
+					BurstablePerformanceSupported: awssdk.Bool(true),
+				}},
+			}, nil
+		},
+	}
+
+	store := NewInstanceStore()
+	if err := store.LoadFromAPI(context.Background(), client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.Len() != 3 {
+		t.Fatalf("expected 3 instance types across both pages, got %d", store.Len())
+	}
+	inst, _ := store.Get("m5.large")
+	if inst.VCpu != 2 || inst.Memory != 8192 || len(inst.Architectures) != 1 || inst.Architectures[0] != "x86_64" {
+		t.Errorf("unexpected m5.large specs: %+v", inst)
+	}
+	if got := store.GetVCpu("c6g.xlarge"); got != "4" {
+		t.Errorf("c6g.xlarge: expected 4 vCPU, got %s", got)
+	}
+	if inst, _ := store.Get("t3.large"); math.Abs(inst.BaselineVCpu-0.6) > 1e-12 {
+		t.Errorf("t3.large: expected a baseline of 0.6 vCPUs, got %v", inst.BaselineVCpu)
+	}
+	if inst, _ := store.Get("m5.large"); inst.BaselineVCpu != 0 {
+		t.Errorf("m5.large: expected no baseline, got %v", inst.BaselineVCpu)
+	}
+}
+
+func TestInstanceStore_LoadFromAPI_Error(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeInstanceTypesFn: func(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+
+	store := NewInstanceStore()
+	if err := store.LoadEmbedded(); err != nil {
+		t.Fatalf("LoadEmbedded: %v", err)
+	}
+	before := store.Len()
+	if err := store.LoadFromAPI(context.Background(), client); err == nil {
+		t.Fatal("expected error")
+	}
+	if store.Len() != before {
+		t.Errorf("failed load should keep previous data: had %d, now %d", before, store.Len())
+	}
+}
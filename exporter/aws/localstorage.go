@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// storageFamilyEquivalents maps storage-optimized families to the family
+// with the same vCPU and memory per size but no instance store.
+var storageFamilyEquivalents = map[string]string{
+	"i2":    "r3",
+	"i3":    "r4",
+	"i3en":  "r5",
+	"i4i":   "r6i",
+	"i4g":   "r6g",
+	"i7ie":  "r7i",
+	"i8g":   "r8g",
+	"im4gn": "m6g",
+	"d2":    "r4",
+	"d3":    "r5",
+	"d3en":  "m5",
+	"h1":    "m4",
+}
+
+// familyAttributes splits a family into generation ("m6") and attributes ("idn").
+var familyAttributes = regexp.MustCompile(`^([a-z]+[0-9]+)([a-z-]*)$`)
+
+// EquivalentInstanceType returns the instance type without instance store
+// that matches instanceType's vCPU and memory: the non-"d" variant for
+// families like m5d or c6gd, or the mapped family for storage-optimized
+// families like i3 or d3. ok is false when there is no equivalent.
+func EquivalentInstanceType(instanceType string) (string, bool) {
+	family, size, found := strings.Cut(instanceType, ".")
+	if !found {
+		return "", false
+	}
+	if equivalent, ok := storageFamilyEquivalents[family]; ok {
+		return equivalent + "." + size, true
+	}
+	m := familyAttributes.FindStringSubmatch(family)
+	if m == nil || !strings.Contains(m[2], "d") {
+		return "", false
+	}
+	return m[1] + strings.Replace(m[2], "d", "", 1) + "." + size, true
+}
+
+// sendLocalStoragePricing sends ec2_local_storage, the hourly price per GiB of
+// instance store, for every filtered type with local storage whose equivalent
+// type (same vCPU and memory, no instance store) is priced in the region. The
+// price is the on-demand Linux difference between the two, divided by the
+// instance store size.
+func sendLocalStoragePricing(region string, linuxPrices map[string]float64, filter InstanceFilter, instances *InstanceStore, scrapes chan<- provider.ScrapeResult) {
+	for instanceType, price := range linuxPrices {
+		inst, ok := instances.Get(instanceType)
+		if !ok || inst.StorageGiB <= 0 || !filter.Match(instances, instanceType) {
+			continue
+		}
+		equivalent, ok := EquivalentInstanceType(instanceType)
+		if !ok {
+			continue
+		}
+		basePrice, ok := linuxPrices[equivalent]
+		if !ok {
+			continue
+		}
+		base, ok := instances.Get(equivalent)
+		if !ok || base.VCpu != inst.VCpu || base.Memory != inst.Memory || price <= basePrice {
+			continue
+		}
+		value := (price - basePrice) / inst.StorageGiB
+		log.Debugf("Creating new metric: ec2_local_storage{region=%s, instance_type=%s} = %v.", region, instanceType, value)
+		scrapes <- provider.ScrapeResult{
+			Name:         "ec2_local_storage",
+			Value:        value,
+			Region:       region,
+			InstanceType: instanceType,
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestEquivalentInstanceType(t *testing.T) {
+	tests := []struct {
+		instanceType, want string
+		wantOK             bool
+	}{
+		{"i4i.large", "r6i.large", true},
+		{"i3.2xlarge", "r4.2xlarge", true},
+		{"d3en.xlarge", "m5.xlarge", true},
+		{"m5d.large", "m5.large", true},
+		{"m5ad.xlarge", "m5a.xlarge", true},
+		{"r6idn.2xlarge", "r6in.2xlarge", true},
+		{"c6gd.medium", "c6g.medium", true},
+		{"m5.large", "", false},
+		{"i3en", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instanceType, func(t *testing.T) {
+			got, ok := EquivalentInstanceType(tt.instanceType)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("EquivalentInstanceType(%q) = (%q, %v), want (%q, %v)", tt.instanceType, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGetOnDemandPricing_LocalStorage(t *testing.T) {
+	var bulk BulkPricingResponse
+	if err := json.Unmarshal([]byte(makeBulkPricingJSON("SKU1", "m5d.large", "Linux", "0.113")), &bulk); err != nil {
+		t.Fatal(err)
+	}
+	for sku, p := range map[string]struct{ instanceType, price string }{
+		"SKU2": {"m5.large", "0.096"},
+		"SKU3": {"r5d.large", "0.144"}, // equivalent r5.large isn't priced
+	} {
+		var extra BulkPricingResponse
+		if err := json.Unmarshal([]byte(makeBulkPricingJSON(sku, p.instanceType, "Linux", p.price)), &extra); err != nil {
+			t.Fatal(err)
+		}
+		bulk.Products[sku] = extra.Products[sku]
+		bulk.Terms.OnDemand[sku] = extra.Terms.OnDemand[sku]
+	}
+	b, _ := json.Marshal(bulk)
+	setupBulkPricingServer(t, string(b), http.StatusOK)
+
+	instances := NewInstanceStoreFromMap(map[string]Instance{
+		"m5.large":  {VCpu: 2, Memory: 8192},
+		"m5d.large": {VCpu: 2, Memory: 8192, StorageGiB: 75, StorageDevices: 1},
+		"r5d.large": {VCpu: 2, Memory: 16384, StorageGiB: 75, StorageDevices: 1},
+	})
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	// The filter excludes m5.large, but it's still used as the baseline.
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`d\.`)}}
+	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Linux"}, filter, OnDemandOptions{LocalStorage: true}, instances, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	local := scrapesByName(results, "ec2_local_storage")
+	if len(local) != 1 || local[0].InstanceType != "m5d.large" {
+		t.Fatalf("expected one ec2_local_storage result for m5d.large, got %+v", local)
+	}
+	if want := (0.113 - 0.096) / 75; math.Abs(local[0].Value-want) > 1e-12 {
+		t.Errorf("expected %v per GiB-hour, got %v", want, local[0].Value)
+	}
+	for _, r := range scrapesByName(results, "ec2") {
+		if r.InstanceType == "m5.large" {
+			t.Error("m5.large is excluded by the filter and must not be exported")
+		}
+	}
+}
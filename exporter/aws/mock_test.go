@@ -4,7 +4,10 @@ import (
 	"context"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
@@ -12,8 +15,10 @@ import (
 
 // mockEC2Client implements EC2Client for testing.
 type mockEC2Client struct {
-	DescribeSpotPriceHistoryFn  func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error)
-	DescribeAvailabilityZonesFn func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+	DescribeSpotPriceHistoryFn      func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error)
+	DescribeAvailabilityZonesFn     func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+	DescribeInstanceTypeOfferingsFn func(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error)
+	DescribeInstanceTypesFn         func(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
 }
 
 func (m *mockEC2Client) DescribeSpotPriceHistory(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
@@ -24,6 +29,14 @@ func (m *mockEC2Client) DescribeAvailabilityZones(ctx context.Context, params *e
 	return m.DescribeAvailabilityZonesFn(ctx, params, optFns...)
 }
 
+func (m *mockEC2Client) DescribeInstanceTypeOfferings(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+	return m.DescribeInstanceTypeOfferingsFn(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	return m.DescribeInstanceTypesFn(ctx, params, optFns...)
+}
+
 // mockSavingsPlansClient implements SavingsPlansAPI for testing.
 type mockSavingsPlansClient struct {
 	DescribeSavingsPlansOfferingRatesFn func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error)
@@ -33,6 +46,43 @@ func (m *mockSavingsPlansClient) DescribeSavingsPlansOfferingRates(ctx context.C
 	return m.DescribeSavingsPlansOfferingRatesFn(ctx, params, optFns...)
 }
 
+// mockS3Client implements S3API for testing.
+type mockS3Client struct {
+	ListObjectsV2Fn func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObjectFn     func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObjectFn     func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return m.ListObjectsV2Fn(ctx, params, optFns...)
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.GetObjectFn(ctx, params, optFns...)
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return m.PutObjectFn(ctx, params, optFns...)
+}
+
+// mockPricingClient implements PricingAPI for testing.
+type mockPricingClient struct {
+	GetProductsFn func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error)
+}
+
+func (m *mockPricingClient) GetProducts(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+	return m.GetProductsFn(ctx, params, optFns...)
+}
+
+// mockCostExplorerClient implements CostExplorerAPI for testing.
+type mockCostExplorerClient struct {
+	GetCostAndUsageFn func(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+}
+
+func (m *mockCostExplorerClient) GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	return m.GetCostAndUsageFn(ctx, params, optFns...)
+}
+
 // testInstanceStore creates an InstanceStore pre-populated with test data.
 func testInstanceStore() *InstanceStore {
 	return &InstanceStore{
@@ -43,11 +93,15 @@ func testInstanceStore() *InstanceStore {
 	}
 }
 
-// drainScrapes collects all results from a closed ScrapeResult channel.
+// drainScrapes collects the price results from a closed ScrapeResult
+// channel, leaving out skipped items and failed requests.
 func drainScrapes(t *testing.T, ch <-chan provider.ScrapeResult) []provider.ScrapeResult {
 	t.Helper()
 	var results []provider.ScrapeResult
 	for r := range ch {
+		if r.Name == provider.SkippedName || r.Name == provider.FailedName {
+			continue
+		}
 		results = append(results, r)
 	}
 	return results
@@ -0,0 +1,51 @@
+package aws
+
+import (
+	"context"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// GetInstanceTypeOfferings sends one instance_type_offered result per instance
+// type and availability zone the type is offered in, so a missing price can be
+// told apart from a type that isn't available in the zone.
+func GetInstanceTypeOfferings(ctx context.Context, region string, client ec2.DescribeInstanceTypeOfferingsAPIClient, filter InstanceFilter, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	input := &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: ec2Types.LocationTypeAvailabilityZone,
+		MaxResults:   awssdk.Int32(1000),
+	}
+	if len(filter.Families) > 0 {
+		input.Filters = append(input.Filters, ec2Types.Filter{Name: awssdk.String("instance-type"), Values: spotInstanceTypePatterns(filter.Families)})
+	}
+	if len(filter.InstanceTypes) > 0 {
+		input.Filters = append(input.Filters, ec2Types.Filter{Name: awssdk.String("instance-type"), Values: filter.InstanceTypes})
+	}
+
+	pag := ec2.NewDescribeInstanceTypeOfferingsPaginator(client, input)
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error while fetching instance type offerings [region=%s]", region)
+			return
+		}
+		for _, offering := range page.InstanceTypeOfferings {
+			instanceType := string(offering.InstanceType)
+			az := awssdk.ToString(offering.Location)
+			if !filter.MatchZone(az) || !filter.Match(instances, instanceType) {
+				continue
+			}
+			scrapes <- provider.ScrapeResult{
+				Name:             "instance_type_offered",
+				Value:            1,
+				Region:           region,
+				AvailabilityZone: az,
+				InstanceType:     instanceType,
+			}
+		}
+	}
+}
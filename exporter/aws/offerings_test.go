@@ -0,0 +1,74 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetInstanceTypeOfferings(t *testing.T) {
+	var input *ec2.DescribeInstanceTypeOfferingsInput
+	client := &mockEC2Client{
+		DescribeInstanceTypeOfferingsFn: func(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+			input = params
+			return &ec2.DescribeInstanceTypeOfferingsOutput{
+				InstanceTypeOfferings: []ec2Types.InstanceTypeOffering{
+					{InstanceType: ec2Types.InstanceTypeM5Large, Location: awssdk.String("us-east-1a"), LocationType: ec2Types.LocationTypeAvailabilityZone},
+					{InstanceType: ec2Types.InstanceTypeM5Large, Location: awssdk.String("us-east-1b"), LocationType: ec2Types.LocationTypeAvailabilityZone},
+					{InstanceType: ec2Types.InstanceTypeC5Large, Location: awssdk.String("us-east-1a"), LocationType: ec2Types.LocationTypeAvailabilityZone},
+				},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	filter := InstanceFilter{
+		Regexes:           []*regexp.Regexp{regexp.MustCompile("^m5")},
+		Families:          []string{"m5"},
+		AvailabilityZones: []string{"us-east-1a"},
+	}
+	GetInstanceTypeOfferings(context.Background(), "us-east-1", client, filter, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if input.LocationType != ec2Types.LocationTypeAvailabilityZone {
+		t.Errorf("expected availability-zone location type, got %s", input.LocationType)
+	}
+	if len(input.Filters) != 1 || input.Filters[0].Values[0] != "m5.*" {
+		t.Errorf("expected instance-type filter m5.*, got %+v", input.Filters)
+	}
+	requireScrapeCount(t, results, 1)
+	r := results[0]
+	if r.Name != "instance_type_offered" || r.InstanceType != "m5.large" || r.AvailabilityZone != "us-east-1a" || r.Value != 1 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetInstanceTypeOfferings_Error(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeInstanceTypeOfferingsFn: func(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+			return nil, errors.New("UnauthorizedOperation")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetInstanceTypeOfferings(context.Background(), "us-east-1", client, InstanceFilter{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+	if errorCount != 1 {
+		t.Errorf("expected errorCount=1, got %d", errorCount)
+	}
+}
@@ -2,25 +2,39 @@ package aws
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	log "github.com/sirupsen/logrus"
 
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/logging"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
+// ondemandLog logs the on-demand and reserved price scrapes, from the bulk
+// files and the Pricing Query API.
+var ondemandLog = logging.New("aws.ondemand")
+
 // BulkPricingURLFormat is the URL template for the AWS public bulk pricing endpoint.
 // %s is replaced with the region code.
 var BulkPricingURLFormat = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonEC2/current/%s/index.json"
 
+// Bulk pricing product families.
+const (
+	productFamilyCompute = "Compute Instance"
+	productFamilyHost    = "Dedicated Host"
+)
+
+// MacHostMinimumAllocationHours is the minimum allocation period of a Mac
+// dedicated host; it's billed for at least this long once allocated.
+const MacHostMinimumAllocationHours = 24
+
 // BulkPricingResponse represents the top-level structure of the AWS bulk pricing JSON.
 type BulkPricingResponse struct {
 	Products map[string]BulkProduct `json:"products"`
@@ -34,126 +48,325 @@ type BulkProduct struct {
 	Attributes    map[string]string `json:"attributes"`
 }
 
-// BulkTerms contains on-demand pricing terms from the bulk pricing JSON.
+// BulkTerms contains on-demand and reserved pricing terms from the bulk pricing JSON.
 type BulkTerms struct {
 	OnDemand map[string]map[string]BulkOfferTerm `json:"OnDemand"`
+	Reserved map[string]map[string]BulkOfferTerm `json:"Reserved"`
 }
 
 // BulkOfferTerm represents a single offer term in the bulk pricing JSON.
+// TermAttributes is only populated for reserved terms.
 type BulkOfferTerm struct {
 	OfferTermCode   string                        `json:"offerTermCode"`
 	PriceDimensions map[string]BulkPriceDimension `json:"priceDimensions"`
+	TermAttributes  BulkTermAttributes            `json:"termAttributes"`
+}
+
+// BulkTermAttributes describes a reserved instance offering.
+type BulkTermAttributes struct {
+	LeaseContractLength string `json:"LeaseContractLength"` // "1yr" or "3yr"
+	OfferingClass       string `json:"OfferingClass"`       // "standard" or "convertible"
+	PurchaseOption      string `json:"PurchaseOption"`      // "No Upfront", "Partial Upfront", "All Upfront"
 }
 
 // BulkPriceDimension represents pricing details in the bulk pricing JSON.
 type BulkPriceDimension struct {
+	Unit         string            `json:"unit"`
+	BeginRange   string            `json:"beginRange"`
 	PricePerUnit map[string]string `json:"pricePerUnit"`
 }
 
+// OnDemandOptions tunes how on-demand prices are exported.
+type OnDemandOptions struct {
+	// PerRegion emits a single series per region with an empty availability_zone
+	// label instead of replicating the identical price across every AZ.
+	PerRegion bool
+	// BurstableUtilization is the assumed average CPU utilization (0-1) used to
+	// export ec2_burstable_effective for t-family types; 0 disables the metric.
+	BurstableUtilization float64
+	// Reserved additionally exports reserved instance prices from the Reserved
+	// terms of the same bulk pricing file, labelled by offering class and type.
+	Reserved bool
+	// SkipOnDemand suppresses the on-demand series, e.g. when only reserved
+	// prices were requested.
+	SkipOnDemand bool
+	// MacHosts additionally exports mac1/mac2 dedicated host prices
+	// (ec2_mac_host and ec2_mac_host_minimum_commitment). Bulk backend only.
+	MacHosts bool
+	// LocalStorage additionally exports ec2_local_storage, the price per GiB of
+	// instance store derived from Linux on-demand prices. Bulk backend only.
+	LocalStorage bool
+	// PageSize is the MaxResults of each Pricing API request, up to
+	// MaxPricingResultsPerPage; 0 uses MaxResultsPerPage. API backend only.
+	PageSize int32
+}
+
 // GetOnDemandPricing fetches on-demand prices from the AWS public bulk pricing
-// URL for a region and sends results to scrapes. No AWS credentials are required.
-// If ec2Client is nil, the region name is used as the sole availability zone.
+// offer file of a region (resolved through RegionIndexURL) and sends results to
+// scrapes. No AWS credentials are required.
+// If ec2Client is nil, the region name is used as the sole availability zone;
+// otherwise zones outside the filter's allowlist are dropped.
 // If httpClient is nil, http.DefaultClient is used.
-func GetOnDemandPricing(ctx context.Context, region string, ec2Client EC2DescribeAZsAPI, httpClient *http.Client, operatingSystems []string, instanceRegexes []*regexp.Regexp, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
-	var azs []string
-	if ec2Client != nil {
-		var err error
-		azs, err = GetAZs(ctx, region, ec2Client)
-		if err != nil {
-			log.WithError(err).Warnf("could not fetch AZs for region %s, falling back to region-level granularity", region)
-			azs = []string{region}
-		}
-	} else {
-		azs = []string{region}
+func GetOnDemandPricing(ctx context.Context, region string, ec2Client EC2DescribeAZsAPI, httpClient *http.Client, operatingSystems []string, filter InstanceFilter, opts OnDemandOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	azs := onDemandZones(ctx, region, ec2Client, filter, opts, errorCount, scrapes)
+	if len(azs) == 0 {
+		return
 	}
 
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
 
-	url := fmt.Sprintf(BulkPricingURLFormat, region)
+	osSet := make(map[string]bool, len(operatingSystems))
+	for _, os := range operatingSystems {
+		osSet[os] = true
+	}
+	matched := func(attrs map[string]string) bool {
+		if !osSet[attrs["operatingSystem"]] {
+			return false
+		}
+		if reason := filter.Reject(instances, attrs["instanceType"]); reason != "" {
+			ondemandLog.SampledDebugf("Skipping instance type: %s", attrs["instanceType"])
+			scrapes <- provider.Skipped("aws", region, reason)
+			return false
+		}
+		return true
+	}
+	keep := func(product BulkProduct) bool {
+		attrs := product.Attributes
+		if product.ProductFamily == productFamilyHost {
+			return opts.MacHosts && isMacHost(attrs) && filter.Match(instances, hostInstanceType(attrs))
+		}
+		if attrs["capacitystatus"] != "Used" || attrs["tenancy"] != "Shared" || attrs["preInstalledSw"] != "NA" {
+			return false
+		}
+		// Local storage prices compare against types outside the filter.
+		if opts.LocalStorage && attrs["operatingSystem"] == "Linux" {
+			return true
+		}
+		return matched(attrs)
+	}
+
+	url := bulkPricingURL(ctx, httpClient, region)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.WithError(err).Errorf("error creating request for bulk pricing [region=%s]", region)
+		ondemandLog.WithError(err).Errorf("error creating request for bulk pricing [region=%s]", region)
 		atomic.AddUint64(errorCount, 1)
 		return
 	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		log.WithError(err).Errorf("error fetching bulk pricing [region=%s]", region)
-		atomic.AddUint64(errorCount, 1)
+		apiError(ondemandLog, region, err, errorCount, scrapes).Errorf("error fetching bulk pricing [region=%s]", region)
 		return
 	}
 	defer resp.Body.Close() //nolint:errcheck
 
 	if resp.StatusCode != http.StatusOK {
-		log.Errorf("bulk pricing API returned status %d [region=%s]", resp.StatusCode, region)
+		ondemandLog.Errorf("bulk pricing API returned status %d [region=%s]", resp.StatusCode, region)
 		atomic.AddUint64(errorCount, 1)
 		return
 	}
 
-	var bulk BulkPricingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&bulk); err != nil {
-		log.WithError(err).Errorf("error decoding bulk pricing JSON [region=%s]", region)
+	bulk, err := decodeBulkPricing(resp.Body, keep, opts.Reserved)
+	if err != nil {
+		ondemandLog.WithError(err).Errorf("error decoding bulk pricing JSON [region=%s]", region)
 		atomic.AddUint64(errorCount, 1)
 		return
 	}
 
-	osSet := make(map[string]bool, len(operatingSystems))
-	for _, os := range operatingSystems {
-		osSet[os] = true
-	}
-
+	linuxPrices := make(map[string]float64)
 	for sku, product := range bulk.Products {
 		attrs := product.Attributes
+		host := product.ProductFamily == productFamilyHost
 
-		if attrs["capacitystatus"] != "Used" {
-			continue
+		if opts.LocalStorage && !host && attrs["operatingSystem"] == "Linux" {
+			if usdPrice, ok := bulkOnDemandPrice(bulk.Terms, sku); ok {
+				if value, err := strconv.ParseFloat(usdPrice, 64); err == nil {
+					linuxPrices[attrs["instanceType"]] = value
+				}
+			}
+			if !matched(attrs) {
+				continue
+			}
 		}
-		if attrs["tenancy"] != "Shared" {
+
+		if opts.Reserved && !host {
+			sendReservedPricing(region, sku, attrs, bulk.Terms.Reserved[sku], azs, instances, errorCount, scrapes)
+		}
+		if opts.SkipOnDemand && !host {
 			continue
 		}
-		if attrs["preInstalledSw"] != "NA" {
+
+		usdPrice, ok := bulkOnDemandPrice(bulk.Terms, sku)
+		if !ok {
+			scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
 			continue
 		}
-		if !osSet[attrs["operatingSystem"]] {
+
+		value, err := strconv.ParseFloat(usdPrice, 64)
+		if err != nil {
+			ondemandLog.WithError(err).Errorf("error while parsing ondemand price value from API response [region=%s, type=%s]", region, attrs["instanceType"])
+			atomic.AddUint64(errorCount, 1)
+			scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
 			continue
 		}
-		if !provider.IsMatchAny(instanceRegexes, attrs["instanceType"]) {
-			log.Debugf("Skipping instance type: %s", attrs["instanceType"])
+		if host {
+			sendMacHostPricing(region, hostInstanceType(attrs), value, scrapes)
 			continue
 		}
+		sendOnDemandPricing(region, attrs, value, azs, opts, instances, scrapes)
+	}
+	if opts.LocalStorage {
+		sendLocalStoragePricing(region, linuxPrices, filter, instances, scrapes)
+	}
+}
 
-		skuOnDemand := fmt.Sprintf("%s.%s", sku, TermOnDemand)
-		skuOnDemandPerHour := fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)
+// bulkOnDemandPrice returns the USD hourly on-demand price of sku.
+func bulkOnDemandPrice(terms BulkTerms, sku string) (string, bool) {
+	skuOnDemand := fmt.Sprintf("%s.%s", sku, TermOnDemand)
+	offerTerm, ok := terms.OnDemand[sku][skuOnDemand]
+	if !ok {
+		return "", false
+	}
+	dim, ok := offerTerm.PriceDimensions[fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)]
+	if !ok {
+		return "", false
+	}
+	usdPrice, ok := dim.PricePerUnit["USD"]
+	return usdPrice, ok
+}
 
-		skuTerms, ok := bulk.Terms.OnDemand[sku]
-		if !ok {
-			continue
+// isMacHost reports whether a dedicated host product is a Mac host.
+func isMacHost(attrs map[string]string) bool {
+	return strings.HasPrefix(attrs["instanceType"], "mac") && attrs["tenancy"] == "Host"
+}
+
+// hostInstanceType returns the instance type a dedicated host runs. Host
+// products name the family ("mac1"); Mac hosts run a single metal instance.
+func hostInstanceType(attrs map[string]string) string {
+	instanceType := attrs["instanceType"]
+	if !strings.Contains(instanceType, ".") {
+		instanceType += ".metal"
+	}
+	return instanceType
+}
+
+// sendMacHostPricing sends the hourly price of a Mac dedicated host and the
+// cost of its minimum allocation period.
+func sendMacHostPricing(region, instanceType string, value float64, scrapes chan<- provider.ScrapeResult) {
+	ondemandLog.SampledDebugf("Creating new metric: ec2_mac_host{region=%s, instance_type=%s} = %v.", region, instanceType, value)
+	scrapes <- provider.ScrapeResult{
+		Name:         "ec2_mac_host",
+		Value:        value,
+		Region:       region,
+		InstanceType: instanceType,
+	}
+	scrapes <- provider.ScrapeResult{
+		Name:         "ec2_mac_host_minimum_commitment",
+		Value:        value * MacHostMinimumAllocationHours,
+		Region:       region,
+		InstanceType: instanceType,
+	}
+}
+
+// onDemandZones returns the availability zones on-demand prices are replicated to:
+// a single empty zone in per-region mode, the region's AZs narrowed by the
+// filter's allowlist, or the region itself when AZs can't be listed. With an
+// allowlist, AZs that can't be listed are a scrape error and no zones are
+// returned, as the region itself never matches the allowlist.
+func onDemandZones(ctx context.Context, region string, ec2Client EC2DescribeAZsAPI, filter InstanceFilter, opts OnDemandOptions, errorCount *uint64, scrapes chan<- provider.ScrapeResult) []string {
+	if opts.PerRegion {
+		return []string{""}
+	}
+	if ec2Client == nil {
+		return filter.filterZones([]string{region})
+	}
+	azs, err := GetAZs(ctx, region, ec2Client)
+	if err != nil && len(filter.AvailabilityZones) > 0 {
+		apiError(ondemandLog, region, err, errorCount, scrapes).Errorf("could not fetch AZs for region %s to match the availability zone allowlist, skipping on-demand prices", region)
+		return nil
+	}
+	if err != nil {
+		ondemandLog.WithError(apierror.Classify("aws", err)).Warnf("could not fetch AZs for region %s, falling back to region-level granularity", region)
+		return []string{region}
+	}
+	return filter.filterZones(azs)
+}
+
+// sendOnDemandPricing sends the ec2, ec2_memory and ec2_vcpu results of an
+// on-demand product for every availability zone.
+func sendOnDemandPricing(region string, attrs map[string]string, value float64, azs []string, opts OnDemandOptions, instances *InstanceStore, scrapes chan<- provider.ScrapeResult) {
+	ondemandLog.SampledDebugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", region, attrs["instanceType"], attrs["operatingSystem"], value)
+
+	vcpu, memory := instances.GetNormalizedCost(value, attrs["instanceType"])
+	for _, az := range azs {
+		result := provider.ScrapeResult{
+			Name:               "ec2",
+			Value:              value,
+			Region:             region,
+			AvailabilityZone:   az,
+			InstanceType:       attrs["instanceType"],
+			InstanceLifecycle:  "ondemand",
+			OperatingSystem:    attrs["operatingSystem"],
+			ProductDescription: attrs["productDescription"],
+			LicenseModel:       attrs["licenseModel"],
+			Memory:             instances.GetMemory(attrs["instanceType"]),
+			VCpu:               instances.GetVCpu(attrs["instanceType"]),
 		}
-		offerTerm, ok := skuTerms[skuOnDemand]
-		if !ok {
-			continue
+		scrapes <- result
+		if burstable, ok := burstableResult(result, opts.BurstableUtilization, instances); ok {
+			scrapes <- burstable
 		}
-		dim, ok := offerTerm.PriceDimensions[skuOnDemandPerHour]
-		if !ok {
-			continue
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_memory",
+			Value:             memory,
+			Region:            region,
+			AvailabilityZone:  az,
+			InstanceType:      attrs["instanceType"],
+			InstanceLifecycle: "ondemand",
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_vcpu",
+			Value:             vcpu,
+			Region:            region,
+			AvailabilityZone:  az,
+			InstanceType:      attrs["instanceType"],
+			InstanceLifecycle: "ondemand",
 		}
-		usdPrice, ok := dim.PricePerUnit["USD"]
+	}
+}
+
+// sendReservedPricing sends one ec2 result per availability zone for each
+// reserved offering of sku. Upfront fees are amortized over the lease so the
+// value is an effective hourly price comparable with on-demand.
+func sendReservedPricing(region, sku string, attrs map[string]string, terms map[string]BulkOfferTerm, azs []string, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	for _, term := range terms {
+		hours, ok := leaseHours(term.TermAttributes.LeaseContractLength)
 		if !ok {
 			continue
 		}
-
-		value, err := strconv.ParseFloat(usdPrice, 64)
-		if err != nil {
-			log.WithError(err).Errorf("error while parsing ondemand price value from API response [region=%s, type=%s]", region, attrs["instanceType"])
-			atomic.AddUint64(errorCount, 1)
+		var value float64
+		for _, dim := range term.PriceDimensions {
+			price, err := strconv.ParseFloat(dim.PricePerUnit["USD"], 64)
+			if err != nil {
+				ondemandLog.WithError(err).Errorf("error while parsing reserved price value from API response [region=%s, type=%s]", region, attrs["instanceType"])
+				atomic.AddUint64(errorCount, 1)
+				value = -1
+				break
+			}
+			switch dim.Unit {
+			case "Hrs":
+				value += price
+			case "Quantity":
+				value += price / hours
+			}
+		}
+		if value < 0 {
 			continue
 		}
-		log.Debugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", region, attrs["instanceType"], attrs["operatingSystem"], value)
+		ondemandLog.SampledDebugf("Creating new metric: ec2{region=%s, instance_type=%s, offering_class=%s, offering_type=%s} = %v.", region, attrs["instanceType"], term.TermAttributes.OfferingClass, term.TermAttributes.PurchaseOption, value)
 
-		vcpu, memory := instances.GetNormalizedCost(value, attrs["instanceType"])
 		for _, az := range azs {
 			scrapes <- provider.ScrapeResult{
 				Name:               "ec2",
@@ -161,32 +374,31 @@ func GetOnDemandPricing(ctx context.Context, region string, ec2Client EC2Describ
 				Region:             region,
 				AvailabilityZone:   az,
 				InstanceType:       attrs["instanceType"],
-				InstanceLifecycle:  "ondemand",
+				InstanceLifecycle:  "reserved",
 				OperatingSystem:    attrs["operatingSystem"],
 				ProductDescription: attrs["productDescription"],
+				LicenseModel:       attrs["licenseModel"],
+				OfferingClass:      term.TermAttributes.OfferingClass,
+				OfferingType:       term.TermAttributes.PurchaseOption,
+				LeaseLength:        term.TermAttributes.LeaseContractLength,
 				Memory:             instances.GetMemory(attrs["instanceType"]),
 				VCpu:               instances.GetVCpu(attrs["instanceType"]),
 			}
-			scrapes <- provider.ScrapeResult{
-				Name:              "ec2_memory",
-				Value:             memory,
-				Region:            region,
-				AvailabilityZone:  az,
-				InstanceType:      attrs["instanceType"],
-				InstanceLifecycle: "ondemand",
-			}
-			scrapes <- provider.ScrapeResult{
-				Name:              "ec2_vcpu",
-				Value:             vcpu,
-				Region:            region,
-				AvailabilityZone:  az,
-				InstanceType:      attrs["instanceType"],
-				InstanceLifecycle: "ondemand",
-			}
 		}
 	}
 }
 
+// leaseHours returns the number of hours in a reserved lease contract length.
+func leaseHours(length string) (float64, bool) {
+	switch length {
+	case "1yr":
+		return 365 * 24, true
+	case "3yr":
+		return 3 * 365 * 24, true
+	}
+	return 0, false
+}
+
 // GetAZs returns the availability zone names for a region.
 func GetAZs(ctx context.Context, region string, client EC2DescribeAZsAPI) ([]string, error) {
 	tmpazs, err := client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
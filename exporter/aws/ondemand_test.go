@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
@@ -12,6 +13,7 @@ import (
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
@@ -62,9 +64,10 @@ func setupBulkPricingServer(t *testing.T, body string, statusCode int) *httptest
 		w.Write([]byte(body))
 	}))
 	t.Cleanup(ts.Close)
-	orig := BulkPricingURLFormat
+	orig, origIndex := BulkPricingURLFormat, RegionIndexURL
 	BulkPricingURLFormat = ts.URL + "/%s"
-	t.Cleanup(func() { BulkPricingURLFormat = orig })
+	RegionIndexURL = ""
+	t.Cleanup(func() { BulkPricingURLFormat, RegionIndexURL = orig, origIndex })
 	return ts
 }
 
@@ -87,7 +90,7 @@ func TestGetOnDemandPricing_SinglePage(t *testing.T) {
 	var errorCount uint64
 
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -123,6 +126,220 @@ func TestGetOnDemandPricing_SinglePage(t *testing.T) {
 	}
 }
 
+func TestGetOnDemandPricing_AvailabilityZoneAllowlist(t *testing.T) {
+	ec2Client := &mockEC2Client{
+		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+			return &ec2.DescribeAvailabilityZonesOutput{
+				AvailabilityZones: []ec2types.AvailabilityZone{
+					{ZoneName: awssdk.String("us-east-1a")},
+					{ZoneName: awssdk.String("us-east-1b")},
+					{ZoneName: awssdk.String("us-east-1c")},
+				},
+			}, nil
+		},
+	}
+
+	bulkJSON := makeBulkPricingJSON("SKU001", "m5.large", "Linux", "0.096")
+	setupBulkPricingServer(t, bulkJSON, http.StatusOK)
+
+	filter := InstanceFilter{
+		Regexes:           []*regexp.Regexp{regexp.MustCompile(".*")},
+		AvailabilityZones: []string{"us-east-1b", "eu-west-1a"},
+	}
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, filter, OnDemandOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// 1 instance × 1 allowed AZ × 3 metrics = 3 results
+	requireScrapeCount(t, results, 3)
+	for _, r := range results {
+		if r.AvailabilityZone != "us-east-1b" {
+			t.Errorf("expected only AZ us-east-1b, got %q", r.AvailabilityZone)
+		}
+	}
+}
+
+func TestGetOnDemandPricing_AvailabilityZoneAllowlistUnlisted(t *testing.T) {
+	ec2Client := &mockEC2Client{
+		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "UnauthorizedOperation"}
+		},
+	}
+	setupBulkPricingServer(t, makeBulkPricingJSON("SKU001", "m5.large", "Linux", "0.096"), http.StatusOK)
+
+	filter := InstanceFilter{
+		Regexes:           []*regexp.Regexp{regexp.MustCompile(".*")},
+		AvailabilityZones: []string{"us-east-1b"},
+	}
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, filter, OnDemandOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	// The region-level fallback would ignore the allowlist.
+	var failed, prices int
+	for r := range scrapes {
+		switch r.Name {
+		case provider.FailedName:
+			failed++
+		case provider.SkippedName:
+		default:
+			prices++
+		}
+	}
+	if prices != 0 || failed != 1 || errorCount != 1 {
+		t.Errorf("expected no prices and one failure, got %d prices, %d failures, %d errors", prices, failed, errorCount)
+	}
+}
+
+func TestGetOnDemandPricing_WindowsLicenseModels(t *testing.T) {
+	var bulk BulkPricingResponse
+	for _, p := range []struct{ sku, licenseModel, price string }{
+		{"SKU001", "License Included", "0.188"},
+		{"SKU002", "Bring your own license", "0.096"},
+	} {
+		var part BulkPricingResponse
+		if err := json.Unmarshal([]byte(makeBulkPricingJSON(p.sku, "m5.large", "Windows", p.price)), &part); err != nil {
+			t.Fatal(err)
+		}
+		part.Products[p.sku].Attributes["licenseModel"] = p.licenseModel
+		if bulk.Products == nil {
+			bulk = part
+			continue
+		}
+		bulk.Products[p.sku] = part.Products[p.sku]
+		bulk.Terms.OnDemand[p.sku] = part.Terms.OnDemand[p.sku]
+	}
+	b, _ := json.Marshal(bulk)
+	setupBulkPricingServer(t, string(b), http.StatusOK)
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Windows"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	ec2Results := scrapesByName(drainScrapes(t, scrapes), "ec2")
+	if len(ec2Results) != 2 {
+		t.Fatalf("expected 2 ec2 metrics (1 per license model), got %d", len(ec2Results))
+	}
+	prices := map[string]float64{}
+	for _, r := range ec2Results {
+		prices[r.LicenseModel] = r.Value
+	}
+	if prices["License Included"] != 0.188 {
+		t.Errorf("License Included: expected 0.188, got %v", prices["License Included"])
+	}
+	if prices["Bring your own license"] != 0.096 {
+		t.Errorf("Bring your own license: expected 0.096, got %v", prices["Bring your own license"])
+	}
+}
+
+func TestGetOnDemandPricing_Reserved(t *testing.T) {
+	var bulk BulkPricingResponse
+	if err := json.Unmarshal([]byte(makeBulkPricingJSON("SKU001", "m5.large", "Linux", "0.096")), &bulk); err != nil {
+		t.Fatal(err)
+	}
+	bulk.Terms.Reserved = map[string]map[string]BulkOfferTerm{
+		"SKU001": {
+			"SKU001.STD": {
+				PriceDimensions: map[string]BulkPriceDimension{
+					"SKU001.STD.HRS": {Unit: "Hrs", PricePerUnit: map[string]string{"USD": "0.0"}},
+					"SKU001.STD.QTY": {Unit: "Quantity", PricePerUnit: map[string]string{"USD": "525.6"}},
+				},
+				TermAttributes: BulkTermAttributes{LeaseContractLength: "1yr", OfferingClass: "standard", PurchaseOption: "All Upfront"},
+			},
+			"SKU001.CNV": {
+				PriceDimensions: map[string]BulkPriceDimension{
+					"SKU001.CNV.HRS": {Unit: "Hrs", PricePerUnit: map[string]string{"USD": "0.07"}},
+				},
+				TermAttributes: BulkTermAttributes{LeaseContractLength: "1yr", OfferingClass: "convertible", PurchaseOption: "No Upfront"},
+			},
+		},
+	}
+	b, _ := json.Marshal(bulk)
+	setupBulkPricingServer(t, string(b), http.StatusOK)
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{Reserved: true, SkipOnDemand: true}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// 2 reserved offerings × 1 AZ, no on-demand series
+	requireScrapeCount(t, results, 2)
+	prices := map[string]float64{}
+	for _, r := range results {
+		if r.InstanceLifecycle != "reserved" {
+			t.Errorf("expected lifecycle=reserved, got %q", r.InstanceLifecycle)
+		}
+		if r.LeaseLength != "1yr" {
+			t.Errorf("expected lease_contract_length=1yr, got %q", r.LeaseLength)
+		}
+		prices[r.OfferingClass+"/"+r.OfferingType] = r.Value
+	}
+	// 525.6 upfront / 8760 hours = 0.06 per hour
+	if math.Abs(prices["standard/All Upfront"]-0.06) > 1e-9 {
+		t.Errorf("standard/All Upfront: expected 0.06, got %v", prices["standard/All Upfront"])
+	}
+	if prices["convertible/No Upfront"] != 0.07 {
+		t.Errorf("convertible/No Upfront: expected 0.07, got %v", prices["convertible/No Upfront"])
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetOnDemandPricing_MacHosts(t *testing.T) {
+	var bulk BulkPricingResponse
+	if err := json.Unmarshal([]byte(makeBulkPricingJSON("SKU001", "m5.large", "Linux", "0.096")), &bulk); err != nil {
+		t.Fatal(err)
+	}
+	bulk.Products["HOST1"] = BulkProduct{
+		SKU:           "HOST1",
+		ProductFamily: "Dedicated Host",
+		Attributes:    map[string]string{"instanceType": "mac1", "tenancy": "Host"},
+	}
+	bulk.Products["HOST2"] = BulkProduct{
+		SKU:           "HOST2",
+		ProductFamily: "Dedicated Host",
+		Attributes:    map[string]string{"instanceType": "c5", "tenancy": "Host"},
+	}
+	for _, sku := range []string{"HOST1", "HOST2"} {
+		bulk.Terms.OnDemand[sku] = map[string]BulkOfferTerm{
+			sku + "." + TermOnDemand: {
+				PriceDimensions: map[string]BulkPriceDimension{
+					sku + "." + TermOnDemand + "." + TermPerHour: {Unit: "Hrs", PricePerUnit: map[string]string{"USD": "1.083"}},
+				},
+			},
+		}
+	}
+	b, _ := json.Marshal(bulk)
+	setupBulkPricingServer(t, string(b), http.StatusOK)
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile("^mac")}}
+	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Linux"}, filter, OnDemandOptions{MacHosts: true}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// m5.large is filtered out by the regex and c5 hosts aren't Mac hosts.
+	requireScrapeCount(t, results, 2)
+	host := scrapesByName(results, "ec2_mac_host")
+	if len(host) != 1 || host[0].InstanceType != "mac1.metal" || host[0].Value != 1.083 {
+		t.Errorf("unexpected ec2_mac_host results: %+v", host)
+	}
+	commitment := scrapesByName(results, "ec2_mac_host_minimum_commitment")
+	if len(commitment) != 1 || math.Abs(commitment[0].Value-1.083*24) > 1e-9 {
+		t.Errorf("unexpected ec2_mac_host_minimum_commitment results: %+v", commitment)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
 func TestGetOnDemandPricing_HTTPError(t *testing.T) {
 	ec2Client := &mockEC2Client{
 		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
@@ -139,7 +356,7 @@ func TestGetOnDemandPricing_HTTPError(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -171,7 +388,7 @@ func TestGetOnDemandPricing_EmptyResults(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 
 	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
@@ -185,7 +402,7 @@ func TestGetOnDemandPricing_NilEC2Client(t *testing.T) {
 	var errorCount uint64
 
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetOnDemandPricing(context.Background(), "us-east-1", nil, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -198,6 +415,36 @@ func TestGetOnDemandPricing_NilEC2Client(t *testing.T) {
 	}
 }
 
+func TestGetOnDemandPricing_PerRegion(t *testing.T) {
+	azCalls := 0
+	ec2Client := &mockEC2Client{
+		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+			azCalls++
+			return &ec2.DescribeAvailabilityZonesOutput{}, nil
+		},
+	}
+
+	bulkJSON := makeBulkPricingJSON("SKU001", "m5.large", "Linux", "0.096")
+	setupBulkPricingServer(t, bulkJSON, http.StatusOK)
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricing(context.Background(), "us-east-1", ec2Client, nil, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{PerRegion: true}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// 1 instance × 1 region-level series × 3 metrics = 3 results
+	requireScrapeCount(t, results, 3)
+	for _, r := range results {
+		if r.AvailabilityZone != "" {
+			t.Errorf("expected empty AZ for per-region series, got %q", r.AvailabilityZone)
+		}
+	}
+	if azCalls != 0 {
+		t.Errorf("expected no DescribeAvailabilityZones calls in per-region mode, got %d", azCalls)
+	}
+}
+
 func TestGetAZs_Success(t *testing.T) {
 	client := &mockEC2Client{
 		DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
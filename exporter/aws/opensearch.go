@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the OpenSearch Service scrape results.
+const (
+	OpenSearchInstanceMetric = "opensearch_instance"
+	OpenSearchStorageMetric  = "opensearch_storage_gb_month"
+)
+
+// GetOpenSearchPricing fetches the AmazonES offer file of a region and sends
+// the hourly USD price of every OpenSearch Service instance type, including
+// UltraWarm and dedicated master nodes, and the monthly price per GB of every
+// storage media (EBS volume types and UltraWarm managed storage) to scrapes.
+// Serverless capacity isn't exported. No AWS credentials are required. If
+// httpClient is nil, http.DefaultClient is used.
+func GetOpenSearchPricing(ctx context.Context, region string, httpClient *http.Client, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	bulk, err := fetchServiceOffer(ctx, httpClient, "AmazonES", region, func(product BulkProduct) bool {
+		_, ok := openSearchPrice(product)
+		return ok
+	})
+	if err != nil {
+		apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error fetching OpenSearch offer file [region=%s]", region)
+		return
+	}
+	sendServicePrices(region, "OpenSearch", bulk, openSearchPrice, errorCount, scrapes)
+}
+
+// openSearchPrice maps instance products, e.g. "r6g.large.search", and
+// storage products of the AmazonES offer file to their series.
+func openSearchPrice(product BulkProduct) (servicePrice, bool) {
+	attrs := product.Attributes
+	switch {
+	case strings.HasSuffix(product.ProductFamily, "Instance") && attrs["instanceType"] != "":
+		return servicePrice{
+			metric: OpenSearchInstanceMetric,
+			labels: map[string]string{"instance_type": attrs["instanceType"]},
+			unit:   "Hrs",
+		}, true
+	case strings.HasSuffix(product.ProductFamily, "Volume") && attrs["storageMedia"] != "":
+		return servicePrice{
+			metric: OpenSearchStorageMetric,
+			labels: map[string]string{"storage_media": attrs["storageMedia"]},
+			unit:   "GB-Mo",
+		}, true
+	}
+	return servicePrice{}, false
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetOpenSearchPricing(t *testing.T) {
+	product := func(family string, attrs map[string]string) BulkProduct {
+		return BulkProduct{ProductFamily: family, Attributes: attrs}
+	}
+	offer := BulkPricingResponse{
+		Products: map[string]BulkProduct{
+			"R6G":      product("Amazon OpenSearch Service Instance", map[string]string{"instanceType": "r6g.large.search"}),
+			"R6G-MAZ":  product("Amazon OpenSearch Service Instance", map[string]string{"instanceType": "r6g.large.search"}),
+			"UW":       product("Amazon OpenSearch Service Instance", map[string]string{"instanceType": "ultrawarm1.medium.search"}),
+			"GP3":      product("Amazon OpenSearch Service Volume", map[string]string{"storageMedia": "GP3"}),
+			"GP3-IOPS": product("Amazon OpenSearch Service Volume", map[string]string{"storageMedia": "GP3-PIOPS"}),
+			"OCU":      product("Amazon OpenSearch Service Serverless", map[string]string{"usagetype": "USE1-IndexingOCU"}),
+		},
+		Terms: BulkTerms{OnDemand: map[string]map[string]BulkOfferTerm{
+			"R6G":      tieredOffer("Hrs", map[string]string{"0": "0.167"}),
+			"R6G-MAZ":  tieredOffer("Hrs", map[string]string{"0": "0.2"}),
+			"UW":       tieredOffer("Hrs", map[string]string{"0": "0.238"}),
+			"GP3":      tieredOffer("GB-Mo", map[string]string{"0": "0.122"}),
+			"GP3-IOPS": tieredOffer("IOPS-Mo", map[string]string{"0": "0.008"}),
+			"OCU":      tieredOffer("OCU-hours", map[string]string{"0": "0.24"}),
+		}},
+	}
+	paths := setupServiceOfferServer(t, offer)
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	var errorCount uint64
+	GetOpenSearchPricing(context.Background(), "us-east-1", nil, &errorCount, scrapes)
+	close(scrapes)
+
+	got := map[string]float64{}
+	skipped := 0
+	for r := range scrapes {
+		if r.Name == provider.SkippedName {
+			skipped++
+			continue
+		}
+		got[r.Name+"/"+r.Labels["instance_type"]+r.Labels["storage_media"]] = r.Value
+	}
+	want := map[string]float64{
+		OpenSearchInstanceMetric + "/r6g.large.search":         0.167,
+		OpenSearchInstanceMetric + "/ultrawarm1.medium.search": 0.238,
+		OpenSearchStorageMetric + "/GP3":                       0.122,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %g, want %g", k, got[k], v)
+		}
+	}
+	// The IOPS price of a volume product isn't a GB-Mo price.
+	if errorCount != 0 || skipped != 1 {
+		t.Errorf("expected no errors and one skipped product, got %d and %d", errorCount, skipped)
+	}
+	if (*paths)[0] != "/AmazonES/us-east-1" {
+		t.Errorf("unexpected offer file request %v", *paths)
+	}
+}
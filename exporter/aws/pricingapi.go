@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingTypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// On-demand pricing backends.
+const (
+	OnDemandBackendBulk = "bulk"
+	OnDemandBackendAPI  = "api"
+)
+
+// GetOnDemandPricingAPI fetches on-demand prices for a region through the
+// Pricing Query API (pricing:GetProducts) and sends results to scrapes. Unlike
+// GetOnDemandPricing it needs AWS credentials, but only the filtered products
+// are transferred instead of the whole regional bulk file. The operating
+// systems are queried concurrently, and the products of every page are sent as
+// soon as it arrives.
+func GetOnDemandPricingAPI(ctx context.Context, region string, ec2Client EC2DescribeAZsAPI, client PricingAPI, operatingSystems []string, filter InstanceFilter, opts OnDemandOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	azs := onDemandZones(ctx, region, ec2Client, filter, opts, errorCount, scrapes)
+	if len(azs) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, os := range operatingSystems {
+		wg.Add(1)
+		go func(os string) {
+			defer wg.Done()
+			getOnDemandPricingAPI(ctx, region, os, azs, client, filter, opts, instances, errorCount, scrapes)
+		}(os)
+	}
+	wg.Wait()
+}
+
+// getOnDemandPricingAPI fetches the on-demand prices of an operating system
+// in a region through the Pricing Query API and sends results to scrapes.
+func getOnDemandPricingAPI(ctx context.Context, region, os string, azs []string, client PricingAPI, filter InstanceFilter, opts OnDemandOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	pag := pricing.NewGetProductsPaginator(client, &pricing.GetProductsInput{
+		ServiceCode: awssdk.String("AmazonEC2"),
+		MaxResults:  maxResults(opts.PageSize),
+		Filters: []pricingTypes.Filter{
+			termMatch("regionCode", region),
+			termMatch("operatingSystem", os),
+			termMatch("tenancy", "Shared"),
+			termMatch("capacitystatus", "Used"),
+			termMatch("preInstalledSw", "NA"),
+		},
+	})
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			apiError(ondemandLog, region, err, errorCount, scrapes).Errorf("error while fetching products from pricing API [region=%s, os=%s]", region, os)
+			return
+		}
+		for _, raw := range page.PriceList {
+			var product Pricing
+			if err := json.Unmarshal([]byte(raw), &product); err != nil {
+				ondemandLog.WithError(err).Errorf("error decoding pricing API product [region=%s]", region)
+				atomic.AddUint64(errorCount, 1)
+				continue
+			}
+			attrs := product.Product.Attributes
+			if reason := filter.Reject(instances, attrs["instanceType"]); reason != "" {
+				ondemandLog.SampledDebugf("Skipping instance type: %s", attrs["instanceType"])
+				scrapes <- provider.Skipped("aws", region, reason)
+				continue
+			}
+
+			if opts.Reserved {
+				sendReservedPricing(region, product.Product.Sku, attrs, reservedOfferTerms(product.Terms.Reserved), azs, instances, errorCount, scrapes)
+			}
+			if opts.SkipOnDemand {
+				continue
+			}
+
+			usdPrice, ok := onDemandHourlyPrice(product)
+			if !ok {
+				scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
+				continue
+			}
+			value, err := strconv.ParseFloat(usdPrice, 64)
+			if err != nil {
+				ondemandLog.WithError(err).Errorf("error while parsing ondemand price value from API response [region=%s, type=%s]", region, attrs["instanceType"])
+				atomic.AddUint64(errorCount, 1)
+				scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
+				continue
+			}
+			sendOnDemandPricing(region, attrs, value, azs, opts, instances, scrapes)
+		}
+	}
+}
+
+func termMatch(field, value string) pricingTypes.Filter {
+	return pricingTypes.Filter{
+		Type:  pricingTypes.FilterTypeTermMatch,
+		Field: awssdk.String(field),
+		Value: awssdk.String(value),
+	}
+}
+
+// onDemandHourlyPrice returns the USD hourly on-demand price of a Pricing API product.
+func onDemandHourlyPrice(product Pricing) (string, bool) {
+	skuOnDemand := fmt.Sprintf("%s.%s", product.Product.Sku, TermOnDemand)
+	term, ok := product.Terms.OnDemand[skuOnDemand]
+	if !ok {
+		return "", false
+	}
+	dim, ok := term.PriceDimensions[fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)]
+	if !ok {
+		return "", false
+	}
+	usdPrice, ok := dim.PricePerUnit["USD"]
+	return usdPrice, ok
+}
+
+// reservedOfferTerms converts Pricing API reserved terms into the bulk file
+// representation used by sendReservedPricing.
+func reservedOfferTerms(terms map[string]SKU) map[string]BulkOfferTerm {
+	result := make(map[string]BulkOfferTerm, len(terms))
+	for code, term := range terms {
+		dims := make(map[string]BulkPriceDimension, len(term.PriceDimensions))
+		for key, dim := range term.PriceDimensions {
+			dims[key] = BulkPriceDimension{Unit: dim.Unit, PricePerUnit: dim.PricePerUnit}
+		}
+		result[code] = BulkOfferTerm{
+			OfferTermCode:   term.OfferTermCode,
+			PriceDimensions: dims,
+			TermAttributes: BulkTermAttributes{
+				LeaseContractLength: term.TermAttributes["LeaseContractLength"],
+				OfferingClass:       term.TermAttributes["OfferingClass"],
+				PurchaseOption:      term.TermAttributes["PurchaseOption"],
+			},
+		}
+	}
+	return result
+}
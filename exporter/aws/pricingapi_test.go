@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+const testPriceListItem = `{
+	"product": {
+		"productFamily": "Compute Instance",
+		"sku": "SKU001",
+		"attributes": {"instanceType": "m5.large", "operatingSystem": "Linux", "productDescription": "Linux/UNIX", "licenseModel": "No License required"}
+	},
+	"serviceCode": "AmazonEC2",
+	"terms": {
+		"OnDemand": {
+			"SKU001.JRTCKXETXF": {
+				"offerTermCode": "JRTCKXETXF",
+				"sku": "SKU001",
+				"priceDimensions": {
+					"SKU001.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0960000000"}}
+				},
+				"termAttributes": {}
+			}
+		},
+		"Reserved": {
+			"SKU001.STD": {
+				"offerTermCode": "STD",
+				"sku": "SKU001",
+				"priceDimensions": {
+					"SKU001.STD.HRS": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0600000000"}}
+				},
+				"termAttributes": {"LeaseContractLength": "1yr", "OfferingClass": "standard", "PurchaseOption": "No Upfront"}
+			}
+		}
+	}
+}`
+
+func TestGetOnDemandPricingAPI(t *testing.T) {
+	var gotFilters []string
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			for _, f := range params.Filters {
+				gotFilters = append(gotFilters, awssdk.ToString(f.Field)+"="+awssdk.ToString(f.Value))
+			}
+			return &pricing.GetProductsOutput{PriceList: []string{testPriceListItem}}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricingAPI(context.Background(), "us-east-1", nil, client, []string{"Linux"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{Reserved: true}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if !provider.Contains(gotFilters, "regionCode=us-east-1") || !provider.Contains(gotFilters, "operatingSystem=Linux") {
+		t.Errorf("expected region and OS filters, got %v", gotFilters)
+	}
+	// 1 reserved + 3 on-demand (ec2, ec2_memory, ec2_vcpu)
+	requireScrapeCount(t, results, 4)
+	prices := map[string]float64{}
+	for _, r := range scrapesByName(results, "ec2") {
+		prices[r.InstanceLifecycle] = r.Value
+	}
+	if prices["ondemand"] != 0.096 {
+		t.Errorf("ondemand: expected 0.096, got %v", prices["ondemand"])
+	}
+	if prices["reserved"] != 0.06 {
+		t.Errorf("reserved: expected 0.06, got %v", prices["reserved"])
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetOnDemandPricingAPI_APIError(t *testing.T) {
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			return nil, errors.New("AccessDeniedException")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricingAPI(context.Background(), "us-east-1", nil, client, []string{"Linux", "Windows"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+	if errorCount != 2 {
+		t.Errorf("expected errorCount=2 (one per OS), got %d", errorCount)
+	}
+}
+
+func TestGetOnDemandPricingAPI_ConcurrentOperatingSystems(t *testing.T) {
+	// Every OS query waits until all of them are in flight, so the OSes must
+	// be queried concurrently for any to return.
+	var inFlight sync.WaitGroup
+	inFlight.Add(2)
+	all := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(all)
+	}()
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			inFlight.Done()
+			select {
+			case <-all:
+				return &pricing.GetProductsOutput{PriceList: []string{testPriceListItem}}, nil
+			case <-time.After(5 * time.Second):
+				return nil, errors.New("operating systems queried serially")
+			}
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetOnDemandPricingAPI(context.Background(), "us-east-1", nil, client, []string{"Linux", "Windows"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, OnDemandOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	// 3 on-demand results (ec2, ec2_memory, ec2_vcpu) per OS
+	requireScrapeCount(t, drainScrapes(t, scrapes), 6)
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingTypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// ProductQuery selects the on-demand prices of any AWS service from the
+// Pricing Query API.
+type ProductQuery struct {
+	// Metric is the name of the scrape results.
+	Metric      string
+	ServiceCode string
+	// Filters are product attribute values the products must have
+	// (TERM_MATCH), besides the scraped region's regionCode.
+	Filters map[string]string
+	// Labels maps label names to the product attribute they're taken from.
+	Labels map[string]string
+	// Unit restricts prices to the price dimensions with this unit, e.g.
+	// "Hrs" or "GB-Mo" (case-insensitive); empty = any unit.
+	Unit string
+	// PageSize is the MaxResults of each request, up to
+	// MaxPricingResultsPerPage; 0 uses MaxResultsPerPage.
+	PageSize int32
+}
+
+// GetProductPricing fetches the products of q in a region through the Pricing
+// Query API and sends their on-demand USD price to scrapes, labelled as q
+// describes. The price of a tiered product is that of its first tier.
+func GetProductPricing(ctx context.Context, region string, client PricingAPI, q ProductQuery, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	filters := []pricingTypes.Filter{termMatch("regionCode", region)}
+	fields := make([]string, 0, len(q.Filters))
+	for field := range q.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		filters = append(filters, termMatch(field, q.Filters[field]))
+	}
+
+	pag := pricing.NewGetProductsPaginator(client, &pricing.GetProductsInput{
+		ServiceCode: awssdk.String(q.ServiceCode),
+		MaxResults:  maxResults(q.PageSize),
+		Filters:     filters,
+	})
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error while fetching products from pricing API [region=%s, service=%s, metric=%s]", region, q.ServiceCode, q.Metric)
+			return
+		}
+		for _, raw := range page.PriceList {
+			var product Pricing
+			if err := json.Unmarshal([]byte(raw), &product); err != nil {
+				log.WithError(err).Errorf("error decoding pricing API product [region=%s, service=%s]", region, q.ServiceCode)
+				atomic.AddUint64(errorCount, 1)
+				continue
+			}
+			usdPrice, ok := firstTierPrice(product, q.Unit)
+			if !ok {
+				log.Debugf("Skipping product without a matching on-demand price [service=%s, sku=%s]", q.ServiceCode, product.Product.Sku)
+				scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
+				continue
+			}
+			value, err := strconv.ParseFloat(usdPrice, 64)
+			if err != nil {
+				log.WithError(err).Errorf("error while parsing price value from API response [region=%s, service=%s, sku=%s]", region, q.ServiceCode, product.Product.Sku)
+				atomic.AddUint64(errorCount, 1)
+				scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
+				continue
+			}
+			labels := make(map[string]string, len(q.Labels))
+			for label, attr := range q.Labels {
+				labels[label] = product.Product.Attributes[attr]
+			}
+			scrapes <- provider.ScrapeResult{
+				Name:   q.Metric,
+				Value:  value,
+				Region: region,
+				Labels: labels,
+			}
+		}
+	}
+}
+
+// firstTierPrice returns the USD price of the on-demand price dimension with
+// unit (any if empty) and the lowest begin range, the lowest rate code among
+// equal ones.
+func firstTierPrice(product Pricing, unit string) (string, bool) {
+	var price, rateCode string
+	begin, found := 0.0, false
+	for _, term := range product.Terms.OnDemand {
+		for _, dim := range term.PriceDimensions {
+			if unit != "" && !strings.EqualFold(dim.Unit, unit) {
+				continue
+			}
+			usd, ok := dim.PricePerUnit["USD"]
+			if !ok {
+				continue
+			}
+			b, err := strconv.ParseFloat(dim.BeginRange, 64)
+			if err != nil {
+				b = 0
+			}
+			if !found || b < begin || (b == begin && dim.RateCode < rateCode) {
+				price, begin, rateCode, found = usd, b, dim.RateCode, true
+			}
+		}
+	}
+	return price, found
+}
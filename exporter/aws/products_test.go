@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// testTieredProduct is an S3 storage product with two price tiers and a
+// request price.
+const testTieredProduct = `{
+	"product": {"sku": "S3STD", "attributes": {"storageClass": "General Purpose", "volumeType": "Standard"}},
+	"terms": {
+		"OnDemand": {
+			"S3STD.JRTCKXETXF": {
+				"priceDimensions": {
+					"S3STD.JRTCKXETXF.T2": {"unit": "GB-Mo", "beginRange": "51200", "endRange": "512000", "pricePerUnit": {"USD": "0.022"}},
+					"S3STD.JRTCKXETXF.T1": {"unit": "GB-Mo", "beginRange": "0", "endRange": "51200", "pricePerUnit": {"USD": "0.023"}},
+					"S3STD.JRTCKXETXF.REQ": {"unit": "Requests", "beginRange": "0", "endRange": "Inf", "pricePerUnit": {"USD": "0.0000004"}}
+				}
+			}
+		}
+	}
+}`
+
+func TestGetProductPricing(t *testing.T) {
+	var serviceCode string
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			serviceCode = *params.ServiceCode
+			return &pricing.GetProductsOutput{PriceList: []string{testTieredProduct}}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	query := ProductQuery{
+		Metric:      "s3_storage",
+		ServiceCode: "AmazonS3",
+		Labels:      map[string]string{"storage_class": "storageClass", "missing": "noSuchAttribute"},
+		Unit:        "gb-mo",
+	}
+	GetProductPricing(context.Background(), "eu-west-1", client, query, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 1)
+	r := results[0]
+	if serviceCode != "AmazonS3" || r.Name != "s3_storage" || r.Region != "eu-west-1" {
+		t.Errorf("unexpected result %+v for service %s", r, serviceCode)
+	}
+	if r.Value != 0.023 {
+		t.Errorf("expected the first tier's price 0.023, got %v", r.Value)
+	}
+	if r.Labels["storage_class"] != "General Purpose" || r.Labels["missing"] != "" {
+		t.Errorf("unexpected labels %v", r.Labels)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetProductPricing_NoMatchingUnit(t *testing.T) {
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			return &pricing.GetProductsOutput{PriceList: []string{testTieredProduct}}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetProductPricing(context.Background(), "eu-west-1", client, ProductQuery{Metric: "s3", ServiceCode: "AmazonS3", Unit: "Hrs"}, &errorCount, scrapes)
+	close(scrapes)
+
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetProductPricing_APIError(t *testing.T) {
+	client := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			return nil, errors.New("AccessDeniedException")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetProductPricing(context.Background(), "eu-west-1", client, ProductQuery{Metric: "s3", ServiceCode: "AmazonS3"}, &errorCount, scrapes)
+	close(scrapes)
+
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+	if errorCount != 1 {
+		t.Errorf("expected errorCount=1, got %d", errorCount)
+	}
+}
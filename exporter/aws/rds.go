@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the RDS scrape results.
+const (
+	AuroraInstanceMetric   = "rds_aurora_instance"
+	AuroraServerlessMetric = "rds_aurora_serverless_acu_hour"
+)
+
+// Aurora storage configurations, the values of the storage_configuration
+// label.
+const (
+	AuroraStorageStandard    = "standard"
+	AuroraStorageIOOptimized = "io_optimized"
+)
+
+// auroraEngines maps the databaseEngine attribute of Aurora products to the
+// engine names of the RDS API, the values of the engine label.
+var auroraEngines = map[string]string{
+	"Aurora MySQL":      "aurora-mysql",
+	"Aurora PostgreSQL": "aurora-postgresql",
+}
+
+// GetRDSPricing fetches the AmazonRDS offer file of a region and sends the
+// hourly USD price of every Aurora instance class and of an Aurora Serverless
+// v2 capacity unit (ACU) per engine and storage configuration to scrapes. No
+// AWS credentials are required. If httpClient is nil, http.DefaultClient is
+// used.
+func GetRDSPricing(ctx context.Context, region string, httpClient *http.Client, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	bulk, err := fetchServiceOffer(ctx, httpClient, "AmazonRDS", region, func(product BulkProduct) bool {
+		_, ok := auroraPrice(product)
+		return ok
+	})
+	if err != nil {
+		apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error fetching RDS offer file [region=%s]", region)
+		return
+	}
+	sendServicePrices(region, "RDS", bulk, auroraPrice, errorCount, scrapes)
+}
+
+// auroraPrice maps the Aurora instance and Serverless v2 products of the
+// AmazonRDS offer file to their series. Outposts and Local Zone products are
+// left out.
+func auroraPrice(product BulkProduct) (servicePrice, bool) {
+	attrs := product.Attributes
+	engine, ok := auroraEngines[attrs["databaseEngine"]]
+	if !ok || (attrs["locationType"] != "" && attrs["locationType"] != "AWS Region") {
+		return servicePrice{}, false
+	}
+	storage := AuroraStorageStandard
+	if strings.Contains(attrs["usagetype"], "IOOptimized") {
+		storage = AuroraStorageIOOptimized
+	}
+	switch {
+	case product.ProductFamily == "Database Instance" && attrs["instanceType"] != "":
+		return servicePrice{
+			metric: AuroraInstanceMetric,
+			labels: map[string]string{"instance_type": attrs["instanceType"], "engine": engine, "storage_configuration": storage},
+			unit:   "Hrs",
+		}, true
+	case product.ProductFamily == "ServerlessV2":
+		return servicePrice{
+			metric: AuroraServerlessMetric,
+			labels: map[string]string{"engine": engine, "storage_configuration": storage},
+			unit:   "ACU-Hr",
+		}, true
+	}
+	return servicePrice{}, false
+}
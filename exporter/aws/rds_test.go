@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetRDSPricing(t *testing.T) {
+	product := func(family, engine, usageType string, attrs map[string]string) BulkProduct {
+		p := BulkProduct{ProductFamily: family, Attributes: map[string]string{"databaseEngine": engine, "usagetype": usageType, "locationType": "AWS Region"}}
+		for k, v := range attrs {
+			p.Attributes[k] = v
+		}
+		return p
+	}
+	r6g := map[string]string{"instanceType": "db.r6g.large"}
+	offer := BulkPricingResponse{
+		Products: map[string]BulkProduct{
+			"MYSQL":     product("Database Instance", "Aurora MySQL", "InstanceUsage:db.r6g.large", r6g),
+			"MYSQL-IO":  product("Database Instance", "Aurora MySQL", "InstanceUsageIOOptimized:db.r6g.large", r6g),
+			"PG":        product("Database Instance", "Aurora PostgreSQL", "InstanceUsage:db.r6g.large", r6g),
+			"PG-SV2":    product("ServerlessV2", "Aurora PostgreSQL", "Aurora:ServerlessV2Usage", nil),
+			"PG-SV2-IO": product("ServerlessV2", "Aurora PostgreSQL", "Aurora:ServerlessV2IOOptimizedUsage", nil),
+			"RDS-PG":    product("Database Instance", "PostgreSQL", "InstanceUsage:db.r6g.large", r6g),
+			"OUTPOSTS":  product("Database Instance", "Aurora MySQL", "InstanceUsage:db.r6g.large", map[string]string{"instanceType": "db.r6g.large", "locationType": "AWS Outposts"}),
+		},
+		Terms: BulkTerms{OnDemand: map[string]map[string]BulkOfferTerm{
+			"MYSQL":     tieredOffer("Hrs", map[string]string{"0": "0.26"}),
+			"MYSQL-IO":  tieredOffer("Hrs", map[string]string{"0": "0.338"}),
+			"PG":        tieredOffer("Hrs", map[string]string{"0": "0.26"}),
+			"PG-SV2":    tieredOffer("ACU-Hr", map[string]string{"0": "0.12"}),
+			"PG-SV2-IO": tieredOffer("ACU-Hr", map[string]string{"0": "0.156"}),
+			"RDS-PG":    tieredOffer("Hrs", map[string]string{"0": "0.225"}),
+			"OUTPOSTS":  tieredOffer("Hrs", map[string]string{"0": "0.5"}),
+		}},
+	}
+	paths := setupServiceOfferServer(t, offer)
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	var errorCount uint64
+	GetRDSPricing(context.Background(), "us-east-1", nil, &errorCount, scrapes)
+	close(scrapes)
+
+	got := map[string]float64{}
+	for _, r := range drainScrapes(t, scrapes) {
+		got[r.Name+"/"+r.Labels["engine"]+"/"+r.Labels["storage_configuration"]+"/"+r.Labels["instance_type"]] = r.Value
+	}
+	want := map[string]float64{
+		AuroraInstanceMetric + "/aurora-mysql/standard/db.r6g.large":      0.26,
+		AuroraInstanceMetric + "/aurora-mysql/io_optimized/db.r6g.large":  0.338,
+		AuroraInstanceMetric + "/aurora-postgresql/standard/db.r6g.large": 0.26,
+		AuroraServerlessMetric + "/aurora-postgresql/standard/":           0.12,
+		AuroraServerlessMetric + "/aurora-postgresql/io_optimized/":       0.156,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %g, want %g", k, got[k], v)
+		}
+	}
+	if errorCount != 0 || (*paths)[0] != "/AmazonRDS/us-east-1" {
+		t.Errorf("unexpected errors %d or offer file requests %v", errorCount, *paths)
+	}
+}
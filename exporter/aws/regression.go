@@ -0,0 +1,44 @@
+package aws
+
+// ResourceRateFit fits per-vCPU and per-GB-memory hourly rates to a set of
+// instance prices by least squares (price ≈ vcpuRate*vCPU + memoryRate*GiB, no
+// intercept). The ratio of the two rates can replace the fixed CpuMemRelation
+// so the normalized metrics follow the provider's own price matrix.
+type ResourceRateFit struct {
+	n                  int
+	vv, vm, mm, vp, mp float64
+}
+
+// Add records one instance type's price.
+func (f *ResourceRateFit) Add(vcpu, memoryGiB, price float64) {
+	f.n++
+	f.vv += vcpu * vcpu
+	f.vm += vcpu * memoryGiB
+	f.mm += memoryGiB * memoryGiB
+	f.vp += vcpu * price
+	f.mp += memoryGiB * price
+}
+
+// Len returns the number of recorded samples.
+func (f *ResourceRateFit) Len() int {
+	return f.n
+}
+
+// Rates solves the normal equations. ok is false when there are fewer than two
+// samples, vCPU and memory are collinear (every type has the same GiB per
+// vCPU), or either rate comes out non-positive.
+func (f *ResourceRateFit) Rates() (vcpuRate, memoryRate float64, ok bool) {
+	if f.n < 2 {
+		return 0, 0, false
+	}
+	det := f.vv*f.mm - f.vm*f.vm
+	if det <= 1e-9*f.vv*f.mm {
+		return 0, 0, false
+	}
+	vcpuRate = (f.vp*f.mm - f.mp*f.vm) / det
+	memoryRate = (f.mp*f.vv - f.vp*f.vm) / det
+	if vcpuRate <= 0 || memoryRate <= 0 {
+		return 0, 0, false
+	}
+	return vcpuRate, memoryRate, true
+}
@@ -0,0 +1,34 @@
+package aws
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResourceRateFit(t *testing.T) {
+	var fit ResourceRateFit
+	// Prices built from exact rates: 0.03/vCPU, 0.004/GiB.
+	for _, s := range []struct{ vcpu, mem float64 }{{2, 4}, {2, 8}, {2, 16}, {4, 16}, {8, 64}} {
+		fit.Add(s.vcpu, s.mem, 0.03*s.vcpu+0.004*s.mem)
+	}
+	vcpu, memory, ok := fit.Rates()
+	if !ok {
+		t.Fatal("expected a fit")
+	}
+	if math.Abs(vcpu-0.03) > 1e-9 || math.Abs(memory-0.004) > 1e-9 {
+		t.Errorf("expected 0.03/0.004, got %v/%v", vcpu, memory)
+	}
+}
+
+func TestResourceRateFit_Degenerate(t *testing.T) {
+	var fit ResourceRateFit
+	if _, _, ok := fit.Rates(); ok {
+		t.Error("expected no fit without samples")
+	}
+	// Every type has 4 GiB per vCPU: vCPU and memory can't be told apart.
+	fit.Add(2, 8, 0.096)
+	fit.Add(4, 16, 0.192)
+	if _, _, ok := fit.Rates(); ok {
+		t.Error("expected no fit for collinear samples")
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
@@ -23,27 +25,73 @@ type savingPlanProperties struct {
 	Tenancy            string
 }
 
+// MaxSavingPlanResultsPerPage is the largest page size accepted by
+// DescribeSavingsPlansOfferingRates.
+const MaxSavingPlanResultsPerPage int32 = 1000
+
+// SavingPlanOptions tunes savings plan pagination.
+type SavingPlanOptions struct {
+	// PageSize is the MaxResults of each request; 0 uses MaxResultsPerPage.
+	PageSize int32
+	// PageDelay is waited between page requests to stay under API throttles.
+	PageDelay time.Duration
+}
+
+// SavingPlanTypeSageMaker is the savings plan type covering SageMaker ML
+// instances, which is priced under the AmazonSageMaker service code.
+const SavingPlanTypeSageMaker = string(savingsplansTypes.SavingsPlanTypeSagemaker)
+
+// SageMakerSavingPlanMetric is the name of the SageMaker savings plan scrape
+// results.
+const SageMakerSavingPlanMetric = "sagemaker_saving_plan"
+
+// sageMakerUsageTypeRE splits the usage type of a SageMaker savings plan rate,
+// e.g. "USE1-Host:ml.m5.large" (no region prefix in us-east-1), into the
+// SageMaker component and the ML instance type.
+var sageMakerUsageTypeRE = regexp.MustCompile(`^(?:[A-Z]+[0-9]+-)?([^:]+):(.+)$`)
+
+// sageMakerComponents maps the usage type components of SageMaker savings
+// plan rates to the values of the component label; unknown components are
+// lowercased.
+var sageMakerComponents = map[string]string{
+	"Host":       "hosting",
+	"Train":      "training",
+	"Notebk":     "notebook",
+	"Processing": "processing",
+	"Tsform":     "batch_transform",
+	"AsyncInf":   "async_inference",
+}
+
 // GetSavingPlanPricing fetches savings plan prices for a region and sends results to scrapes.
-func GetSavingPlanPricing(ctx context.Context, region string, client SavingsPlansAPI, savingPlanTypes []string, productDescriptions []string, instanceRegexes []*regexp.Regexp, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
-	params := &savingsplans.DescribeSavingsPlansOfferingRatesInput{
-		MaxResults:       *awssdk.Int32(MaxResultsPerPage),
-		SavingsPlanTypes: convertSavingsPlanType(savingPlanTypes),
-		ServiceCodes:     []savingsplansTypes.SavingsPlanRateServiceCode{"AmazonEC2"},
-		Filters: []savingsplansTypes.SavingsPlanOfferingRateFilterElement{
-			{
-				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeRegion,
-				Values: []string{region},
-			},
-			{
-				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeTenancy,
-				Values: []string{"shared"},
-			},
-			{
-				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeProductDescription,
-				Values: productDescriptions,
-			},
-		},
+// EC2 instance rates are fetched for every type but SavingPlanTypeSageMaker, whose
+// ML instance rates are fetched separately (see getSageMakerSavingPlanPricing).
+// Pagination stops early when ctx is done; rates fetched so far are still exported.
+func GetSavingPlanPricing(ctx context.Context, region string, client SavingsPlansAPI, savingPlanTypes []string, productDescriptions []string, filter InstanceFilter, opts SavingPlanOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	ec2Types := make([]string, 0, len(savingPlanTypes))
+	sageMaker := false
+	for _, t := range savingPlanTypes {
+		if t == SavingPlanTypeSageMaker {
+			sageMaker = true
+			continue
+		}
+		ec2Types = append(ec2Types, t)
 	}
+	if len(ec2Types) > 0 {
+		getEC2SavingPlanPricing(ctx, region, client, ec2Types, productDescriptions, filter, opts, instances, errorCount, scrapes)
+	}
+	if sageMaker {
+		getSageMakerSavingPlanPricing(ctx, region, client, opts, errorCount, scrapes)
+	}
+}
+
+// describeSavingPlanRates fetches every page of savings plan rates matching
+// params. On errors, the rates fetched so far are returned.
+func describeSavingPlanRates(ctx context.Context, region string, client SavingsPlansAPI, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, opts SavingPlanOptions, errorCount *uint64, scrapes chan<- provider.ScrapeResult) []savingsplansTypes.SavingsPlanOfferingRate {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = MaxResultsPerPage
+	}
+	params.MaxResults = pageSize
 
 	savingPlanList := make([]savingsplansTypes.SavingsPlanOfferingRate, 0)
 
@@ -51,8 +99,7 @@ func GetSavingPlanPricing(ctx context.Context, region string, client SavingsPlan
 		resp, err := client.DescribeSavingsPlansOfferingRates(ctx, params)
 
 		if err != nil {
-			log.WithError(err).Errorf("error while fetching saving plans [region=%s]", region)
-			atomic.AddUint64(errorCount, 1)
+			apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error while fetching saving plans [region=%s]", region)
 			break // Bug fix: don't access nil resp fields after error
 		}
 
@@ -64,24 +111,64 @@ func GetSavingPlanPricing(ctx context.Context, region string, client SavingsPlan
 		}
 
 		params.NextToken = resp.NextToken
+
+		if err := sleepContext(ctx, opts.PageDelay); err != nil {
+			log.WithError(err).Errorf("saving plans pagination interrupted [region=%s]", region)
+			atomic.AddUint64(errorCount, 1)
+			break
+		}
+	}
+	return savingPlanList
+}
+
+// getEC2SavingPlanPricing fetches the EC2 instance rates of the savings plan types.
+func getEC2SavingPlanPricing(ctx context.Context, region string, client SavingsPlansAPI, savingPlanTypes []string, productDescriptions []string, filter InstanceFilter, opts SavingPlanOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	params := &savingsplans.DescribeSavingsPlansOfferingRatesInput{
+		SavingsPlanTypes: convertSavingsPlanType(savingPlanTypes),
+		ServiceCodes:     []savingsplansTypes.SavingsPlanRateServiceCode{"AmazonEC2"},
+		Filters: []savingsplansTypes.SavingsPlanOfferingRateFilterElement{
+			{
+				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeRegion,
+				Values: []string{region},
+			},
+			{
+				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeTenancy,
+				Values: []string{"shared"},
+			},
+			{
+				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeProductDescription,
+				Values: productDescriptions,
+			},
+		},
 	}
+	if len(filter.Families) > 0 {
+		params.Filters = append(params.Filters, savingsplansTypes.SavingsPlanOfferingRateFilterElement{
+			Name:   savingsplansTypes.SavingsPlanRateFilterAttributeInstanceFamily,
+			Values: filter.Families,
+		})
+	}
+
+	savingPlanList := describeSavingPlanRates(ctx, region, client, params, opts, errorCount, scrapes)
 
 	for _, plan := range savingPlanList {
 		planProperties := convertPropertiesToStruct(plan.Properties)
 
-		if !provider.IsMatchAny(instanceRegexes, planProperties.InstanceType) {
+		if reason := filter.Reject(instances, planProperties.InstanceType); reason != "" {
 			log.Debugf("Skipping instance type: %s", planProperties.InstanceType)
+			scrapes <- provider.Skipped("aws", region, reason)
 			continue
 		}
 
 		if plan.Rate == nil {
 			log.Warnf("nil Rate for saving plan [region=%s, type=%s], skipping", region, planProperties.InstanceType)
+			scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
 			continue
 		}
 		value, err := strconv.ParseFloat(*plan.Rate, 64)
 		if err != nil {
 			log.WithError(err).Errorf("error while parsing saving plan price value from API response [region=%s, type=%s]", region, planProperties.InstanceType)
 			atomic.AddUint64(errorCount, 1)
+			scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
 			continue
 		}
 		log.Debugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", region, planProperties.InstanceType, planProperties.ProductDescription, value)
@@ -127,7 +214,116 @@ func GetSavingPlanPricing(ctx context.Context, region string, client SavingsPlan
 			SavingPlanDuration: years,
 			SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
 		}
+		if upfront, ok := SavingPlanUpfront(value, plan.SavingsPlanOffering.PaymentOption, years); ok {
+			scrapes <- provider.ScrapeResult{
+				Name:               "ec2_saving_plan_upfront",
+				Value:              upfront,
+				Region:             region,
+				InstanceType:       planProperties.InstanceType,
+				ProductDescription: planProperties.ProductDescription,
+				SavingPlanOption:   string(plan.SavingsPlanOffering.PaymentOption),
+				SavingPlanDuration: years,
+				SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
+			}
+		}
+	}
+}
+
+// getSageMakerSavingPlanPricing fetches the SageMaker ML instance rates of
+// SageMaker savings plans and sends them to scrapes, labelled with the
+// instance type and the SageMaker component (hosting, training, notebook...)
+// it applies to. The EC2 instance filters and product descriptions don't
+// apply to ML instances.
+func getSageMakerSavingPlanPricing(ctx context.Context, region string, client SavingsPlansAPI, opts SavingPlanOptions, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	params := &savingsplans.DescribeSavingsPlansOfferingRatesInput{
+		SavingsPlanTypes: []savingsplansTypes.SavingsPlanType{savingsplansTypes.SavingsPlanTypeSagemaker},
+		ServiceCodes:     []savingsplansTypes.SavingsPlanRateServiceCode{savingsplansTypes.SavingsPlanRateServiceCodeSagemaker},
+		Filters: []savingsplansTypes.SavingsPlanOfferingRateFilterElement{
+			{
+				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeRegion,
+				Values: []string{region},
+			},
+		},
+	}
+
+	for _, plan := range describeSavingPlanRates(ctx, region, client, params, opts, errorCount, scrapes) {
+		usageType := awssdk.ToString(plan.UsageType)
+		m := sageMakerUsageTypeRE.FindStringSubmatch(usageType)
+		if m == nil {
+			log.Debugf("Skipping SageMaker saving plan rate of usage type %q [region=%s]", usageType, region)
+			continue
+		}
+		instanceType := convertPropertiesToStruct(plan.Properties).InstanceType
+		if instanceType == "" {
+			instanceType = m[2]
+		}
+		component, ok := sageMakerComponents[m[1]]
+		if !ok {
+			component = strings.ToLower(m[1])
+		}
+
+		if plan.Rate == nil || plan.SavingsPlanOffering == nil {
+			log.Warnf("nil Rate for SageMaker saving plan [region=%s, type=%s], skipping", region, instanceType)
+			scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
+			continue
+		}
+		value, err := strconv.ParseFloat(*plan.Rate, 64)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing SageMaker saving plan price value from API response [region=%s, type=%s]", region, instanceType)
+			atomic.AddUint64(errorCount, 1)
+			scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
+			continue
+		}
+		years, err := SecondsToYears(plan.SavingsPlanOffering.DurationSeconds)
+		if err != nil {
+			log.WithError(err).Errorf("error converting duration [region=%s, type=%s]", region, instanceType)
+			atomic.AddUint64(errorCount, 1)
+			continue
+		}
+
+		scrapes <- provider.ScrapeResult{
+			Name:               SageMakerSavingPlanMetric,
+			Value:              value,
+			Region:             region,
+			InstanceType:       instanceType,
+			SavingPlanOption:   string(plan.SavingsPlanOffering.PaymentOption),
+			SavingPlanDuration: years,
+			SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
+			Labels:             map[string]string{"component": component},
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx.Err() in the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SavingPlanUpfront returns the upfront payment that covers one instance at the
+// given hourly rate for the whole term. All Upfront plans prepay the full
+// commitment; Partial Upfront plans are assumed to prepay the 50% minimum.
+// ok is false for No Upfront plans.
+func SavingPlanUpfront(rate float64, option savingsplansTypes.SavingsPlanPaymentOption, years int) (upfront float64, ok bool) {
+	const hoursPerYear = 365 * 24
+
+	total := rate * float64(years*hoursPerYear)
+	switch option {
+	case savingsplansTypes.SavingsPlanPaymentOptionAllUpfront:
+		return total, true
+	case savingsplansTypes.SavingsPlanPaymentOptionPartialUpfront:
+		return total / 2, true
 	}
+	return 0, false
 }
 
 func convertSavingsPlanType(spt []string) []savingsplansTypes.SavingsPlanType {
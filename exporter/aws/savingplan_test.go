@@ -3,8 +3,10 @@ package aws
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"testing"
+	"time"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
@@ -53,7 +55,7 @@ func TestGetSavingPlanPricing_NilNextToken(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -95,7 +97,7 @@ func TestGetSavingPlanPricing_MultiplePages(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -115,7 +117,7 @@ func TestGetSavingPlanPricing_APIError(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -125,6 +127,220 @@ func TestGetSavingPlanPricing_APIError(t *testing.T) {
 	}
 }
 
+func TestGetSavingPlanPricing_FamilyFilterPushedToAPI(t *testing.T) {
+	var gotFamilies []string
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			for _, f := range params.Filters {
+				if f.Name == savingsplansTypes.SavingsPlanRateFilterAttributeInstanceFamily {
+					gotFamilies = f.Values
+				}
+			}
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{}, nil
+		},
+	}
+
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}, Families: []string{"m5"}}
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, filter, SavingPlanOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	if len(gotFamilies) != 1 || gotFamilies[0] != "m5" {
+		t.Errorf("expected instanceFamily filter [m5], got %v", gotFamilies)
+	}
+}
+
+func TestGetSavingPlanPricing_UpfrontMetric(t *testing.T) {
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			allUpfront := makeSavingsPlanRate("m5.large", "0.03", 31536000)
+			allUpfront.SavingsPlanOffering.PaymentOption = savingsplansTypes.SavingsPlanPaymentOptionAllUpfront
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{
+				SearchResults: []savingsplansTypes.SavingsPlanOfferingRate{
+					allUpfront,
+					makeSavingsPlanRate("m5.large", "0.04", 31536000), // No Upfront
+				},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 7) // 2 plans × 3 metrics + 1 upfront
+	upfront := scrapesByName(results, "ec2_saving_plan_upfront")
+	if len(upfront) != 1 {
+		t.Fatalf("expected 1 upfront metric, got %d", len(upfront))
+	}
+	if upfront[0].SavingPlanOption != "All Upfront" {
+		t.Errorf("expected saving_plan_option=All Upfront, got %q", upfront[0].SavingPlanOption)
+	}
+	if math.Abs(upfront[0].Value-262.8) > 1e-9 { // 0.03 × 8760 hours
+		t.Errorf("expected upfront=262.8, got %v", upfront[0].Value)
+	}
+}
+
+func TestGetSavingPlanPricing_SageMaker(t *testing.T) {
+	var calls []*savingsplans.DescribeSavingsPlansOfferingRatesInput
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			calls = append(calls, params)
+			if params.ServiceCodes[0] != savingsplansTypes.SavingsPlanRateServiceCodeSagemaker {
+				return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{
+					SearchResults: []savingsplansTypes.SavingsPlanOfferingRate{makeSavingsPlanRate("m5.large", "0.04", 31536000)},
+				}, nil
+			}
+			hosting := makeSavingsPlanRate("ml.m5.large", "0.08", 94608000) // 3 years
+			hosting.UsageType = awssdk.String("USE1-Host:ml.m5.large")
+			hosting.SavingsPlanOffering.PlanType = savingsplansTypes.SavingsPlanTypeSagemaker
+			studio := makeSavingsPlanRate("ml.t3.medium", "0.03", 31536000)
+			studio.UsageType = awssdk.String("USE1-Studio:ml.t3.medium")
+			studio.SavingsPlanOffering.PlanType = savingsplansTypes.SavingsPlanTypeSagemaker
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{
+				SearchResults: []savingsplansTypes.SavingsPlanOfferingRate{hosting, studio},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	// The instance filter doesn't apply to ML instances.
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`^m5\.`)}}
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute", "SageMaker"}, []string{"Linux/UNIX"}, filter, SavingPlanOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if got := calls[0].SavingsPlanTypes; len(got) != 1 || got[0] != savingsplansTypes.SavingsPlanTypeCompute {
+		t.Errorf("expected EC2 call for [Compute], got %v", got)
+	}
+	if got := calls[1].SavingsPlanTypes; len(got) != 1 || got[0] != savingsplansTypes.SavingsPlanTypeSagemaker {
+		t.Errorf("expected SageMaker call for [SageMaker], got %v", got)
+	}
+	if len(calls[1].Filters) != 1 || calls[1].Filters[0].Name != savingsplansTypes.SavingsPlanRateFilterAttributeRegion {
+		t.Errorf("expected only a region filter for SageMaker, got %v", calls[1].Filters)
+	}
+
+	requireScrapeCount(t, results, 5) // 1 EC2 instance × 3 metrics + 2 SageMaker rates
+	sageMaker := scrapesByName(results, SageMakerSavingPlanMetric)
+	if len(sageMaker) != 2 {
+		t.Fatalf("expected 2 SageMaker metrics, got %d", len(sageMaker))
+	}
+	got := map[string]provider.ScrapeResult{}
+	for _, r := range sageMaker {
+		got[r.Labels["component"]] = r
+	}
+	if r := got["hosting"]; r.InstanceType != "ml.m5.large" || r.Value != 0.08 || r.SavingPlanDuration != 3 || r.SavingPlanType != "SageMaker" {
+		t.Errorf("unexpected hosting result %+v", r)
+	}
+	if r := got["studio"]; r.InstanceType != "ml.t3.medium" || r.Value != 0.03 {
+		t.Errorf("unexpected studio result %+v", r)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetSavingPlanPricing_SageMakerOnly(t *testing.T) {
+	var serviceCodes []savingsplansTypes.SavingsPlanRateServiceCode
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			serviceCodes = append(serviceCodes, params.ServiceCodes...)
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"SageMaker"}, []string{"Linux/UNIX"}, InstanceFilter{}, SavingPlanOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	if len(serviceCodes) != 1 || serviceCodes[0] != savingsplansTypes.SavingsPlanRateServiceCodeSagemaker {
+		t.Errorf("expected only the AmazonSageMaker service code to be queried, got %v", serviceCodes)
+	}
+}
+
+func TestSavingPlanUpfront(t *testing.T) {
+	tests := []struct {
+		option savingsplansTypes.SavingsPlanPaymentOption
+		years  int
+		want   float64
+		wantOk bool
+	}{
+		{savingsplansTypes.SavingsPlanPaymentOptionAllUpfront, 1, 876, true},
+		{savingsplansTypes.SavingsPlanPaymentOptionAllUpfront, 3, 2628, true},
+		{savingsplansTypes.SavingsPlanPaymentOptionPartialUpfront, 1, 438, true},
+		{savingsplansTypes.SavingsPlanPaymentOptionNoUpfront, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%dy", tt.option, tt.years), func(t *testing.T) {
+			got, ok := SavingPlanUpfront(0.1, tt.option, tt.years)
+			if ok != tt.wantOk {
+				t.Fatalf("ok: expected %v, got %v", tt.wantOk, ok)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetSavingPlanPricing_PageSize(t *testing.T) {
+	var gotMaxResults int32
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			gotMaxResults = params.MaxResults
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSavingPlanPricing(context.Background(), "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{PageSize: 500}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	if gotMaxResults != 500 {
+		t.Errorf("expected MaxResults=500, got %d", gotMaxResults)
+	}
+}
+
+func TestGetSavingPlanPricing_ContextCancelledBetweenPages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	callCount := 0
+	client := &mockSavingsPlansClient{
+		DescribeSavingsPlansOfferingRatesFn: func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error) {
+			callCount++
+			cancel() // deadline reached while the first page is in flight
+			return &savingsplans.DescribeSavingsPlansOfferingRatesOutput{
+				SearchResults: []savingsplansTypes.SavingsPlanOfferingRate{
+					makeSavingsPlanRate("m5.large", "0.04", 31536000),
+				},
+				NextToken: awssdk.String("page2"),
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSavingPlanPricing(ctx, "us-east-1", client, []string{"Compute"}, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SavingPlanOptions{PageDelay: time.Hour}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if callCount != 1 {
+		t.Errorf("expected pagination to stop after 1 call, got %d", callCount)
+	}
+	if errorCount != 1 {
+		t.Errorf("expected errorCount=1, got %d", errorCount)
+	}
+	requireScrapeCount(t, results, 3) // rates from the first page are still exported
+}
+
 func TestConvertSavingsPlanType(t *testing.T) {
 	tests := []struct {
 		input []string
@@ -0,0 +1,150 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// ServiceOfferURLFormat is the URL template of the regional offer files of
+// AWS services other than EC2. The first %s is replaced with the service
+// code, e.g. "AmazonDynamoDB", the second with the region code.
+var ServiceOfferURLFormat = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/%s/current/%s/index.json"
+
+// fetchServiceOffer downloads and decodes the regional offer file of a
+// service, keeping the products accepted by keep and their on-demand terms.
+// If httpClient is nil, http.DefaultClient is used.
+func fetchServiceOffer(ctx context.Context, httpClient *http.Client, serviceCode, region string, keep func(BulkProduct) bool) (BulkPricingResponse, error) {
+	return fetchOffer(ctx, httpClient, fmt.Sprintf(ServiceOfferURLFormat, serviceCode, region), keep)
+}
+
+// fetchOffer downloads and decodes the offer file at url, keeping the
+// products accepted by keep and their on-demand terms. If httpClient is nil,
+// http.DefaultClient is used.
+func fetchOffer(ctx context.Context, httpClient *http.Client, url string, keep func(BulkProduct) bool) (BulkPricingResponse, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return BulkPricingResponse{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return BulkPricingResponse{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return BulkPricingResponse{}, fmt.Errorf("offer file returned status %d", resp.StatusCode)
+	}
+	return decodeOfferFile(resp.Body, keep, false)
+}
+
+// servicePrice describes the series a product of a service offer file is
+// exported as.
+type servicePrice struct {
+	metric string
+	labels map[string]string
+	unit   string // unit of the exported price dimension, e.g. "Hrs" (case-insensitive); empty = any
+}
+
+// id identifies the series of p.
+func (p servicePrice) id() string {
+	keys := make([]string, 0, len(p.labels))
+	for k := range p.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(p.metric)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\xff%s=%s", k, p.labels[k])
+	}
+	return b.String()
+}
+
+// sendServicePrices sends the first paid tier USD price of every product of
+// bulk that price maps to a series to scrapes. Products exported as the same
+// series are deduplicated, keeping the lowest price. service names the
+// service in log messages.
+func sendServicePrices(region, service string, bulk BulkPricingResponse, price func(BulkProduct) (servicePrice, bool), errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	type series struct {
+		price servicePrice
+		value float64
+	}
+	exported := make(map[string]series)
+	for sku, product := range bulk.Products {
+		p, ok := price(product)
+		if !ok {
+			continue
+		}
+		value, ok, err := firstPaidTierPrice(bulk.Terms, sku, p.unit)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing %s price [region=%s, sku=%s]", service, region, sku)
+			atomic.AddUint64(errorCount, 1)
+			scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
+			continue
+		}
+		if !ok {
+			scrapes <- provider.Skipped("aws", region, provider.SkipMissingTerms)
+			continue
+		}
+		id := p.id()
+		if prev, found := exported[id]; found && prev.value <= value {
+			continue
+		}
+		exported[id] = series{p, value}
+	}
+	for _, s := range exported {
+		scrapes <- provider.ScrapeResult{
+			Name:   s.price.metric,
+			Value:  s.value,
+			Region: region,
+			Labels: s.price.labels,
+		}
+	}
+}
+
+// firstPaidTierPrice returns the USD price of the on-demand price dimension
+// of sku with unit (any if empty) and the lowest begin range among those that
+// aren't free, skipping free tiers such as the first 25 GB of DynamoDB
+// storage. It's 0 if every tier is free. ok is false if sku has no such USD
+// price, err is set if a price can't be parsed.
+func firstPaidTierPrice(terms BulkTerms, sku, unit string) (price float64, ok bool, err error) {
+	begin, paid := 0.0, false
+	for _, term := range terms.OnDemand[sku] {
+		for _, dim := range term.PriceDimensions {
+			if unit != "" && !strings.EqualFold(dim.Unit, unit) {
+				continue
+			}
+			usd, found := dim.PricePerUnit["USD"]
+			if !found {
+				continue
+			}
+			value, perr := strconv.ParseFloat(usd, 64)
+			if perr != nil {
+				return 0, false, perr
+			}
+			ok = true
+			if value == 0 {
+				continue
+			}
+			b, berr := strconv.ParseFloat(dim.BeginRange, 64)
+			if berr != nil {
+				b = 0
+			}
+			if !paid || b < begin {
+				price, begin, paid = value, b, true
+			}
+		}
+	}
+	return price, ok, nil
+}
@@ -2,76 +2,207 @@ package aws
 
 import (
 	"context"
-	"regexp"
 	"strconv"
 	"sync/atomic"
 	"time"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	log "github.com/sirupsen/logrus"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 
+	"github.com/jz-wilson/cloud-price-exporter/exporter/logging"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
+// spotLog logs the spot price scrapes, from the API and the data feed.
+var spotLog = logging.New("aws.spot")
+
+// Spot aggregation modes.
+const (
+	SpotAggregationNone   = "none"
+	SpotAggregationRegion = "region"
+)
+
+// SpotOptions tunes how spot price history is fetched and exported.
+type SpotOptions struct {
+	// Aggregation collapses per-AZ prices into per-region min/avg/max series
+	// when set to SpotAggregationRegion. Empty or SpotAggregationNone keeps per-AZ series.
+	Aggregation string
+	// BurstableUtilization is the assumed average CPU utilization (0-1) used to
+	// export ec2_burstable_effective for t-family types; 0 disables the metric.
+	BurstableUtilization float64
+	// HistoryWindow moves the DescribeSpotPriceHistory StartTime this far into
+	// the past; 0 only returns the prices in effect now.
+	HistoryWindow time.Duration
+	// PageSize is the MaxResults of each DescribeSpotPriceHistory request, up
+	// to MaxSpotResultsPerPage; 0 uses MaxResultsPerPage.
+	PageSize int32
+}
+
+// spotRecord is a parsed spot price row.
+type spotRecord struct {
+	price ec2types.SpotPrice
+	value float64
+}
+
+// spotAggregate accumulates per-AZ spot prices of one instance type and product description.
+type spotAggregate struct {
+	instanceType       string
+	productDescription string
+	min, max, sum      float64
+	count              int
+}
+
+func (a *spotAggregate) add(value float64) {
+	if a.count == 0 || value < a.min {
+		a.min = value
+	}
+	if a.count == 0 || value > a.max {
+		a.max = value
+	}
+	a.sum += value
+	a.count++
+}
+
 // GetSpotPricing fetches spot prices for a region and sends results to scrapes.
-func GetSpotPricing(ctx context.Context, region string, client ec2.DescribeSpotPriceHistoryAPIClient, productDescriptions []string, instanceRegexes []*regexp.Regexp, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
-	pag := ec2.NewDescribeSpotPriceHistoryPaginator(
-		client,
-		&ec2.DescribeSpotPriceHistoryInput{
-			StartTime:           awssdk.Time(time.Now()),
-			MaxResults:          awssdk.Int32(MaxResultsPerPage),
-			ProductDescriptions: productDescriptions,
+func GetSpotPricing(ctx context.Context, region string, client ec2.DescribeSpotPriceHistoryAPIClient, productDescriptions []string, filter InstanceFilter, opts SpotOptions, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		StartTime:           awssdk.Time(time.Now().Add(-opts.HistoryWindow)),
+		MaxResults:          maxResults(opts.PageSize),
+		ProductDescriptions: productDescriptions,
+	}
+	// Push the family, type and zone filters to the API so unwanted rows are never paginated.
+	if len(filter.Families) > 0 {
+		input.Filters = append(input.Filters, ec2types.Filter{
+			Name:   awssdk.String("instance-type"),
+			Values: spotInstanceTypePatterns(filter.Families),
+		})
+	}
+	if len(filter.InstanceTypes) > 0 {
+		input.Filters = append(input.Filters, ec2types.Filter{
+			Name:   awssdk.String("instance-type"),
+			Values: filter.InstanceTypes,
 		})
+	}
+	if len(filter.AvailabilityZones) > 0 {
+		input.Filters = append(input.Filters, ec2types.Filter{
+			Name:   awssdk.String("availability-zone"),
+			Values: filter.AvailabilityZones,
+		})
+	}
+
+	// Rows are deduplicated to the newest record per (type, AZ, product) before
+	// anything is exported, so the result doesn't depend on pagination order.
+	var latest []spotRecord
+	index := make(map[string]int)
+
+	pag := ec2.NewDescribeSpotPriceHistoryPaginator(client, input)
 	for pag.HasMorePages() {
 		history, err := pag.NextPage(ctx)
 		if err != nil {
-			log.WithError(err).Errorf("error while fetching spot price history [region=%s]", region)
-			atomic.AddUint64(errorCount, 1)
+			apiError(spotLog, region, err, errorCount, scrapes).Errorf("error while fetching spot price history [region=%s]", region)
 			break
 		}
 		for _, price := range history.SpotPriceHistory {
-			if !provider.IsMatchAny(instanceRegexes, string(price.InstanceType)) {
-				log.Debugf("Skipping instance type: %s", price.InstanceType)
+			if reason := filter.Reject(instances, string(price.InstanceType)); reason != "" {
+				spotLog.SampledDebugf("Skipping instance type: %s", price.InstanceType)
+				scrapes <- provider.Skipped("aws", region, reason)
+				continue
+			}
+			if !filter.MatchZone(awssdk.ToString(price.AvailabilityZone)) {
+				scrapes <- provider.Skipped("aws", region, provider.SkipFiltered)
 				continue
 			}
 
 			value, err := strconv.ParseFloat(*price.SpotPrice, 64)
 			if err != nil {
-				log.WithError(err).Errorf("error while parsing spot price value from API response [region=%s, az=%s, type=%s]", region, *price.AvailabilityZone, price.InstanceType)
+				spotLog.WithError(err).Errorf("error while parsing spot price value from API response [region=%s, az=%s, type=%s]", region, *price.AvailabilityZone, price.InstanceType)
 				atomic.AddUint64(errorCount, 1)
+				scrapes <- provider.Skipped("aws", region, provider.SkipUnparsablePrice)
 				continue
 			}
-			log.Debugf("Creating new metric: ec2{region=%s, az=%s, instance_type=%s, product_description=%s} = %v.", region, *price.AvailabilityZone, price.InstanceType, price.ProductDescription, value)
 
-			scrapes <- provider.ScrapeResult{
-				Name:               "ec2",
-				Value:              value,
-				Region:             region,
-				AvailabilityZone:   *price.AvailabilityZone,
-				InstanceType:       string(price.InstanceType),
-				InstanceLifecycle:  "spot",
-				ProductDescription: string(price.ProductDescription),
-				Memory:             instances.GetMemory(string(price.InstanceType)),
-				VCpu:               instances.GetVCpu(string(price.InstanceType)),
+			key := string(price.InstanceType) + "/" + awssdk.ToString(price.AvailabilityZone) + "/" + string(price.ProductDescription)
+			record := spotRecord{price: price, value: value}
+			if i, ok := index[key]; !ok {
+				index[key] = len(latest)
+				latest = append(latest, record)
+			} else if awssdk.ToTime(price.Timestamp).After(awssdk.ToTime(latest[i].price.Timestamp)) {
+				latest[i] = record
 			}
+		}
+	}
 
-			vcpu, memory := instances.GetNormalizedCost(value, string(price.InstanceType))
-			scrapes <- provider.ScrapeResult{
-				Name:              "ec2_memory",
-				Value:             memory,
-				Region:            region,
-				AvailabilityZone:  *price.AvailabilityZone,
-				InstanceType:      string(price.InstanceType),
-				InstanceLifecycle: "spot",
+	aggregate := opts.Aggregation == SpotAggregationRegion
+	aggregates := make(map[string]*spotAggregate)
+
+	for _, record := range latest {
+		price, value := record.price, record.value
+
+		if aggregate {
+			key := string(price.InstanceType) + "/" + string(price.ProductDescription)
+			agg, ok := aggregates[key]
+			if !ok {
+				agg = &spotAggregate{instanceType: string(price.InstanceType), productDescription: string(price.ProductDescription)}
+				aggregates[key] = agg
 			}
+			agg.add(value)
+			continue
+		}
+		spotLog.SampledDebugf("Creating new metric: ec2{region=%s, az=%s, instance_type=%s, product_description=%s} = %v.", region, *price.AvailabilityZone, price.InstanceType, price.ProductDescription, value)
+
+		result := provider.ScrapeResult{
+			Name:               "ec2",
+			Value:              value,
+			Region:             region,
+			AvailabilityZone:   *price.AvailabilityZone,
+			InstanceType:       string(price.InstanceType),
+			InstanceLifecycle:  "spot",
+			ProductDescription: string(price.ProductDescription),
+			Memory:             instances.GetMemory(string(price.InstanceType)),
+			VCpu:               instances.GetVCpu(string(price.InstanceType)),
+		}
+		scrapes <- result
+		if burstable, ok := burstableResult(result, opts.BurstableUtilization, instances); ok {
+			scrapes <- burstable
+		}
+
+		vcpu, memory := instances.GetNormalizedCost(value, string(price.InstanceType))
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_memory",
+			Value:             memory,
+			Region:            region,
+			AvailabilityZone:  *price.AvailabilityZone,
+			InstanceType:      string(price.InstanceType),
+			InstanceLifecycle: "spot",
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_vcpu",
+			Value:             vcpu,
+			Region:            region,
+			AvailabilityZone:  *price.AvailabilityZone,
+			InstanceType:      string(price.InstanceType),
+			InstanceLifecycle: "spot",
+		}
+	}
+
+	for _, agg := range aggregates {
+		for _, stat := range []struct {
+			name  string
+			value float64
+		}{
+			{"min", agg.min},
+			{"avg", agg.sum / float64(agg.count)},
+			{"max", agg.max},
+		} {
 			scrapes <- provider.ScrapeResult{
-				Name:              "ec2_vcpu",
-				Value:             vcpu,
-				Region:            region,
-				AvailabilityZone:  *price.AvailabilityZone,
-				InstanceType:      string(price.InstanceType),
-				InstanceLifecycle: "spot",
+				Name:               "ec2_spot_region",
+				Value:              stat.value,
+				Region:             region,
+				InstanceType:       agg.instanceType,
+				InstanceLifecycle:  "spot",
+				ProductDescription: agg.productDescription,
+				Statistic:          stat.name,
 			}
 		}
 	}
@@ -3,8 +3,10 @@ package aws
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"testing"
+	"time"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -38,7 +40,7 @@ func TestGetSpotPricing_SinglePage(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -102,7 +104,7 @@ func TestGetSpotPricing_MultiplePages(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -112,6 +114,93 @@ func TestGetSpotPricing_MultiplePages(t *testing.T) {
 	}
 }
 
+func TestGetSpotPricing_KeepsLatestPerAZ(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	callCount := 0
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			callCount++
+			// The newer row arrives on the first page, the stale one on the second.
+			if callCount == 1 {
+				return &ec2.DescribeSpotPriceHistoryOutput{
+					SpotPriceHistory: []ec2types.SpotPrice{
+						{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.06"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix, Timestamp: awssdk.Time(newer)},
+					},
+					NextToken: awssdk.String("page2"),
+				}, nil
+			}
+			return &ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []ec2types.SpotPrice{
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.05"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix, Timestamp: awssdk.Time(older)},
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.07"), AvailabilityZone: awssdk.String("us-east-1b"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix, Timestamp: awssdk.Time(older)},
+				},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	ec2Results := scrapesByName(drainScrapes(t, scrapes), "ec2")
+	if len(ec2Results) != 2 {
+		t.Fatalf("expected 2 ec2 metrics (1 per AZ), got %d", len(ec2Results))
+	}
+	for _, r := range ec2Results {
+		want := map[string]float64{"us-east-1a": 0.06, "us-east-1b": 0.07}[r.AvailabilityZone]
+		if r.Value != want {
+			t.Errorf("AZ=%s: expected newest value %v, got %v", r.AvailabilityZone, want, r.Value)
+		}
+	}
+}
+
+func TestGetSpotPricing_HistoryWindow(t *testing.T) {
+	var startTime time.Time
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			startTime = awssdk.ToTime(params.StartTime)
+			return &ec2.DescribeSpotPriceHistoryOutput{}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{HistoryWindow: 6 * time.Hour}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	if age := time.Since(startTime); age < 6*time.Hour || age > 6*time.Hour+time.Minute {
+		t.Errorf("expected StartTime ~6h ago, got %v ago", age)
+	}
+}
+
+func TestGetSpotPricing_PageSize(t *testing.T) {
+	for _, tt := range []struct {
+		pageSize, want int32
+	}{
+		{0, MaxResultsPerPage},
+		{MaxSpotResultsPerPage, MaxSpotResultsPerPage},
+	} {
+		var maxResults int32
+		client := &mockEC2Client{
+			DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+				maxResults = awssdk.ToInt32(params.MaxResults)
+				return &ec2.DescribeSpotPriceHistoryOutput{}, nil
+			},
+		}
+
+		var errorCount uint64
+		scrapes := make(chan provider.ScrapeResult, 100)
+		GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{PageSize: tt.pageSize}, testInstanceStore(), &errorCount, scrapes)
+		close(scrapes)
+
+		if maxResults != tt.want {
+			t.Errorf("PageSize %d: expected MaxResults %d, got %d", tt.pageSize, tt.want, maxResults)
+		}
+	}
+}
+
 func TestGetSpotPricing_APIError(t *testing.T) {
 	client := &mockEC2Client{
 		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
@@ -122,7 +211,7 @@ func TestGetSpotPricing_APIError(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -158,7 +247,7 @@ func TestGetSpotPricing_InstanceRegexFilter(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
 	// Only match m5.* — c5.xlarge must be filtered out
-	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(`^m5\.`)}, instances, &errorCount, scrapes)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`^m5\.`)}}, SpotOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -180,7 +269,7 @@ func TestGetSpotPricing_EmptyResponse(t *testing.T) {
 	instances := testInstanceStore()
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 100)
-	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, []*regexp.Regexp{regexp.MustCompile(".*")}, instances, &errorCount, scrapes)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{}, instances, &errorCount, scrapes)
 	close(scrapes)
 	results := drainScrapes(t, scrapes)
 
@@ -190,6 +279,123 @@ func TestGetSpotPricing_EmptyResponse(t *testing.T) {
 	}
 }
 
+func TestGetSpotPricing_FamilyFilterPushedToAPI(t *testing.T) {
+	var gotInput *ec2.DescribeSpotPriceHistoryInput
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			gotInput = params
+			return &ec2.DescribeSpotPriceHistoryOutput{}, nil
+		},
+	}
+
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}, Families: []string{"m5", "c6g"}}
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, filter, SpotOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	if gotInput == nil || len(gotInput.Filters) != 1 {
+		t.Fatalf("expected 1 API filter, got %+v", gotInput)
+	}
+	if *gotInput.Filters[0].Name != "instance-type" {
+		t.Errorf("expected instance-type filter, got %q", *gotInput.Filters[0].Name)
+	}
+	want := []string{"m5.*", "c6g.*"}
+	for i, v := range want {
+		if gotInput.Filters[0].Values[i] != v {
+			t.Errorf("filter value %d: want %q, got %q", i, v, gotInput.Filters[0].Values[i])
+		}
+	}
+}
+
+func TestGetSpotPricing_AvailabilityZoneAllowlist(t *testing.T) {
+	var gotInput *ec2.DescribeSpotPriceHistoryInput
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			gotInput = params
+			return &ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []ec2types.SpotPrice{
+					{
+						InstanceType:       ec2types.InstanceTypeM5Large,
+						SpotPrice:          awssdk.String("0.05"),
+						AvailabilityZone:   awssdk.String("us-east-1a"),
+						ProductDescription: ec2types.RIProductDescriptionLinuxUnix,
+					},
+					{
+						InstanceType:       ec2types.InstanceTypeM5Large,
+						SpotPrice:          awssdk.String("0.06"),
+						AvailabilityZone:   awssdk.String("us-east-1b"),
+						ProductDescription: ec2types.RIProductDescriptionLinuxUnix,
+					},
+				},
+			}, nil
+		},
+	}
+
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}, AvailabilityZones: []string{"us-east-1a"}}
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, filter, SpotOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	var results []provider.ScrapeResult
+	var filtered int
+	for r := range scrapes {
+		if r.Name == provider.SkippedName && r.Labels["reason"] == provider.SkipFiltered {
+			filtered++
+		} else {
+			results = append(results, r)
+		}
+	}
+
+	if filtered != 1 {
+		t.Errorf("expected the us-east-1b row to be counted as filtered, got %d", filtered)
+	}
+	if len(gotInput.Filters) != 1 || *gotInput.Filters[0].Name != "availability-zone" {
+		t.Fatalf("expected availability-zone API filter, got %+v", gotInput.Filters)
+	}
+	requireScrapeCount(t, results, 3) // rows outside the allowlist are dropped client-side too
+	for _, r := range results {
+		if r.AvailabilityZone != "us-east-1a" {
+			t.Errorf("expected only AZ us-east-1a, got %q", r.AvailabilityZone)
+		}
+	}
+}
+
+func TestGetSpotPricing_RegionAggregation(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			return &ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []ec2types.SpotPrice{
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.03"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.06"), AvailabilityZone: awssdk.String("us-east-1b"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.09"), AvailabilityZone: awssdk.String("us-east-1c"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+				},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, SpotOptions{Aggregation: SpotAggregationRegion}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	// 3 AZ rows collapse into min/avg/max
+	requireScrapeCount(t, results, 3)
+	want := map[string]float64{"min": 0.03, "avg": 0.06, "max": 0.09}
+	for _, r := range results {
+		if r.Name != "ec2_spot_region" {
+			t.Errorf("expected name=ec2_spot_region, got %q", r.Name)
+		}
+		if r.AvailabilityZone != "" {
+			t.Errorf("expected empty AZ for aggregated series, got %q", r.AvailabilityZone)
+		}
+		if math.Abs(r.Value-want[r.Statistic]) > 1e-9 {
+			t.Errorf("statistic %s: expected %v, got %v", r.Statistic, want[r.Statistic], r.Value)
+		}
+	}
+}
+
 // scrapesByName filters results to those with a matching Name field.
 func scrapesByName(results []provider.ScrapeResult, name string) []provider.ScrapeResult {
 	var out []provider.ScrapeResult
@@ -200,3 +406,35 @@ func scrapesByName(results []provider.ScrapeResult, name string) []provider.Scra
 	}
 	return out
 }
+
+func TestGetSpotPricing_ReportsSkippedItems(t *testing.T) {
+	client := &mockEC2Client{
+		DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+			return &ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []ec2types.SpotPrice{
+					{InstanceType: ec2types.InstanceTypeM5Large, SpotPrice: awssdk.String("0.05"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+					{InstanceType: ec2types.InstanceTypeM5Xlarge, SpotPrice: awssdk.String("n/a"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+					{InstanceType: ec2types.InstanceTypeC5Large, SpotPrice: awssdk.String("0.04"), AvailabilityZone: awssdk.String("us-east-1a"), ProductDescription: ec2types.RIProductDescriptionLinuxUnix},
+				},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	GetSpotPricing(context.Background(), "us-east-1", client, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`^m5\.`)}}, SpotOptions{}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	skipped := make(map[string]int)
+	for r := range scrapes {
+		if r.Name == provider.SkippedName {
+			if r.Labels["provider"] != "aws" || r.Region != "us-east-1" {
+				t.Errorf("unexpected skipped item %+v", r)
+			}
+			skipped[r.Labels["reason"]]++
+		}
+	}
+	if skipped[provider.SkipFiltered] != 1 || skipped[provider.SkipUnparsablePrice] != 1 || len(skipped) != 2 {
+		t.Errorf("expected one filtered and one unparsable item, got %v", skipped)
+	}
+}
@@ -0,0 +1,278 @@
+package aws
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Spot price data sources.
+const (
+	SpotSourceAPI  = "api"
+	SpotSourceFeed = "feed"
+)
+
+// SpotFeedConfig locates the account's spot instance data feed in S3.
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-data-feeds.html
+type SpotFeedConfig struct {
+	Bucket string
+	Prefix string
+	Region string // bucket region
+}
+
+// spotFeedRecord is one parsed line of a spot data feed file.
+type spotFeedRecord struct {
+	timestamp          time.Time
+	region             string
+	instanceType       string
+	productDescription string
+	price              float64
+}
+
+// usageTypeRegions maps the UsageType prefix of billing records to region codes.
+// us-east-1 usage types carry no prefix.
+var usageTypeRegions = map[string]string{
+	"":     "us-east-1",
+	"USE1": "us-east-1",
+	"USE2": "us-east-2",
+	"USW1": "us-west-1",
+	"USW2": "us-west-2",
+	"CAN1": "ca-central-1",
+	"SAE1": "sa-east-1",
+	"EUC1": "eu-central-1",
+	"EUC2": "eu-central-2",
+	"EU":   "eu-west-1",
+	"EUW1": "eu-west-1",
+	"EUW2": "eu-west-2",
+	"EUW3": "eu-west-3",
+	"EUN1": "eu-north-1",
+	"EUS1": "eu-south-1",
+	"EUS2": "eu-south-2",
+	"APN1": "ap-northeast-1",
+	"APN2": "ap-northeast-2",
+	"APN3": "ap-northeast-3",
+	"APS1": "ap-southeast-1",
+	"APS2": "ap-southeast-2",
+	"APS3": "ap-south-1",
+	"APS4": "ap-southeast-3",
+	"APS5": "ap-south-2",
+	"APE1": "ap-east-1",
+	"MES1": "me-south-1",
+	"MEC1": "me-central-1",
+	"AFS1": "af-south-1",
+	"ILC1": "il-central-1",
+}
+
+// operationProductDescriptions maps the billing Operation of spot usage to
+// spot product descriptions.
+var operationProductDescriptions = map[string]string{
+	"RunInstances":      "Linux/UNIX",
+	"RunInstances:0002": "Windows",
+	"RunInstances:000g": "SUSE Linux",
+	"RunInstances:0010": "Red Hat Enterprise Linux",
+}
+
+// GetSpotFeedPricing reads the newest hour of the spot data feed from S3 and
+// sends the latest market price per region, instance type and product
+// description to scrapes. The feed only covers instance types the account has
+// run and carries no availability zone, so results have an empty
+// availability_zone label. Feed files span all regions, so this is called once
+// per scrape for every region of interest.
+func GetSpotFeedPricing(ctx context.Context, regions []string, client S3API, feed SpotFeedConfig, productDescriptions []string, filter InstanceFilter, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	keys, err := latestSpotFeedKeys(ctx, client, feed)
+	if err != nil {
+		apiError(spotLog, feed.Region, err, errorCount, scrapes).Errorf("error while listing spot data feed [bucket=%s]", feed.Bucket)
+		return
+	}
+	if len(keys) == 0 {
+		spotLog.Warnf("no spot data feed files found [bucket=%s, prefix=%s]", feed.Bucket, feed.Prefix)
+		return
+	}
+
+	latest := make(map[string]spotFeedRecord)
+	var order []string
+	for _, key := range keys {
+		records, err := readSpotFeedFile(ctx, client, feed.Bucket, key)
+		if err != nil {
+			apiError(spotLog, feed.Region, err, errorCount, scrapes).Errorf("error while reading spot data feed [bucket=%s, key=%s]", feed.Bucket, key)
+			continue
+		}
+		for _, r := range records {
+			k := r.region + "/" + r.instanceType + "/" + r.productDescription
+			prev, ok := latest[k]
+			if !ok {
+				order = append(order, k)
+			}
+			if !ok || r.timestamp.After(prev.timestamp) {
+				latest[k] = r
+			}
+		}
+	}
+
+	for _, k := range order {
+		r := latest[k]
+		if !provider.Contains(regions, r.region) {
+			continue
+		}
+		if !provider.Contains(productDescriptions, r.productDescription) &&
+			!provider.Contains(productDescriptions, r.productDescription+" (Amazon VPC)") {
+			continue
+		}
+		if reason := filter.Reject(instances, r.instanceType); reason != "" {
+			spotLog.SampledDebugf("Skipping instance type: %s", r.instanceType)
+			scrapes <- provider.Skipped("aws", r.region, reason)
+			continue
+		}
+		spotLog.SampledDebugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", r.region, r.instanceType, r.productDescription, r.price)
+
+		vcpu, memory := instances.GetNormalizedCost(r.price, r.instanceType)
+		scrapes <- provider.ScrapeResult{
+			Name:               "ec2",
+			Value:              r.price,
+			Region:             r.region,
+			InstanceType:       r.instanceType,
+			InstanceLifecycle:  "spot",
+			ProductDescription: r.productDescription,
+			Memory:             instances.GetMemory(r.instanceType),
+			VCpu:               instances.GetVCpu(r.instanceType),
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_memory",
+			Value:             memory,
+			Region:            r.region,
+			InstanceType:      r.instanceType,
+			InstanceLifecycle: "spot",
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2_vcpu",
+			Value:             vcpu,
+			Region:            r.region,
+			InstanceType:      r.instanceType,
+			InstanceLifecycle: "spot",
+		}
+	}
+}
+
+// latestSpotFeedKeys returns the keys of the newest hour of feed files. Feed
+// files are named {accountId}.{YYYY}-{MM}-{DD}-{HH}.{n}.{unique}.gz.
+func latestSpotFeedKeys(ctx context.Context, client S3API, feed SpotFeedConfig) ([]string, error) {
+	var newest string
+	var keys []string
+
+	pag := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: awssdk.String(feed.Bucket),
+		Prefix: awssdk.String(feed.Prefix),
+	})
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			key := awssdk.ToString(obj.Key)
+			parts := strings.Split(path.Base(key), ".")
+			if len(parts) != 5 || parts[4] != "gz" {
+				continue
+			}
+			switch hour := parts[1]; {
+			case hour > newest:
+				newest = hour
+				keys = []string{key}
+			case hour == newest:
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func readSpotFeedFile(ctx context.Context, client S3API, bucket, key string) ([]spotFeedRecord, error) {
+	obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: awssdk.String(bucket),
+		Key:    awssdk.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close() //nolint:errcheck
+
+	gz, err := gzip.NewReader(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() //nolint:errcheck
+
+	return parseSpotFeed(gz)
+}
+
+// parseSpotFeed parses a decompressed, tab-separated spot data feed. Column
+// positions are taken from the "#Fields:" header. Lines that aren't spot usage
+// of a known region and operation are skipped.
+func parseSpotFeed(r io.Reader) ([]spotFeedRecord, error) {
+	columns := map[string]int{"Timestamp": 0, "UsageType": 1, "Operation": 2, "MarketPrice": 6}
+	var records []spotFeedRecord
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if header, ok := strings.CutPrefix(line, "#Fields:"); ok {
+			for i, name := range strings.Fields(header) {
+				columns[name] = i
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		field := func(name string) string {
+			if i := columns[name]; i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+
+		prefix, instanceType, ok := strings.Cut(field("UsageType"), "SpotUsage:")
+		if !ok {
+			continue
+		}
+		region, ok := usageTypeRegions[strings.TrimSuffix(prefix, "-")]
+		if !ok {
+			continue
+		}
+		productDescription, ok := operationProductDescriptions[field("Operation")]
+		if !ok {
+			continue
+		}
+		amount, _, _ := strings.Cut(field("MarketPrice"), " ")
+		price, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid market price %q: %w", field("MarketPrice"), err)
+		}
+		timestamp, err := time.Parse("2006-01-02 15:04:05 MST", field("Timestamp"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %w", field("Timestamp"), err)
+		}
+
+		records = append(records, spotFeedRecord{
+			timestamp:          timestamp,
+			region:             region,
+			instanceType:       instanceType,
+			productDescription: productDescription,
+			price:              price,
+		})
+	}
+	return records, scanner.Err()
+}
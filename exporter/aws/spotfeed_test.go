@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+const testSpotFeed = `#Version: 1.0
+#Fields: Timestamp UsageType Operation InstanceID MyBidID MyMaxPrice MarketPrice Charge Version
+2026-01-01 10:00:00 UTC	USE1-SpotUsage:m5.large	RunInstances	i-1	sir-1	0.096 USD	0.030 USD	0.030 USD	1
+2026-01-01 10:30:00 UTC	USE1-SpotUsage:m5.large	RunInstances	i-2	sir-2	0.096 USD	0.035 USD	0.035 USD	1
+2026-01-01 10:00:00 UTC	SpotUsage:m5.xlarge	RunInstances:0002	i-3	sir-3	0.384 USD	0.120 USD	0.120 USD	1
+2026-01-01 10:00:00 UTC	EUW1-SpotUsage:m5.large	RunInstances	i-4	sir-4	0.107 USD	0.040 USD	0.040 USD	1
+2026-01-01 10:00:00 UTC	USE1-BoxUsage:m5.large	RunInstances	i-5	sir-5	0.096 USD	0.030 USD	0.030 USD	1
+`
+
+func gzipString(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseSpotFeed(t *testing.T) {
+	records, err := parseSpotFeed(strings.NewReader(testSpotFeed))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The BoxUsage (on-demand) line is skipped.
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+	r := records[2]
+	if r.region != "us-east-1" || r.instanceType != "m5.xlarge" || r.productDescription != "Windows" || r.price != 0.12 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if records[3].region != "eu-west-1" {
+		t.Errorf("expected region eu-west-1, got %s", records[3].region)
+	}
+}
+
+func TestParseSpotFeed_InvalidPrice(t *testing.T) {
+	feed := "2026-01-01 10:00:00 UTC\tUSE1-SpotUsage:m5.large\tRunInstances\ti-1\tsir-1\t0.096 USD\tn/a\t0\t1\n"
+	if _, err := parseSpotFeed(strings.NewReader(feed)); err == nil {
+		t.Error("expected error for invalid market price, got nil")
+	}
+}
+
+func TestGetSpotFeedPricing(t *testing.T) {
+	var fetched []string
+	client := &mockS3Client{
+		ListObjectsV2Fn: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents: []s3types.Object{
+					{Key: awssdk.String("feed/123456789012.2026-01-01-09.001.abcd.gz")},
+					{Key: awssdk.String("feed/123456789012.2026-01-01-10.001.efgh.gz")},
+					{Key: awssdk.String("feed/README.txt")},
+				},
+			}, nil
+		},
+		GetObjectFn: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			fetched = append(fetched, awssdk.ToString(params.Key))
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(gzipString(t, testSpotFeed)))}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 100)
+	feed := SpotFeedConfig{Bucket: "spot-feed", Prefix: "feed/"}
+	GetSpotFeedPricing(context.Background(), []string{"us-east-1"}, client, feed, []string{"Linux/UNIX"}, InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(".*")}}, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if len(fetched) != 1 || fetched[0] != "feed/123456789012.2026-01-01-10.001.efgh.gz" {
+		t.Errorf("expected only the newest hour to be fetched, got %v", fetched)
+	}
+	// Only us-east-1 Linux/UNIX m5.large remains: 1 instance × 3 metrics.
+	requireScrapeCount(t, results, 3)
+	ec2Results := scrapesByName(results, "ec2")
+	if ec2Results[0].Value != 0.035 {
+		t.Errorf("expected newest market price 0.035, got %v", ec2Results[0].Value)
+	}
+	if ec2Results[0].InstanceLifecycle != "spot" || ec2Results[0].AvailabilityZone != "" {
+		t.Errorf("expected spot lifecycle with empty AZ, got %+v", ec2Results[0])
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
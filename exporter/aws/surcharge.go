@@ -0,0 +1,70 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// ManagedSurchargeMetric is the name of the scrape results of managed
+// service surcharges.
+const ManagedSurchargeMetric = "ec2_managed_surcharge"
+
+// Managed services charging an hourly surcharge per EC2 instance on top of
+// its EC2 price, the values of the service label.
+const (
+	ManagedServiceEMR = "emr" // EMR on EC2
+	ManagedServiceEKS = "eks" // EKS Auto Mode
+)
+
+// ManagedServices lists the managed services with a surcharge.
+var ManagedServices = []string{ManagedServiceEMR, ManagedServiceEKS}
+
+// managedServiceOffers are the offer file service codes of the managed
+// services.
+var managedServiceOffers = map[string]string{
+	ManagedServiceEMR: "ElasticMapReduce",
+	ManagedServiceEKS: "AmazonEKS",
+}
+
+// GetManagedSurchargePricing fetches the offer files of the given managed
+// services in a region and sends the hourly USD surcharge per instance type
+// of each to scrapes, labelled with the EC2 instance type so it can be added
+// to the EC2 price. Instance types are filtered like EC2 prices. No AWS
+// credentials are required. If httpClient is nil, http.DefaultClient is used.
+func GetManagedSurchargePricing(ctx context.Context, region string, httpClient *http.Client, services []string, filter InstanceFilter, instances *InstanceStore, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	for _, service := range services {
+		surcharge := func(product BulkProduct) bool {
+			attrs := product.Attributes
+			if attrs["instanceType"] == "" {
+				return false
+			}
+			// EMR also prices its software on other platforms, e.g. Outposts.
+			return service != ManagedServiceEMR || attrs["softwareType"] == "EMR"
+		}
+		bulk, err := fetchServiceOffer(ctx, httpClient, managedServiceOffers[service], region, func(product BulkProduct) bool {
+			if !surcharge(product) {
+				return false
+			}
+			if reason := filter.Reject(instances, product.Attributes["instanceType"]); reason != "" {
+				scrapes <- provider.Skipped("aws", region, reason)
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			apiError(log.StandardLogger(), region, err, errorCount, scrapes).Errorf("error fetching %s offer file [region=%s]", managedServiceOffers[service], region)
+			continue
+		}
+		sendServicePrices(region, service, bulk, func(product BulkProduct) (servicePrice, bool) {
+			return servicePrice{
+				metric: ManagedSurchargeMetric,
+				labels: map[string]string{"instance_type": product.Attributes["instanceType"], "service": service},
+				unit:   "Hrs",
+			}, true
+		}, errorCount, scrapes)
+	}
+}
@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetManagedSurchargePricing(t *testing.T) {
+	product := func(instanceType, softwareType string) BulkProduct {
+		return BulkProduct{ProductFamily: "Elastic Map Reduce Instance", Attributes: map[string]string{"instanceType": instanceType, "softwareType": softwareType}}
+	}
+	offer := BulkPricingResponse{
+		Products: map[string]BulkProduct{
+			"M5XL":     product("m5.xlarge", "EMR"),
+			"M5L":      product("m5.large", "EMR"),
+			"OUTPOSTS": product("m5.xlarge", "EMR-Outposts"),
+			"CLUSTER":  {ProductFamily: "Compute", Attributes: map[string]string{"usagetype": "USE1-AmazonEKS-Hours:perCluster"}},
+		},
+		Terms: BulkTerms{OnDemand: map[string]map[string]BulkOfferTerm{
+			"M5XL":     tieredOffer("Hrs", map[string]string{"0": "0.048"}),
+			"M5L":      tieredOffer("Hrs", map[string]string{"0": "0.024"}),
+			"OUTPOSTS": tieredOffer("Hrs", map[string]string{"0": "0.06"}),
+			"CLUSTER":  tieredOffer("Hours", map[string]string{"0": "0.1"}),
+		}},
+	}
+	paths := setupServiceOfferServer(t, offer)
+	filter := InstanceFilter{Regexes: []*regexp.Regexp{regexp.MustCompile(`xlarge`)}}
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	var errorCount uint64
+	GetManagedSurchargePricing(context.Background(), "us-east-1", nil, ManagedServices, filter, testInstanceStore(), &errorCount, scrapes)
+	close(scrapes)
+
+	got := map[string]float64{}
+	skipped := map[string]int{}
+	for r := range scrapes {
+		if r.Name == provider.SkippedName {
+			skipped[r.Labels["reason"]]++
+			continue
+		}
+		if r.Name != ManagedSurchargeMetric {
+			t.Errorf("unexpected result %+v", r)
+		}
+		got[r.Labels["service"]+"/"+r.Labels["instance_type"]] = r.Value
+	}
+	// The same offer is served for both services; only EMR checks the
+	// software type, so EKS keeps the lower Outposts price of m5.xlarge too.
+	want := map[string]float64{"emr/m5.xlarge": 0.048, "eks/m5.xlarge": 0.048}
+	if len(got) != len(want) || got["emr/m5.xlarge"] != want["emr/m5.xlarge"] || got["eks/m5.xlarge"] != want["eks/m5.xlarge"] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if skipped[provider.SkipFiltered] != 2 || errorCount != 0 {
+		t.Errorf("expected m5.large to be filtered for both services, got skips %v and %d errors", skipped, errorCount)
+	}
+	if len(*paths) != 2 || (*paths)[0] != "/ElasticMapReduce/us-east-1" || (*paths)[1] != "/AmazonEKS/us-east-1" {
+		t.Errorf("unexpected offer file requests %v", *paths)
+	}
+}
@@ -1,17 +1,29 @@
 package aws
 
+import awssdk "github.com/aws/aws-sdk-go-v2/aws"
+
 const (
+	// MaxResultsPerPage is the default page size of paginated API requests.
 	MaxResultsPerPage int32 = 100
 
+	// MaxSpotResultsPerPage is the largest page size accepted by
+	// DescribeSpotPriceHistory.
+	MaxSpotResultsPerPage int32 = 1000
+	// MaxPricingResultsPerPage is the largest page size accepted by the
+	// Pricing Query API (GetProducts).
+	MaxPricingResultsPerPage int32 = 100
+
 	TermOnDemand string = "JRTCKXETXF"
 	TermPerHour  string = "6YS6EN2CT7"
 
-	// cpuMemRelation is the CPU-to-memory cost ratio used for normalized cost calculations.
+	// CpuMemRelation is the default CPU-to-memory cost ratio used for normalized
+	// cost calculations (see InstanceStore.SetCPUMemRatio).
 	// CPU-cost = 7.2 * memory-GB-cost
 	// https://engineering.empathy.co/cloud-finops-part-4-kubernetes-cost-report/
 	CpuMemRelation = 7.2
 )
 
+// Pricing is a product entry of the Pricing Query API (GetProducts PriceList).
 type Pricing struct {
 	Product     Product
 	ServiceCode string
@@ -34,7 +46,7 @@ type SKU struct {
 	Sku             string
 	EffectiveDate   string
 	OfferTermCode   string
-	TermAttributes  string
+	TermAttributes  map[string]string
 }
 
 type Details struct {
@@ -48,6 +60,28 @@ type Details struct {
 }
 
 type Instance struct {
-	Memory int64
-	VCpu   int32
+	Memory             int64
+	VCpu               int32
+	Architectures      []string // e.g. "x86_64", "arm64"
+	NetworkPerformance string   // e.g. "Up to 10 Gigabit"
+	StorageGiB         float64  // total instance store size; 0 = EBS only
+	StorageDevices     int32
+	GPU                int32
+	GPUModel           string
+	BaselineVCpu       float64 // burstable baseline performance in vCPUs; 0 = not burstable or unknown
+}
+
+// CPUCreditsPerHour returns the CPU credits a burstable instance earns per
+// hour (one credit is one vCPU at 100% for one minute), or 0 when unknown.
+func (i Instance) CPUCreditsPerHour() float64 {
+	return i.BaselineVCpu * 60
+}
+
+// maxResults returns the MaxResults of a request with the configured page
+// size, MaxResultsPerPage if it's 0.
+func maxResults(pageSize int32) *int32 {
+	if pageSize <= 0 {
+		pageSize = MaxResultsPerPage
+	}
+	return awssdk.Int32(pageSize)
 }
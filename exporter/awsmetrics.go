@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// configMetricPrefix prefixes the pricing metric names of the AWS metrics of
+// the configuration file, so they can't replace built-in ones.
+const configMetricPrefix = "config:"
+
+// WithAWSMetrics exports the AWS metrics of the configuration file, scraped
+// from the Pricing Query API for every AWS region.
+func WithAWSMetrics(metrics []config.AWSMetric) Option {
+	return func(e *Exporter) {
+		e.awsMetrics = metrics
+	}
+}
+
+// initAWSMetricGauges creates the pricing metrics of the AWS metrics, labelled
+// with region and their labels in alphabetical order.
+func (e *Exporter) initAWSMetricGauges() {
+	for _, m := range e.awsMetrics {
+		labels := make([]string, 0, len(m.Labels)+1)
+		for label := range m.Labels {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		e.newPricingMetric(configMetricPrefix+m.Name, prometheus.GaugeOpts{
+			Name: m.Name,
+			Help: m.Help,
+		}, e.priceLabels(append([]string{"region"}, labels...)...))
+	}
+}
+
+// scrapeAWSMetrics scrapes the AWS metrics of a region.
+func (e *Exporter) scrapeAWSMetrics(ctx context.Context, region string, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	if len(e.awsMetrics) == 0 {
+		return
+	}
+	client, err := e.clientFactory.NewPricingClient()
+	if err != nil {
+		log.WithError(err).Errorf("failed to create Pricing client [region=%s]", region)
+		atomic.AddUint64(errorCount, 1)
+		return
+	}
+	for _, m := range e.awsMetrics {
+		aws.GetProductPricing(ctx, region, client, aws.ProductQuery{
+			Metric:      configMetricPrefix + m.Name,
+			ServiceCode: m.ServiceCode,
+			Filters:     m.Filters,
+			Labels:      m.Labels,
+			Unit:        m.Unit,
+			PageSize:    e.onDemandOptions.PageSize,
+		}, errorCount, scrapes)
+	}
+}
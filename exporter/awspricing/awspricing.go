@@ -0,0 +1,271 @@
+// Package awspricing serves the scraped AWS on-demand prices through the
+// GetProducts operation of the AWS Pricing Query API, so AWS SDK clients like
+// Karpenter's pricing provider can be pointed at the exporter (e.g. with
+// AWS_ENDPOINT_URL_PRICING) where the Pricing API isn't reachable.
+package awspricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+)
+
+const (
+	targetGetProducts = "AWSPriceListService.GetProducts"
+	contentType       = "application/x-amz-json-1.1"
+	maxResults        = 100
+)
+
+// PriceSource provides the served prices.
+type PriceSource interface {
+	Prices() *exporter.PriceIndex
+}
+
+type filter struct {
+	Field string
+	Type  string
+	Value string
+}
+
+type getProductsInput struct {
+	ServiceCode   string
+	Filters       []filter
+	FormatVersion string
+	NextToken     string
+	MaxResults    int
+}
+
+type getProductsOutput struct {
+	FormatVersion string   `json:"FormatVersion"`
+	NextToken     string   `json:"NextToken,omitempty"`
+	PriceList     []string `json:"PriceList"`
+}
+
+// product is a PriceList entry in the aws_v1 format.
+type product struct {
+	Product struct {
+		ProductFamily string            `json:"productFamily"`
+		Attributes    map[string]string `json:"attributes"`
+		Sku           string            `json:"sku"`
+	} `json:"product"`
+	ServiceCode string `json:"serviceCode"`
+	Terms       struct {
+		OnDemand map[string]term `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+type term struct {
+	PriceDimensions map[string]priceDimension `json:"priceDimensions"`
+	Sku             string                    `json:"sku"`
+	OfferTermCode   string                    `json:"offerTermCode"`
+	TermAttributes  map[string]string         `json:"termAttributes"`
+}
+
+type priceDimension struct {
+	Unit         string            `json:"unit"`
+	Description  string            `json:"description"`
+	RateCode     string            `json:"rateCode"`
+	BeginRange   string            `json:"beginRange"`
+	EndRange     string            `json:"endRange"`
+	AppliesTo    []string          `json:"appliesTo"`
+	PricePerUnit map[string]string `json:"pricePerUnit"`
+}
+
+// Handler serves GetProducts for ServiceCode AmazonEC2 from the Linux
+// on-demand prices of the last scrape, the cheapest zone of each region. Each
+// product has the attributes of a shared-tenancy Linux instance without
+// pre-installed software, and filters on other attribute values match nothing.
+type Handler struct {
+	prices PriceSource
+}
+
+// NewHandler returns a Handler serving prices.
+func NewHandler(prices PriceSource) *Handler {
+	return &Handler{prices: prices}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "UnknownOperationException", "POST requests only")
+		return
+	}
+	if target := r.Header.Get("X-Amz-Target"); target != targetGetProducts {
+		writeError(w, http.StatusBadRequest, "UnknownOperationException", fmt.Sprintf("operation %q is not supported", target))
+		return
+	}
+	var in getProductsInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidParameterException", "decoding request: "+err.Error())
+		return
+	}
+	if in.ServiceCode != "AmazonEC2" {
+		writeError(w, http.StatusBadRequest, "InvalidParameterException", fmt.Sprintf("service code %q is not supported", in.ServiceCode))
+		return
+	}
+	index := h.prices.Prices()
+	if index == nil {
+		writeError(w, http.StatusServiceUnavailable, "ServiceUnavailableException", "no prices scraped yet")
+		return
+	}
+
+	var products []map[string]string
+	var usd []float64
+	index.Each(func(q exporter.PriceQuery, price float64) {
+		if q.Provider != "aws" || q.Lifecycle != "ondemand" || q.Zone != "" {
+			return
+		}
+		attrs := attributes(q)
+		for _, f := range in.Filters {
+			if !f.match(attrs) {
+				return
+			}
+		}
+		products = append(products, attrs)
+		usd = append(usd, price)
+	})
+	order := make([]int, len(products))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := products[order[i]], products[order[j]]
+		if a["regionCode"] != b["regionCode"] {
+			return a["regionCode"] < b["regionCode"]
+		}
+		return a["instanceType"] < b["instanceType"]
+	})
+
+	start := 0
+	if in.NextToken != "" {
+		var err error
+		start, err = strconv.Atoi(in.NextToken)
+		if err != nil || start < 0 || start > len(order) {
+			writeError(w, http.StatusBadRequest, "InvalidNextTokenException", "invalid next token")
+			return
+		}
+	}
+	limit := in.MaxResults
+	if limit <= 0 || limit > maxResults {
+		limit = maxResults
+	}
+	end := min(start+limit, len(order))
+
+	out := getProductsOutput{FormatVersion: "aws_v1", PriceList: []string{}}
+	for _, i := range order[start:end] {
+		raw, err := json.Marshal(newProduct(products[i], usd[i]))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalErrorException", err.Error())
+			return
+		}
+		out.PriceList = append(out.PriceList, string(raw))
+	}
+	if end < len(order) {
+		out.NextToken = strconv.Itoa(end)
+	}
+	log.Debugf("aws pricing: served %d of %d products from %d", len(out.PriceList), len(order), start)
+	w.Header().Set("Content-Type", contentType)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		log.WithError(err).Debug("aws pricing: writing response")
+	}
+}
+
+// attributes returns the product attributes of an on-demand price.
+func attributes(q exporter.PriceQuery) map[string]string {
+	family := "Compute Instance"
+	if strings.HasSuffix(q.InstanceType, ".metal") || strings.Contains(q.InstanceType, ".metal-") {
+		family = "Compute Instance (bare metal)"
+	}
+	return map[string]string{
+		"servicecode":     "AmazonEC2",
+		"productFamily":   family,
+		"instanceType":    q.InstanceType,
+		"regionCode":      q.Region,
+		"operatingSystem": "Linux",
+		"tenancy":         "Shared",
+		"preInstalledSw":  "NA",
+		"capacitystatus":  "Used",
+		"licenseModel":    "No License required",
+		"marketoption":    "OnDemand",
+		"usagetype":       "BoxUsage:" + q.InstanceType,
+		"operation":       "RunInstances",
+	}
+}
+
+// match reports whether attrs pass the filter. Field names are matched
+// case-insensitively like the Pricing API does.
+func (f filter) match(attrs map[string]string) bool {
+	var value string
+	found := false
+	for k, v := range attrs {
+		if strings.EqualFold(k, f.Field) {
+			value, found = v, true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	switch f.Type {
+	case "", "TERM_MATCH", "EQUALS":
+		return strings.EqualFold(value, f.Value)
+	case "CONTAINS":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(f.Value))
+	case "ANY_OF", "NONE_OF":
+		listed := false
+		for _, v := range strings.Split(f.Value, ",") {
+			if strings.EqualFold(value, strings.TrimSpace(v)) {
+				listed = true
+				break
+			}
+		}
+		return listed == (f.Type == "ANY_OF")
+	}
+	return false
+}
+
+// newProduct returns the PriceList entry of attrs priced usd per hour. Its
+// SKU is derived from the region and instance type, stable across requests.
+func newProduct(attrs map[string]string, usd float64) product {
+	hash := fnv.New64a()
+	hash.Write([]byte(attrs["regionCode"] + "/" + attrs["instanceType"]))
+	sku := strings.ToUpper(strconv.FormatUint(hash.Sum64(), 36))
+
+	var p product
+	p.Product.ProductFamily = attrs["productFamily"]
+	p.Product.Attributes = attrs
+	p.Product.Sku = sku
+	p.ServiceCode = "AmazonEC2"
+	termKey := sku + "." + aws.TermOnDemand
+	p.Terms.OnDemand = map[string]term{termKey: {
+		Sku:            sku,
+		OfferTermCode:  aws.TermOnDemand,
+		TermAttributes: map[string]string{},
+		PriceDimensions: map[string]priceDimension{termKey + "." + aws.TermPerHour: {
+			Unit:         "Hrs",
+			Description:  fmt.Sprintf("$%s per On Demand Linux %s Instance Hour", strconv.FormatFloat(usd, 'f', -1, 64), attrs["instanceType"]),
+			RateCode:     termKey + "." + aws.TermPerHour,
+			BeginRange:   "0",
+			EndRange:     "Inf",
+			AppliesTo:    []string{},
+			PricePerUnit: map[string]string{"USD": strconv.FormatFloat(usd, 'f', 10, 64)},
+		}},
+	}}
+	return p
+}
+
+// writeError writes an awsJson1_1 error response.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": msg})
+}
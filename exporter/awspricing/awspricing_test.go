@@ -0,0 +1,141 @@
+package awspricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingTypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+)
+
+type staticPrices struct {
+	index *exporter.PriceIndex
+}
+
+func (s staticPrices) Prices() *exporter.PriceIndex { return s.index }
+
+func newClient(t *testing.T, src PriceSource) *pricing.Client {
+	t.Helper()
+	srv := httptest.NewServer(NewHandler(src))
+	t.Cleanup(srv.Close)
+	return pricing.New(pricing.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     awssdk.String(srv.URL + "/aws-pricing"),
+		Credentials:      awssdk.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+}
+
+func termMatch(field, value string) pricingTypes.Filter {
+	return pricingTypes.Filter{Type: pricingTypes.FilterTypeTermMatch, Field: awssdk.String(field), Value: awssdk.String(value)}
+}
+
+func TestHandler_GetProducts(t *testing.T) {
+	index := exporter.NewPriceIndex(map[exporter.PriceQuery]float64{
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "ondemand"}:  0.096,
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.xlarge", Lifecycle: "ondemand"}: 0.192,
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "spot"}:      0.04,
+		{Provider: "aws", Region: "eu-west-1", Zone: "eu-west-1a", InstanceType: "m5.large", Lifecycle: "ondemand"}:  0.107,
+		{Provider: "azure", Region: "eastus", InstanceType: "Standard_D2s_v5", Lifecycle: "ondemand"}:                0.096,
+	})
+	client := newClient(t, staticPrices{index})
+
+	// The filters of Karpenter's on-demand price query.
+	pag := pricing.NewGetProductsPaginator(client, &pricing.GetProductsInput{
+		ServiceCode: awssdk.String("AmazonEC2"),
+		MaxResults:  awssdk.Int32(1),
+		Filters: []pricingTypes.Filter{
+			termMatch("regionCode", "us-east-1"),
+			termMatch("serviceCode", "AmazonEC2"),
+			termMatch("preInstalledSw", "NA"),
+			termMatch("operatingSystem", "Linux"),
+			termMatch("capacitystatus", "Used"),
+			termMatch("marketoption", "OnDemand"),
+			termMatch("tenancy", "Shared"),
+			termMatch("productFamily", "Compute Instance"),
+		},
+	})
+	got := map[string]string{}
+	pages := 0
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(context.Background())
+		if err != nil {
+			t.Fatalf("GetProducts: %v", err)
+		}
+		pages++
+		for _, raw := range page.PriceList {
+			// Decoded like the exporter's own Pricing API backend does.
+			var p aws.Pricing
+			if err := json.Unmarshal([]byte(raw), &p); err != nil {
+				t.Fatalf("decoding product: %v", err)
+			}
+			sku := p.Product.Sku + "." + aws.TermOnDemand
+			got[p.Product.Attributes["instanceType"]] = p.Terms.OnDemand[sku].PriceDimensions[sku+"."+aws.TermPerHour].PricePerUnit["USD"]
+		}
+	}
+	want := map[string]string{"m5.large": "0.0960000000", "m5.xlarge": "0.1920000000"}
+	if len(got) != len(want) || got["m5.large"] != want["m5.large"] || got["m5.xlarge"] != want["m5.xlarge"] {
+		t.Errorf("prices = %v, want %v", got, want)
+	}
+	if pages != 2 {
+		t.Errorf("pages = %d, want 2", pages)
+	}
+
+	out, err := client.GetProducts(context.Background(), &pricing.GetProductsInput{
+		ServiceCode: awssdk.String("AmazonEC2"),
+		Filters:     []pricingTypes.Filter{termMatch("regionCode", "us-east-1"), termMatch("tenancy", "Dedicated")},
+	})
+	if err != nil {
+		t.Fatalf("GetProducts: %v", err)
+	}
+	if len(out.PriceList) != 0 {
+		t.Errorf("expected no dedicated products, got %d", len(out.PriceList))
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	client := newClient(t, staticPrices{})
+	_, err := client.GetProducts(context.Background(), &pricing.GetProductsInput{ServiceCode: awssdk.String("AmazonEC2")})
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ServiceUnavailableException" {
+		t.Errorf("before the first scrape: err = %v, want ServiceUnavailableException", err)
+	}
+
+	client = newClient(t, staticPrices{exporter.NewPriceIndex(nil)})
+	_, err = client.GetProducts(context.Background(), &pricing.GetProductsInput{ServiceCode: awssdk.String("AmazonRDS")})
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidParameterException" {
+		t.Errorf("unsupported service: err = %v, want InvalidParameterException", err)
+	}
+	_, err = client.DescribeServices(context.Background(), &pricing.DescribeServicesInput{})
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "UnknownOperationException" {
+		t.Errorf("unsupported operation: err = %v, want UnknownOperationException", err)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	attrs := map[string]string{"instanceType": "m5.large", "tenancy": "Shared"}
+	tests := []struct {
+		f    filter
+		want bool
+	}{
+		{filter{"instancetype", "TERM_MATCH", "m5.large"}, true},
+		{filter{"instanceType", "EQUALS", "m5.xlarge"}, false},
+		{filter{"instanceType", "CONTAINS", "m5"}, true},
+		{filter{"instanceType", "ANY_OF", "c5.large, m5.large"}, true},
+		{filter{"instanceType", "NONE_OF", "c5.large,m5.large"}, false},
+		{filter{"vcpu", "TERM_MATCH", "2"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.f.match(attrs); got != tt.want {
+			t.Errorf("%+v.match() = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
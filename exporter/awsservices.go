@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// WithDynamoDB exports the DynamoDB capacity, request and storage prices of
+// every AWS region from the public AmazonDynamoDB offer files.
+func WithDynamoDB(enabled bool) Option {
+	return func(e *Exporter) {
+		e.dynamoDB = enabled
+	}
+}
+
+// WithOpenSearch exports the OpenSearch Service instance and storage prices
+// of every AWS region from the public AmazonES offer files.
+func WithOpenSearch(enabled bool) Option {
+	return func(e *Exporter) {
+		e.openSearch = enabled
+	}
+}
+
+// WithRDS exports the RDS service group, the Aurora instance and Serverless
+// v2 prices of every AWS region, from the public AmazonRDS offer files.
+func WithRDS(enabled bool) Option {
+	return func(e *Exporter) {
+		e.rds = enabled
+	}
+}
+
+// WithCloudFront exports the CloudFront data transfer and request prices of
+// every edge location group from the public AmazonCloudFront offer file. They
+// are scraped once per scrape, in the region aws.CloudFrontRegion.
+func WithCloudFront(enabled bool) Option {
+	return func(e *Exporter) {
+		e.cloudFront = enabled
+	}
+}
+
+// WithManagedSurcharges exports the hourly surcharge per EC2 instance of the
+// given managed services (aws.ManagedServiceEMR, aws.ManagedServiceEKS) in
+// every AWS region from their public offer files.
+func WithManagedSurcharges(services []string) Option {
+	return func(e *Exporter) {
+		e.managedSurcharges = services
+	}
+}
+
+// initAWSServiceGauges creates the pricing metrics of the enabled AWS
+// services other than EC2.
+func (e *Exporter) initAWSServiceGauges() {
+	if e.dynamoDB {
+		e.newPricingMetric(aws.DynamoDBCapacityMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.DynamoDBCapacityMetric,
+			Help:      "Hourly price of a provisioned DynamoDB read or write capacity unit.",
+		}, e.priceLabels("region", "operation", "table_class"))
+		e.newPricingMetric(aws.DynamoDBRequestMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.DynamoDBRequestMetric,
+			Help:      "Price of a DynamoDB on-demand read or write request unit.",
+		}, e.priceLabels("region", "operation", "table_class"))
+		e.newPricingMetric(aws.DynamoDBStorageMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.DynamoDBStorageMetric,
+			Help:      "Monthly price of a GB of DynamoDB table storage beyond the free tier.",
+		}, e.priceLabels("region", "table_class"))
+	}
+	if e.openSearch {
+		e.newPricingMetric(aws.OpenSearchInstanceMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.OpenSearchInstanceMetric,
+			Help:      "Hourly on-demand price of the OpenSearch Service instance type.",
+		}, e.priceLabels("region", "instance_type"))
+		e.newPricingMetric(aws.OpenSearchStorageMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.OpenSearchStorageMetric,
+			Help:      "Monthly price of a GB of OpenSearch Service storage of the storage media.",
+		}, e.priceLabels("region", "storage_media"))
+	}
+	if e.rds {
+		e.newPricingMetric(aws.AuroraInstanceMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.AuroraInstanceMetric,
+			Help:      "Hourly on-demand price of the Aurora DB instance class.",
+		}, e.priceLabels("instance_type", "region", "engine", "storage_configuration"))
+		e.newPricingMetric(aws.AuroraServerlessMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.AuroraServerlessMetric,
+			Help:      "Hourly price of an Aurora Serverless v2 capacity unit (ACU).",
+		}, e.priceLabels("region", "engine", "storage_configuration"))
+	}
+	if e.cloudFront {
+		e.newPricingMetric(aws.CloudFrontTransferMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.CloudFrontTransferMetric,
+			Help:      "Price per GB transferred by CloudFront from the edge locations of the group to the internet or the origin, in the first volume tier.",
+		}, e.priceLabels("region", "region_group", "price_class", "destination"))
+		e.newPricingMetric(aws.CloudFrontRequestMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.CloudFrontRequestMetric,
+			Help:      "Price of a single HTTP or HTTPS request to the CloudFront edge locations of the group.",
+		}, e.priceLabels("region", "region_group", "price_class", "protocol"))
+	}
+	if len(e.managedSurcharges) > 0 {
+		e.newPricingMetric(aws.ManagedSurchargeMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.ManagedSurchargeMetric,
+			Help:      "Hourly surcharge of the managed service per EC2 instance of the type, on top of the EC2 price.",
+		}, e.priceLabels("instance_type", "region", "service"))
+	}
+}
+
+// scrapeAWSServices scrapes the enabled AWS services other than EC2 in a
+// region.
+func (e *Exporter) scrapeAWSServices(ctx context.Context, region string, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	if e.dynamoDB {
+		aws.GetDynamoDBPricing(ctx, region, e.httpClient, errorCount, scrapes)
+	}
+	if e.openSearch {
+		aws.GetOpenSearchPricing(ctx, region, e.httpClient, errorCount, scrapes)
+	}
+	if e.rds {
+		aws.GetRDSPricing(ctx, region, e.httpClient, errorCount, scrapes)
+	}
+	if len(e.managedSurcharges) > 0 {
+		aws.GetManagedSurchargePricing(ctx, region, e.httpClient, e.managedSurcharges, e.instanceFilter, e.instances, errorCount, scrapes)
+	}
+}
+
+// scrapeCloudFront scrapes the CloudFront prices, which aren't regional.
+func (e *Exporter) scrapeCloudFront(ctx context.Context, now time.Time, pool *workerPool, scrapes chan<- provider.ScrapeResult) {
+	key := regionKey{"aws", aws.CloudFrontRegion}
+	if !e.regionDue(key, now) {
+		return
+	}
+	if !e.breakerAllows(key, now) {
+		log.Debug("circuit breaker open, skipping CloudFront prices")
+		return
+	}
+	pool.submit(func() {
+		aws.GetCloudFrontPricing(ctx, e.httpClient, e.regionErrors[key], scrapes)
+	})
+}
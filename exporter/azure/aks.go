@@ -0,0 +1,39 @@
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// AKSClusterMetric is the name of the AKS cluster fee scrape results.
+const AKSClusterMetric = "azure_aks_cluster"
+
+// AKS pricing tiers charging a fee per cluster, the values of the tier label.
+// The Free tier has no fee.
+const (
+	AKSTierStandard = "standard"
+	AKSTierPremium  = "premium"
+)
+
+// GetAKSPricing fetches the AKS prices of a region and sends the hourly fee
+// per cluster of the Standard and Premium pricing tiers to scrapes, labelled
+// with the tier. Node VMs are priced as azure_vm.
+func GetAKSPricing(ctx context.Context, region string, client RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	getServicePrices(ctx, region, client, "AKS", "serviceName eq 'Azure Kubernetes Service'", func(item RetailPriceItem) (servicePrice, bool) {
+		tier := strings.ToLower(item.SkuName)
+		if item.ProductName != "Azure Kubernetes Service" || (tier != AKSTierStandard && tier != AKSTierPremium) {
+			return servicePrice{}, false
+		}
+		hours, ok := unitHours(item.UnitOfMeasure)
+		if !ok {
+			return servicePrice{}, false
+		}
+		return servicePrice{
+			metric: AKSClusterMetric,
+			labels: map[string]string{"tier": tier},
+			per:    hours,
+		}, true
+	}, errorCount, scrapes)
+}
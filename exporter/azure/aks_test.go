@@ -0,0 +1,47 @@
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetAKSPricing(t *testing.T) {
+	var gotFilter string
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			gotFilter = filter
+			return []RetailPriceItem{
+				{RetailPrice: 0.1, ProductName: "Azure Kubernetes Service", SkuName: "Standard", MeterName: "Standard Uptime SLA", UnitOfMeasure: "1 Hour"},
+				{RetailPrice: 60, ProductName: "Azure Kubernetes Service", SkuName: "Premium", MeterName: "Premium Long Term Support", UnitOfMeasure: "100 Hours"},
+				{RetailPrice: 0, ProductName: "Azure Kubernetes Service", SkuName: "Free", MeterName: "Free", UnitOfMeasure: "1 Hour"},
+				{RetailPrice: 0.16, ProductName: "Azure Kubernetes Service - Automatic", SkuName: "Standard", MeterName: "Standard Hosted Control Plane", UnitOfMeasure: "1 Hour"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetAKSPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if want := "(serviceName eq 'Azure Kubernetes Service') and priceType eq 'Consumption' and armRegionName eq 'eastus'"; gotFilter != want {
+		t.Errorf("filter = %q, want %q", gotFilter, want)
+	}
+	requireScrapeCount(t, results, 2)
+	got := map[string]float64{}
+	for _, r := range results {
+		if r.Name != AKSClusterMetric || r.Region != "eastus" {
+			t.Errorf("unexpected result %+v", r)
+		}
+		got[r.Labels["tier"]] = r.Value
+	}
+	if got[AKSTierStandard] != 0.1 || got[AKSTierPremium] != 0.6 {
+		t.Errorf("expected standard=0.1 and premium=0.6 per hour, got %v", got)
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
@@ -2,12 +2,37 @@ package azure
 
 import "context"
 
-// RetailPricesClient fetches VM pricing from the Azure Retail Prices API.
+// Azure retail price types.
+const (
+	PriceTypeConsumption        = "Consumption"
+	PriceTypeDevTestConsumption = "DevTestConsumption"
+)
+
+// Azure VM lifecycles, derived from the meter name.
+const (
+	LifecycleOnDemand    = "ondemand"
+	LifecycleSpot        = "spot"
+	LifecycleLowPriority = "lowpriority"
+)
+
+// VMPriceQuery selects which VM prices GetVMPrices returns.
+type VMPriceQuery struct {
+	OperatingSystems []string // "Linux", "Windows"
+	PriceTypes       []string // empty = Consumption only
+	Lifecycles       []string // LifecycleOnDemand, LifecycleSpot, LifecycleLowPriority; empty = on-demand only
+	InstanceTypes    []string // exact ARM SKU names, e.g. "Standard_D2s_v5"; empty = all
+}
+
+// RetailPricesClient fetches pricing from the Azure Retail Prices API.
 type RetailPricesClient interface {
-	GetVMPrices(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error)
+	GetVMPrices(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error)
+	// GetPrices returns the items of any service matching an OData $filter.
+	GetPrices(ctx context.Context, filter string) ([]RetailPriceItem, error)
 }
 
 // ClientFactory creates Azure API clients, enabling dependency injection for testing.
 type ClientFactory interface {
 	NewRetailPricesClient() RetailPricesClient
+	// NewResourceSKUsClient returns nil when no credentials are configured.
+	NewResourceSKUsClient() ResourceSKUsClient
 }
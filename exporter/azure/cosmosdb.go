@@ -0,0 +1,66 @@
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the Cosmos DB scrape results.
+const (
+	CosmosDBThroughputMetric = "azure_cosmosdb_provisioned_throughput"
+	CosmosDBRequestMetric    = "azure_cosmosdb_serverless_request_unit"
+	CosmosDBStorageMetric    = "azure_cosmosdb_storage_gb_month"
+)
+
+// Cosmos DB capacity modes, the values of the capacity_mode label.
+const (
+	CosmosDBModeProvisioned = "provisioned"
+	CosmosDBModeAutoscale   = "autoscale"
+	CosmosDBModeServerless  = "serverless"
+)
+
+// cosmosDBProducts maps the products of the Cosmos DB NoSQL (core) API
+// capacity modes to the mode. The vCore and PostgreSQL products are priced
+// differently and aren't exported.
+var cosmosDBProducts = map[string]string{
+	"Azure Cosmos DB":            CosmosDBModeProvisioned,
+	"Azure Cosmos DB autoscale":  CosmosDBModeAutoscale,
+	"Azure Cosmos DB serverless": CosmosDBModeServerless,
+}
+
+// GetCosmosDBPricing fetches the Cosmos DB prices of a region and sends the
+// hourly price of 1 RU/s of standard (manual) and autoscale provisioned
+// throughput, the price of a serverless request unit and the monthly price of
+// a GB of transactional storage of every capacity mode to scrapes. Throughput
+// is that of accounts with a single write region.
+func GetCosmosDBPricing(ctx context.Context, region string, client RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	getServicePrices(ctx, region, client, "Cosmos DB", "serviceName eq 'Azure Cosmos DB'", cosmosDBPrice, errorCount, scrapes)
+}
+
+// cosmosDBPrice maps the throughput, request unit and storage meters of
+// Cosmos DB to their series, e.g. "100 RU/s" per hour, "1M RUs" or "Data
+// Stored" per GB-month.
+func cosmosDBPrice(item RetailPriceItem) (servicePrice, bool) {
+	mode, ok := cosmosDBProducts[item.ProductName]
+	if !ok {
+		return servicePrice{}, false
+	}
+	labels := map[string]string{"capacity_mode": mode}
+	meter := item.MeterName
+	switch {
+	case mode != CosmosDBModeServerless && strings.HasSuffix(meter, " RU/s") && !strings.Contains(meter, "Multi"):
+		hours, ok := unitHours(item.UnitOfMeasure)
+		if !ok {
+			return servicePrice{}, false
+		}
+		return servicePrice{metric: CosmosDBThroughputMetric, labels: labels, per: hours * unitQuantity(meter)}, true
+	case mode == CosmosDBModeServerless && strings.HasSuffix(meter, " RUs"):
+		delete(labels, "capacity_mode")
+		return servicePrice{metric: CosmosDBRequestMetric, labels: labels, per: unitQuantity(item.UnitOfMeasure) * unitQuantity(meter)}, true
+	case meter == "Data Stored" && strings.EqualFold(item.UnitOfMeasure, "1 GB/Month"):
+		return servicePrice{metric: CosmosDBStorageMetric, labels: labels}, true
+	}
+	return servicePrice{}, false
+}
@@ -0,0 +1,52 @@
+package azure
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetCosmosDBPricing(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.008, ProductName: "Azure Cosmos DB", MeterName: "100 RU/s", UnitOfMeasure: "1 Hour"},
+				{RetailPrice: 0.016, ProductName: "Azure Cosmos DB", MeterName: "100 Multi-master RU/s", UnitOfMeasure: "1 Hour"},
+				{RetailPrice: 0.25, ProductName: "Azure Cosmos DB", MeterName: "Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.03, ProductName: "Azure Cosmos DB", MeterName: "Analytical Storage Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 1.2, ProductName: "Azure Cosmos DB autoscale", MeterName: "100 RU/s", UnitOfMeasure: "100 Hours"},
+				{RetailPrice: 0.25, ProductName: "Azure Cosmos DB serverless", MeterName: "1M RUs", UnitOfMeasure: "1"},
+				{RetailPrice: 0.25, ProductName: "Azure Cosmos DB serverless", MeterName: "Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.22, ProductName: "Azure Cosmos DB for MongoDB vCore", MeterName: "M30 vCore", UnitOfMeasure: "1 Hour"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetCosmosDBPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	got := map[string]float64{}
+	for _, r := range results {
+		got[r.Name+"/"+r.Labels["capacity_mode"]] = r.Value
+	}
+	want := map[string]float64{
+		CosmosDBThroughputMetric + "/" + CosmosDBModeProvisioned: 0.00008,
+		CosmosDBThroughputMetric + "/" + CosmosDBModeAutoscale:   0.00012,
+		CosmosDBRequestMetric + "/":                              0.00000025,
+		CosmosDBStorageMetric + "/" + CosmosDBModeProvisioned:    0.25,
+		CosmosDBStorageMetric + "/" + CosmosDBModeServerless:     0.25,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if math.Abs(got[k]-v) > 1e-12 {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
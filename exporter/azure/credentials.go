@@ -0,0 +1,104 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+)
+
+const (
+	loginBaseURL      = "https://login.microsoftonline.com"
+	managementBaseURL = "https://management.azure.com"
+)
+
+// Credentials identify an Entra ID service principal used for Azure Resource
+// Manager calls. The Retail Prices API needs none of this.
+type Credentials struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+}
+
+// CredentialsFromEnv reads AZURE_TENANT_ID, AZURE_CLIENT_ID,
+// AZURE_CLIENT_SECRET and AZURE_SUBSCRIPTION_ID. ok is false unless all are set.
+func CredentialsFromEnv() (creds Credentials, ok bool) {
+	creds = Credentials{
+		TenantID:       os.Getenv("AZURE_TENANT_ID"),
+		ClientID:       os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:   os.Getenv("AZURE_CLIENT_SECRET"),
+		SubscriptionID: os.Getenv("AZURE_SUBSCRIPTION_ID"),
+	}
+	ok = creds.TenantID != "" && creds.ClientID != "" && creds.ClientSecret != "" && creds.SubscriptionID != ""
+	return creds, ok
+}
+
+// tokenSource fetches and caches OAuth2 client-credentials tokens for Azure
+// Resource Manager.
+type tokenSource struct {
+	client   *http.Client
+	creds    Credentials
+	loginURL string // overridable for tests
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"` // seconds
+}
+
+// Token returns a cached access token, requesting a new one when it expires
+// within a minute.
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Until(t.expires) > time.Minute {
+		return t.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {t.creds.ClientID},
+		"client_secret": {t.creds.ClientSecret},
+		"scope":         {managementBaseURL + "/.default"},
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", t.loginURL, url.PathEscape(t.creds.TenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting Azure token: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		err := &apierror.StatusError{API: "azure token endpoint", StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			// Unknown tenants and clients, wrong or expired secrets.
+			return "", &apierror.Error{Provider: "azure", Category: apierror.CategoryCredentials, Err: err}
+		}
+		return "", err
+	}
+
+	var tok tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("decoding Azure token: %w", err)
+	}
+	t.token = tok.AccessToken
+	t.expires = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return t.token, nil
+}
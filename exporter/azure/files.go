@@ -0,0 +1,64 @@
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the Azure Files and Azure NetApp Files scrape results.
+const (
+	FilesStorageMetric = "azure_files_storage_gb_month"
+	NetAppFilesMetric  = "azure_netapp_files_capacity_gib_hour"
+)
+
+// netAppFilesTiers are the Azure NetApp Files service levels whose capacity
+// is exported, the values of the tier label by SKU name.
+var netAppFilesTiers = map[string]string{
+	"Standard": "standard",
+	"Premium":  "premium",
+	"Ultra":    "ultra",
+}
+
+// GetFilesPricing fetches the Azure Files prices of a region and sends the
+// monthly price of a GB of file share storage of every tier (hot, cool,
+// transaction optimized and premium, which is billed by provisioned size) and
+// redundancy to scrapes.
+func GetFilesPricing(ctx context.Context, region string, client RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	getServicePrices(ctx, region, client, "Files", "serviceName eq 'Storage' and (productName eq 'Files' or productName eq 'Files v2' or productName eq 'Premium Files')", filesPrice, errorCount, scrapes)
+}
+
+// filesPrice maps the data stored and provisioned meters of Azure Files to
+// their series, e.g. the "Hot LRS Data Stored" meter of the "Hot LRS" SKU.
+func filesPrice(item RetailPriceItem) (servicePrice, bool) {
+	if item.MeterName != item.SkuName+" Data Stored" && item.MeterName != item.SkuName+" Provisioned" {
+		return servicePrice{}, false // e.g. snapshots, metadata or transactions
+	}
+	i := strings.LastIndex(item.SkuName, " ")
+	if i < 0 {
+		return servicePrice{}, false
+	}
+	tier := strings.ToLower(strings.ReplaceAll(item.SkuName[:i], " ", "_"))
+	return servicePrice{
+		metric: FilesStorageMetric,
+		labels: map[string]string{"tier": tier, "redundancy": item.SkuName[i+1:]},
+	}, true
+}
+
+// GetNetAppFilesPricing fetches the Azure NetApp Files prices of a region and
+// sends the hourly price of a GiB of provisioned capacity of the Standard,
+// Premium and Ultra service levels to scrapes.
+func GetNetAppFilesPricing(ctx context.Context, region string, client RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	getServicePrices(ctx, region, client, "NetApp Files", "serviceName eq 'Azure NetApp Files'", func(item RetailPriceItem) (servicePrice, bool) {
+		tier, ok := netAppFilesTiers[item.SkuName]
+		if !ok || item.MeterName != item.SkuName+" Capacity" {
+			return servicePrice{}, false
+		}
+		hours, ok := unitHours(strings.Replace(item.UnitOfMeasure, " GiB/Hour", " Hour", 1))
+		if !ok {
+			return servicePrice{}, false
+		}
+		return servicePrice{metric: NetAppFilesMetric, labels: map[string]string{"tier": tier}, per: hours}, true
+	}, errorCount, scrapes)
+}
@@ -0,0 +1,80 @@
+package azure
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetFilesPricing(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.0255, ProductName: "Files v2", SkuName: "Hot LRS", MeterName: "Hot LRS Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.0318, ProductName: "Files v2", SkuName: "Hot ZRS", MeterName: "Hot ZRS Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.06, ProductName: "Files", SkuName: "Transaction Optimized LRS", MeterName: "Transaction Optimized LRS Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.16, ProductName: "Premium Files", SkuName: "Premium LRS", MeterName: "Premium LRS Provisioned", UnitOfMeasure: "1 GiB/Month"},
+				{RetailPrice: 0.065, ProductName: "Files v2", SkuName: "Hot LRS", MeterName: "Hot LRS Write Operations", UnitOfMeasure: "10K"},
+				{RetailPrice: 0.0255, ProductName: "Files v2", SkuName: "Hot LRS", MeterName: "Hot LRS Snapshots Data Stored", UnitOfMeasure: "1 GB/Month"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetFilesPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	got := map[string]float64{}
+	for _, r := range results {
+		if r.Name != FilesStorageMetric {
+			t.Errorf("unexpected result %+v", r)
+		}
+		got[r.Labels["tier"]+"/"+r.Labels["redundancy"]] = r.Value
+	}
+	want := map[string]float64{"hot/LRS": 0.0255, "hot/ZRS": 0.0318, "transaction_optimized/LRS": 0.06, "premium/LRS": 0.16}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestGetNetAppFilesPricing(t *testing.T) {
+	var gotFilter string
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			gotFilter = filter
+			return []RetailPriceItem{
+				{RetailPrice: 0.000202, SkuName: "Standard", MeterName: "Standard Capacity", UnitOfMeasure: "1 GiB/Hour"},
+				{RetailPrice: 0.000403, SkuName: "Premium", MeterName: "Premium Capacity", UnitOfMeasure: "1 GiB/Hour"},
+				{RetailPrice: 0.000538, SkuName: "Ultra", MeterName: "Ultra Capacity", UnitOfMeasure: "1 GiB/Hour"},
+				{RetailPrice: 0.000101, SkuName: "Standard Cool", MeterName: "Standard Cool Capacity", UnitOfMeasure: "1 GiB/Hour"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetNetAppFilesPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	if want := "(serviceName eq 'Azure NetApp Files') and priceType eq 'Consumption' and armRegionName eq 'eastus'"; gotFilter != want {
+		t.Errorf("filter = %q, want %q", gotFilter, want)
+	}
+	requireScrapeCount(t, results, 3)
+	got := map[string]float64{}
+	for _, r := range results {
+		got[r.Labels["tier"]] = r.Value
+	}
+	if math.Abs(got["standard"]-0.000202) > 1e-12 || math.Abs(got["ultra"]-0.000538) > 1e-12 {
+		t.Errorf("unexpected prices %v", got)
+	}
+}
@@ -0,0 +1,95 @@
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Names of the Azure Functions scrape results.
+const (
+	FunctionsPremiumPlanMetric   = "azure_functions_premium_plan"
+	FunctionsExecutionMetric     = "azure_functions_execution"
+	FunctionsExecutionTimeMetric = "azure_functions_execution_time_gb_second"
+)
+
+// functionsPremiumSKU is the size of a Functions Premium plan instance.
+type functionsPremiumSKU struct {
+	vcpu      float64
+	memoryGiB float64
+}
+
+// functionsPremiumSKUs are the Functions Premium plan instance sizes, the
+// values of the sku label, by name.
+var functionsPremiumSKUs = map[string]functionsPremiumSKU{
+	"EP1": {vcpu: 1, memoryGiB: 3.5},
+	"EP2": {vcpu: 2, memoryGiB: 7},
+	"EP3": {vcpu: 4, memoryGiB: 14},
+}
+
+// Series of the Premium plan vCPU and memory meters the SKU prices are
+// derived from; they aren't exported.
+const (
+	functionsPremiumVCpu   = "premium_vcpu_hour"
+	functionsPremiumMemory = "premium_memory_gb_hour"
+)
+
+// GetFunctionsPricing fetches the Functions prices of a region and sends the
+// hourly price of an instance of every Premium plan SKU (EP1-EP3), derived
+// from the vCPU and memory duration meters, and the consumption plan price
+// per execution and per GB-s of execution time beyond the free grant to
+// scrapes.
+func GetFunctionsPricing(ctx context.Context, region string, client RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	prices, err := fetchServicePrices(ctx, region, client, "serviceName eq 'Functions'", functionsPrice)
+	if err != nil {
+		apiError(region, err, errorCount, scrapes).Errorf("error while fetching Azure Functions prices [region=%s]", region)
+		return
+	}
+
+	var consumption []seriesPrice
+	var vcpu, memory float64
+	for _, p := range prices {
+		switch p.price.metric {
+		case functionsPremiumVCpu:
+			vcpu = p.value
+		case functionsPremiumMemory:
+			memory = p.value
+		default:
+			consumption = append(consumption, p)
+		}
+	}
+	sendServicePrices(region, consumption, scrapes)
+
+	if vcpu == 0 || memory == 0 {
+		azureLog.Debugf("No Functions Premium vCPU and memory prices [region=%s]", region)
+		return
+	}
+	for name, sku := range functionsPremiumSKUs {
+		scrapes <- provider.ScrapeResult{
+			Name:   FunctionsPremiumPlanMetric,
+			Value:  sku.vcpu*vcpu + sku.memoryGiB*memory,
+			Region: region,
+			Labels: map[string]string{"sku": name},
+		}
+	}
+}
+
+// functionsPrice maps the consumption plan execution meters and the Premium
+// plan duration meters of Functions to their series.
+func functionsPrice(item RetailPriceItem) (servicePrice, bool) {
+	var metric string
+	switch {
+	case item.SkuName == "Standard" && strings.HasSuffix(item.MeterName, "Total Executions"):
+		metric = FunctionsExecutionMetric
+	case item.SkuName == "Standard" && strings.HasSuffix(item.MeterName, "Execution Time"):
+		metric = FunctionsExecutionTimeMetric
+	case item.SkuName == "Premium" && strings.HasSuffix(item.MeterName, "vCPU Duration"):
+		metric = functionsPremiumVCpu
+	case item.SkuName == "Premium" && strings.HasSuffix(item.MeterName, "Memory Duration"):
+		metric = functionsPremiumMemory
+	default:
+		return servicePrice{}, false
+	}
+	return servicePrice{metric: metric, labels: map[string]string{}, per: unitQuantity(item.UnitOfMeasure)}, true
+}
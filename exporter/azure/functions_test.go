@@ -0,0 +1,86 @@
+package azure
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetFunctionsPricing(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0, SkuName: "Standard", MeterName: "Standard Execution Time", UnitOfMeasure: "1 GB Second"},
+				{RetailPrice: 0.000016, SkuName: "Standard", MeterName: "Standard Execution Time", UnitOfMeasure: "1 GB Second", TierMinimumUnits: 400000},
+				{RetailPrice: 0, SkuName: "Standard", MeterName: "Standard Total Executions", UnitOfMeasure: "10"},
+				{RetailPrice: 0.000002, SkuName: "Standard", MeterName: "Standard Total Executions", UnitOfMeasure: "10", TierMinimumUnits: 100000},
+				{RetailPrice: 0.173, SkuName: "Premium", MeterName: "Premium vCPU Duration", UnitOfMeasure: "1 Hour"},
+				{RetailPrice: 0.0123, SkuName: "Premium", MeterName: "Premium Memory Duration", UnitOfMeasure: "1 GB Hour"},
+				{RetailPrice: 0.04, SkuName: "Flex Consumption", MeterName: "Always Ready Baseline", UnitOfMeasure: "1 GB Hour"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetFunctionsPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 5) // 3 Premium SKUs + execution + execution time
+	got := map[string]float64{}
+	for _, r := range results {
+		got[r.Name+"/"+r.Labels["sku"]] = r.Value
+	}
+	want := map[string]float64{
+		FunctionsExecutionTimeMetric + "/":  0.000016,
+		FunctionsExecutionMetric + "/":      0.0000002,
+		FunctionsPremiumPlanMetric + "/EP1": 0.173 + 3.5*0.0123,
+		FunctionsPremiumPlanMetric + "/EP2": 2*0.173 + 7*0.0123,
+		FunctionsPremiumPlanMetric + "/EP3": 4*0.173 + 14*0.0123,
+	}
+	for k, v := range want {
+		if math.Abs(got[k]-v) > 1e-12 {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if errorCount != 0 {
+		t.Errorf("expected errorCount=0, got %d", errorCount)
+	}
+}
+
+func TestGetFunctionsPricing_NoPremiumMeters(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.173, SkuName: "Premium", MeterName: "Premium vCPU Duration", UnitOfMeasure: "1 Hour"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetFunctionsPricing(context.Background(), "eastus", client, &errorCount, scrapes)
+	close(scrapes)
+	// Without the memory price no SKU price can be derived.
+	requireScrapeCount(t, drainScrapes(t, scrapes), 0)
+}
+
+func TestUnitQuantity(t *testing.T) {
+	tests := map[string]float64{
+		"1 Hour":     1,
+		"100 Hours":  100,
+		"10":         10,
+		"10K":        10000,
+		"1M":         1e6,
+		"1 GB/Month": 1,
+		"GB":         1,
+	}
+	for unit, want := range tests {
+		if got := unitQuantity(unit); got != want {
+			t.Errorf("unitQuantity(%q) = %v, want %v", unit, got, want)
+		}
+	}
+}
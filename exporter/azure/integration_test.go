@@ -15,7 +15,7 @@ func TestIntegration_AzureVMPricing(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	items, err := client.GetVMPrices(ctx, "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(ctx, "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("Azure API call failed: %v", err)
 	}
@@ -7,11 +7,15 @@ import (
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
-// drainScrapes collects all results from a closed ScrapeResult channel.
+// drainScrapes collects the price results from a closed ScrapeResult
+// channel, leaving out skipped items and failed requests.
 func drainScrapes(t *testing.T, ch <-chan provider.ScrapeResult) []provider.ScrapeResult {
 	t.Helper()
 	var results []provider.ScrapeResult
 	for r := range ch {
+		if r.Name == provider.SkippedName || r.Name == provider.FailedName {
+			continue
+		}
 		results = append(results, r)
 	}
 	return results
@@ -27,12 +31,32 @@ func requireScrapeCount(t *testing.T, results []provider.ScrapeResult, want int)
 
 // mockRetailPricesClient implements RetailPricesClient for testing.
 type mockRetailPricesClient struct {
-	GetVMPricesFn func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error)
+	GetVMPricesFn func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error)
+	GetPricesFn   func(ctx context.Context, filter string) ([]RetailPriceItem, error)
 }
 
-func (m *mockRetailPricesClient) GetVMPrices(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+// mockResourceSKUsClient implements ResourceSKUsClient for testing.
+type mockResourceSKUsClient struct {
+	GetVMSizesFn func(ctx context.Context, region string) (map[string]VMSize, error)
+}
+
+func (m *mockResourceSKUsClient) GetVMSizes(ctx context.Context, region string) (map[string]VMSize, error) {
+	if m.GetVMSizesFn != nil {
+		return m.GetVMSizesFn(ctx, region)
+	}
+	return nil, nil
+}
+
+func (m *mockRetailPricesClient) GetVMPrices(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 	if m.GetVMPricesFn != nil {
-		return m.GetVMPricesFn(ctx, region, osTypes)
+		return m.GetVMPricesFn(ctx, region, query)
+	}
+	return nil, nil
+}
+
+func (m *mockRetailPricesClient) GetPrices(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+	if m.GetPricesFn != nil {
+		return m.GetPricesFn(ctx, filter)
 	}
 	return nil, nil
 }
@@ -3,46 +3,114 @@ package azure
 import (
 	"context"
 	"regexp"
+	"strconv"
 	"strings"
-	"sync/atomic"
-
-	log "github.com/sirupsen/logrus"
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
-// GetOnDemandPricing fetches Azure VM on-demand prices for a single region
-// and sends results to the scrapes channel.
-func GetOnDemandPricing(ctx context.Context, region string, client RetailPricesClient, operatingSystems []string, instanceRegexes []*regexp.Regexp, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
-	items, err := client.GetVMPrices(ctx, region, operatingSystems)
+// GetOnDemandPricing fetches Azure VM prices for a single region and sends
+// results to the scrapes channel. Spot and Low Priority meters are only
+// returned when their lifecycle is part of the query and are labelled
+// instance_lifecycle="spot" and "lowpriority". When skuClient is non-nil, the
+// memory (MiB) and vcpu labels are filled from the Resource SKUs API.
+// Constrained-core sizes report their active vCPUs as vcpu and
+// constrained_vcpu, since the price covers the full hardware of the parent
+// size but only the active cores are usable.
+//
+// When both Linux and Windows are scraped, the Windows license uplift (the
+// Windows price minus the Linux price of the same size and price type) is
+// sent as azure_vm_windows_license, so Azure Hybrid Benefit users can read
+// their effective price off the Linux series.
+func GetOnDemandPricing(ctx context.Context, region string, client RetailPricesClient, skuClient ResourceSKUsClient, query VMPriceQuery, instanceRegexes []*regexp.Regexp, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	items, err := client.GetVMPrices(ctx, region, query)
 	if err != nil {
-		log.WithError(err).Errorf("error while fetching Azure VM prices [region=%s]", region)
-		atomic.AddUint64(errorCount, 1)
+		apiError(region, err, errorCount, scrapes).Errorf("error while fetching Azure VM prices [region=%s]", region)
 		return
 	}
 
+	var sizes map[string]VMSize
+	if skuClient != nil {
+		sizes, err = skuClient.GetVMSizes(ctx, region)
+		if err != nil {
+			apiError(region, err, errorCount, scrapes).Errorf("error while fetching Azure VM sizes, exporting prices without memory/vcpu labels [region=%s]", region)
+		}
+	}
+
+	linux := make(map[string]float64)
+	var windows []provider.ScrapeResult
 	for _, item := range items {
 		if len(instanceRegexes) > 0 && !provider.IsMatchAny(instanceRegexes, item.ArmSkuName) {
-			log.Debugf("Skipping Azure instance type: %s", item.ArmSkuName)
+			azureLog.SampledDebugf("Skipping Azure instance type: %s", item.ArmSkuName)
+			scrapes <- provider.Skipped("azure", region, provider.SkipFiltered)
 			continue
 		}
 
 		os := classifyAzureOS(item.ProductName)
-		if !provider.Contains(operatingSystems, os) {
+		if !provider.Contains(query.OperatingSystems, os) {
 			continue
 		}
 
-		scrapes <- provider.ScrapeResult{
+		result := provider.ScrapeResult{
 			Name:              "azure_vm",
 			Value:             item.RetailPrice,
 			Region:            region,
 			InstanceType:      item.ArmSkuName,
-			InstanceLifecycle: "ondemand",
+			InstanceLifecycle: MeterLifecycle(item.MeterName),
 			OperatingSystem:   os,
+			PriceType:         item.Type,
+			MeterName:         item.MeterName,
+			ProductName:       item.ProductName,
+		}
+		if size, ok := sizes[item.ArmSkuName]; ok {
+			result.Memory = strconv.Itoa(int(size.MemoryGiB * 1024))
+			result.VCpu = strconv.Itoa(int(size.VCpu))
+		}
+		if vcpu, ok := constrainedVCpu(item.ArmSkuName); ok {
+			result.VCpu = strconv.Itoa(vcpu)
+			result.ConstrainedVCpu = result.VCpu
+		}
+		scrapes <- result
+
+		switch os {
+		case "Linux":
+			linux[item.ArmSkuName+"/"+item.Type+"/"+result.InstanceLifecycle] = item.RetailPrice
+		case "Windows":
+			windows = append(windows, result)
+		}
+	}
+
+	for _, w := range windows {
+		compute, ok := linux[w.InstanceType+"/"+w.PriceType+"/"+w.InstanceLifecycle]
+		if !ok || w.Value < compute {
+			continue
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:              "azure_vm_windows_license",
+			Value:             w.Value - compute,
+			Region:            region,
+			InstanceType:      w.InstanceType,
+			InstanceLifecycle: w.InstanceLifecycle,
+			PriceType:         w.PriceType,
 		}
 	}
 }
 
+// constrainedSKU matches constrained-core sizes such as Standard_E8-4s_v5 or
+// Standard_M128-32ms; the number after the dash is the active vCPU count.
+var constrainedSKU = regexp.MustCompile(`^Standard_[A-Za-z]+\d+-(\d+)`)
+
+// constrainedVCpu returns the active vCPU count of a constrained-core size.
+// ok is false for regular sizes.
+func constrainedVCpu(armSkuName string) (int, bool) {
+	m := constrainedSKU.FindStringSubmatch(armSkuName)
+	if m == nil {
+		return 0, false
+	}
+	vcpu, err := strconv.Atoi(m[1])
+	return vcpu, err == nil
+}
+
 // classifyAzureOS returns "Windows" if the product name contains "Windows", otherwise "Linux".
 func classifyAzureOS(productName string) string {
 	if strings.Contains(productName, "Windows") {
@@ -50,3 +118,15 @@ func classifyAzureOS(productName string) string {
 	}
 	return "Linux"
 }
+
+// MeterLifecycle returns the lifecycle of a VM meter: Spot and Low Priority
+// meters carry the suffix in their name, e.g. "D2s v5 Low Priority".
+func MeterLifecycle(meterName string) string {
+	switch {
+	case strings.Contains(meterName, "Spot"):
+		return LifecycleSpot
+	case strings.Contains(meterName, "Low Priority"):
+		return LifecycleLowPriority
+	}
+	return LifecycleOnDemand
+}
@@ -3,6 +3,7 @@ package azure
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"testing"
 
@@ -11,10 +12,10 @@ import (
 
 func TestGetOnDemandPricing_SingleRegion(t *testing.T) {
 	client := &mockRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 			return []RetailPriceItem{
-				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
-				{RetailPrice: 0.192, ArmRegionName: "eastus", ArmSkuName: "Standard_D4s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D4s v5"},
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5", Type: "Consumption"},
+				{RetailPrice: 0.192, ArmRegionName: "eastus", ArmSkuName: "Standard_D4s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D4s v5", Type: "Consumption"},
 			}, nil
 		},
 	}
@@ -22,7 +23,7 @@ func TestGetOnDemandPricing_SingleRegion(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 10)
 	go func() {
-		GetOnDemandPricing(context.Background(), "eastus", client, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
 		close(scrapes)
 	}()
 	results := drainScrapes(t, scrapes)
@@ -41,6 +42,9 @@ func TestGetOnDemandPricing_SingleRegion(t *testing.T) {
 		if r.Region != "eastus" {
 			t.Errorf("results[%d]: expected region=eastus, got %q", i, r.Region)
 		}
+		if r.PriceType != "Consumption" {
+			t.Errorf("results[%d]: expected price type=Consumption, got %q", i, r.PriceType)
+		}
 	}
 	if results[0].InstanceType != "Standard_D2s_v5" || results[0].Value != 0.096 {
 		t.Errorf("first result: want Standard_D2s_v5/0.096, got %s/%v", results[0].InstanceType, results[0].Value)
@@ -52,7 +56,7 @@ func TestGetOnDemandPricing_SingleRegion(t *testing.T) {
 
 func TestGetOnDemandPricing_APIError(t *testing.T) {
 	client := &mockRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 			return nil, fmt.Errorf("connection refused")
 		},
 	}
@@ -60,7 +64,7 @@ func TestGetOnDemandPricing_APIError(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 10)
 	go func() {
-		GetOnDemandPricing(context.Background(), "eastus", client, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
 		close(scrapes)
 	}()
 	results := drainScrapes(t, scrapes)
@@ -73,7 +77,7 @@ func TestGetOnDemandPricing_APIError(t *testing.T) {
 
 func TestGetOnDemandPricing_RegexFilter(t *testing.T) {
 	client := &mockRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 			return []RetailPriceItem{
 				{RetailPrice: 0.096, ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series"},
 				{RetailPrice: 0.500, ArmSkuName: "Standard_E8s_v5", ProductName: "Virtual Machines Ev5 Series"},
@@ -84,7 +88,7 @@ func TestGetOnDemandPricing_RegexFilter(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 10)
 	go func() {
-		GetOnDemandPricing(context.Background(), "eastus", client, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(`^Standard_D`)}, &errorCount, scrapes)
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(`^Standard_D`)}, &errorCount, scrapes)
 		close(scrapes)
 	}()
 	results := drainScrapes(t, scrapes)
@@ -97,7 +101,7 @@ func TestGetOnDemandPricing_RegexFilter(t *testing.T) {
 
 func TestGetOnDemandPricing_OSFilter(t *testing.T) {
 	client := &mockRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 			return []RetailPriceItem{
 				{RetailPrice: 0.096, ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series"},
 				{RetailPrice: 0.200, ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series Windows"},
@@ -108,7 +112,7 @@ func TestGetOnDemandPricing_OSFilter(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 10)
 	go func() {
-		GetOnDemandPricing(context.Background(), "eastus", client, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
 		close(scrapes)
 	}()
 	results := drainScrapes(t, scrapes)
@@ -121,7 +125,7 @@ func TestGetOnDemandPricing_OSFilter(t *testing.T) {
 
 func TestGetOnDemandPricing_EmptyResponse(t *testing.T) {
 	client := &mockRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
 			return []RetailPriceItem{}, nil
 		},
 	}
@@ -129,7 +133,7 @@ func TestGetOnDemandPricing_EmptyResponse(t *testing.T) {
 	var errorCount uint64
 	scrapes := make(chan provider.ScrapeResult, 10)
 	go func() {
-		GetOnDemandPricing(context.Background(), "eastus", client, []string{"Linux"}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
 		close(scrapes)
 	}()
 
@@ -161,3 +165,164 @@ func TestClassifyAzureOS(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOnDemandPricing_VMSizes(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+				{RetailPrice: 0.5, ArmRegionName: "eastus", ArmSkuName: "Standard_Unknown", ProductName: "Virtual Machines", MeterName: "Unknown"},
+			}, nil
+		},
+	}
+	skuClient := &mockResourceSKUsClient{
+		GetVMSizesFn: func(ctx context.Context, region string) (map[string]VMSize, error) {
+			return map[string]VMSize{"Standard_D2s_v5": {VCpu: 2, MemoryGiB: 8}}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	go func() {
+		GetOnDemandPricing(context.Background(), "eastus", client, skuClient, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		close(scrapes)
+	}()
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 2)
+	if results[0].Memory != "8192" || results[0].VCpu != "2" {
+		t.Errorf("Standard_D2s_v5: expected memory=8192 vcpu=2, got memory=%q vcpu=%q", results[0].Memory, results[0].VCpu)
+	}
+	if results[1].Memory != "" || results[1].VCpu != "" {
+		t.Errorf("unknown size: expected empty labels, got memory=%q vcpu=%q", results[1].Memory, results[1].VCpu)
+	}
+}
+
+func TestMeterLifecycle(t *testing.T) {
+	tests := map[string]string{
+		"D2s v5":              LifecycleOnDemand,
+		"D2s v5 Spot":         LifecycleSpot,
+		"D2s v5 Low Priority": LifecycleLowPriority,
+	}
+	for meter, want := range tests {
+		if got := MeterLifecycle(meter); got != want {
+			t.Errorf("MeterLifecycle(%q) = %q, want %q", meter, got, want)
+		}
+	}
+}
+
+func TestConstrainedVCpu(t *testing.T) {
+	tests := []struct {
+		sku  string
+		want int
+		ok   bool
+	}{
+		{"Standard_E8-4s_v5", 4, true},
+		{"Standard_M128-32ms", 32, true},
+		{"Standard_DS13-2_v2", 2, true},
+		{"Standard_D2s_v5", 0, false},
+		{"Standard_NC24ads_A100_v4", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := constrainedVCpu(tt.sku)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("constrainedVCpu(%q) = %d, %v; want %d, %v", tt.sku, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetOnDemandPricing_ConstrainedVCpu(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.504, ArmRegionName: "eastus", ArmSkuName: "Standard_E8-4s_v5", ProductName: "Virtual Machines Esv5 Series", MeterName: "E8-4s v5"},
+				{RetailPrice: 0.504, ArmRegionName: "eastus", ArmSkuName: "Standard_E8s_v5", ProductName: "Virtual Machines Esv5 Series", MeterName: "E8s v5"},
+			}, nil
+		},
+	}
+	skuClient := &mockResourceSKUsClient{
+		GetVMSizesFn: func(ctx context.Context, region string) (map[string]VMSize, error) {
+			return map[string]VMSize{
+				"Standard_E8-4s_v5": {VCpu: 8, MemoryGiB: 64},
+				"Standard_E8s_v5":   {VCpu: 8, MemoryGiB: 64},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	go func() {
+		GetOnDemandPricing(context.Background(), "eastus", client, skuClient, VMPriceQuery{OperatingSystems: []string{"Linux"}}, nil, &errorCount, scrapes)
+		close(scrapes)
+	}()
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 2)
+	if results[0].VCpu != "4" || results[0].ConstrainedVCpu != "4" {
+		t.Errorf("Standard_E8-4s_v5: expected vcpu=4 constrained_vcpu=4, got vcpu=%q constrained_vcpu=%q", results[0].VCpu, results[0].ConstrainedVCpu)
+	}
+	if results[1].VCpu != "8" || results[1].ConstrainedVCpu != "" {
+		t.Errorf("Standard_E8s_v5: expected vcpu=8 and no constrained_vcpu, got vcpu=%q constrained_vcpu=%q", results[1].VCpu, results[1].ConstrainedVCpu)
+	}
+}
+
+func TestGetOnDemandPricing_WindowsLicense(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5", Type: "Consumption"},
+				{RetailPrice: 0.188, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series Windows", MeterName: "D2s v5", Type: "Consumption"},
+				{RetailPrice: 0.376, ArmRegionName: "eastus", ArmSkuName: "Standard_D4s_v5", ProductName: "Virtual Machines Dv5 Series Windows", MeterName: "D4s v5", Type: "Consumption"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	go func() {
+		GetOnDemandPricing(context.Background(), "eastus", client, nil, VMPriceQuery{OperatingSystems: []string{"Linux", "Windows"}}, nil, &errorCount, scrapes)
+		close(scrapes)
+	}()
+	results := drainScrapes(t, scrapes)
+
+	// 3 prices + 1 license uplift; Standard_D4s_v5 has no Linux price to compare against.
+	requireScrapeCount(t, results, 4)
+	license := results[3]
+	if license.Name != "azure_vm_windows_license" || license.InstanceType != "Standard_D2s_v5" {
+		t.Fatalf("expected azure_vm_windows_license for Standard_D2s_v5, got %s/%s", license.Name, license.InstanceType)
+	}
+	if math.Abs(license.Value-0.092) > 1e-9 {
+		t.Errorf("expected license uplift 0.092, got %v", license.Value)
+	}
+	if license.PriceType != "Consumption" {
+		t.Errorf("expected price type Consumption, got %q", license.PriceType)
+	}
+}
+
+func TestGetOnDemandPricing_VMSizesError(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
+			return []RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+			}, nil
+		},
+	}
+	skuClient := &mockResourceSKUsClient{
+		GetVMSizesFn: func(ctx context.Context, region string) (map[string]VMSize, error) {
+			return nil, fmt.Errorf("status 403")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	go func() {
+		GetOnDemandPricing(context.Background(), "eastus", client, skuClient, VMPriceQuery{OperatingSystems: []string{"Linux"}}, []*regexp.Regexp{regexp.MustCompile(".*")}, &errorCount, scrapes)
+		close(scrapes)
+	}()
+	results := drainScrapes(t, scrapes)
+
+	requireScrapeCount(t, results, 1)
+	if errorCount != 1 {
+		t.Errorf("expected errorCount=1, got %d", errorCount)
+	}
+}
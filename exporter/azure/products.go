@@ -0,0 +1,58 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// RetailPriceQuery selects the retail prices of any Azure service.
+type RetailPriceQuery struct {
+	// Metric is the name of the scrape results.
+	Metric string
+	// Filter is an OData $filter expression, e.g. "serviceName eq 'Storage'",
+	// restricted to the scraped region.
+	Filter string
+	// Labels maps label names to the item field they're taken from, e.g.
+	// "skuName" (see IsItemField).
+	Labels map[string]string
+	// Unit restricts prices to the items with this unit of measure, e.g.
+	// "1 GB/Month" (case-insensitive); empty = any unit.
+	Unit string
+}
+
+// GetRetailPricing fetches the items of q in a region and sends their USD
+// retail price per unit of measure to scrapes, labelled as q describes. Only
+// the first tier (tierMinimumUnits 0) of tiered prices is sent.
+func GetRetailPricing(ctx context.Context, region string, client RetailPricesClient, q RetailPriceQuery, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	filter := fmt.Sprintf("(%s) and armRegionName eq '%s'", q.Filter, region)
+	items, err := client.GetPrices(ctx, filter)
+	if err != nil {
+		apiError(region, err, errorCount, scrapes).Errorf("error while fetching Azure retail prices [region=%s, metric=%s]", region, q.Metric)
+		return
+	}
+	for _, item := range items {
+		if q.Unit != "" && !strings.EqualFold(item.UnitOfMeasure, q.Unit) {
+			continue
+		}
+		if item.TierMinimumUnits != 0 {
+			azureLog.SampledDebugf("Skipping Azure price tier [meter=%s, tier=%g]", item.MeterName, item.TierMinimumUnits)
+			continue
+		}
+		labels := make(map[string]string, len(q.Labels))
+		for label, field := range q.Labels {
+			labels[label] = ""
+			if value, ok := itemFields[field]; ok {
+				labels[label] = value(item)
+			}
+		}
+		scrapes <- provider.ScrapeResult{
+			Name:   q.Metric,
+			Value:  item.RetailPrice,
+			Region: region,
+			Labels: labels,
+		}
+	}
+}
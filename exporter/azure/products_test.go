@@ -0,0 +1,68 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func TestGetRetailPricing(t *testing.T) {
+	var gotFilter string
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			gotFilter = filter
+			return []RetailPriceItem{
+				{RetailPrice: 0.0184, SkuName: "Hot LRS", MeterName: "Hot LRS Data Stored", UnitOfMeasure: "1 GB/Month"},
+				{RetailPrice: 0.0177, SkuName: "Hot LRS", MeterName: "Hot LRS Data Stored", UnitOfMeasure: "1 GB/Month", TierMinimumUnits: 51200},
+				{RetailPrice: 0.0044, SkuName: "Hot LRS", MeterName: "Hot Read Operations", UnitOfMeasure: "10K"},
+			}, nil
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	query := RetailPriceQuery{
+		Metric: "blob_storage",
+		Filter: "serviceName eq 'Storage' and skuName eq 'Hot LRS'",
+		Labels: map[string]string{"sku": "skuName", "meter": "meterName"},
+		Unit:   "1 gb/month",
+	}
+	GetRetailPricing(context.Background(), "eastus", client, query, &errorCount, scrapes)
+	close(scrapes)
+
+	var results []provider.ScrapeResult
+	for r := range scrapes {
+		results = append(results, r)
+	}
+	if want := "(serviceName eq 'Storage' and skuName eq 'Hot LRS') and armRegionName eq 'eastus'"; gotFilter != want {
+		t.Errorf("filter = %q, want %q", gotFilter, want)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected the first tier of the matching unit only, got %+v", results)
+	}
+	r := results[0]
+	if r.Name != "blob_storage" || r.Region != "eastus" || r.Value != 0.0184 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r.Labels["sku"] != "Hot LRS" || r.Labels["meter"] != "Hot LRS Data Stored" {
+		t.Errorf("unexpected labels %v", r.Labels)
+	}
+}
+
+func TestGetRetailPricing_Error(t *testing.T) {
+	client := &mockRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+			return nil, errors.New("service unavailable")
+		},
+	}
+
+	var errorCount uint64
+	scrapes := make(chan provider.ScrapeResult, 10)
+	GetRetailPricing(context.Background(), "eastus", client, RetailPriceQuery{Metric: "m", Filter: "serviceName eq 'Storage'"}, &errorCount, scrapes)
+	close(scrapes)
+	if results := drainScrapes(t, scrapes); len(results) != 0 || errorCount != 1 {
+		t.Errorf("expected no results and errorCount=1, got %d results and errorCount=%d", len(results), errorCount)
+	}
+}
@@ -0,0 +1,105 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter caps the wait requested by a Retry-After header.
+const maxRetryAfter = 5 * time.Minute
+
+// rateLimiter is a token bucket shared by the retail price clients of all
+// regions. A nil *rateLimiter doesn't limit.
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64 // tokens per second; 0 = unlimited, Retry-After pauses only
+	burst      float64
+	tokens     float64
+	last       time.Time
+	pauseUntil time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second with
+// bursts of up to burst requests. A rate of 0 only honors pauses.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a request may be sent or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		d := l.reserve(time.Now())
+		if d <= 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.pauseUntil) {
+		return l.pauseUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// pause holds back all requests until t, e.g. when the API asked to retry
+// after a while.
+func (l *rateLimiter) pause(t time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t.After(l.pauseUntil) {
+		l.pauseUntil = t
+	}
+}
+
+// retryAfter returns the wait requested by the Retry-After header of resp,
+// in seconds or as an HTTP date, capped at maxRetryAfter. ok is false when
+// the header is missing or invalid.
+func retryAfter(resp *http.Response, now time.Time) (d time.Duration, ok bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	return min(d, maxRetryAfter), true
+}
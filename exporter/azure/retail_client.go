@@ -3,21 +3,44 @@ package azure
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/logging"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
+// azureLog logs the Azure price scrapes.
+var azureLog = logging.New("azure")
+
+// apiError classifies err of an Azure request of a scrape of region, counts
+// it in errorCount and reports it to scrapes. It returns the entry of
+// azureLog to log it with, which carries the remediation hint.
+func apiError(region string, err error, errorCount *uint64, scrapes chan<- provider.ScrapeResult) *log.Entry {
+	classified := apierror.Classify("azure", err)
+	atomic.AddUint64(errorCount, 1)
+	scrapes <- provider.Failed(region, classified)
+	return azureLog.WithError(classified).WithFields(classified.Fields())
+}
+
 const retailPricesBaseURL = "https://prices.azure.com/api/retail/prices"
 
 // DefaultClientFactory creates production Azure API clients.
 // A single shared HTTP client is reused across all regions for connection pooling.
 type DefaultClientFactory struct {
-	client *http.Client
+	client      *http.Client
+	tokens      *tokenSource // nil = no credentials, retail prices only
+	limiter     *rateLimiter // shared by the retail price clients of all regions
+	maxAttempts int
 }
 
 func NewDefaultClientFactory() *DefaultClientFactory {
@@ -30,35 +53,97 @@ func NewDefaultClientFactory() *DefaultClientFactory {
 				TLSHandshakeTimeout: 10 * time.Second,
 			},
 		},
+		limiter:     newRateLimiter(0, 1),
+		maxAttempts: defaultMaxAttempts,
+	}
+}
+
+// SetRateLimit limits the Retail Prices API requests of all regions to rate
+// per second with bursts of up to burst requests. A rate of 0 disables the
+// limit; Retry-After responses still pause all regions.
+func (f *DefaultClientFactory) SetRateLimit(rate float64, burst int) {
+	f.limiter = newRateLimiter(rate, burst)
+}
+
+// SetMaxAttempts sets how often a Retail Prices API request is attempted,
+// including the first attempt, when it fails or is throttled.
+func (f *DefaultClientFactory) SetMaxAttempts(attempts int) {
+	f.maxAttempts = attempts
+}
+
+// SetHTTPClient replaces the shared HTTP client of all Azure API clients.
+func (f *DefaultClientFactory) SetHTTPClient(client *http.Client) {
+	f.client = client
+	if f.tokens != nil {
+		f.tokens.client = client
+	}
+}
+
+// SetCredentials enables Resource Manager clients with the given service principal.
+func (f *DefaultClientFactory) SetCredentials(creds Credentials) {
+	f.tokens = &tokenSource{client: f.client, creds: creds, loginURL: loginBaseURL}
+}
+
+// CheckCredentials requests a Resource Manager token with the credentials of
+// SetCredentials.
+func (f *DefaultClientFactory) CheckCredentials(ctx context.Context) error {
+	if f.tokens == nil {
+		return errors.New("no Azure credentials set")
+	}
+	_, err := f.tokens.Token(ctx)
+	return err
+}
+
+func (f *DefaultClientFactory) NewResourceSKUsClient() ResourceSKUsClient {
+	if f.tokens == nil {
+		return nil
+	}
+	return &HTTPResourceSKUsClient{
+		client:         f.client,
+		tokens:         f.tokens,
+		subscriptionID: f.tokens.creds.SubscriptionID,
+		baseURL:        managementBaseURL,
 	}
 }
 
 func (f *DefaultClientFactory) NewRetailPricesClient() RetailPricesClient {
 	return &HTTPRetailPricesClient{
-		client:     f.client,
-		baseURL:    retailPricesBaseURL,
-		retryDelay: time.Second,
+		client:      f.client,
+		baseURL:     retailPricesBaseURL,
+		retryDelay:  time.Second,
+		limiter:     f.limiter,
+		maxAttempts: f.maxAttempts,
 	}
 }
 
 // HTTPRetailPricesClient calls the Azure Retail Prices REST API over HTTP.
 type HTTPRetailPricesClient struct {
-	client     *http.Client
-	baseURL    string        // overridable for tests
-	retryDelay time.Duration // base unit for exponential backoff; defaults to time.Second
+	client      *http.Client
+	baseURL     string        // overridable for tests
+	retryDelay  time.Duration // base unit for exponential backoff; defaults to time.Second
+	limiter     *rateLimiter  // nil = unlimited
+	maxAttempts int           // attempts per request; defaults to defaultMaxAttempts
 }
 
-func (c *HTTPRetailPricesClient) GetVMPrices(ctx context.Context, region string, osTypes []string) ([]RetailPriceItem, error) {
+func (c *HTTPRetailPricesClient) GetVMPrices(ctx context.Context, region string, query VMPriceQuery) ([]RetailPriceItem, error) {
+	priceTypes := query.PriceTypes
+	if len(priceTypes) == 0 {
+		priceTypes = []string{PriceTypeConsumption}
+	}
+	priceTypeFilters := make([]string, len(priceTypes))
+	for i, priceType := range priceTypes {
+		priceTypeFilters[i] = fmt.Sprintf("priceType eq '%s'", priceType)
+	}
 	filter := fmt.Sprintf(
-		"serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '%s' and isPrimaryMeterRegion eq true",
-		region,
+		"serviceName eq 'Virtual Machines' and (%s) and armRegionName eq '%s'",
+		strings.Join(priceTypeFilters, " or "), region,
 	)
 
 	// Apply OS-level filtering at the API to reduce data transfer.
 	// Azure has no explicit "os" field — Windows products contain "Windows" in productName.
 	// Only applied for single-OS configs; multi-OS falls back to client-side filtering in ondemand.go.
-	if len(osTypes) == 1 {
-		switch osTypes[0] {
+	if len(query.OperatingSystems) == 1 {
+		switch query.OperatingSystems[0] {
 		case "Windows":
 			filter += " and contains(productName, 'Windows')"
 		case "Linux":
@@ -66,86 +151,194 @@ func (c *HTTPRetailPricesClient) GetVMPrices(ctx context.Context, region string,
 		}
 	}
 
-	nextURL := fmt.Sprintf("%s?$filter=%s", c.baseURL, url.QueryEscape(filter))
+	if len(query.InstanceTypes) > 0 {
+		skuFilters := make([]string, len(query.InstanceTypes))
+		for i, sku := range query.InstanceTypes {
+			skuFilters[i] = fmt.Sprintf("armSkuName eq '%s'", sku)
+		}
+		filter += " and (" + strings.Join(skuFilters, " or ") + ")"
+	}
+
+	lifecycles := query.Lifecycles
+	if len(lifecycles) == 0 {
+		lifecycles = []string{LifecycleOnDemand}
+	}
 
+	results, err := c.fetch(ctx, filter+" and isPrimaryMeterRegion eq true", lifecycles)
+	if err != nil || len(results) > 0 {
+		return results, err
+	}
+
+	// Some regions are only priced through secondary meters; retry without
+	// the primary meter filter and keep one item per SKU, product, price type
+	// and lifecycle.
+	azureLog.Debugf("No primary meter prices for Azure region, falling back to secondary meters [region=%s]", region)
+	items, err := c.fetch(ctx, filter, lifecycles)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		key := item.ArmSkuName + "/" + item.ProductName + "/" + item.Type + "/" + MeterLifecycle(item.MeterName)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+// GetPrices returns every item matching an OData filter across all pages,
+// in the unit and currency (USD) the API reports them.
+func (c *HTTPRetailPricesClient) GetPrices(ctx context.Context, filter string) ([]RetailPriceItem, error) {
+	var results []RetailPriceItem
+	err := c.fetchPages(ctx, filter, func(item RetailPriceItem) {
+		results = append(results, item)
+	})
+	return results, err
+}
+
+// fetch returns the hourly VM prices of the given lifecycles matching filter
+// across all pages.
+func (c *HTTPRetailPricesClient) fetch(ctx context.Context, filter string, lifecycles []string) ([]RetailPriceItem, error) {
 	var results []RetailPriceItem //nolint:prealloc
+	err := c.fetchPages(ctx, filter, func(item RetailPriceItem) {
+		hours, ok := unitHours(item.UnitOfMeasure)
+		if !ok {
+			azureLog.SampledDebugf("Skipping Azure item with non-hourly unit: sku=%s unit=%q", item.ArmSkuName, item.UnitOfMeasure)
+			return
+		}
+		item.RetailPrice /= hours
+		if !provider.Contains(lifecycles, MeterLifecycle(item.MeterName)) {
+			return
+		}
+		if item.RetailPrice <= 0 {
+			azureLog.SampledDebugf("Skipping Azure item with non-positive price: sku=%s region=%s price=%f", item.ArmSkuName, item.ArmRegionName, item.RetailPrice)
+			return
+		}
+		if item.ArmSkuName == "" {
+			azureLog.SampledDebugf("Skipping Azure item with empty armSkuName: meterName=%s region=%s", item.MeterName, item.ArmRegionName)
+			return
+		}
+		results = append(results, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// fetchPages calls fn for every item matching filter across all pages.
+func (c *HTTPRetailPricesClient) fetchPages(ctx context.Context, filter string, fn func(RetailPriceItem)) error {
+	nextURL := fmt.Sprintf("%s?$filter=%s", c.baseURL, url.QueryEscape(filter))
 
 	for nextURL != "" {
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, nextURL, nil)
 		if err != nil {
-			return nil, fmt.Errorf("creating request: %w", err)
+			return fmt.Errorf("creating request: %w", err)
 		}
 
 		resp, err := c.doWithRetry(req)
 		if err != nil {
-			return nil, fmt.Errorf("fetching Azure prices: %w", err)
+			return fmt.Errorf("fetching Azure prices: %w", err)
 		}
 
 		var page RetailPriceResponse
 		err = json.NewDecoder(resp.Body).Decode(&page)
 		if err != nil {
 			_ = resp.Body.Close()
-			return nil, fmt.Errorf("decoding Azure response: %w", err)
+			return fmt.Errorf("decoding Azure response: %w", err)
 		}
 		_ = resp.Body.Close()
 
 		for _, item := range page.Items {
-			if item.UnitOfMeasure != "1 Hour" {
-				continue
-			}
-			if strings.Contains(item.MeterName, "Spot") || strings.Contains(item.MeterName, "Low Priority") {
-				continue
-			}
-			if item.RetailPrice <= 0 {
-				log.Debugf("Skipping Azure item with non-positive price: sku=%s region=%s price=%f", item.ArmSkuName, item.ArmRegionName, item.RetailPrice)
-				continue
-			}
-			if item.ArmSkuName == "" {
-				log.Debugf("Skipping Azure item with empty armSkuName: meterName=%s region=%s", item.MeterName, item.ArmRegionName)
-				continue
-			}
-			results = append(results, item)
+			fn(item)
 		}
 
 		validNext, err := validateNextPageLink(page.NextPageLink, c.baseURL)
 		if err != nil {
-			log.WithError(err).Warn("invalid NextPageLink, stopping pagination")
+			azureLog.WithError(err).Warn("invalid NextPageLink, stopping pagination")
 			break
 		}
 		nextURL = validNext
 	}
 
-	return results, nil
+	return nil
 }
 
-const maxRetries = 3
+// unitHours parses an hourly unit of measure such as "1 Hour", "10 Hours" or
+// "100 Hours" into its number of hours. ok is false for other units.
+func unitHours(unit string) (hours float64, ok bool) {
+	quantity, period, found := strings.Cut(strings.TrimSpace(unit), " ")
+	if !found || (period != "Hour" && period != "Hours") {
+		return 0, false
+	}
+	hours, err := strconv.ParseFloat(quantity, 64)
+	if err != nil || hours <= 0 {
+		return 0, false
+	}
+	return hours, true
+}
 
+const defaultMaxAttempts = 3
+
+// doWithRetry sends req through the rate limiter, retrying transport errors,
+// 429 and 5xx responses with exponential backoff. A Retry-After header on a
+// 429 or 503 response replaces the backoff and pauses the requests of all
+// regions sharing the limiter.
 func (c *HTTPRetailPricesClient) doWithRetry(req *http.Request) (*http.Response, error) {
 	delay := c.retryDelay
 	if delay == 0 {
 		delay = time.Second
 	}
+	maxAttempts := c.maxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
 	var lastErr error
-	for attempt := range maxRetries {
+	for attempt := range maxAttempts {
+		if err := c.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		backoff := time.Duration(1<<attempt) * delay
 		resp, err := c.client.Do(req)
 		if err != nil {
 			lastErr = err
-			time.Sleep(time.Duration(1<<attempt) * delay)
-			continue
-		}
-		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		} else if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
 			_ = resp.Body.Close()
-			lastErr = fmt.Errorf("azure API returned status %d", resp.StatusCode)
-			time.Sleep(time.Duration(1<<attempt) * delay)
-			continue
-		}
-		if resp.StatusCode != http.StatusOK {
+			lastErr = &apierror.StatusError{API: "azure API", StatusCode: resp.StatusCode}
+			if wait, ok := retryAfter(resp, time.Now()); ok {
+				azureLog.Debugf("Azure API asked to retry after %s [status=%d]", wait, resp.StatusCode)
+				c.limiter.pause(time.Now().Add(wait))
+				backoff = wait
+			}
+		} else if resp.StatusCode != http.StatusOK {
 			_ = resp.Body.Close()
-			return nil, fmt.Errorf("azure API returned status %d", resp.StatusCode)
+			return nil, &apierror.StatusError{API: "azure API", StatusCode: resp.StatusCode}
+		} else {
+			return resp, nil
+		}
+		if attempt == maxAttempts-1 {
+			break
 		}
-		return resp, nil
+		if err := sleepContext(req.Context(), backoff); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("azure API failed after %d attempts: %w", maxAttempts, lastErr)
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx's error then.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	return nil, fmt.Errorf("azure API failed after %d retries: %w", maxRetries, lastErr)
 }
 
 func validateNextPageLink(next, baseURL string) (string, error) {
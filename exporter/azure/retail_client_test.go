@@ -3,8 +3,11 @@ package azure
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,7 +31,7 @@ func TestHTTPClient_SinglePage(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	items, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -72,7 +75,7 @@ func TestHTTPClient_Pagination(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	items, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -96,7 +99,7 @@ func TestHTTPClient_ServerError(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	_, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	_, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err == nil {
 		t.Fatal("expected error on 500 status")
 	}
@@ -123,7 +126,7 @@ func TestHTTPClient_FiltersSpotAndLowPriority(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	items, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -133,6 +136,14 @@ func TestHTTPClient_FiltersSpotAndLowPriority(t *testing.T) {
 	if items[0].RetailPrice != 0.096 {
 		t.Errorf("expected price 0.096, got %f", items[0].RetailPrice)
 	}
+
+	items, err = client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{Lifecycles: []string{LifecycleOnDemand, LifecycleLowPriority}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 2 || items[1].RetailPrice != 0.030 {
+		t.Fatalf("expected on-demand and Low Priority items, got %+v", items)
+	}
 }
 
 func TestHTTPClient_RetriesOnTransientError(t *testing.T) {
@@ -158,7 +169,7 @@ func TestHTTPClient_RetriesOnTransientError(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	items, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("expected retry to succeed on third attempt, got error: %v", err)
 	}
@@ -184,12 +195,115 @@ func TestHTTPClient_ExhaustsAllRetries(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	_, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	_, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err == nil {
 		t.Fatal("expected error after exhausting all retries")
 	}
 	if callCount != 3 {
-		t.Errorf("expected exactly 3 attempts (maxRetries), got %d", callCount)
+		t.Errorf("expected exactly 3 attempts (defaultMaxAttempts), got %d", callCount)
+	}
+}
+
+func TestHTTPClient_MaxAttempts(t *testing.T) {
+	callCount := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond, maxAttempts: 5}
+	_, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{})
+	if err == nil {
+		t.Fatal("expected error after exhausting all attempts")
+	}
+	if callCount != 5 {
+		t.Errorf("expected 5 attempts, got %d", callCount)
+	}
+}
+
+func TestHTTPClient_RetryAfter(t *testing.T) {
+	callCount := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(RetailPriceResponse{})
+	}))
+	defer srv.Close()
+
+	limiter := newRateLimiter(0, 1)
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond, limiter: limiter}
+	start := time.Now()
+	if _, err := client.fetch(context.Background(), "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the retry to wait for Retry-After (1s), took %s", elapsed)
+	}
+	if callCount != 2 {
+		t.Errorf("expected 2 calls, got %d", callCount)
+	}
+	if !limiter.pauseUntil.After(start) {
+		t.Error("expected Retry-After to pause the shared limiter")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"garbage", 0, false},
+		{"7", 7 * time.Second, true},
+		{"3600", maxRetryAfter, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v; want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Now()
+	l := newRateLimiter(10, 2)
+	l.last = start
+
+	// The burst is available right away, then one token every 100ms.
+	for i := range 2 {
+		if d := l.reserve(start); d != 0 {
+			t.Fatalf("request %d: expected burst token, got wait %s", i, d)
+		}
+	}
+	if d := l.reserve(start); d != 100*time.Millisecond {
+		t.Errorf("expected 100ms wait after the burst, got %s", d)
+	}
+	if d := l.reserve(start.Add(100 * time.Millisecond)); d != 0 {
+		t.Errorf("expected a token after 100ms, got wait %s", d)
+	}
+
+	l.pause(start.Add(time.Minute))
+	if d := l.reserve(start.Add(time.Second)); d != 59*time.Second {
+		t.Errorf("expected pause until 1m, got wait %s", d)
+	}
+
+	var unlimited *rateLimiter
+	if err := unlimited.wait(context.Background()); err != nil {
+		t.Errorf("nil limiter should not limit: %v", err)
 	}
 }
 
@@ -198,8 +312,9 @@ func TestHTTPClient_FiltersNonHourly(t *testing.T) {
 		Items: []RetailPriceItem{
 			{RetailPrice: 0.096, ArmSkuName: "Standard_D2s_v5", MeterName: "D2s v5", UnitOfMeasure: "1 Hour"},
 			{RetailPrice: 70.08, ArmSkuName: "Standard_D2s_v5", MeterName: "D2s v5", UnitOfMeasure: "1 Month"},
+			{RetailPrice: 9.6, ArmSkuName: "Standard_D4s_v5", MeterName: "D4s v5", UnitOfMeasure: "100 Hours"},
 		},
-		Count: 2,
+		Count: 3,
 	}
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -213,11 +328,160 @@ func TestHTTPClient_FiltersNonHourly(t *testing.T) {
 		retryDelay: time.Millisecond,
 	}
 
-	items, err := client.GetVMPrices(context.Background(), "eastus", []string{"Linux"})
+	items, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{OperatingSystems: []string{"Linux"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(items) != 1 {
-		t.Fatalf("expected 1 item (non-hourly filtered), got %d", len(items))
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items (non-hourly filtered), got %d", len(items))
+	}
+	if items[1].ArmSkuName != "Standard_D4s_v5" || math.Abs(items[1].RetailPrice-0.096) > 1e-9 {
+		t.Errorf("expected Standard_D4s_v5 normalized to 0.096/hour, got %s/%v", items[1].ArmSkuName, items[1].RetailPrice)
+	}
+}
+
+func TestUnitHours(t *testing.T) {
+	tests := []struct {
+		unit  string
+		hours float64
+		ok    bool
+	}{
+		{"1 Hour", 1, true},
+		{"10 Hours", 10, true},
+		{"100 Hours", 100, true},
+		{"1 Month", 0, false},
+		{"1 GB/Month", 0, false},
+		{"Hour", 0, false},
+		{"0 Hours", 0, false},
+	}
+	for _, tt := range tests {
+		hours, ok := unitHours(tt.unit)
+		if hours != tt.hours || ok != tt.ok {
+			t.Errorf("unitHours(%q) = %v, %v; want %v, %v", tt.unit, hours, ok, tt.hours, tt.ok)
+		}
+	}
+}
+
+func TestHTTPClient_PriceTypeFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		priceTypes []string
+		want       string
+	}{
+		{"default", nil, "(priceType eq 'Consumption')"},
+		{"devtest", []string{PriceTypeConsumption, PriceTypeDevTestConsumption}, "(priceType eq 'Consumption' or priceType eq 'DevTestConsumption')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filter = r.URL.Query().Get("$filter")
+				_ = json.NewEncoder(w).Encode(RetailPriceResponse{})
+			}))
+			defer srv.Close()
+
+			client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond}
+			if _, err := client.GetVMPrices(context.Background(), "eastus", VMPriceQuery{PriceTypes: tt.priceTypes}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(filter, tt.want) {
+				t.Errorf("filter %q does not contain %q", filter, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_InstanceTypeFilter(t *testing.T) {
+	var filter string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("$filter")
+		_ = json.NewEncoder(w).Encode(RetailPriceResponse{})
+	}))
+	defer srv.Close()
+
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond}
+	query := VMPriceQuery{InstanceTypes: []string{"Standard_D2s_v5", "Standard_E4s_v5"}}
+	if _, err := client.GetVMPrices(context.Background(), "eastus", query); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "(armSkuName eq 'Standard_D2s_v5' or armSkuName eq 'Standard_E4s_v5')"
+	if !strings.Contains(filter, want) {
+		t.Errorf("filter %q does not contain %q", filter, want)
+	}
+}
+
+func TestHTTPClient_SecondaryMeterFallback(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var resp RetailPriceResponse
+		if !strings.Contains(r.URL.Query().Get("$filter"), "isPrimaryMeterRegion eq true") {
+			resp.Items = []RetailPriceItem{
+				{RetailPrice: 0.11, ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5", UnitOfMeasure: "1 Hour", Type: "Consumption"},
+				{RetailPrice: 0.12, ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5", UnitOfMeasure: "1 Hour", Type: "Consumption"},
+				{RetailPrice: 0.22, ArmSkuName: "Standard_D4s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D4s v5", UnitOfMeasure: "1 Hour", Type: "Consumption"},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond}
+	items, err := client.GetVMPrices(context.Background(), "qatarcentral", VMPriceQuery{OperatingSystems: []string{"Linux"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected primary query and fallback, got %d requests", requests)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items (duplicate meters dropped), got %d", len(items))
+	}
+	if items[0].RetailPrice != 0.11 {
+		t.Errorf("expected first meter price 0.11, got %v", items[0].RetailPrice)
+	}
+}
+
+func TestHTTPClient_RetryCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetVMPrices(ctx, "eastus", VMPriceQuery{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retry backoff not interrupted, took %s", elapsed)
+	}
+}
+
+func TestHTTPClient_GetPrices(t *testing.T) {
+	var filter string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("$filter")
+		_ = json.NewEncoder(w).Encode(RetailPriceResponse{Items: []RetailPriceItem{
+			{RetailPrice: 0.0184, SkuName: "Hot LRS", MeterName: "Hot LRS Data Stored", UnitOfMeasure: "1 GB/Month"},
+			{RetailPrice: 0, SkuName: "Hot LRS", MeterName: "Hot LRS Data Stored", UnitOfMeasure: "1 GB/Month", TierMinimumUnits: 51200},
+		}})
+	}))
+	defer srv.Close()
+
+	client := &HTTPRetailPricesClient{client: srv.Client(), baseURL: srv.URL, retryDelay: time.Millisecond}
+	items, err := client.GetPrices(context.Background(), "serviceName eq 'Storage'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter != "serviceName eq 'Storage'" {
+		t.Errorf("unexpected filter %q", filter)
+	}
+	if len(items) != 2 || items[0].SkuName != "Hot LRS" || items[1].TierMinimumUnits != 51200 {
+		t.Errorf("expected both items unfiltered, got %+v", items)
 	}
 }
@@ -0,0 +1,128 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// servicePrice describes the series an item of an Azure service is exported
+// as.
+type servicePrice struct {
+	metric string
+	labels map[string]string
+	per    float64 // units of measure the item price covers, e.g. 10 for "10"; 0 = 1
+}
+
+// id identifies the series of p.
+func (p servicePrice) id() string {
+	keys := make([]string, 0, len(p.labels))
+	for k := range p.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(p.metric)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\xff%s=%s", k, p.labels[k])
+	}
+	return b.String()
+}
+
+// seriesPrice is the price of a series of a service.
+type seriesPrice struct {
+	price servicePrice
+	value float64
+}
+
+// getServicePrices fetches the prices of the series of a service in a region
+// (see fetchServicePrices) and sends them to scrapes.
+func getServicePrices(ctx context.Context, region string, client RetailPricesClient, service, filter string, price func(RetailPriceItem) (servicePrice, bool), errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	prices, err := fetchServicePrices(ctx, region, client, filter, price)
+	if err != nil {
+		apiError(region, err, errorCount, scrapes).Errorf("error while fetching Azure %s prices [region=%s]", service, region)
+		return
+	}
+	sendServicePrices(region, prices, scrapes)
+}
+
+// sendServicePrices sends prices to scrapes.
+func sendServicePrices(region string, prices []seriesPrice, scrapes chan<- provider.ScrapeResult) {
+	for _, p := range prices {
+		scrapes <- provider.ScrapeResult{
+			Name:   p.price.metric,
+			Value:  p.value,
+			Region: region,
+			Labels: p.price.labels,
+		}
+	}
+}
+
+// fetchServicePrices fetches the Consumption items matching filter in a
+// region and returns the first paid tier price of every series price maps
+// items to, skipping free grants such as the first 400,000 GB-s of Functions
+// executions. It's 0 if every tier is free. Items of the same series are
+// deduplicated, keeping the lowest price.
+func fetchServicePrices(ctx context.Context, region string, client RetailPricesClient, filter string, price func(RetailPriceItem) (servicePrice, bool)) ([]seriesPrice, error) {
+	items, err := client.GetPrices(ctx, fmt.Sprintf("(%s) and priceType eq '%s' and armRegionName eq '%s'", filter, PriceTypeConsumption, region))
+	if err != nil {
+		return nil, err
+	}
+
+	type series struct {
+		seriesPrice
+		tier float64 // tierMinimumUnits of value
+		paid bool    // value isn't free
+	}
+	var ids []string
+	exported := make(map[string]*series)
+	for _, item := range items {
+		p, ok := price(item)
+		if !ok {
+			continue
+		}
+		value := item.RetailPrice
+		if p.per > 0 {
+			value /= p.per
+		}
+		id := p.id()
+		s, found := exported[id]
+		switch {
+		case !found:
+			ids = append(ids, id)
+			exported[id] = &series{seriesPrice: seriesPrice{p, value}, tier: item.TierMinimumUnits, paid: value != 0}
+		case value == 0:
+			// Free tiers never replace a price.
+		case !s.paid, item.TierMinimumUnits < s.tier, item.TierMinimumUnits == s.tier && value < s.value:
+			s.value, s.tier, s.paid = value, item.TierMinimumUnits, true
+		}
+	}
+	prices := make([]seriesPrice, 0, len(ids))
+	for _, id := range ids {
+		prices = append(prices, exported[id].seriesPrice)
+	}
+	return prices, nil
+}
+
+// unitQuantity returns the number of units a price with the unit of measure
+// covers, e.g. 10 for "10", 10000 for "10K" or 1 for "1 GB/Month". It's 1 if
+// the unit doesn't start with a quantity.
+func unitQuantity(unit string) float64 {
+	quantity, _, _ := strings.Cut(strings.TrimSpace(unit), " ")
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(quantity, "K"):
+		quantity, scale = strings.TrimSuffix(quantity, "K"), 1e3
+	case strings.HasSuffix(quantity, "M"):
+		quantity, scale = strings.TrimSuffix(quantity, "M"), 1e6
+	}
+	n, err := strconv.ParseFloat(quantity, 64)
+	if err != nil || n <= 0 {
+		return 1
+	}
+	return n * scale
+}
@@ -0,0 +1,109 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+)
+
+const resourceSKUsAPIVersion = "2021-07-01"
+
+// ResourceSKUsClient fetches VM size specifications from the Compute Resource SKUs API.
+type ResourceSKUsClient interface {
+	GetVMSizes(ctx context.Context, region string) (map[string]VMSize, error)
+}
+
+// VMSize is the specification of an Azure VM size.
+type VMSize struct {
+	VCpu      int32
+	MemoryGiB float64
+}
+
+// resourceSKUsResponse is a page of the Compute Resource SKUs API.
+type resourceSKUsResponse struct {
+	Value []struct {
+		ResourceType string `json:"resourceType"`
+		Name         string `json:"name"`
+		Capabilities []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"capabilities"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// HTTPResourceSKUsClient calls the Compute Resource SKUs REST API over HTTP
+// with a service principal token.
+type HTTPResourceSKUsClient struct {
+	client         *http.Client
+	tokens         *tokenSource
+	subscriptionID string
+	baseURL        string // overridable for tests
+}
+
+// GetVMSizes returns the vCPU and memory of every virtual machine SKU offered
+// in region, keyed by ARM SKU name (e.g. "Standard_D2s_v3").
+func (c *HTTPResourceSKUsClient) GetVMSizes(ctx context.Context, region string) (map[string]VMSize, error) {
+	nextURL := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/skus?api-version=%s&$filter=%s",
+		c.baseURL, url.PathEscape(c.subscriptionID), resourceSKUsAPIVersion, url.QueryEscape(fmt.Sprintf("location eq '%s'", region)))
+
+	sizes := make(map[string]VMSize)
+	for nextURL != "" {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, nextURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetching Azure resource SKUs: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, &apierror.StatusError{API: "azure resource SKUs API", StatusCode: resp.StatusCode, Permission: "Microsoft.Compute/skus/read"}
+		}
+		var page resourceSKUsResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding Azure resource SKUs: %w", err)
+		}
+
+		for _, sku := range page.Value {
+			if !strings.EqualFold(sku.ResourceType, "virtualMachines") {
+				continue
+			}
+			var size VMSize
+			for _, capability := range sku.Capabilities {
+				switch capability.Name {
+				case "vCPUs":
+					if v, err := strconv.ParseInt(capability.Value, 10, 32); err == nil {
+						size.VCpu = int32(v)
+					}
+				case "MemoryGB":
+					if v, err := strconv.ParseFloat(capability.Value, 64); err == nil {
+						size.MemoryGiB = v
+					}
+				}
+			}
+			sizes[sku.Name] = size
+		}
+
+		nextURL, err = validateNextPageLink(page.NextLink, c.baseURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
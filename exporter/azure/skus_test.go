@@ -0,0 +1,141 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+)
+
+func TestHTTPResourceSKUsClient_GetVMSizes(t *testing.T) {
+	var tokenRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "tok", "expires_in": 3600}`))
+	})
+	var srvURL string
+	mux.HandleFunc("/subscriptions/sub/providers/Microsoft.Compute/skus", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.Contains(r.URL.Query().Get("$filter"), "eastus") {
+			t.Errorf("expected location filter, got %q", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("page") == "" {
+			_, _ = w.Write([]byte(`{"value": [
+				{"resourceType": "virtualMachines", "name": "Standard_D2s_v5", "capabilities": [{"name": "vCPUs", "value": "2"}, {"name": "MemoryGB", "value": "8"}]},
+				{"resourceType": "disks", "name": "Premium_LRS", "capabilities": []}
+			], "nextLink": "` + srvURL + r.URL.Path + `?page=2&$filter=location%20eq%20%27eastus%27"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"value": [
+			{"resourceType": "virtualMachines", "name": "Standard_E2s_v5", "capabilities": [{"name": "vCPUs", "value": "2"}, {"name": "MemoryGB", "value": "16"}]}
+		]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	srvURL = srv.URL
+
+	client := &HTTPResourceSKUsClient{
+		client:         srv.Client(),
+		tokens:         &tokenSource{client: srv.Client(), creds: Credentials{TenantID: "tenant", ClientID: "id", ClientSecret: "secret"}, loginURL: srv.URL},
+		subscriptionID: "sub",
+		baseURL:        srv.URL,
+	}
+
+	sizes, err := client.GetVMSizes(context.Background(), "eastus")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("expected 2 VM sizes, got %d: %v", len(sizes), sizes)
+	}
+	if got := sizes["Standard_D2s_v5"]; got.VCpu != 2 || got.MemoryGiB != 8 {
+		t.Errorf("Standard_D2s_v5: got %+v", got)
+	}
+	if got := sizes["Standard_E2s_v5"]; got.VCpu != 2 || got.MemoryGiB != 16 {
+		t.Errorf("Standard_E2s_v5: got %+v", got)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected the token to be cached across pages, got %d token requests", tokenRequests)
+	}
+}
+
+func TestHTTPResourceSKUsClient_TokenError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := &HTTPResourceSKUsClient{
+		client:         srv.Client(),
+		tokens:         &tokenSource{client: srv.Client(), creds: Credentials{TenantID: "tenant"}, loginURL: srv.URL},
+		subscriptionID: "sub",
+		baseURL:        srv.URL,
+	}
+	if _, err := client.GetVMSizes(context.Background(), "eastus"); err == nil {
+		t.Fatal("expected error when the token request fails")
+	}
+}
+
+func TestDefaultClientFactory_CheckCredentials(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+	}))
+	defer srv.Close()
+
+	f := NewDefaultClientFactory()
+	if err := f.CheckCredentials(context.Background()); err == nil {
+		t.Error("expected error without credentials")
+	}
+	f.SetCredentials(Credentials{TenantID: "tenant", ClientID: "id", ClientSecret: "secret", SubscriptionID: "sub"})
+	f.tokens.loginURL = srv.URL
+	if err := f.CheckCredentials(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	status = http.StatusUnauthorized
+	f.tokens.token = ""
+	err := f.CheckCredentials(context.Background())
+	if e := apierror.Classify("azure", err); e == nil || e.Category != apierror.CategoryCredentials {
+		t.Errorf("expected a credentials error, got %v", err)
+	}
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "id")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret")
+	t.Setenv("AZURE_SUBSCRIPTION_ID", "")
+	if _, ok := CredentialsFromEnv(); ok {
+		t.Error("expected incomplete credentials without a subscription")
+	}
+	t.Setenv("AZURE_SUBSCRIPTION_ID", "sub")
+	creds, ok := CredentialsFromEnv()
+	if !ok || creds.SubscriptionID != "sub" {
+		t.Errorf("expected complete credentials, got %+v (ok=%v)", creds, ok)
+	}
+}
+
+func TestDefaultClientFactory_ResourceSKUsClientRequiresCredentials(t *testing.T) {
+	f := NewDefaultClientFactory()
+	if f.NewResourceSKUsClient() != nil {
+		t.Error("expected no Resource SKUs client without credentials")
+	}
+	f.SetCredentials(Credentials{TenantID: "tenant", ClientID: "id", ClientSecret: "secret", SubscriptionID: "sub"})
+	if f.NewResourceSKUsClient() == nil {
+		t.Error("expected a Resource SKUs client with credentials")
+	}
+}
@@ -19,4 +19,37 @@ type RetailPriceItem struct {
 	IsPrimaryMeterRegion bool    `json:"isPrimaryMeterRegion"`
 	ServiceName          string  `json:"serviceName"`
 	CurrencyCode         string  `json:"currencyCode"`
+	ServiceFamily        string  `json:"serviceFamily"`
+	SkuName              string  `json:"skuName"`
+	MeterID              string  `json:"meterId"`
+	ProductID            string  `json:"productId"`
+	SkuID                string  `json:"skuId"`
+	Location             string  `json:"location"`
+	ReservationTerm      string  `json:"reservationTerm"`
+	TierMinimumUnits     float64 `json:"tierMinimumUnits"`
+}
+
+// itemFields are the RetailPriceItem fields labels can be taken from, by
+// their API name.
+var itemFields = map[string]func(RetailPriceItem) string{
+	"armRegionName":   func(i RetailPriceItem) string { return i.ArmRegionName },
+	"armSkuName":      func(i RetailPriceItem) string { return i.ArmSkuName },
+	"productName":     func(i RetailPriceItem) string { return i.ProductName },
+	"meterName":       func(i RetailPriceItem) string { return i.MeterName },
+	"unitOfMeasure":   func(i RetailPriceItem) string { return i.UnitOfMeasure },
+	"type":            func(i RetailPriceItem) string { return i.Type },
+	"serviceName":     func(i RetailPriceItem) string { return i.ServiceName },
+	"serviceFamily":   func(i RetailPriceItem) string { return i.ServiceFamily },
+	"skuName":         func(i RetailPriceItem) string { return i.SkuName },
+	"meterId":         func(i RetailPriceItem) string { return i.MeterID },
+	"productId":       func(i RetailPriceItem) string { return i.ProductID },
+	"skuId":           func(i RetailPriceItem) string { return i.SkuID },
+	"location":        func(i RetailPriceItem) string { return i.Location },
+	"reservationTerm": func(i RetailPriceItem) string { return i.ReservationTerm },
+}
+
+// IsItemField reports whether labels can be taken from the item field name.
+func IsItemField(name string) bool {
+	_, ok := itemFields[name]
+	return ok
 }
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// azureConfigMetricPrefix prefixes the pricing metric names of the Azure
+// metrics of the configuration file; the azure_ prefix makes their prices
+// belong to Azure regions (see metricProvider).
+const azureConfigMetricPrefix = "azure_config:"
+
+// WithAzureMetrics exports the Azure metrics of the configuration file,
+// scraped from the Retail Prices API for every Azure region.
+func WithAzureMetrics(metrics []config.AzureMetric) Option {
+	return func(e *Exporter) {
+		e.azureMetrics = metrics
+	}
+}
+
+// validateAzureMetrics checks that the labels of the Azure metrics are taken
+// from known item fields.
+func (e *Exporter) validateAzureMetrics() error {
+	for _, m := range e.azureMetrics {
+		for label, field := range m.Labels {
+			if !azure.IsItemField(field) {
+				return fmt.Errorf("Azure metric %q: label %q is taken from unknown field %q", m.Name, label, field)
+			}
+		}
+	}
+	return nil
+}
+
+// initAzureMetricGauges creates the pricing metrics of the Azure metrics,
+// labelled with region and their labels in alphabetical order.
+func (e *Exporter) initAzureMetricGauges() {
+	for _, m := range e.azureMetrics {
+		labels := make([]string, 0, len(m.Labels)+1)
+		for label := range m.Labels {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		e.newPricingMetric(azureConfigMetricPrefix+m.Name, prometheus.GaugeOpts{
+			Name: m.Name,
+			Help: m.Help,
+		}, e.priceLabels(append([]string{"region"}, labels...)...))
+	}
+}
+
+// scrapeAzureMetrics scrapes the Azure metrics of a region.
+func (e *Exporter) scrapeAzureMetrics(ctx context.Context, region string, client azure.RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	for _, m := range e.azureMetrics {
+		azure.GetRetailPricing(ctx, region, client, azure.RetailPriceQuery{
+			Metric: azureConfigMetricPrefix + m.Name,
+			Filter: m.Filter,
+			Labels: m.Labels,
+			Unit:   m.Unit,
+		}, errorCount, scrapes)
+	}
+}
@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// WithAzureAKS exports the hourly AKS cluster fee of the Standard and Premium
+// pricing tiers of every Azure region from the Retail Prices API.
+func WithAzureAKS(enabled bool) Option {
+	return func(e *Exporter) {
+		e.azureAKS = enabled
+	}
+}
+
+// WithAzureFunctions exports the Functions Premium plan SKU prices and the
+// consumption plan execution prices of every Azure region from the Retail
+// Prices API.
+func WithAzureFunctions(enabled bool) Option {
+	return func(e *Exporter) {
+		e.azureFunctions = enabled
+	}
+}
+
+// WithAzureCosmosDB exports the Cosmos DB service group, the provisioned
+// throughput, serverless request unit and storage prices of every Azure
+// region, from the Retail Prices API.
+func WithAzureCosmosDB(enabled bool) Option {
+	return func(e *Exporter) {
+		e.azureCosmosDB = enabled
+	}
+}
+
+// WithAzureStorage exports the storage service group, the Azure Files storage
+// prices by tier and redundancy of every Azure region, from the Retail Prices
+// API.
+func WithAzureStorage(enabled bool) Option {
+	return func(e *Exporter) {
+		e.azureStorage = enabled
+	}
+}
+
+// WithAzureNetAppFiles adds the Azure NetApp Files capacity prices by service
+// level to the storage service group; it has no effect without
+// WithAzureStorage.
+func WithAzureNetAppFiles(enabled bool) Option {
+	return func(e *Exporter) {
+		e.azureNetAppFiles = enabled
+	}
+}
+
+// initAzureServiceGauges creates the pricing metrics of the enabled Azure
+// services other than VMs.
+func (e *Exporter) initAzureServiceGauges() {
+	if e.azureAKS {
+		e.newPricingMetric(azure.AKSClusterMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "aks_cluster",
+			Help:      "Hourly fee per AKS cluster of the pricing tier, on top of the node VM prices.",
+		}, e.priceLabels("region", "tier"))
+	}
+	if e.azureFunctions {
+		e.newPricingMetric(azure.FunctionsPremiumPlanMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "functions_premium_plan",
+			Help:      "Hourly price of an instance of the Functions Premium plan SKU.",
+		}, e.priceLabels("region", "sku"))
+		e.newPricingMetric(azure.FunctionsExecutionMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "functions_execution",
+			Help:      "Price of a Functions consumption plan execution beyond the free grant.",
+		}, e.priceLabels("region"))
+		e.newPricingMetric(azure.FunctionsExecutionTimeMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "functions_execution_time_gb_second",
+			Help:      "Price of a GB-second of Functions consumption plan execution time beyond the free grant.",
+		}, e.priceLabels("region"))
+	}
+	if e.azureCosmosDB {
+		e.newPricingMetric(azure.CosmosDBThroughputMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "cosmosdb_provisioned_throughput",
+			Help:      "Hourly price of 1 RU/s of Cosmos DB standard or autoscale provisioned throughput.",
+		}, e.priceLabels("region", "capacity_mode"))
+		e.newPricingMetric(azure.CosmosDBRequestMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "cosmosdb_serverless_request_unit",
+			Help:      "Price of a Cosmos DB serverless request unit.",
+		}, e.priceLabels("region"))
+		e.newPricingMetric(azure.CosmosDBStorageMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "cosmosdb_storage_gb_month",
+			Help:      "Monthly price of a GB of Cosmos DB transactional storage of the capacity mode.",
+		}, e.priceLabels("region", "capacity_mode"))
+	}
+	if e.azureStorage {
+		e.newPricingMetric(azure.FilesStorageMetric, prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "files_storage_gb_month",
+			Help:      "Monthly price of a GB of Azure Files share storage of the tier and redundancy, provisioned for the premium tier.",
+		}, e.priceLabels("region", "tier", "redundancy"))
+		if e.azureNetAppFiles {
+			e.newPricingMetric(azure.NetAppFilesMetric, prometheus.GaugeOpts{
+				Namespace: "azure_pricing",
+				Name:      "netapp_files_capacity_gib_hour",
+				Help:      "Hourly price of a GiB of provisioned Azure NetApp Files capacity of the service level.",
+			}, e.priceLabels("region", "tier"))
+		}
+	}
+}
+
+// scrapeAzureServices scrapes the enabled Azure services other than VMs in a
+// region.
+func (e *Exporter) scrapeAzureServices(ctx context.Context, region string, client azure.RetailPricesClient, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	if e.azureAKS {
+		azure.GetAKSPricing(ctx, region, client, errorCount, scrapes)
+	}
+	if e.azureFunctions {
+		azure.GetFunctionsPricing(ctx, region, client, errorCount, scrapes)
+	}
+	if e.azureCosmosDB {
+		azure.GetCosmosDBPricing(ctx, region, client, errorCount, scrapes)
+	}
+	if e.azureStorage {
+		azure.GetFilesPricing(ctx, region, client, errorCount, scrapes)
+		if e.azureNetAppFiles {
+			azure.GetNetAppFilesPricing(ctx, region, client, errorCount, scrapes)
+		}
+	}
+}
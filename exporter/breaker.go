@@ -0,0 +1,77 @@
+package exporter
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBreakerCooldown caps the exponential cooldown of an open circuit breaker.
+const maxBreakerCooldown = 6 * time.Hour
+
+// breaker tracks consecutive failed scrapes of a region.
+type breaker struct {
+	failures  int // consecutive scrapes with errors
+	trips     int // consecutive times the breaker opened
+	openUntil time.Time
+}
+
+// breakerAllows reports whether key may be scraped, i.e. its breaker is
+// disabled, closed, or its cooldown has passed. A region whose cooldown has
+// passed is scraped once; another failure reopens the breaker right away.
+func (e *Exporter) breakerAllows(key regionKey, now time.Time) bool {
+	if e.breakerFailures <= 0 {
+		return true
+	}
+	b, ok := e.breakers[key]
+	if !ok || !now.Before(b.openUntil) {
+		return true
+	}
+	if e.skippedRegions == nil {
+		e.skippedRegions = make(map[regionKey]bool)
+	}
+	e.skippedRegions[key] = true
+	return false
+}
+
+// updateBreakers records the outcome of the regions scraped in this scrape,
+// opening the breaker of a region after breakerFailures consecutive failed
+// scrapes. The cooldown doubles every time it reopens, up to
+// maxBreakerCooldown.
+func (e *Exporter) updateBreakers(now time.Time) {
+	if e.breakerFailures <= 0 {
+		return
+	}
+	if e.breakers == nil {
+		e.breakers = make(map[regionKey]*breaker)
+	}
+	for key, errs := range e.regionErrors {
+		b, ok := e.breakers[key]
+		if !ok {
+			b = &breaker{}
+			e.breakers[key] = b
+		}
+		switch {
+		case e.skippedRegions[key], e.deferredRegions[key]:
+		case atomic.LoadUint64(errs) == 0:
+			*b = breaker{}
+		default:
+			b.failures++
+			if b.failures >= e.breakerFailures {
+				cooldown := e.breakerCooldown << b.trips
+				if cooldown <= 0 || cooldown > maxBreakerCooldown {
+					cooldown = maxBreakerCooldown
+				}
+				b.trips++
+				b.openUntil = now.Add(cooldown)
+				log.Warnf("circuit breaker opened after %d failed scrapes, skipping for %s [provider=%s, region=%s]", b.failures, cooldown, key.provider, key.region)
+			}
+		}
+		open := 0.0
+		if now.Before(b.openUntil) {
+			open = 1
+		}
+		e.breakerOpen.WithLabelValues(key.provider, key.region).Set(open)
+	}
+}
@@ -0,0 +1,353 @@
+// Package config loads the exporter's YAML configuration file, which declares
+// what doesn't fit in flags, like derived metrics, metrics of other AWS and
+// Azure services and how metrics are exported.
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Aggregations of the series of a derived metric operand.
+const (
+	AggregationMin = "min"
+	AggregationMax = "max"
+	AggregationAvg = "avg"
+	AggregationSum = "sum"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Config is the configuration file. The JSON field names, used to serve the
+// effective configuration, are those of the YAML file.
+type Config struct {
+	DerivedMetrics []DerivedMetric `yaml:"derivedMetrics" json:"derivedMetrics"`
+	AWSMetrics     []AWSMetric     `yaml:"awsMetrics" json:"awsMetrics"`
+	AzureMetrics   []AzureMetric   `yaml:"azureMetrics" json:"azureMetrics"`
+	MetricMappings []MetricMapping `yaml:"metricMappings" json:"metricMappings"`
+	Validation     Validation      `yaml:"validation" json:"validation"`
+}
+
+// DerivedMetric is a metric computed from scraped prices every scrape.
+type DerivedMetric struct {
+	// Name is the exported metric name.
+	Name string `yaml:"name" json:"name"`
+	Help string `yaml:"help" json:"help"`
+	// Expr is an arithmetic expression of the operands in Series and
+	// numbers, e.g. "spot / ondemand" or "ondemand * 24 * 30".
+	Expr string `yaml:"expr" json:"expr"`
+	// Series defines the operands of Expr.
+	Series map[string]Series `yaml:"series" json:"series"`
+	// On lists the labels the operands are joined on, which become the labels
+	// of the derived metric, e.g. [instance_type, region].
+	On []string `yaml:"on" json:"on"`
+	// Aggregation combines the series of an operand with the same On labels:
+	// min (default), max, avg or sum.
+	Aggregation string `yaml:"aggregation" json:"aggregation"`
+
+	expr *Expr
+}
+
+// Series selects the series of a pricing metric.
+type Series struct {
+	// Metric is the exported name of a pricing metric, e.g. "aws_pricing_ec2".
+	Metric string `yaml:"metric" json:"metric"`
+	// Match are label values the series must have.
+	Match map[string]string `yaml:"match" json:"match"`
+}
+
+// AWSMetric is a metric of the on-demand prices of an AWS service, scraped
+// from the Pricing Query API for every AWS region.
+type AWSMetric struct {
+	// Name is the exported metric name.
+	Name string `yaml:"name" json:"name"`
+	Help string `yaml:"help" json:"help"`
+	// ServiceCode is the Pricing API service, e.g. "AmazonRDS".
+	ServiceCode string `yaml:"serviceCode" json:"serviceCode"`
+	// Filters are product attribute values the products must have, e.g.
+	// {productFamily: Database Instance, databaseEngine: PostgreSQL}.
+	Filters map[string]string `yaml:"filters" json:"filters"`
+	// Labels maps the metric's labels, besides region, to the product
+	// attribute they're taken from, e.g. {instance_type: instanceType}.
+	Labels map[string]string `yaml:"labels" json:"labels"`
+	// Unit restricts prices to the price dimensions with this unit, e.g.
+	// "Hrs" or "GB-Mo"; empty = any unit.
+	Unit string `yaml:"unit" json:"unit"`
+}
+
+// AzureMetric is a metric of the retail prices of an Azure service, scraped
+// from the Retail Prices API for every Azure region.
+type AzureMetric struct {
+	// Name is the exported metric name.
+	Name string `yaml:"name" json:"name"`
+	Help string `yaml:"help" json:"help"`
+	// Filter is an OData $filter expression selecting the items, e.g.
+	// "serviceName eq 'Storage' and skuName eq 'Hot LRS'".
+	Filter string `yaml:"filter" json:"filter"`
+	// Labels maps the metric's labels, besides region, to the item field
+	// they're taken from, e.g. {sku: skuName}.
+	Labels map[string]string `yaml:"labels" json:"labels"`
+	// Unit restricts prices to the items with this unit of measure, e.g.
+	// "1 GB/Month"; empty = any unit.
+	Unit string `yaml:"unit" json:"unit"`
+}
+
+// MetricMapping changes the labels and values a pricing metric is exported
+// with, e.g. for an organization's own label schema.
+type MetricMapping struct {
+	// Metric is the exported name of a pricing metric, e.g. "aws_pricing_ec2".
+	Metric string `yaml:"metric" json:"metric"`
+	// Labels are the labels kept, by their original name; empty = all.
+	Labels []string `yaml:"labels" json:"labels"`
+	// Rename maps original label names to exported ones.
+	Rename map[string]string `yaml:"rename" json:"rename"`
+	// Scale multiplies the exported values, e.g. 730 for monthly prices;
+	// 0 = 1.
+	Scale float64 `yaml:"scale" json:"scale"`
+}
+
+// Actions of Validation on rejected prices.
+const (
+	ValidationDrop = "drop"
+	ValidationFlag = "flag"
+)
+
+// Validation rejects implausible pricing metric values before they're
+// exported, e.g. zero prices or sudden jumps caused by bad API data.
+type Validation struct {
+	// Action is what happens to rejected values: ValidationDrop (the
+	// default) exports the series' previous value instead, if it has one;
+	// ValidationFlag exports them anyway. Both count and log them.
+	Action string `yaml:"action" json:"action"`
+	// RejectZero rejects prices of zero or less.
+	RejectZero bool `yaml:"rejectZero" json:"rejectZero"`
+	// MaxChangeFactor rejects values that rose or fell by more than this
+	// factor since the last scrape, e.g. 100; 0 = unlimited.
+	MaxChangeFactor float64 `yaml:"maxChangeFactor" json:"maxChangeFactor"`
+	// Rules bound the plausible values of pricing metrics.
+	Rules []PriceRule `yaml:"rules" json:"rules"`
+}
+
+// PriceRule bounds the USD values of the pricing metric series it matches.
+type PriceRule struct {
+	// Metric is the exported name of a pricing metric; empty = all.
+	Metric string `yaml:"metric" json:"metric"`
+	// Lifecycle matches the instance_lifecycle label, e.g. "spot"; empty =
+	// any series.
+	Lifecycle string `yaml:"lifecycle" json:"lifecycle"`
+	// Min is the lowest plausible value.
+	Min float64 `yaml:"min" json:"min"`
+	// Max is the highest plausible value; 0 = unlimited.
+	Max float64 `yaml:"max" json:"max"`
+}
+
+// Enabled reports whether any value is validated.
+func (v Validation) Enabled() bool {
+	return v.RejectZero || v.MaxChangeFactor > 0 || len(v.Rules) > 0
+}
+
+// reservedLabels are set by the exporter on AWS and Azure metrics.
+var reservedLabels = map[string]bool{"region": true, "currency": true, "provider": true}
+
+// Compiled returns the parsed Expr.
+func (d DerivedMetric) Compiled() *Expr {
+	return d.expr
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a configuration. Unknown fields are errors.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	names := make(map[string]bool)
+	for i := range cfg.DerivedMetrics {
+		d := &cfg.DerivedMetrics[i]
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("derived metric %q: %w", d.Name, err)
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("derived metric %q is declared twice", d.Name)
+		}
+		names[d.Name] = true
+	}
+	for i := range cfg.AWSMetrics {
+		m := &cfg.AWSMetrics[i]
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("AWS metric %q: %w", m.Name, err)
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("metric %q is declared twice", m.Name)
+		}
+		names[m.Name] = true
+	}
+	for i := range cfg.AzureMetrics {
+		m := &cfg.AzureMetrics[i]
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("Azure metric %q: %w", m.Name, err)
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("metric %q is declared twice", m.Name)
+		}
+		names[m.Name] = true
+	}
+	mapped := make(map[string]bool)
+	for i := range cfg.MetricMappings {
+		m := &cfg.MetricMappings[i]
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("metric mapping of %q: %w", m.Metric, err)
+		}
+		if mapped[m.Metric] {
+			return nil, fmt.Errorf("metric %q is mapped twice", m.Metric)
+		}
+		mapped[m.Metric] = true
+	}
+	if err := cfg.Validation.validate(); err != nil {
+		return nil, fmt.Errorf("validation: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (d *DerivedMetric) validate() error {
+	if !metricNameRE.MatchString(d.Name) {
+		return fmt.Errorf("invalid metric name")
+	}
+	if d.Help == "" {
+		d.Help = "Derived metric " + d.Expr + "."
+	}
+	switch d.Aggregation {
+	case "":
+		d.Aggregation = AggregationMin
+	case AggregationMin, AggregationMax, AggregationAvg, AggregationSum:
+	default:
+		return fmt.Errorf("invalid aggregation %q: must be min, max, avg or sum", d.Aggregation)
+	}
+	for _, label := range d.On {
+		if !labelNameRE.MatchString(label) {
+			return fmt.Errorf("invalid label name %q in on", label)
+		}
+	}
+	for name, s := range d.Series {
+		if !metricNameRE.MatchString(s.Metric) {
+			return fmt.Errorf("series %q: invalid metric name %q", name, s.Metric)
+		}
+	}
+	expr, err := ParseExpr(d.Expr)
+	if err != nil {
+		return err
+	}
+	for _, name := range expr.Vars() {
+		if _, ok := d.Series[name]; !ok {
+			return fmt.Errorf("expr uses %q, which isn't declared in series", name)
+		}
+	}
+	d.expr = expr
+	return nil
+}
+
+func (m *AWSMetric) validate() error {
+	if !metricNameRE.MatchString(m.Name) {
+		return fmt.Errorf("invalid metric name")
+	}
+	if m.ServiceCode == "" {
+		return fmt.Errorf("serviceCode is required")
+	}
+	if m.Help == "" {
+		m.Help = "On-demand price of " + m.ServiceCode + " products."
+	}
+	return validateLabels(m.Labels)
+}
+
+func (m *AzureMetric) validate() error {
+	if !metricNameRE.MatchString(m.Name) {
+		return fmt.Errorf("invalid metric name")
+	}
+	if m.Filter == "" {
+		return fmt.Errorf("filter is required")
+	}
+	if m.Help == "" {
+		m.Help = "Azure retail price per unit of measure of " + m.Filter + "."
+	}
+	return validateLabels(m.Labels)
+}
+
+// validateLabels checks a mapping of label names to the field or attribute
+// their values are taken from.
+func validateLabels(labels map[string]string) error {
+	for label, source := range labels {
+		if !labelNameRE.MatchString(label) || reservedLabels[label] {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+		if source == "" {
+			return fmt.Errorf("label %q has no source field", label)
+		}
+	}
+	return nil
+}
+
+func (m *MetricMapping) validate() error {
+	if !metricNameRE.MatchString(m.Metric) {
+		return fmt.Errorf("invalid metric name")
+	}
+	for _, label := range m.Labels {
+		if !labelNameRE.MatchString(label) {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+	}
+	for from, to := range m.Rename {
+		if !labelNameRE.MatchString(from) || !labelNameRE.MatchString(to) {
+			return fmt.Errorf("invalid rename of %q to %q", from, to)
+		}
+	}
+	if m.Scale < 0 || math.IsNaN(m.Scale) || math.IsInf(m.Scale, 0) {
+		return fmt.Errorf("scale must be a positive number")
+	}
+	if m.Scale == 0 {
+		m.Scale = 1
+	}
+	return nil
+}
+
+func (v *Validation) validate() error {
+	switch v.Action {
+	case "":
+		v.Action = ValidationDrop
+	case ValidationDrop, ValidationFlag:
+	default:
+		return fmt.Errorf("unknown action %q, must be %s or %s", v.Action, ValidationDrop, ValidationFlag)
+	}
+	if v.MaxChangeFactor != 0 && (!(v.MaxChangeFactor > 1) || math.IsInf(v.MaxChangeFactor, 0)) {
+		return fmt.Errorf("maxChangeFactor must be greater than 1, got %g", v.MaxChangeFactor)
+	}
+	for i, r := range v.Rules {
+		if r.Metric != "" && !metricNameRE.MatchString(r.Metric) {
+			return fmt.Errorf("rule %d: invalid metric name %q", i+1, r.Metric)
+		}
+		if r.Min < 0 || r.Max < 0 || math.IsNaN(r.Min) || math.IsNaN(r.Max) {
+			return fmt.Errorf("rule %d: min and max must not be negative", i+1)
+		}
+		if r.Min == 0 && r.Max == 0 {
+			return fmt.Errorf("rule %d: needs a min or max", i+1)
+		}
+		if r.Max != 0 && r.Max < r.Min {
+			return fmt.Errorf("rule %d: max %g is below min %g", i+1, r.Max, r.Min)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const derivedConfig = `
+derivedMetrics:
+  - name: spot_ondemand_ratio
+    help: Spot price relative to the on-demand price.
+    expr: spot / ondemand
+    on: [instance_type, region]
+    series:
+      spot:
+        metric: aws_pricing_ec2
+        match: {instance_lifecycle: spot}
+      ondemand:
+        metric: aws_pricing_ec2
+        match: {instance_lifecycle: ondemand, operating_system: Linux}
+  - name: node_pool_monthly_cost
+    expr: ondemand * 3 * 730
+    series:
+      ondemand:
+        metric: aws_pricing_ec2
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(derivedConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.DerivedMetrics) != 2 {
+		t.Fatalf("got %d derived metrics, want 2", len(cfg.DerivedMetrics))
+	}
+	ratio := cfg.DerivedMetrics[0]
+	if ratio.Aggregation != AggregationMin || ratio.Series["ondemand"].Match["operating_system"] != "Linux" {
+		t.Errorf("unexpected derived metric %+v", ratio)
+	}
+	if v, ok := ratio.Compiled().Eval(map[string]float64{"spot": 0.03, "ondemand": 0.1}); !ok || math.Abs(v-0.3) > 1e-9 {
+		t.Errorf("Eval = %v, %v, want 0.3", v, ok)
+	}
+	if help := cfg.DerivedMetrics[1].Help; help == "" {
+		t.Error("expected a default help text")
+	}
+}
+
+func TestParse_AWSMetrics(t *testing.T) {
+	cfg, err := Parse([]byte(`
+awsMetrics:
+  - name: aws_pricing_rds_instance
+    serviceCode: AmazonRDS
+    filters: {productFamily: Database Instance, databaseEngine: PostgreSQL}
+    labels: {instance_type: instanceType, deployment: deploymentOption}
+    unit: Hrs
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.AWSMetrics) != 1 {
+		t.Fatalf("got %d AWS metrics, want 1", len(cfg.AWSMetrics))
+	}
+	m := cfg.AWSMetrics[0]
+	if m.Filters["productFamily"] != "Database Instance" || m.Labels["deployment"] != "deploymentOption" || m.Unit != "Hrs" {
+		t.Errorf("unexpected AWS metric %+v", m)
+	}
+	if m.Help == "" {
+		t.Error("expected a default help text")
+	}
+}
+
+func TestParse_AzureMetrics(t *testing.T) {
+	cfg, err := Parse([]byte(`
+azureMetrics:
+  - name: azure_pricing_blob_storage
+    filter: serviceName eq 'Storage' and productName eq 'Blob Storage'
+    labels: {sku: skuName, meter: meterName}
+    unit: 1 GB/Month
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.AzureMetrics) != 1 {
+		t.Fatalf("got %d Azure metrics, want 1", len(cfg.AzureMetrics))
+	}
+	m := cfg.AzureMetrics[0]
+	if m.Filter != "serviceName eq 'Storage' and productName eq 'Blob Storage'" || m.Labels["sku"] != "skuName" || m.Unit != "1 GB/Month" {
+		t.Errorf("unexpected Azure metric %+v", m)
+	}
+	if m.Help == "" {
+		t.Error("expected a default help text")
+	}
+}
+
+func TestParse_MetricMappings(t *testing.T) {
+	cfg, err := Parse([]byte(`
+metricMappings:
+  - metric: aws_pricing_ec2
+    labels: [instance_type, region]
+    rename: {instance_type: type}
+    scale: 730
+  - metric: azure_pricing_vm
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.MetricMappings) != 2 {
+		t.Fatalf("got %d metric mappings, want 2", len(cfg.MetricMappings))
+	}
+	m := cfg.MetricMappings[0]
+	if m.Metric != "aws_pricing_ec2" || len(m.Labels) != 2 || m.Rename["instance_type"] != "type" || m.Scale != 730 {
+		t.Errorf("unexpected metric mapping %+v", m)
+	}
+}
+
+func TestParse_Validation(t *testing.T) {
+	cfg, err := Parse([]byte(`
+validation:
+  rejectZero: true
+  maxChangeFactor: 100
+  rules:
+    - lifecycle: spot
+      min: 0.0001
+      max: 50
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	v := cfg.Validation
+	if !v.Enabled() || v.Action != ValidationDrop || v.MaxChangeFactor != 100 || len(v.Rules) != 1 || v.Rules[0].Max != 50 {
+		t.Errorf("unexpected validation %+v", v)
+	}
+	if cfg, _ := Parse([]byte("validation:\n  action: flag\n")); cfg == nil || cfg.Validation.Enabled() {
+		t.Error("expected validation without checks to be disabled")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":         "derivedMetrics:\n  - name: a\n    expr: x\n    typo: 1\n",
+		"invalid name":          "derivedMetrics:\n  - name: a-b\n    expr: '1'\n",
+		"undeclared operand":    "derivedMetrics:\n  - name: a\n    expr: x * 2\n",
+		"invalid expr":          "derivedMetrics:\n  - name: a\n    expr: '1 +'\n",
+		"aggregation":           "derivedMetrics:\n  - name: a\n    expr: '1'\n    aggregation: median\n",
+		"duplicate":             "derivedMetrics:\n  - name: a\n    expr: '1'\n  - name: a\n    expr: '2'\n",
+		"aws without service":   "awsMetrics:\n  - name: a\n",
+		"aws reserved label":    "awsMetrics:\n  - name: a\n    serviceCode: AmazonRDS\n    labels: {region: regionCode}\n",
+		"aws empty attribute":   "awsMetrics:\n  - name: a\n    serviceCode: AmazonRDS\n    labels: {engine: ''}\n",
+		"azure without filter":  "azureMetrics:\n  - name: a\n",
+		"azure reserved label":  "azureMetrics:\n  - name: a\n    filter: serviceName eq 'Storage'\n    labels: {currency: currencyCode}\n",
+		"azure duplicate":       "awsMetrics:\n  - name: a\n    serviceCode: AmazonS3\nazureMetrics:\n  - name: a\n    filter: serviceName eq 'Storage'\n",
+		"mapping label":         "metricMappings:\n  - metric: aws_pricing_ec2\n    labels: [instance-type]\n",
+		"mapping rename":        "metricMappings:\n  - metric: aws_pricing_ec2\n    rename: {instance_type: ''}\n",
+		"mapping scale":         "metricMappings:\n  - metric: aws_pricing_ec2\n    scale: -1\n",
+		"mapping duplicate":     "metricMappings:\n  - metric: aws_pricing_ec2\n  - metric: aws_pricing_ec2\n",
+		"validation action":     "validation:\n  action: ignore\n",
+		"validation factor":     "validation:\n  maxChangeFactor: 0.5\n",
+		"validation empty rule": "validation:\n  rules:\n    - lifecycle: spot\n",
+		"validation min > max":  "validation:\n  rules:\n    - {min: 2, max: 1}\n",
+		"aws duplicate":         "derivedMetrics:\n  - name: a\n    expr: '1'\nawsMetrics:\n  - name: a\n    serviceCode: AmazonRDS\n",
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestExpr(t *testing.T) {
+	vars := map[string]float64{"a": 2, "b": 4, "zero": 0}
+	tests := []struct {
+		expr string
+		want float64
+		ok   bool
+	}{
+		{"1 + 2 * 3", 7, true},
+		{"(1 + 2) * 3", 9, true},
+		{"a / b", 0.5, true},
+		{"-a + b", 2, true},
+		{"b - a - 1", 1, true},
+		{"a * .5", 1, true},
+		{"a / zero", 0, false},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		got, ok := e.Eval(vars)
+		if ok != tt.ok || (ok && math.Abs(got-tt.want) > 1e-9) {
+			t.Errorf("%q = %v, %v, want %v, %v", tt.expr, got, ok, tt.want, tt.ok)
+		}
+	}
+	if e, _ := ParseExpr("spot / (ondemand + spot)"); strings.Join(e.Vars(), ",") != "ondemand,spot" {
+		t.Errorf("Vars() = %v", e.Vars())
+	}
+	for _, bad := range []string{"", "1 +", "(1", "1 2", "a $ b", "1..2"} {
+		if _, err := ParseExpr(bad); err == nil {
+			t.Errorf("ParseExpr(%q): expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode"
+)
+
+// Expr is a parsed arithmetic expression of numbers, variables, + - * /,
+// unary minus and parentheses.
+type Expr struct {
+	eval func(vars map[string]float64) float64
+	vars map[string]bool
+}
+
+// ParseExpr parses an expression like "spot / ondemand" or "(a + b) * 24".
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{input: s, vars: make(map[string]bool)}
+	p.next()
+	eval, err := p.sum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expr %q: %w", s, err)
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("invalid expr %q: unexpected %q", s, p.tok)
+	}
+	return &Expr{eval: eval, vars: p.vars}, nil
+}
+
+// Vars returns the variables of the expression, sorted.
+func (e *Expr) Vars() []string {
+	vars := make([]string, 0, len(e.vars))
+	for v := range e.vars {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// Eval evaluates the expression, ok is false if the result isn't a finite
+// number, e.g. after a division by zero.
+func (e *Expr) Eval(vars map[string]float64) (value float64, ok bool) {
+	value = e.eval(vars)
+	return value, !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+type evalFunc func(vars map[string]float64) float64
+
+// exprParser is a recursive descent parser; tok is the current token, empty
+// at the end of the input.
+type exprParser struct {
+	input string
+	pos   int
+	tok   string
+	vars  map[string]bool
+}
+
+// next reads the next token: a number, an identifier or an operator.
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.input) {
+		p.tok = ""
+		return
+	}
+	c := rune(p.input[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '_') {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.input[start:p.pos]
+}
+
+// sum parses term (("+" | "-") term)*.
+func (p *exprParser) sum() (evalFunc, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok
+		p.next()
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(v map[string]float64) float64 { return l(v) + right(v) }
+		} else {
+			left = func(v map[string]float64) float64 { return l(v) - right(v) }
+		}
+	}
+	return left, nil
+}
+
+// product parses factor (("*" | "/") factor)*.
+func (p *exprParser) product() (evalFunc, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(v map[string]float64) float64 { return l(v) * right(v) }
+		} else {
+			left = func(v map[string]float64) float64 { return l(v) / right(v) }
+		}
+	}
+	return left, nil
+}
+
+// factor parses a number, a variable, "-" factor or "(" sum ")".
+func (p *exprParser) factor() (evalFunc, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end")
+	case tok == "-":
+		p.next()
+		f, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(v map[string]float64) float64 { return -f(v) }, nil
+	case tok == "(":
+		p.next()
+		f, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return f, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		p.next()
+		return func(map[string]float64) float64 { return n }, nil
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		p.vars[tok] = true
+		p.next()
+		return func(v map[string]float64) float64 { return v[tok] }, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
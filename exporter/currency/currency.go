@@ -0,0 +1,121 @@
+// Package currency converts USD prices into other currencies using the
+// European Central Bank's daily euro foreign exchange reference rates.
+package currency
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// USD is the currency every provider reports prices in.
+const USD = "USD"
+
+// ECBRatesURL is the ECB daily reference rates feed. Exported so tests and
+// air-gapped deployments can override it.
+var ECBRatesURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// ecbEnvelope is the document of the ECB daily reference rates feed.
+type ecbEnvelope struct {
+	Cube struct {
+		Cube struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// Rates holds units of each currency per US dollar. It's safe for concurrent
+// use; Load swaps in new rates atomically.
+type Rates struct {
+	mu      sync.RWMutex
+	perUSD  map[string]float64
+	updated time.Time
+	url     string // override URL for testing; empty = use ECBRatesURL
+}
+
+// NewRates returns Rates that only know USD until loaded.
+func NewRates() *Rates {
+	return &Rates{perUSD: map[string]float64{USD: 1}}
+}
+
+// Load fetches the ECB reference rates. Pass nil for httpClient to use
+// http.DefaultClient.
+func (r *Rates) Load(ctx context.Context, httpClient *http.Client) error {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	url := r.url
+	if url == "" {
+		url = ECBRatesURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request for exchange rates: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching exchange rates from %s: %w", url, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching exchange rates from %s", resp.StatusCode, url)
+	}
+
+	var doc ecbEnvelope
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("error parsing exchange rates: %w", err)
+	}
+
+	// ECB rates are units per euro; rebase them on the dollar.
+	perEUR := map[string]float64{"EUR": 1}
+	for _, rate := range doc.Cube.Cube.Rates {
+		if rate.Rate > 0 {
+			perEUR[rate.Currency] = rate.Rate
+		}
+	}
+	usdPerEUR, ok := perEUR[USD]
+	if !ok {
+		return fmt.Errorf("exchange rates from %s have no %s rate", url, USD)
+	}
+	perUSD := make(map[string]float64, len(perEUR))
+	for code, rate := range perEUR {
+		perUSD[code] = rate / usdPerEUR
+	}
+
+	r.mu.Lock()
+	r.perUSD = perUSD
+	r.updated = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Updated returns when the rates were last loaded; zero if never.
+func (r *Rates) Updated() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.updated
+}
+
+// Has reports whether the rate of currency is known.
+func (r *Rates) Has(currency string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.perUSD[currency]
+	return ok
+}
+
+// Convert converts a USD amount into currency. ok is false when the rate is unknown.
+func (r *Rates) Convert(usd float64, currency string) (float64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rate, ok := r.perUSD[currency]
+	return usd * rate, ok
+}
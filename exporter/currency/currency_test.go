@@ -0,0 +1,68 @@
+package currency
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const ecbXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-10-15">
+			<Cube currency="USD" rate="1.25"/>
+			<Cube currency="GBP" rate="0.85"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestRates_Load(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(ecbXML))
+	}))
+	defer ts.Close()
+
+	rates := NewRates()
+	rates.url = ts.URL
+	if err := rates.Load(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rates.Updated().IsZero() {
+		t.Error("expected Updated to be set")
+	}
+
+	for _, tt := range []struct {
+		currency string
+		want     float64
+	}{{"USD", 10}, {"EUR", 8}, {"GBP", 6.8}} {
+		got, ok := rates.Convert(10, tt.currency)
+		if !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Convert(10, %s) = (%v, %v), want %v", tt.currency, got, ok, tt.want)
+		}
+	}
+	if _, ok := rates.Convert(10, "XYZ"); ok {
+		t.Error("expected unknown currency to fail")
+	}
+}
+
+func TestRates_LoadError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	rates := NewRates()
+	rates.url = ts.URL
+	if err := rates.Load(context.Background(), nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, ok := rates.Convert(10, USD); !ok || got != 10 {
+		t.Errorf("USD must always convert, got (%v, %v)", got, ok)
+	}
+	if _, ok := rates.Convert(10, "EUR"); ok {
+		t.Error("expected EUR to be unknown before a successful load")
+	}
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+)
+
+// derivedMetric is a metric declared in the configuration file.
+type derivedMetric struct {
+	cfg   config.DerivedMetric
+	gauge *prometheus.GaugeVec
+}
+
+// operandValue aggregates the series of an operand with the same join labels.
+type operandValue struct {
+	value float64
+	count int
+}
+
+// add aggregates v into the operand.
+func (o *operandValue) add(aggregation string, v float64) {
+	switch {
+	case o.count == 0:
+		o.value = v
+	case aggregation == config.AggregationMin:
+		o.value = min(o.value, v)
+	case aggregation == config.AggregationMax:
+		o.value = max(o.value, v)
+	default: // sum and avg
+		o.value += v
+	}
+	o.count++
+}
+
+// result returns the aggregated value.
+func (o operandValue) result(aggregation string) float64 {
+	if aggregation == config.AggregationAvg {
+		return o.value / float64(o.count)
+	}
+	return o.value
+}
+
+// WithDerivedMetrics exports the derived metrics of the configuration file,
+// computed from the prices of every scrape.
+func WithDerivedMetrics(metrics []config.DerivedMetric) Option {
+	return func(e *Exporter) {
+		for _, cfg := range metrics {
+			d := &derivedMetric{cfg: cfg}
+			d.gauge = d.newGauge()
+			e.derivedMetrics = append(e.derivedMetrics, d)
+		}
+	}
+}
+
+// newGauge returns an empty gauge of the derived metric.
+func (d *derivedMetric) newGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: d.cfg.Name,
+		Help: d.cfg.Help,
+	}, d.cfg.On)
+}
+
+// setDerivedMetrics evaluates the derived metrics on the served prices,
+// including stale prices of failed regions. Operands are joined on the
+// derived metric's labels; label sets missing an operand or evaluating to a
+// non-finite number (e.g. a division by zero) are skipped.
+func (e *Exporter) setDerivedMetrics() {
+	for _, d := range e.derivedMetrics {
+		d.gauge.Reset()
+		groups := make(map[string]map[string]*operandValue)
+		joinLabels := make(map[string]prometheus.Labels)
+		for _, points := range e.lastPrices {
+			for _, p := range points {
+				for operand, series := range d.cfg.Series {
+					if e.metricNames[p.name] != series.Metric || !matchLabels(p.labels, series.Match) {
+						continue
+					}
+					labels := make(prometheus.Labels, len(d.cfg.On))
+					values := make([]string, len(d.cfg.On))
+					for i, l := range d.cfg.On {
+						labels[l] = p.labels[l]
+						values[i] = p.labels[l]
+					}
+					key := strings.Join(values, "\xff")
+					if groups[key] == nil {
+						groups[key] = make(map[string]*operandValue)
+						joinLabels[key] = labels
+					}
+					if groups[key][operand] == nil {
+						groups[key][operand] = &operandValue{}
+					}
+					groups[key][operand].add(d.cfg.Aggregation, p.usd)
+				}
+			}
+		}
+		for key, operands := range groups {
+			if len(operands) < len(d.cfg.Series) {
+				continue
+			}
+			vars := make(map[string]float64, len(operands))
+			for operand, v := range operands {
+				vars[operand] = v.result(d.cfg.Aggregation)
+			}
+			if value, ok := d.cfg.Compiled().Eval(vars); ok {
+				d.gauge.With(joinLabels[key]).Set(value)
+			}
+		}
+	}
+}
+
+// matchLabels reports whether labels has all values of match.
+func matchLabels(labels prometheus.Labels, match map[string]string) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
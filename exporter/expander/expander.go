@@ -0,0 +1,340 @@
+// Package expander implements the Cluster Autoscaler gRPC expander
+// (grpcplugin.Expander) on the prices of the exporter's last scrape, so the
+// autoscaler scales up the cheapest node group using live spot prices.
+//
+// gRPC is served by net/http over HTTP/2 and the messages are decoded with
+// protowire, only the fields needed for pricing are read.
+package expander
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
+)
+
+// Path is the gRPC method served by Handler.
+const Path = "/grpcplugin.Expander/BestOptions"
+
+// Node labels of the capacity type of a node group.
+const (
+	LabelKarpenterCapacityType = kube.LabelKarpenterCapacityType
+	LabelEKSCapacityType       = kube.LabelEKSCapacityType
+	LabelAKSPriority           = kube.LabelAKSPriority
+)
+
+// maxMessageBytes bounds a request, which carries the pending pods too.
+const maxMessageBytes = 64 << 20
+
+// gRPC status codes, see google.golang.org/grpc/codes.
+const (
+	codeOK              = 0
+	codeInvalidArgument = 3
+	codeUnimplemented   = 12
+)
+
+// PriceSource provides the prices node groups are compared by.
+type PriceSource interface {
+	Prices() *exporter.PriceIndex
+}
+
+// option is a scale-up option of a BestOptionsRequest.
+type option struct {
+	raw         []byte // the encoded Option, returned unchanged
+	nodeGroupID string
+	nodeCount   int64
+}
+
+// Handler serves BestOptions: it returns the options whose nodes cost the
+// least per hour in total, all of them if several tie. Options of node groups
+// without a price are only returned if none has one, leaving the choice to
+// the autoscaler's fallback expander.
+type Handler struct {
+	prices PriceSource
+}
+
+// NewHandler returns a Handler pricing node groups with prices.
+func NewHandler(prices PriceSource) *Handler {
+	return &Handler{prices: prices}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if r.URL.Path != Path {
+		writeStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	msg, err := readMessage(io.LimitReader(r.Body, maxMessageBytes+5))
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+	options, nodes, err := parseRequest(msg)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	var resp []byte
+	for _, opt := range h.bestOptions(options, nodes) {
+		resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+		resp = protowire.AppendBytes(resp, opt.raw)
+	}
+	frame := make([]byte, 5, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+	if _, err := w.Write(append(frame, resp...)); err != nil {
+		log.WithError(err).Debug("expander: writing response")
+		return
+	}
+	writeStatus(w, codeOK, "")
+}
+
+// bestOptions returns the cheapest options.
+func (h *Handler) bestOptions(options []option, nodes map[string]map[string]string) []option {
+	index := h.prices.Prices()
+	var best []option
+	bestCost := 0.0
+	for _, opt := range options {
+		labels, ok := nodes[opt.nodeGroupID]
+		if !ok {
+			log.Debugf("expander: no template node for node group %s", opt.nodeGroupID)
+			continue
+		}
+		price, ok := lookup(index, labels)
+		if !ok {
+			log.Debugf("expander: no price for node group %s", opt.nodeGroupID)
+			continue
+		}
+		cost := price * float64(max(opt.nodeCount, 1))
+		log.Debugf("expander: node group %s costs %g USD/h for %d nodes", opt.nodeGroupID, cost, opt.nodeCount)
+		switch {
+		case best == nil || cost < bestCost:
+			best, bestCost = []option{opt}, cost
+		case cost == bestCost:
+			best = append(best, opt)
+		}
+	}
+	if best == nil {
+		return options
+	}
+	return best
+}
+
+// lookup returns the hourly price of a node with labels. Nodes of node group
+// templates usually have no providerID, so the provider is found by its
+// region.
+func lookup(index *exporter.PriceIndex, labels map[string]string) (float64, bool) {
+	q := exporter.PriceQuery{
+		Region:       firstLabel(labels, kube.LabelRegion, kube.LabelRegionBeta),
+		Zone:         firstLabel(labels, kube.LabelZone, kube.LabelZoneBeta),
+		InstanceType: firstLabel(labels, kube.LabelInstanceType, kube.LabelInstanceTypeBeta),
+		Lifecycle:    Lifecycle(labels),
+	}
+	if q.Region == "" || q.InstanceType == "" {
+		return 0, false
+	}
+	for _, provider := range []string{"aws", "azure"} {
+		q.Provider = provider
+		if price, ok := index.Lookup(q); ok {
+			return price, true
+		}
+		// Azure zones are numbers and not priced separately.
+		zoned := q
+		zoned.Zone = ""
+		if price, ok := index.Lookup(zoned); ok {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// Lifecycle returns the instance_lifecycle of a node from its capacity type
+// labels, "ondemand" if it has none.
+func Lifecycle(labels map[string]string) string {
+	return kube.Lifecycle(labels)
+}
+
+func firstLabel(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// writeStatus sets the gRPC status trailers.
+func writeStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", msg)
+	}
+}
+
+// readMessage reads a single length-prefixed gRPC message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading message prefix: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxMessageBytes {
+		return nil, fmt.Errorf("message of %d bytes exceeds the maximum of %d", n, maxMessageBytes)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return msg, nil
+}
+
+// parseRequest decodes a BestOptionsRequest:
+//
+//	message BestOptionsRequest {
+//	  repeated Option options = 1;
+//	  map<string, k8s.io.api.core.v1.Node> nodeMap = 2;
+//	}
+//
+// returning the labels of the template node of each node group.
+func parseRequest(b []byte) ([]option, map[string]map[string]string, error) {
+	var options []option
+	nodes := make(map[string]map[string]string)
+	err := walk(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			opt, err := parseOption(v)
+			if err != nil {
+				return fmt.Errorf("option: %w", err)
+			}
+			options = append(options, opt)
+		case 2:
+			var id string
+			var labels map[string]string
+			err := walk(v, func(num protowire.Number, v []byte, _ uint64) error {
+				var err error
+				switch num {
+				case 1:
+					id = string(v)
+				case 2:
+					labels, err = parseNodeLabels(v)
+				}
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("nodeMap: %w", err)
+			}
+			nodes[id] = labels
+		}
+		return nil
+	})
+	return options, nodes, err
+}
+
+// parseOption decodes the node group and count of an Option:
+//
+//	message Option {
+//	  string nodeGroupId = 1;
+//	  int32 nodeCount = 2;
+//	  string debug = 3;
+//	  repeated k8s.io.api.core.v1.Pod pod = 4;
+//	}
+func parseOption(b []byte) (option, error) {
+	opt := option{raw: b}
+	err := walk(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			opt.nodeGroupID = string(v)
+		case 2:
+			opt.nodeCount = int64(int32(n))
+		}
+		return nil
+	})
+	return opt, err
+}
+
+// parseNodeLabels decodes the labels of a Node, field 11 of its ObjectMeta
+// (field 1).
+func parseNodeLabels(b []byte) (map[string]string, error) {
+	labels := make(map[string]string)
+	err := walk(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		return walk(v, func(num protowire.Number, v []byte, _ uint64) error {
+			if num != 11 {
+				return nil
+			}
+			var key, value string
+			err := walk(v, func(num protowire.Number, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					key = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			labels[key] = value
+			return err
+		})
+	})
+	return labels, err
+}
+
+// walk calls fn for each field of a message with the value of
+// length-delimited fields or the value of varint fields; other fields are
+// skipped.
+func walk(b []byte, fn func(num protowire.Number, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			if err := fn(num, v, 0); err != nil {
+				return err
+			}
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			if err := fn(num, nil, v); err != nil {
+				return err
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
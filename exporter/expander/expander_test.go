@@ -0,0 +1,166 @@
+package expander
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+)
+
+type staticPrices struct {
+	index *exporter.PriceIndex
+}
+
+func (s staticPrices) Prices() *exporter.PriceIndex { return s.index }
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func encodeOption(id string, count int) []byte {
+	b := appendString(nil, 1, id)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(count))
+	return appendString(b, 3, "debug")
+}
+
+func encodeNode(labels map[string]string) []byte {
+	var meta []byte
+	meta = appendString(meta, 1, "template-node")
+	for k, v := range labels {
+		meta = appendMessage(meta, 11, appendString(appendString(nil, 1, k), 2, v))
+	}
+	return appendMessage(nil, 1, meta)
+}
+
+func grpcRequest(t *testing.T, path string, msg []byte) *http.Request {
+	t.Helper()
+	frame := make([]byte, 5)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(append(frame, msg...)))
+	req.Header.Set("Content-Type", "application/grpc")
+	return req
+}
+
+func TestHandler_BestOptions(t *testing.T) {
+	index := exporter.NewPriceIndex(map[exporter.PriceQuery]float64{
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "ondemand"}: 0.096,
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "spot"}:     0.04,
+		{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.xlarge", Lifecycle: "spot"}:    0.07,
+		{Provider: "azure", Region: "eastus", InstanceType: "Standard_D2s_v5", Lifecycle: "spot"}:                   0.02,
+	})
+	nodes := map[string]map[string]string{
+		"ondemand": {"node.kubernetes.io/instance-type": "m5.large", "topology.kubernetes.io/region": "us-east-1", "topology.kubernetes.io/zone": "us-east-1a"},
+		"spot":     {"node.kubernetes.io/instance-type": "m5.large", "topology.kubernetes.io/region": "us-east-1", "topology.kubernetes.io/zone": "us-east-1a", LabelEKSCapacityType: "SPOT"},
+		"xlarge":   {"node.kubernetes.io/instance-type": "m5.xlarge", "topology.kubernetes.io/region": "us-east-1", "topology.kubernetes.io/zone": "us-east-1a", LabelKarpenterCapacityType: "spot"},
+		"azure":    {"node.kubernetes.io/instance-type": "Standard_D2s_v5", "topology.kubernetes.io/region": "eastus", "topology.kubernetes.io/zone": "eastus-1", LabelAKSPriority: "spot"},
+		"unpriced": {"node.kubernetes.io/instance-type": "m7i.large", "topology.kubernetes.io/region": "us-east-1"},
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]int
+		want    []string
+	}{
+		{"spot beats ondemand", map[string]int{"ondemand": 1, "spot": 1}, []string{"spot"}},
+		{"node count", map[string]int{"spot": 2, "xlarge": 1}, []string{"xlarge"}},
+		{"tie", map[string]int{"spot": 7, "xlarge": 4}, []string{"spot", "xlarge"}},
+		{"azure region price", map[string]int{"azure": 1, "spot": 1}, []string{"azure"}},
+		{"unpriced ignored", map[string]int{"unpriced": 1, "ondemand": 1}, []string{"ondemand"}},
+		{"nothing priced", map[string]int{"unpriced": 1}, []string{"unpriced"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req []byte
+			for _, id := range []string{"ondemand", "spot", "xlarge", "azure", "unpriced"} {
+				count, ok := tt.options[id]
+				if !ok {
+					continue
+				}
+				req = appendMessage(req, 1, encodeOption(id, count))
+				entry := appendMessage(appendString(nil, 1, id), 2, encodeNode(nodes[id]))
+				req = appendMessage(req, 2, entry)
+			}
+
+			rec := httptest.NewRecorder()
+			NewHandler(staticPrices{index}).ServeHTTP(rec, grpcRequest(t, Path, req))
+			resp := rec.Result()
+			if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+				t.Fatalf("grpc-status = %q (%s), want 0", status, resp.Trailer.Get("Grpc-Message"))
+			}
+
+			body := rec.Body.Bytes()
+			if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+				t.Fatalf("malformed response frame %x", body)
+			}
+			var got []string
+			err := walk(body[5:], func(num protowire.Number, v []byte, _ uint64) error {
+				opt, err := parseOption(v)
+				got = append(got, opt.nodeGroupID)
+				if !bytes.Equal(v, encodeOption(opt.nodeGroupID, tt.options[opt.nodeGroupID])) {
+					t.Errorf("option %s not returned unchanged", opt.nodeGroupID)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("best options = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := NewHandler(staticPrices{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, grpcRequest(t, "/grpcplugin.Expander/Other", nil))
+	if status := rec.Result().Trailer.Get("Grpc-Status"); status != "12" {
+		t.Errorf("unknown method: grpc-status = %q, want 12", status)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, grpcRequest(t, Path, []byte{0x0a, 0xff}))
+	if status := rec.Result().Trailer.Get("Grpc-Status"); status != "3" {
+		t.Errorf("malformed request: grpc-status = %q, want 3", status)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("non-gRPC request: status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   string
+	}{
+		{nil, "ondemand"},
+		{map[string]string{LabelKarpenterCapacityType: "on-demand"}, "ondemand"},
+		{map[string]string{LabelKarpenterCapacityType: "spot"}, "spot"},
+		{map[string]string{LabelEKSCapacityType: "ON_DEMAND"}, "ondemand"},
+		{map[string]string{LabelEKSCapacityType: "SPOT"}, "spot"},
+		{map[string]string{LabelAKSPriority: "spot"}, "spot"},
+	}
+	for _, tt := range tests {
+		if got := Lifecycle(tt.labels); got != tt.want {
+			t.Errorf("Lifecycle(%v) = %q, want %q", tt.labels, got, tt.want)
+		}
+	}
+}
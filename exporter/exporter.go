@@ -2,7 +2,13 @@ package exporter
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -13,7 +19,13 @@ import (
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/currency"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/fake"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/notify"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/regionname"
 )
 
 // AzureConfig holds configuration for Azure VM pricing scraping.
@@ -21,8 +33,11 @@ import (
 type AzureConfig struct {
 	Regions          []string
 	OperatingSystems []string
+	PriceTypes       []string // e.g. "Consumption", "DevTestConsumption"; empty = Consumption
+	Lifecycles       []string // "ondemand", "spot", "lowpriority"; empty = ondemand
 	InstanceRegexes  []*regexp.Regexp
 	ClientFactory    azure.ClientFactory
+	DetailLabels     bool // add meter_name and product_name labels to azure_vm
 }
 
 // Exporter implements the prometheus.Collector interface and exports cloud pricing metrics.
@@ -32,45 +47,460 @@ type Exporter struct {
 	operatingSystems    []string
 	regions             []string
 	lifecycle           []string
-	instanceRegexes     []*regexp.Regexp
+	instanceFilter      aws.InstanceFilter
 	savingPlanTypes     []string
+	savingPlanOptions   aws.SavingPlanOptions
+	spotOptions         aws.SpotOptions
+	spotFeed            *aws.SpotFeedConfig
+	onDemandOptions     aws.OnDemandOptions
+	onDemandBackend     string
+	effectiveWindow     time.Duration
+	effectiveMu         sync.Mutex
+	effectiveRates      []provider.ScrapeResult // nil = not fetched yet
+	effectiveFetched    time.Time
+	typeOfferings       bool
+	dynamoDB            bool     // export DynamoDB prices
+	openSearch          bool     // export OpenSearch Service prices
+	rds                 bool     // export RDS (Aurora) prices
+	cloudFront          bool     // export CloudFront prices
+	managedSurcharges   []string // managed services whose per-instance surcharges are exported
 	clientFactory       aws.ClientFactory
+	accounts            []aws.Account
 	instances           *aws.InstanceStore
+	instanceSource      string
+	cpuMemRegression    bool
+	currencies          []string
+	precision           int  // decimal places prices are rounded to; negative = unrounded
+	regionNameLabel     bool // add region_name to pricing metrics with a region label
+	rates               *currency.Rates
+	unconverted         map[string]int // prices dropped per currency without a rate in the current refresh
+	instanceRefresh     time.Duration
 	cache               int
+	breakerFailures     int // consecutive failed scrapes that open a region's circuit breaker; 0 = disabled
+	breakerCooldown     time.Duration
+	skipUnauthorized    bool
+	httpClient          *http.Client // nil = http.DefaultClient
+	cacheJitter         float64      // fraction of cache the expiry varies by, 0-1
+	scrapeConcurrency   int          // fetches of a scrape running at once; 0 = unbounded
+	externalRefresh     bool         // scrapes are run by Refresh, not Collect
+	metricsFormat       string       // MetricsFormatNative (default), MetricsFormatOpenCost or MetricsFormatBoth
+	nodeCost            bool         // export cloud_pricing_node_hourly_cost
+	notifier            notify.Notifier
+	notifyThreshold     float64 // minimum price change in percent that is notified
+	nodeLister          kube.NodeLister
+	baseFilter          *aws.InstanceFilter // instanceFilter before the cluster node restriction
 
 	// Azure fields
 	azureEnabled          bool
 	azureRegions          []string
 	azureOperatingSystems []string
+	azurePriceTypes       []string
+	azureLifecycles       []string
 	azureInstanceRegexes  []*regexp.Regexp
 	azureClientFactory    azure.ClientFactory
+	azureDetailLabels     bool
+	azureInstanceTypes    []string // ARM SKU names of the cluster nodes; empty = all
+	azureAKS              bool     // export AKS cluster fees
+	azureFunctions        bool     // export Functions prices
+	azureCosmosDB         bool     // export Cosmos DB prices
+	azureStorage          bool     // export Azure Files prices
+	azureNetAppFiles      bool     // export Azure NetApp Files prices with azureStorage
+
+	fake *fake.Provider // nil unless synthetic prices are exported
 
 	// Prometheus metrics
-	duration       prometheus.Gauge
-	scrapeErrors   prometheus.Gauge
-	totalScrapes   prometheus.Counter
-	pricingMetrics map[string]*prometheus.GaugeVec
+	duration             prometheus.Gauge
+	scrapeErrors         prometheus.Gauge
+	totalScrapes         prometheus.Counter
+	poolWorkers          prometheus.Gauge
+	poolQueued           prometheus.Gauge
+	poolInFlight         prometheus.Gauge
+	scrapeAllocated      prometheus.Gauge
+	scrapePeakHeap       prometheus.Gauge
+	scrapeGoroutines     prometheus.Gauge
+	instanceDataLoaded   prometheus.Gauge   // nil unless AWS is enabled
+	instanceDataFailures prometheus.Counter // nil unless AWS is enabled
+	stale                *prometheus.GaugeVec
+	breakerOpen          *prometheus.GaugeVec   // nil unless the circuit breaker is enabled
+	regionSkipped        *prometheus.GaugeVec   // nil unless unauthorized regions are skipped
+	notifyFailures       prometheus.Counter     // nil unless price changes are notified
+	rejectedValues       *prometheus.CounterVec // nil unless values are validated
+	skippedItems         *prometheus.CounterVec
+	apiErrors            *prometheus.CounterVec
+	pricingMetrics       map[string]*prometheus.GaugeVec
+	metricNames          map[string]string   // exported names of pricingMetrics
+	labelOrder           map[string][]string // exported label names of pricingMetrics, in order
+	metricOpts           map[string]prometheus.GaugeOpts
+	snapshot             atomic.Pointer[metricSnapshot] // metrics served by Collect
+	valueBuf             []string                       // label values of the series being exported
+	derivedMetrics       []*derivedMetric
+	awsMetrics           []config.AWSMetric
+	azureMetrics         []config.AzureMetric
+	mappingConfig        []config.MetricMapping
+	mappings             map[string]*metricMapping // by pricing metric name
+	mappingErr           error                     // first invalid mapping found by initGauges
+	validation           config.Validation
 
 	// State
-	nextScrape time.Time
-	errorCount uint64
-	mu         sync.Mutex
+	ctx             context.Context // root context of scrapes, cancelled on shutdown
+	nextScrape      time.Time
+	errorCount      uint64
+	regionErrors    map[regionKey]*uint64 // errors of the current scrape per region
+	skippedRegions  map[regionKey]bool    // regions skipped by their circuit breaker in the current scrape
+	refreshStagger  bool
+	refreshDue      map[regionKey]time.Time // when every region is due for a refresh when staggered
+	deferredRegions map[regionKey]bool      // regions not due in the current scrape
+	breakers        map[regionKey]*breaker
+	regionAccess    map[string]bool    // AWS regions checked for access: true = accessible, false = skipped
+	clusterRegions  map[regionKey]bool // regions with cluster nodes; nil = not restricted
+	clusterNodes    []kube.Node        // nodes of the last successful listing
+	accessMu        sync.Mutex
+	scrapedPrices   map[regionKey]map[string]pricePoint
+	labelValues     labelInterner // label values of the current scrape
+	openCostSize    int           // OpenCost prices of the previous scrape
+	lastPrices      map[regionKey]map[string]pricePoint
+	scrapedJumps    map[regionKey]map[string]float64 // values rejected as jumps in the current scrape
+	jumpedPrices    map[regionKey]map[string]float64 // values rejected as jumps in the last scrape of each region
+	rejections      map[rejection]*rejectionSample   // values rejected in the current scrape
+	priceIndex      atomic.Pointer[PriceIndex]
+	mu              sync.Mutex
+	refreshMu       sync.Mutex
+	refreshing      chan struct{} // closed when the refresh run by Refresh completes; nil = none
+}
+
+// Option configures optional Exporter behaviour.
+type Option func(*Exporter)
+
+// WithResourceBounds restricts exported AWS instance types to the given vCPU and
+// memory (GiB) ranges. Zero values leave the corresponding bound unset.
+func WithResourceBounds(minVCpu, maxVCpu int32, minMemoryGiB, maxMemoryGiB float64) Option {
+	return func(e *Exporter) {
+		e.instanceFilter.MinVCpu = minVCpu
+		e.instanceFilter.MaxVCpu = maxVCpu
+		e.instanceFilter.MinMemoryGiB = minMemoryGiB
+		e.instanceFilter.MaxMemoryGiB = maxMemoryGiB
+	}
+}
+
+// WithInstanceFamilies restricts exported AWS instance types to the given
+// families (e.g. "m5", "c6g"). The filter is pushed into the spot price history
+// and savings plans API requests.
+func WithInstanceFamilies(families []string) Option {
+	return func(e *Exporter) {
+		e.instanceFilter.Families = families
+	}
+}
+
+// WithArchitectures restricts exported AWS instance types to those supporting
+// one of the given architectures (e.g. "arm64", "x86_64").
+func WithArchitectures(architectures []string) Option {
+	return func(e *Exporter) {
+		e.instanceFilter.Architectures = architectures
+	}
+}
+
+// WithAvailabilityZones restricts exported spot and on-demand AWS series to the
+// given availability zones.
+func WithAvailabilityZones(azs []string) Option {
+	return func(e *Exporter) {
+		e.instanceFilter.AvailabilityZones = azs
+	}
+}
+
+// WithSpotAggregation sets the spot aggregation mode (aws.SpotAggregationNone or
+// aws.SpotAggregationRegion).
+func WithSpotAggregation(mode string) Option {
+	return func(e *Exporter) {
+		e.spotOptions.Aggregation = mode
+	}
+}
+
+// WithSpotFeed reads spot prices from the account's S3 spot data feed instead
+// of DescribeSpotPriceHistory.
+func WithSpotFeed(feed aws.SpotFeedConfig) Option {
+	return func(e *Exporter) {
+		e.spotFeed = &feed
+	}
+}
+
+// WithSpotHistoryWindow looks back this far in the spot price history; the
+// newest price per instance type and AZ is exported.
+func WithSpotHistoryWindow(window time.Duration) Option {
+	return func(e *Exporter) {
+		e.spotOptions.HistoryWindow = window
+	}
+}
+
+// WithOnDemandPerRegion emits one on-demand series per region (empty
+// availability_zone) instead of one per AZ. Spot series stay per AZ.
+func WithOnDemandPerRegion(enabled bool) Option {
+	return func(e *Exporter) {
+		e.onDemandOptions.PerRegion = enabled
+	}
+}
+
+// WithOnDemandBackend selects where on-demand prices come from:
+// aws.OnDemandBackendBulk (public bulk file, default) or aws.OnDemandBackendAPI
+// (Pricing Query API, requires credentials).
+func WithOnDemandBackend(backend string) Option {
+	return func(e *Exporter) {
+		e.onDemandBackend = backend
+	}
+}
+
+// WithEffectiveRates exports aws_pricing_ec2_effective, the account's effective
+// hourly rate per instance type from Cost Explorer over the trailing window.
+// A zero window disables it.
+func WithEffectiveRates(window time.Duration) Option {
+	return func(e *Exporter) {
+		e.effectiveWindow = window
+	}
+}
+
+// WithInstanceDataSource selects where instance specifications come from:
+// aws.InstanceDataSourceHTTP (ec2instances.info, default),
+// aws.InstanceDataSourceAPI (DescribeInstanceTypes in the first region) or
+// aws.InstanceDataSourceEmbedded (bundled snapshot only).
+func WithInstanceDataSource(source string) Option {
+	return func(e *Exporter) {
+		e.instanceSource = source
+	}
+}
+
+// WithInstanceRefresh reloads the instance specifications (vCPU, memory,
+// architecture) from ec2instances.info every interval, so new instance types
+// get their specs without a restart. Zero keeps the data loaded at startup.
+func WithInstanceRefresh(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.instanceRefresh = interval
+	}
+}
+
+// WithMacHosts exports mac1/mac2 dedicated host prices from the on-demand bulk
+// pricing file.
+func WithMacHosts(enabled bool) Option {
+	return func(e *Exporter) {
+		e.onDemandOptions.MacHosts = enabled
+	}
+}
+
+// WithLocalStorage exports ec2_local_storage, the hourly price per GiB of
+// instance store of types with local disks, from the on-demand bulk pricing
+// file.
+func WithLocalStorage(enabled bool) Option {
+	return func(e *Exporter) {
+		e.onDemandOptions.LocalStorage = enabled
+	}
+}
+
+// WithInstanceTypeOfferings exports aws_ec2_instance_type_offered for every
+// instance type and availability zone it's offered in.
+func WithInstanceTypeOfferings(enabled bool) Option {
+	return func(e *Exporter) {
+		e.typeOfferings = enabled
+	}
+}
+
+// WithAccounts scrapes spot prices and savings plan rates once per account
+// through the account's client factory, labelling them with account_id.
+// On-demand and the other public prices are still scraped once through the
+// exporter's own client factory.
+func WithAccounts(accounts []aws.Account) Option {
+	return func(e *Exporter) {
+		e.accounts = accounts
+	}
+}
+
+// WithSavingPlanPaging sets the savings plan page size (0 = default) and the
+// delay between page requests.
+func WithSavingPlanPaging(pageSize int32, pageDelay time.Duration) Option {
+	return func(e *Exporter) {
+		e.savingPlanOptions = aws.SavingPlanOptions{PageSize: pageSize, PageDelay: pageDelay}
+	}
+}
+
+// WithSpotPageSize sets the page size of spot price history requests (0 =
+// default).
+func WithSpotPageSize(pageSize int32) Option {
+	return func(e *Exporter) {
+		e.spotOptions.PageSize = pageSize
+	}
+}
+
+// WithPricingPageSize sets the page size of Pricing Query API requests, of
+// the on-demand API backend and the AWS metrics of the configuration file
+// (0 = default).
+func WithPricingPageSize(pageSize int32) Option {
+	return func(e *Exporter) {
+		e.onDemandOptions.PageSize = pageSize
+	}
+}
+
+// WithBurstableUtilization enables the ec2_burstable_effective metric, pricing
+// t2/t3/t3a/t4g instances in unlimited mode at the given average CPU
+// utilization (0-1). Zero disables it.
+func WithBurstableUtilization(utilization float64) Option {
+	return func(e *Exporter) {
+		e.spotOptions.BurstableUtilization = utilization
+		e.onDemandOptions.BurstableUtilization = utilization
+	}
+}
+
+// WithCPUMemRatio sets the CPU-to-memory cost ratio used to split instance
+// prices into ec2_vcpu and ec2_memory (one vCPU costs as much as ratio GB of
+// memory). Zero keeps the default of aws.CpuMemRelation.
+func WithCPUMemRatio(ratio float64) Option {
+	return func(e *Exporter) {
+		e.instances.SetCPUMemRatio(ratio)
+	}
+}
+
+// WithCPUMemRegression replaces the fixed CPU-to-memory ratio with one fitted
+// by least squares to the Linux on-demand prices of each scrape. The fitted
+// ratio applies from the following scrape on; until then the ratio set by
+// WithCPUMemRatio is used.
+func WithCPUMemRegression() Option {
+	return func(e *Exporter) {
+		e.cpuMemRegression = true
+	}
+}
+
+// WithCurrencies emits every price once per currency, converted from USD with
+// rates and distinguished by a currency label. Rates are reloaded every 12
+// hours. Empty currencies keeps plain USD metrics without the label.
+func WithCurrencies(currencies []string, rates *currency.Rates) Option {
+	return func(e *Exporter) {
+		e.currencies = currencies
+		e.rates = rates
+	}
+}
+
+// WithPricePrecision rounds every price to the given number of decimal places
+// before it is set, so float noise in provider responses doesn't show up as
+// changes. Negative disables rounding.
+func WithPricePrecision(digits int) Option {
+	return func(e *Exporter) {
+		e.precision = digits
+	}
+}
+
+// WithRegionNameLabel adds a region_name label with the display name of the
+// region, e.g. "EU (Frankfurt)" or "West Europe", to every pricing metric
+// with a region label. It's empty for regions the exporter doesn't know.
+func WithRegionNameLabel(enabled bool) Option {
+	return func(e *Exporter) {
+		e.regionNameLabel = enabled
+	}
+}
+
+// WithCircuitBreaker skips a region for cooldown after failures consecutive
+// failed scrapes, doubling the cooldown each time the region fails again
+// afterwards. Skipped regions keep serving their last prices. Zero failures
+// disables it.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(e *Exporter) {
+		e.breakerFailures = failures
+		e.breakerCooldown = cooldown
+	}
+}
+
+// WithSkipUnauthorizedRegions checks every AWS region for access before its
+// first scrape and skips it for good when the credentials aren't authorized,
+// e.g. an opt-in region that isn't enabled or one denied by a service control
+// policy. Skipped regions are logged once and exported as
+// cloud_pricing_region_skipped instead of counting as scrape errors.
+func WithSkipUnauthorizedRegions(enabled bool) Option {
+	return func(e *Exporter) {
+		e.skipUnauthorized = enabled
+	}
+}
+
+// WithContext sets the root context of all scrapes and background refreshes.
+// Cancelling it, e.g. on shutdown, aborts in-flight API requests and stops
+// the instance data refresh.
+func WithContext(ctx context.Context) Option {
+	return func(e *Exporter) {
+		e.ctx = ctx
+	}
+}
+
+// WithMetricsFormat selects the exported metric set: the native per-provider
+// metrics, the OpenCost node pricing metrics (node_total_hourly_cost,
+// node_cpu_hourly_cost, node_ram_hourly_cost) or both.
+func WithMetricsFormat(format string) Option {
+	return func(e *Exporter) {
+		e.metricsFormat = format
+	}
+}
+
+// WithNodeCost exports cloud_pricing_node_hourly_cost, the cheapest Linux
+// price of every instance type, region and lifecycle with labels matching
+// kube-state-metrics' kube_node_labels.
+func WithNodeCost(enabled bool) Option {
+	return func(e *Exporter) {
+		e.nodeCost = enabled
+	}
+}
+
+// WithPriceChangeNotifier notifies n of the prices that changed by at least
+// thresholdPercent between two scrapes of their region.
+func WithPriceChangeNotifier(n notify.Notifier, thresholdPercent float64) Option {
+	return func(e *Exporter) {
+		e.notifier = n
+		e.notifyThreshold = thresholdPercent
+	}
+}
+
+// WithCacheJitter varies the cache expiry of every scrape randomly by up to
+// fraction (0-1) of the cache duration, so replicas sharing the same cache
+// duration don't all scrape the pricing endpoints at the same instant.
+func WithCacheJitter(fraction float64) Option {
+	return func(e *Exporter) {
+		e.cacheJitter = fraction
+	}
+}
+
+// WithExternalRefresh leaves scraping to Refresh: Collect only serves the
+// metrics of the last complete scrape and never waits for one.
+func WithExternalRefresh() Option {
+	return func(e *Exporter) {
+		e.externalRefresh = true
+	}
+}
+
+// WithHTTPClient sets the HTTP client of all non-SDK fetches: the bulk
+// pricing files, ec2instances.info and the ECB exchange rates.
+func WithHTTPClient(client *http.Client) Option {
+	return func(e *Exporter) {
+		e.httpClient = client
+	}
+}
+
+// WithNodeLister restricts every scrape to the regions, availability zones
+// and instance types of the AWS and Azure Nodes listed by lister, i.e. of
+// the Kubernetes cluster the exporter runs in.
+func WithNodeLister(lister kube.NodeLister) Option {
+	return func(e *Exporter) {
+		e.nodeLister = lister
+	}
 }
 
 // NewExporter returns a new exporter of cloud pricing metrics.
 // Pass nil for azureCfg to disable Azure VM pricing.
-func NewExporter(pds []string, oss []string, regions []string, lifecycle []string, cache int, instanceRegexes []*regexp.Regexp, savingPlanTypes []string, clientFactory aws.ClientFactory, azureCfg *AzureConfig) (*Exporter, error) {
+func NewExporter(pds []string, oss []string, regions []string, lifecycle []string, cache int, instanceRegexes []*regexp.Regexp, savingPlanTypes []string, clientFactory aws.ClientFactory, azureCfg *AzureConfig, opts ...Option) (*Exporter, error) {
 
 	e := Exporter{
+		ctx:                 context.Background(),
 		productDescriptions: pds,
 		operatingSystems:    oss,
 		regions:             regions,
 		lifecycle:           lifecycle,
 		cache:               cache,
-		instanceRegexes:     instanceRegexes,
+		instanceFilter:      aws.InstanceFilter{Regexes: instanceRegexes},
 		savingPlanTypes:     savingPlanTypes,
 		clientFactory:       clientFactory,
 		instances:           aws.NewInstanceStore(),
+		precision:           -1,
 		nextScrape:          time.Now(),
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: "aws_pricing",
@@ -87,61 +517,310 @@ func NewExporter(pds []string, oss []string, regions []string, lifecycle []strin
 			Name:      "scrape_error",
 			Help:      "The scrape error status.",
 		}),
+		stale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "cloud_pricing",
+			Name:      "stale",
+			Help:      "Whether the last scrape of the region failed and its previous prices are served (1) or not (0).",
+		}, []string{"provider", "region"}),
 	}
 
 	if azureCfg != nil {
 		e.azureEnabled = true
 		e.azureRegions = azureCfg.Regions
 		e.azureOperatingSystems = azureCfg.OperatingSystems
+		e.azurePriceTypes = azureCfg.PriceTypes
+		e.azureLifecycles = azureCfg.Lifecycles
 		e.azureInstanceRegexes = azureCfg.InstanceRegexes
 		e.azureClientFactory = azureCfg.ClientFactory
+		e.azureDetailLabels = azureCfg.DetailLabels
 	}
 
+	for _, opt := range opts {
+		opt(&e)
+	}
+
+	if err := e.validateAzureMetrics(); err != nil {
+		return nil, err
+	}
 	e.initGauges()
+	if e.mappingErr != nil {
+		return nil, e.mappingErr
+	}
+	exported := make(map[string]bool, len(e.metricNames))
+	for _, name := range e.metricNames {
+		if exported[name] {
+			return nil, fmt.Errorf("metric %q of the configuration file has the name of a pricing metric", name)
+		}
+		exported[name] = true
+	}
+	for _, m := range e.mappingConfig {
+		if !exported[m.Metric] {
+			return nil, fmt.Errorf("metric mapping of %q: no such pricing metric", m.Metric)
+		}
+	}
+	for _, d := range e.derivedMetrics {
+		if exported[d.cfg.Name] {
+			return nil, fmt.Errorf("derived metric %q has the name of a pricing metric", d.cfg.Name)
+		}
+	}
+	if e.validation.Enabled() {
+		if err := e.initValidation(exported); err != nil {
+			return nil, err
+		}
+	}
 
 	// Only fetch AWS instances if AWS regions are configured
 	if len(regions) > 0 {
-		if err := e.instances.Load(context.Background(), nil); err != nil {
-			log.WithError(err).Warn("failed to load instance metadata from ec2instances.info — normalized vCPU/memory costs will be unavailable; pricing metrics will still be collected")
+		e.instanceDataLoaded = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "instance_data_last_refresh_timestamp_seconds",
+			Help:      "Unix time of the last successful load of instance specifications.",
+		})
+		e.instanceDataFailures = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "aws_pricing",
+			Name:      "instance_data_refresh_failures_total",
+			Help:      "Total failed loads of instance specifications.",
+		})
+		if err := e.loadInstances(e.ctx); err != nil {
+			log.WithError(err).Warnf("failed to load instance metadata [source=%s], falling back to the bundled snapshot", e.instanceSource)
+			if err := e.instances.LoadEmbedded(); err != nil {
+				log.WithError(err).Warn("failed to load bundled instance metadata — normalized vCPU/memory costs will be unavailable; pricing metrics will still be collected")
+			}
+		}
+		if e.instanceRefresh > 0 && e.instanceSource != aws.InstanceDataSourceEmbedded {
+			go e.refreshInstances(e.ctx, e.instanceRefresh)
 		}
 	}
 
 	return &e, nil
 }
 
+// loadInstances loads the instance store from the configured source and
+// records the outcome.
+func (e *Exporter) loadInstances(ctx context.Context) error {
+	var err error
+	switch e.instanceSource {
+	case aws.InstanceDataSourceEmbedded:
+		err = e.instances.LoadEmbedded()
+	case aws.InstanceDataSourceAPI:
+		var ec2Client aws.EC2Client
+		ec2Client, err = e.clientFactory.NewEC2Client(e.regions[0])
+		if err == nil {
+			err = e.instances.LoadFromAPI(ctx, ec2Client)
+		}
+	default:
+		err = e.instances.Load(ctx, e.httpClient)
+	}
+	if err != nil {
+		e.instanceDataFailures.Inc()
+		return err
+	}
+	e.instanceDataLoaded.SetToCurrentTime()
+	return nil
+}
+
+// refreshInstances reloads the instance store every interval until ctx is
+// done. Failed reloads keep the previous data.
+func (e *Exporter) refreshInstances(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		loadCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		if err := e.loadInstances(loadCtx); err != nil {
+			log.WithError(err).Warnf("failed to refresh instance metadata [source=%s], keeping previous data", e.instanceSource)
+		}
+		cancel()
+	}
+}
+
+// currencyRefresh is how often exchange rates are reloaded; the ECB publishes
+// new reference rates once per working day.
+const currencyRefresh = 12 * time.Hour
+
+// priceLabels returns the label names of a price metric, adding currency when
+// prices are emitted in several currencies.
+func (e *Exporter) priceLabels(names ...string) []string {
+	if len(e.currencies) > 0 {
+		names = append(names, "currency")
+	}
+	return names
+}
+
 func (e *Exporter) initGauges() {
+	e.initPoolGauges()
+	e.initUsageGauges()
+
+	if e.breakerFailures > 0 {
+		e.breakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "cloud_pricing",
+			Name:      "circuit_breaker_open",
+			Help:      "Whether the circuit breaker of the region is open and its scrapes are skipped (1) or not (0).",
+		}, []string{"provider", "region"})
+	}
+
+	if e.skipUnauthorized {
+		e.regionSkipped = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "cloud_pricing",
+			Name:      "region_skipped",
+			Help:      "Regions skipped because the credentials aren't authorized to call them, with the API error code as reason. Always 1.",
+		}, []string{"provider", "region", "reason"})
+	}
+
+	if e.notifier != nil {
+		e.notifyFailures = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "cloud_pricing",
+			Name:      "notification_failures_total",
+			Help:      "Total failed deliveries of price change notifications.",
+		})
+	}
+
+	e.skippedItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cloud_pricing",
+		Name:      "skipped_items_total",
+		Help:      "Total items of provider API responses skipped, by reason: filtered, unknown_instance_type, unparsable_price or missing_terms.",
+	}, []string{"provider", "reason"})
+	for _, reason := range []string{provider.SkipFiltered, provider.SkipUnknownInstanceType, provider.SkipUnparsablePrice, provider.SkipMissingTerms} {
+		if len(e.regions) > 0 {
+			e.skippedItems.WithLabelValues("aws", reason)
+		}
+		if e.azureEnabled {
+			e.skippedItems.WithLabelValues("azure", reason)
+		}
+	}
+
+	e.apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cloud_pricing",
+		Name:      "api_errors_total",
+		Help:      "Total failed provider API requests, by category (permission, credentials, region, throttling, network, server or other), the missing permission of permission errors and the remediation hint.",
+	}, []string{"provider", "category", "permission", "hint"})
+
 	e.pricingMetrics = map[string]*prometheus.GaugeVec{}
-	e.pricingMetrics["ec2"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	e.metricNames = map[string]string{}
+	e.labelOrder = map[string][]string{}
+	e.metricOpts = map[string]prometheus.GaugeOpts{}
+	e.newPricingMetric("ec2", prometheus.GaugeOpts{
 		Namespace: "aws_pricing",
 		Name:      "ec2",
 		Help:      "Current price of the instance type.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "product_description", "operating_system", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "memory", "vcpu"})
+	}, e.priceLabels("instance_lifecycle", "instance_type", "region", "availability_zone", "product_description", "operating_system", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "license_model", "offering_class", "offering_type", "lease_contract_length", "memory", "vcpu", "account_id"))
 
-	e.pricingMetrics["ec2_memory"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	e.newPricingMetric("ec2_memory", prometheus.GaugeOpts{
 		Namespace: "aws_pricing",
 		Name:      "ec2_memory",
 		Help:      "Price of each GB of memory of the instance.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type"})
+	}, e.priceLabels("instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "account_id"))
 
-	e.pricingMetrics["ec2_vcpu"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	e.newPricingMetric("ec2_vcpu", prometheus.GaugeOpts{
 		Namespace: "aws_pricing",
 		Name:      "ec2_vcpu",
 		Help:      "Price of each VCPU of the instance.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type"})
+	}, e.priceLabels("instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "account_id"))
+
+	if len(e.savingPlanTypes) > 0 {
+		e.newPricingMetric("ec2_saving_plan_upfront", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_saving_plan_upfront",
+			Help:      "Upfront payment of a Partial or All Upfront savings plan covering one instance of the type for the full term.",
+		}, e.priceLabels("instance_type", "region", "product_description", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "account_id"))
+	}
+
+	if slices.Contains(e.savingPlanTypes, aws.SavingPlanTypeSageMaker) {
+		e.newPricingMetric(aws.SageMakerSavingPlanMetric, prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      aws.SageMakerSavingPlanMetric,
+			Help:      "Hourly SageMaker savings plan rate of the ML instance type used by the SageMaker component.",
+		}, e.priceLabels("instance_type", "region", "component", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "account_id"))
+	}
+
+	if e.onDemandOptions.MacHosts {
+		e.newPricingMetric("ec2_mac_host", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_mac_host",
+			Help:      "Hourly on-demand price of a Mac dedicated host, billed for at least minimum_allocation_hours once allocated.",
+		}, e.priceLabels("instance_type", "region", "minimum_allocation_hours"))
+		e.newPricingMetric("ec2_mac_host_minimum_commitment", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_mac_host_minimum_commitment",
+			Help:      "Minimum cost of allocating a Mac dedicated host (hourly price times the minimum allocation period).",
+		}, e.priceLabels("instance_type", "region"))
+	}
+
+	if e.onDemandOptions.LocalStorage {
+		e.newPricingMetric("ec2_local_storage", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_local_storage",
+			Help:      "Hourly price per GiB of instance store: the on-demand Linux price difference to the equivalent type without local disks, divided by the instance store size.",
+		}, e.priceLabels("instance_type", "region"))
+	}
+
+	if e.typeOfferings {
+		e.newPricingMetric("instance_type_offered", prometheus.GaugeOpts{
+			Namespace: "aws_ec2",
+			Name:      "instance_type_offered",
+			Help:      "Whether the instance type is offered in the availability zone (1 if offered, absent otherwise).",
+		}, []string{"instance_type", "region", "availability_zone"})
+	}
+
+	if e.effectiveWindow > 0 {
+		e.newPricingMetric("ec2_effective", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_effective",
+			Help:      "Effective hourly rate actually paid for the instance type (net amortized cost per running hour, from Cost Explorer).",
+		}, e.priceLabels("instance_type", "region"))
+	}
+
+	if e.spotOptions.BurstableUtilization > 0 {
+		e.newPricingMetric("ec2_burstable_effective", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_burstable_effective",
+			Help:      "Effective hourly price of a burstable instance type in unlimited mode, including the CPU credit surcharge at the assumed utilization.",
+		}, e.priceLabels("instance_lifecycle", "instance_type", "region", "availability_zone", "product_description", "operating_system", "license_model", "account_id"))
+	}
+
+	if e.spotOptions.Aggregation == aws.SpotAggregationRegion {
+		e.newPricingMetric("ec2_spot_region", prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "ec2_spot_region",
+			Help:      "Spot price of the instance type aggregated across the availability zones of a region.",
+		}, e.priceLabels("instance_type", "region", "product_description", "statistic", "account_id"))
+	}
+
+	if e.metricsFormat == MetricsFormatOpenCost || e.metricsFormat == MetricsFormatBoth {
+		e.initOpenCostGauges()
+	}
+	if e.nodeCost {
+		e.initNodeCostGauge()
+	}
+
+	e.initAWSMetricGauges()
+	e.initAWSServiceGauges()
 
 	if e.azureEnabled {
-		e.pricingMetrics["azure_vm"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		azureLabels := []string{"instance_lifecycle", "instance_type", "region", "operating_system", "price_type", "memory", "vcpu", "constrained_vcpu"}
+		if e.azureDetailLabels {
+			azureLabels = append(azureLabels, "meter_name", "product_name")
+		}
+		e.newPricingMetric("azure_vm", prometheus.GaugeOpts{
 			Namespace: "azure_pricing",
 			Name:      "vm",
 			Help:      "Current price of the Azure VM instance type.",
-		}, []string{"instance_lifecycle", "instance_type", "region", "operating_system"})
+		}, e.priceLabels(azureLabels...))
+		e.newPricingMetric("azure_vm_windows_license", prometheus.GaugeOpts{
+			Namespace: "azure_pricing",
+			Name:      "vm_windows_license",
+			Help:      "Hourly Windows license uplift of the Azure VM instance type over its Linux price.",
+		}, e.priceLabels("instance_lifecycle", "instance_type", "region", "price_type"))
+		e.initAzureMetricGauges()
+		e.initAzureServiceGauges()
 	}
-}
 
-// resetGauges clears all existing gauge values without replacing the registered GaugeVec objects.
-func (e *Exporter) resetGauges() {
-	for _, m := range e.pricingMetrics {
-		m.Reset()
+	if e.fake != nil {
+		e.initFakeGauges()
 	}
 }
 
@@ -150,36 +829,156 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.pricingMetrics {
 		m.Describe(ch)
 	}
+	for _, d := range e.derivedMetrics {
+		d.gauge.Describe(ch)
+	}
 	ch <- e.duration.Desc()
 	ch <- e.totalScrapes.Desc()
 	ch <- e.scrapeErrors.Desc()
+	ch <- e.poolWorkers.Desc()
+	ch <- e.poolQueued.Desc()
+	ch <- e.poolInFlight.Desc()
+	ch <- e.scrapeAllocated.Desc()
+	ch <- e.scrapePeakHeap.Desc()
+	ch <- e.scrapeGoroutines.Desc()
+	e.stale.Describe(ch)
+	e.skippedItems.Describe(ch)
+	e.apiErrors.Describe(ch)
+	if e.breakerOpen != nil {
+		e.breakerOpen.Describe(ch)
+	}
+	if e.regionSkipped != nil {
+		e.regionSkipped.Describe(ch)
+	}
+	if e.notifyFailures != nil {
+		ch <- e.notifyFailures.Desc()
+	}
+	if e.rejectedValues != nil {
+		e.rejectedValues.Describe(ch)
+	}
+	if e.instanceDataLoaded != nil {
+		ch <- e.instanceDataLoaded.Desc()
+		ch <- e.instanceDataFailures.Desc()
+	}
 }
 
-// Collect fetches info from cloud provider APIs.
+// rootContext returns the context set by WithContext, or the background
+// context.
+func (e *Exporter) rootContext() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// cacheTTL returns how long scrape results are cached, varied randomly by
+// up to cacheJitter of the cache duration in either direction.
+func (e *Exporter) cacheTTL() time.Duration {
+	ttl := time.Second * time.Duration(e.cache)
+	if e.cacheJitter <= 0 {
+		return ttl
+	}
+	return time.Duration(float64(ttl) * (1 + e.cacheJitter*(2*rand.Float64()-1)))
+}
+
+// Collect fetches info from cloud provider APIs. The metrics of a scrape are
+// served once it's complete; collectors running concurrently with a scrape
+// are served the previous one.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	if !e.externalRefresh && e.lockForScrape() {
+		e.refresh()
+		e.mu.Unlock()
+	}
 
-	e.mu.Lock()
+	e.duration.Collect(ch)
+	e.totalScrapes.Collect(ch)
+	e.scrapeErrors.Collect(ch)
+	e.poolWorkers.Collect(ch)
+	e.poolQueued.Collect(ch)
+	e.poolInFlight.Collect(ch)
+	e.scrapeAllocated.Collect(ch)
+	e.scrapePeakHeap.Collect(ch)
+	e.scrapeGoroutines.Collect(ch)
+	e.stale.Collect(ch)
+	e.skippedItems.Collect(ch)
+	e.apiErrors.Collect(ch)
+	if e.breakerOpen != nil {
+		e.breakerOpen.Collect(ch)
+	}
+	if e.regionSkipped != nil {
+		e.regionSkipped.Collect(ch)
+	}
+	if e.notifyFailures != nil {
+		e.notifyFailures.Collect(ch)
+	}
+	if e.rejectedValues != nil {
+		e.rejectedValues.Collect(ch)
+	}
+	if e.instanceDataLoaded != nil {
+		e.instanceDataLoaded.Collect(ch)
+		e.instanceDataFailures.Collect(ch)
+	}
+
+	e.collectSnapshot(ch)
+}
+
+// Refresh scrapes the providers if the cache has expired. Callers while a
+// refresh runs join it instead of starting another one. It returns ctx's
+// error if ctx is done first; the scrape carries on and its metrics are
+// served once it's complete.
+func (e *Exporter) Refresh(ctx context.Context) error {
+	e.refreshMu.Lock()
+	done := e.refreshing
+	if done == nil {
+		done = make(chan struct{})
+		e.refreshing = done
+		go func() {
+			e.mu.Lock()
+			e.refresh()
+			e.mu.Unlock()
+			e.refreshMu.Lock()
+			e.refreshing = nil
+			e.refreshMu.Unlock()
+			close(done)
+		}()
+	}
+	e.refreshMu.Unlock()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh scrapes the providers if the cache has expired and publishes the
+// result. e.mu must be held.
+func (e *Exporter) refresh() {
 	if time.Now().After(e.nextScrape) {
 		// Set nextScrape immediately to prevent concurrent scrapes from entering
-		e.nextScrape = time.Now().Add(time.Second * time.Duration(e.cache))
+		e.nextScrape = time.Now().Add(e.cacheTTL())
 
 		pricingScrapes := make(chan provider.ScrapeResult)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		ctx, cancel := context.WithTimeout(e.rootContext(), 5*time.Minute)
 		defer cancel()
 
+		usage := startUsage()
 		e.resetGauges()
 		go e.scrape(ctx, pricingScrapes)
 		e.setPricingMetrics(pricingScrapes)
+		if e.notifier != nil {
+			e.notifyPriceChanges()
+		}
+		e.serveStale()
+		e.setDerivedMetrics()
+		e.reportUnconverted()
+		e.buildPriceIndex()
+		usage.finish(e)
+		e.publishSnapshot()
 	}
-	e.mu.Unlock()
-
-	e.duration.Collect(ch)
-	e.totalScrapes.Collect(ch)
-	e.scrapeErrors.Collect(ch)
-
-	for _, m := range e.pricingMetrics {
-		m.Collect(ch)
+	if e.snapshot.Load() == nil {
+		e.publishSnapshot()
 	}
 }
 
@@ -191,102 +990,562 @@ func (e *Exporter) scrape(ctx context.Context, scrapes chan<- provider.ScrapeRes
 	e.totalScrapes.Inc()
 
 	atomic.StoreUint64(&e.errorCount, 0)
+	e.initRegionErrors()
+	e.applyClusterNodes(ctx)
+	e.refreshRates(ctx)
 	log.Debugf("before for %v\n", e.regions)
+	awsRegions := e.dueRegions("aws", e.awsScrapeRegions(), now)
 
-	var wg sync.WaitGroup
-	for _, region := range e.regions {
+	pool := e.newWorkerPool()
+	if e.spotFeed != nil && provider.Contains(e.lifecycle, "spot") {
+		pool.submit(func() {
+			s3Client, err := e.clientFactory.NewS3Client(e.spotFeed.Region)
+			if err != nil {
+				log.WithError(err).Errorf("failed to create S3 client [region=%s]", e.spotFeed.Region)
+				atomic.AddUint64(&e.errorCount, 1)
+				return
+			}
+			aws.GetSpotFeedPricing(ctx, awsRegions, s3Client, *e.spotFeed, e.productDescriptions, e.instanceFilter, e.instances, &e.errorCount, scrapes)
+		})
+	}
+	if e.effectiveWindow > 0 {
+		pool.submit(func() {
+			e.scrapeEffectiveRates(ctx, awsRegions, scrapes)
+		})
+	}
+	for _, region := range awsRegions {
+		if !e.regionAccessible(region) {
+			continue
+		}
+		if !e.breakerAllows(regionKey{"aws", region}, now) {
+			log.Debugf("circuit breaker open, skipping ec2 prices [region=%s]", region)
+			continue
+		}
 		log.Debugf("querying ec2 prices [region=%s]", region)
-		wg.Add(1)
-		go func(region string) {
-			defer wg.Done()
+		pool.submit(func() {
+			errorCount := e.regionErrors[regionKey{"aws", region}]
 
 			ec2Client, err := e.clientFactory.NewEC2Client(region)
 			if err != nil {
 				log.WithError(err).Errorf("failed to create EC2 client [region=%s]", region)
-				atomic.AddUint64(&e.errorCount, 1)
+				atomic.AddUint64(errorCount, 1)
 				return
 			}
-
-			if provider.Contains(e.lifecycle, "spot") {
-				aws.GetSpotPricing(ctx, region, ec2Client, e.productDescriptions, e.instanceRegexes, e.instances, &e.errorCount, scrapes)
+			if !e.checkRegionAccess(ctx, region, ec2Client) {
+				return
 			}
 
-			if provider.Contains(e.lifecycle, "ondemand") {
-				aws.GetOnDemandPricing(ctx, region, ec2Client, nil, e.operatingSystems, e.instanceRegexes, e.instances, &e.errorCount, scrapes)
+			if len(e.accounts) == 0 {
+				e.scrapeAccount(ctx, region, aws.Account{ClientFactory: e.clientFactory}, ec2Client, errorCount, scrapes)
 			}
 
-			if len(e.savingPlanTypes) != 0 {
-				spClient, err := e.clientFactory.NewSavingsPlansClient()
-				if err != nil {
-					log.WithError(err).Errorf("failed to create SavingsPlans client [region=%s]", region)
-					atomic.AddUint64(&e.errorCount, 1)
-					return
+			if provider.Contains(e.lifecycle, "ondemand") || provider.Contains(e.lifecycle, "reserved") {
+				opts := e.onDemandOptions
+				opts.Reserved = provider.Contains(e.lifecycle, "reserved")
+				opts.SkipOnDemand = !provider.Contains(e.lifecycle, "ondemand")
+				if e.onDemandBackend == aws.OnDemandBackendAPI {
+					pricingClient, err := e.clientFactory.NewPricingClient()
+					if err != nil {
+						log.WithError(err).Errorf("failed to create Pricing client [region=%s]", region)
+						atomic.AddUint64(errorCount, 1)
+					} else {
+						aws.GetOnDemandPricingAPI(ctx, region, ec2Client, pricingClient, e.operatingSystems, e.instanceFilter, opts, e.instances, errorCount, scrapes)
+					}
+				} else {
+					aws.GetOnDemandPricing(ctx, region, ec2Client, e.httpClient, e.operatingSystems, e.instanceFilter, opts, e.instances, errorCount, scrapes)
 				}
-				aws.GetSavingPlanPricing(ctx, region, spClient, e.savingPlanTypes, e.productDescriptions, e.instanceRegexes, e.instances, &e.errorCount, scrapes)
 			}
 
-		}(region)
+			if e.typeOfferings {
+				aws.GetInstanceTypeOfferings(ctx, region, ec2Client, e.instanceFilter, e.instances, errorCount, scrapes)
+			}
+
+			e.scrapeAWSMetrics(ctx, region, errorCount, scrapes)
+			e.scrapeAWSServices(ctx, region, errorCount, scrapes)
+		})
+
+		for _, account := range e.accounts {
+			pool.submit(func() {
+				e.scrapeAccount(ctx, region, account, nil, e.regionErrors[regionKey{"aws", region}], scrapes)
+			})
+		}
 	}
 	// Azure VM pricing
 	if e.azureEnabled && e.azureClientFactory != nil {
 		for _, region := range e.azureRegions {
-			wg.Add(1)
-			go func(region string) {
-				defer wg.Done()
+			if !e.inCluster(regionKey{"azure", region}) || !e.regionDue(regionKey{"azure", region}, now) {
+				continue
+			}
+			if !e.breakerAllows(regionKey{"azure", region}, now) {
+				log.Debugf("circuit breaker open, skipping Azure VM prices [region=%s]", region)
+				continue
+			}
+			pool.submit(func() {
 				client := e.azureClientFactory.NewRetailPricesClient()
-				azure.GetOnDemandPricing(ctx, region, client, e.azureOperatingSystems, e.azureInstanceRegexes, &e.errorCount, scrapes)
-			}(region)
+				azure.GetOnDemandPricing(ctx, region, client, e.azureClientFactory.NewResourceSKUsClient(), azure.VMPriceQuery{OperatingSystems: e.azureOperatingSystems, PriceTypes: e.azurePriceTypes, Lifecycles: e.azureLifecycles, InstanceTypes: e.azureInstanceTypes}, e.azureInstanceRegexes, e.regionErrors[regionKey{"azure", region}], scrapes)
+				e.scrapeAzureMetrics(ctx, region, client, e.regionErrors[regionKey{"azure", region}], scrapes)
+				e.scrapeAzureServices(ctx, region, client, e.regionErrors[regionKey{"azure", region}], scrapes)
+			})
 		}
 	}
 
-	wg.Wait()
+	if e.cloudFront {
+		e.scrapeCloudFront(ctx, now, pool, scrapes)
+	}
+	if e.fake != nil {
+		e.scrapeFake(ctx, now, pool, scrapes)
+	}
 
+	pool.wait()
+
+	for _, errs := range e.regionErrors {
+		atomic.AddUint64(&e.errorCount, atomic.LoadUint64(errs))
+	}
+	e.updateBreakers(time.Now())
+	e.scheduleRefreshes(now)
 	e.scrapeErrors.Set(float64(atomic.LoadUint64(&e.errorCount)))
 	e.duration.Set(time.Since(now).Seconds())
 }
 
+// scrapeAccount scrapes the account-specific data of a region: spot prices
+// (AZ names are mapped per account) and savings plan rates. ec2Client may be
+// nil, in which case it's created through the account's client factory when
+// needed. Results of named accounts carry their account ID. Errors are counted
+// in errorCount.
+func (e *Exporter) scrapeAccount(ctx context.Context, region string, account aws.Account, ec2Client aws.EC2Client, errorCount *uint64, scrapes chan<- provider.ScrapeResult) {
+	if account.ID != "" {
+		labelled := make(chan provider.ScrapeResult)
+		done := make(chan struct{})
+		go func(out chan<- provider.ScrapeResult) {
+			defer close(done)
+			for r := range labelled {
+				r.AccountID = account.ID
+				out <- r
+			}
+		}(scrapes)
+		defer func() {
+			close(labelled)
+			<-done
+		}()
+		scrapes = labelled
+	}
+
+	if provider.Contains(e.lifecycle, "spot") && e.spotFeed == nil {
+		if ec2Client == nil {
+			var err error
+			ec2Client, err = account.ClientFactory.NewEC2Client(region)
+			if err != nil {
+				log.WithError(err).Errorf("failed to create EC2 client [region=%s, account=%s]", region, account.ID)
+				atomic.AddUint64(errorCount, 1)
+				return
+			}
+		}
+		aws.GetSpotPricing(ctx, region, ec2Client, e.productDescriptions, e.instanceFilter, e.spotOptions, e.instances, errorCount, scrapes)
+	}
+
+	if len(e.savingPlanTypes) != 0 {
+		spClient, err := account.ClientFactory.NewSavingsPlansClient()
+		if err != nil {
+			log.WithError(err).Errorf("failed to create SavingsPlans client [region=%s, account=%s]", region, account.ID)
+			atomic.AddUint64(errorCount, 1)
+			return
+		}
+		aws.GetSavingPlanPricing(ctx, region, spClient, e.savingPlanTypes, e.productDescriptions, e.instanceFilter, e.savingPlanOptions, e.instances, errorCount, scrapes)
+	}
+}
+
+// ingestBatchSize is the maximum number of scrape results setPricingMetrics
+// takes off the channel at once.
+const ingestBatchSize = 512
+
 func (e *Exporter) setPricingMetrics(scrapes <-chan provider.ScrapeResult) {
 	log.Debug("set pricing metrics")
-	for scr := range scrapes {
-		name := scr.Name
-		if _, ok := e.pricingMetrics[name]; !ok {
-			log.Warnf("setPricingMetrics: unknown metric name %q, dropping", name)
-			continue
+	var fit aws.ResourceRateFit
+	fitted := make(map[string]bool)
+	openCost := e.metricsFormat == MetricsFormatOpenCost || e.metricsFormat == MetricsFormatBoth
+	openCostPrices := make(map[openCostKey]openCostPrice, e.openCostSize)
+	e.labelValues.reset()
+	batch := make([]provider.ScrapeResult, 0, ingestBatchSize)
+	for {
+		batch = receiveBatch(scrapes, batch[:0])
+		if len(batch) == 0 {
+			break
 		}
-		var labels prometheus.Labels
-		switch name {
-		case "ec2":
-			labels = map[string]string{
-				"instance_lifecycle":   scr.InstanceLifecycle,
-				"instance_type":        scr.InstanceType,
-				"region":               scr.Region,
-				"availability_zone":    scr.AvailabilityZone,
-				"product_description":  scr.ProductDescription,
-				"operating_system":     scr.OperatingSystem,
-				"saving_plan_option":   scr.SavingPlanOption,
-				"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
-				"saving_plan_type":     scr.SavingPlanType,
-				"memory":               scr.Memory,
-				"vcpu":                 scr.VCpu,
+		for i := range batch {
+			scr := &batch[i]
+			if scr.Name == provider.SkippedName {
+				e.skippedItems.WithLabelValues(scr.Labels["provider"], scr.Labels["reason"]).Inc()
+				continue
+			}
+			if scr.Name == provider.FailedName {
+				e.apiErrors.WithLabelValues(scr.Labels["provider"], scr.Labels["category"], scr.Labels["permission"], scr.Labels["hint"]).Inc()
+				continue
+			}
+			name := scr.Name
+			if _, ok := e.pricingMetrics[name]; !ok {
+				log.Warnf("setPricingMetrics: unknown metric name %q, dropping", name)
+				continue
+			}
+			labels := e.pricingLabels(*scr)
+			e.labelValues.internLabels(labels)
+			value, ok := e.validatePrice(name, scr.Region, labels, scr.Value)
+			if !ok {
+				continue
+			}
+			scr.Value = value
+			if e.cpuMemRegression {
+				e.addResourceSample(&fit, fitted, *scr)
+			}
+			if openCost || e.nodeCost {
+				e.addOpenCostSample(openCostPrices, *scr)
+			}
+			if e.metricsFormat == MetricsFormatOpenCost {
+				continue
+			}
+			e.recordPrice(scr.Region, name, labels, scr.Value)
+			e.setPrice(name, labels, scr.Value)
+		}
+		clear(batch) // drop the label maps of the results
+	}
+	if e.rejectedValues != nil {
+		e.finishValidation()
+	}
+	e.openCostSize = len(openCostPrices)
+	if openCost {
+		e.setOpenCostMetrics(openCostPrices)
+	}
+	if e.nodeCost {
+		e.setNodeCostMetrics(openCostPrices)
+	}
+	if e.cpuMemRegression {
+		e.applyResourceFit(&fit)
+	}
+}
+
+// receiveBatch appends the results waiting in scrapes to batch, up to its
+// capacity, blocking only for the first one. It returns batch unchanged once
+// scrapes is closed and drained.
+func receiveBatch(scrapes <-chan provider.ScrapeResult, batch []provider.ScrapeResult) []provider.ScrapeResult {
+	scr, ok := <-scrapes
+	if !ok {
+		return batch
+	}
+	batch = append(batch, scr)
+	for len(batch) < cap(batch) {
+		select {
+		case scr, ok := <-scrapes:
+			if !ok {
+				return batch
 			}
-		case "ec2_memory", "ec2_vcpu":
-			labels = map[string]string{
-				"instance_lifecycle":   scr.InstanceLifecycle,
-				"instance_type":        scr.InstanceType,
-				"region":               scr.Region,
-				"availability_zone":    scr.AvailabilityZone,
-				"saving_plan_option":   scr.SavingPlanOption,
-				"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
-				"saving_plan_type":     scr.SavingPlanType,
+			batch = append(batch, scr)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// pricingLabels returns the labels of the pricing metric of a scrape result.
+func (e *Exporter) pricingLabels(scr provider.ScrapeResult) prometheus.Labels {
+	var labels prometheus.Labels
+	switch scr.Name {
+	case "ec2":
+		labels = map[string]string{
+			"instance_lifecycle":    scr.InstanceLifecycle,
+			"instance_type":         scr.InstanceType,
+			"region":                scr.Region,
+			"availability_zone":     scr.AvailabilityZone,
+			"product_description":   scr.ProductDescription,
+			"operating_system":      scr.OperatingSystem,
+			"saving_plan_option":    scr.SavingPlanOption,
+			"saving_plan_duration":  strconv.Itoa(scr.SavingPlanDuration),
+			"saving_plan_type":      scr.SavingPlanType,
+			"license_model":         scr.LicenseModel,
+			"offering_class":        scr.OfferingClass,
+			"offering_type":         scr.OfferingType,
+			"lease_contract_length": scr.LeaseLength,
+			"memory":                scr.Memory,
+			"vcpu":                  scr.VCpu,
+			"account_id":            scr.AccountID,
+		}
+	case "ec2_memory", "ec2_vcpu":
+		labels = map[string]string{
+			"instance_lifecycle":   scr.InstanceLifecycle,
+			"instance_type":        scr.InstanceType,
+			"region":               scr.Region,
+			"availability_zone":    scr.AvailabilityZone,
+			"saving_plan_option":   scr.SavingPlanOption,
+			"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
+			"saving_plan_type":     scr.SavingPlanType,
+			"account_id":           scr.AccountID,
+		}
+	case "ec2_saving_plan_upfront":
+		labels = map[string]string{
+			"instance_type":        scr.InstanceType,
+			"region":               scr.Region,
+			"product_description":  scr.ProductDescription,
+			"saving_plan_option":   scr.SavingPlanOption,
+			"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
+			"saving_plan_type":     scr.SavingPlanType,
+			"account_id":           scr.AccountID,
+		}
+	case aws.SageMakerSavingPlanMetric:
+		labels = map[string]string{
+			"instance_type":        scr.InstanceType,
+			"region":               scr.Region,
+			"component":            scr.Labels["component"],
+			"saving_plan_option":   scr.SavingPlanOption,
+			"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
+			"saving_plan_type":     scr.SavingPlanType,
+			"account_id":           scr.AccountID,
+		}
+	case "ec2_mac_host":
+		labels = map[string]string{
+			"instance_type":            scr.InstanceType,
+			"region":                   scr.Region,
+			"minimum_allocation_hours": strconv.Itoa(aws.MacHostMinimumAllocationHours),
+		}
+	case "ec2_mac_host_minimum_commitment":
+		labels = map[string]string{
+			"instance_type": scr.InstanceType,
+			"region":        scr.Region,
+		}
+	case "ec2_local_storage":
+		labels = map[string]string{
+			"instance_type": scr.InstanceType,
+			"region":        scr.Region,
+		}
+	case "instance_type_offered":
+		labels = map[string]string{
+			"instance_type":     scr.InstanceType,
+			"region":            scr.Region,
+			"availability_zone": scr.AvailabilityZone,
+		}
+	case "ec2_effective":
+		labels = map[string]string{
+			"instance_type": scr.InstanceType,
+			"region":        scr.Region,
+		}
+	case "ec2_burstable_effective":
+		labels = map[string]string{
+			"instance_lifecycle":  scr.InstanceLifecycle,
+			"instance_type":       scr.InstanceType,
+			"region":              scr.Region,
+			"availability_zone":   scr.AvailabilityZone,
+			"product_description": scr.ProductDescription,
+			"operating_system":    scr.OperatingSystem,
+			"license_model":       scr.LicenseModel,
+			"account_id":          scr.AccountID,
+		}
+	case "ec2_spot_region":
+		labels = map[string]string{
+			"instance_type":       scr.InstanceType,
+			"region":              scr.Region,
+			"product_description": scr.ProductDescription,
+			"statistic":           scr.Statistic,
+			"account_id":          scr.AccountID,
+		}
+	case "azure_vm":
+		labels = map[string]string{
+			"instance_lifecycle": scr.InstanceLifecycle,
+			"instance_type":      scr.InstanceType,
+			"region":             scr.Region,
+			"operating_system":   scr.OperatingSystem,
+			"price_type":         scr.PriceType,
+			"memory":             scr.Memory,
+			"vcpu":               scr.VCpu,
+			"constrained_vcpu":   scr.ConstrainedVCpu,
+		}
+		if e.azureDetailLabels {
+			labels["meter_name"] = scr.MeterName
+			labels["product_name"] = scr.ProductName
+		}
+	case "azure_vm_windows_license":
+		labels = map[string]string{
+			"instance_lifecycle": scr.InstanceLifecycle,
+			"instance_type":      scr.InstanceType,
+			"region":             scr.Region,
+			"price_type":         scr.PriceType,
+		}
+	case fake.MetricName:
+		labels = map[string]string{
+			"instance_lifecycle": scr.InstanceLifecycle,
+			"instance_type":      scr.InstanceType,
+			"region":             scr.Region,
+		}
+	default: // AWS and Azure metrics of the configuration file
+		labels = make(prometheus.Labels, len(scr.Labels)+1)
+		for k, v := range scr.Labels {
+			labels[k] = v
+		}
+		labels["region"] = scr.Region
+	}
+	return labels
+}
+
+// newPricingMetric creates the pricing metric name, exported as described by
+// opts.
+func (e *Exporter) newPricingMetric(name string, opts prometheus.GaugeOpts, labels []string) {
+	if e.regionNameLabel && slices.Contains(labels, "region") {
+		labels = append(slices.Clip(labels), "region_name")
+	}
+	fqName := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	names := e.mapLabelNames(name, fqName, labels)
+	e.pricingMetrics[name] = prometheus.NewGaugeVec(opts, names)
+	e.metricNames[name] = fqName
+	e.labelOrder[name] = names
+	e.metricOpts[name] = opts
+}
+
+// setPrice sets a pricing metric, once per configured currency when
+// currencies are set. Currencies without a known rate are skipped. labels is
+// left as it was passed, except for the region_name label it's given when
+// enabled.
+func (e *Exporter) setPrice(name string, labels prometheus.Labels, usd float64) {
+	if m := e.mappings[name]; m != nil {
+		usd *= m.scale
+	}
+	if region, ok := labels["region"]; ok && e.regionNameLabel {
+		labels["region_name"] = regionname.Name(region)
+	}
+	if name == "instance_type_offered" {
+		e.export(name, labels, usd)
+		return
+	}
+	if len(e.currencies) == 0 {
+		e.export(name, labels, e.round(usd))
+		return
+	}
+	for _, code := range e.currencies {
+		value, ok := e.rates.Convert(usd, code)
+		if !ok {
+			if e.unconverted == nil {
+				e.unconverted = make(map[string]int)
 			}
-		case "azure_vm":
-			labels = map[string]string{
-				"instance_lifecycle": scr.InstanceLifecycle,
-				"instance_type":      scr.InstanceType,
-				"region":             scr.Region,
-				"operating_system":   scr.OperatingSystem,
+			e.unconverted[code]++
+			continue
+		}
+		labels["currency"] = code
+		e.export(name, labels, e.round(value))
+	}
+	delete(labels, "currency")
+}
+
+// round rounds value to the configured price precision.
+func (e *Exporter) round(value float64) float64 {
+	if e.precision < 0 {
+		return value
+	}
+	scale := math.Pow10(e.precision)
+	return math.Round(value*scale) / scale
+}
+
+// effectiveRatesRefresh is how long effective rates are reused. Cost Explorer
+// data changes daily and every request is billed, so it isn't queried on
+// every scrape.
+const effectiveRatesRefresh = 6 * time.Hour
+
+// scrapeEffectiveRates sends the effective rates of regions, querying Cost
+// Explorer for all scraped regions once the cached rates are older than
+// effectiveRatesRefresh. A failed query keeps the cached rates and is retried
+// on the next scrape.
+func (e *Exporter) scrapeEffectiveRates(ctx context.Context, regions []string, scrapes chan<- provider.ScrapeResult) {
+	e.effectiveMu.Lock()
+	defer e.effectiveMu.Unlock()
+	if e.effectiveRates == nil || time.Since(e.effectiveFetched) >= effectiveRatesRefresh {
+		if rates, ok := e.fetchEffectiveRates(ctx, scrapes); ok {
+			e.effectiveRates, e.effectiveFetched = rates, time.Now()
+		}
+	}
+	for _, r := range e.effectiveRates {
+		if provider.Contains(regions, r.Region) {
+			scrapes <- r
+		}
+	}
+}
+
+// fetchEffectiveRates queries Cost Explorer for the effective rates of all
+// scraped regions. Failures and skips are passed on to scrapes; ok is false
+// if the query failed.
+func (e *Exporter) fetchEffectiveRates(ctx context.Context, scrapes chan<- provider.ScrapeResult) (rates []provider.ScrapeResult, ok bool) {
+	ceClient, err := e.clientFactory.NewCostExplorerClient()
+	if err != nil {
+		log.WithError(err).Error("failed to create Cost Explorer client")
+		atomic.AddUint64(&e.errorCount, 1)
+		return nil, false
+	}
+	results := make(chan provider.ScrapeResult)
+	done := make(chan struct{})
+	rates, ok = []provider.ScrapeResult{}, true
+	go func() {
+		defer close(done)
+		for r := range results {
+			switch r.Name {
+			case provider.FailedName:
+				ok = false
+				scrapes <- r
+			case provider.SkippedName:
+				scrapes <- r
+			default:
+				rates = append(rates, r)
 			}
 		}
-		e.pricingMetrics[name].With(labels).Set(float64(scr.Value))
+	}()
+	aws.GetEffectivePricing(ctx, e.awsScrapeRegions(), ceClient, e.effectiveWindow, e.instanceFilter, e.instances, &e.errorCount, results)
+	close(results)
+	<-done
+	return rates, ok
+}
+
+// reportUnconverted logs, once per refresh, the currencies prices couldn't be
+// converted to because their exchange rate isn't loaded.
+func (e *Exporter) reportUnconverted() {
+	for _, code := range slices.Sorted(maps.Keys(e.unconverted)) {
+		log.Warnf("no %s exchange rate loaded, dropped %d %s prices", code, e.unconverted[code], code)
+	}
+	clear(e.unconverted)
+}
+
+// refreshRates reloads exchange rates once they're older than currencyRefresh.
+// Failed reloads keep the previous rates.
+func (e *Exporter) refreshRates(ctx context.Context) {
+	if len(e.currencies) == 0 || time.Since(e.rates.Updated()) < currencyRefresh {
+		return
+	}
+	if err := e.rates.Load(ctx, e.httpClient); err != nil {
+		log.WithError(err).Error("failed to load exchange rates, keeping previous rates")
+		atomic.AddUint64(&e.errorCount, 1)
+	}
+}
+
+// addResourceSample records the price of a Linux on-demand ec2 result, once
+// per region and instance type, for the CPU-to-memory regression.
+func (e *Exporter) addResourceSample(fit *aws.ResourceRateFit, seen map[string]bool, scr provider.ScrapeResult) {
+	if scr.Name != "ec2" || scr.InstanceLifecycle != "ondemand" || scr.OperatingSystem != "Linux" {
+		return
+	}
+	key := scr.Region + "/" + scr.InstanceType
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+	inst, ok := e.instances.Get(scr.InstanceType)
+	if !ok || inst.VCpu == 0 || inst.Memory == 0 {
+		return
+	}
+	fit.Add(float64(inst.VCpu), float64(inst.Memory)/1024, scr.Value)
+}
+
+// applyResourceFit sets the instance store's CPU-to-memory ratio from the
+// fitted rates. A failed fit keeps the previous ratio.
+func (e *Exporter) applyResourceFit(fit *aws.ResourceRateFit) {
+	vcpuRate, memoryRate, ok := fit.Rates()
+	if !ok {
+		if fit.Len() > 0 {
+			log.Warnf("could not fit CPU/memory rates to %d on-demand prices, keeping previous ratio", fit.Len())
+		}
+		return
 	}
+	log.Infof("fitted %d on-demand prices: %.6f/vCPU-hour, %.6f/GiB-hour, CPU-to-memory ratio %.3f", fit.Len(), vcpuRate, memoryRate, vcpuRate/memoryRate)
+	e.instances.SetCPUMemRatio(vcpuRate / memoryRate)
 }
@@ -3,24 +3,39 @@ package exporter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	ceTypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
 	savingsplansTypes "github.com/aws/aws-sdk-go-v2/service/savingsplans/types"
+	"github.com/aws/smithy-go"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/currency"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/fake"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
 )
 
@@ -134,6 +149,87 @@ func TestNewExporter_DegracefullyOnInstancesError(t *testing.T) {
 	if exp == nil {
 		t.Fatal("expected non-nil exporter")
 	}
+	if exp.instances.Len() == 0 {
+		t.Error("expected instance store to fall back to the bundled snapshot")
+	}
+}
+
+func TestRefreshInstances(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The initial load fails, refreshes succeed.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(instancesJSON))
+	}))
+	t.Cleanup(ts.Close)
+	orig := aws.EC2InstancesInfoURL
+	aws.EC2InstancesInfoURL = ts.URL
+	t.Cleanup(func() { aws.EC2InstancesInfoURL = orig })
+
+	exp, err := NewExporter([]string{"Linux/UNIX"}, []string{"Linux"}, []string{"us-east-1"}, []string{"spot"}, 0, []*regexp.Regexp{regexp.MustCompile(".*")}, []string{}, &mockClientFactory{}, nil)
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	// The failed load falls back to the bundled snapshot.
+	if _, ok := exp.instances.Get("m5.xlarge"); !ok {
+		t.Fatal("expected bundled snapshot after failed load")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go exp.refreshInstances(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for exp.instances.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if exp.instances.Len() != 1 {
+		t.Fatalf("expected refresh to load 1 instance, got %d", exp.instances.Len())
+	}
+
+	var failures, loaded dto.Metric
+	if err := exp.instanceDataFailures.Write(&failures); err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.instanceDataLoaded.Write(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if failures.GetCounter().GetValue() != 1 {
+		t.Errorf("expected 1 refresh failure, got %v", failures.GetCounter().GetValue())
+	}
+	if loaded.GetGauge().GetValue() == 0 {
+		t.Error("expected last refresh timestamp to be set")
+	}
+}
+
+func TestNewExporter_InstanceDataSourceAPI(t *testing.T) {
+	setupFailingInstancesServer(t)
+	factory := newMockFactoryWithInstances()
+	factory.ec2Client.(*mockEC2Client).DescribeInstanceTypesFn = func(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+		return &ec2.DescribeInstanceTypesOutput{
+			InstanceTypes: []ec2types.InstanceTypeInfo{{
+				InstanceType:  ec2types.InstanceTypeM7gLarge,
+				VCpuInfo:      &ec2types.VCpuInfo{DefaultVCpus: awssdk.Int32(2)},
+				MemoryInfo:    &ec2types.MemoryInfo{SizeInMiB: awssdk.Int64(8192)},
+				ProcessorInfo: &ec2types.ProcessorInfo{SupportedArchitectures: []ec2types.ArchitectureType{ec2types.ArchitectureTypeArm64}},
+			}},
+		}, nil
+	}
+
+	exp, err := NewExporter([]string{"Linux/UNIX"}, []string{"Linux"}, []string{"us-east-1"}, []string{"spot"}, 0, []*regexp.Regexp{regexp.MustCompile(".*")}, []string{}, factory, nil, WithInstanceDataSource(aws.InstanceDataSourceAPI))
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	if exp.instances.Len() != 1 {
+		t.Fatalf("expected 1 instance type from DescribeInstanceTypes, got %d", exp.instances.Len())
+	}
+	inst, _ := exp.instances.Get("m7g.large")
+	if inst.VCpu != 2 || inst.Memory != 8192 || len(inst.Architectures) != 1 || inst.Architectures[0] != "arm64" {
+		t.Errorf("unexpected m7g.large specs: %+v", inst)
+	}
 }
 
 func TestCollect_ClientFactoryError(t *testing.T) {
@@ -168,9 +264,9 @@ func TestDescribe(t *testing.T) {
 		descs = append(descs, d)
 	}
 
-	// 3 pricing gauges (ec2, ec2_memory, ec2_vcpu) + duration + totalScrapes + scrapeErrors = 6
-	if len(descs) != 6 {
-		t.Errorf("expected 6 descriptors, got %d", len(descs))
+	// 3 pricing gauges (ec2, ec2_memory, ec2_vcpu) + duration + totalScrapes + scrapeErrors + 3 worker pool gauges + 3 resource usage gauges + stale + skippedItems + apiErrors = 15
+	if len(descs) != 15 {
+		t.Errorf("expected 15 descriptors, got %d", len(descs))
 	}
 }
 
@@ -207,6 +303,26 @@ func TestCollect_CacheHit(t *testing.T) {
 	}
 }
 
+func TestCacheTTL_Jitter(t *testing.T) {
+	e := &Exporter{cache: 100}
+	if ttl := e.cacheTTL(); ttl != 100*time.Second {
+		t.Errorf("expected 100s without jitter, got %s", ttl)
+	}
+
+	e.cacheJitter = 0.2
+	seen := make(map[time.Duration]bool)
+	for range 100 {
+		ttl := e.cacheTTL()
+		if ttl < 80*time.Second || ttl > 120*time.Second {
+			t.Fatalf("expected TTL within 100s ±20%%, got %s", ttl)
+		}
+		seen[ttl] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expected jittered TTLs to vary")
+	}
+}
+
 func TestCollect_CacheExpired(t *testing.T) {
 	factory := newMockFactoryWithInstances()
 	scrapeCount := 0
@@ -252,6 +368,273 @@ func TestCollect_CacheExpired(t *testing.T) {
 	}
 }
 
+func TestSetPricingMetrics_CPUMemRegression(t *testing.T) {
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.cpuMemRegression = true
+		e.instances = aws.NewInstanceStoreFromMap(map[string]aws.Instance{
+			"c5.large": {VCpu: 2, Memory: 4096},
+			"m5.large": {VCpu: 2, Memory: 8192},
+			"r5.large": {VCpu: 2, Memory: 16384},
+		})
+	})
+
+	// Prices built from 0.03/vCPU-hour and 0.004/GiB-hour: fitted ratio 7.5.
+	scrapes := make(chan provider.ScrapeResult, 10)
+	for _, inst := range []struct {
+		instanceType string
+		memoryGiB    float64
+	}{{"c5.large", 4}, {"m5.large", 8}, {"r5.large", 16}} {
+		scrapes <- provider.ScrapeResult{
+			Name:              "ec2",
+			Value:             0.03*2 + 0.004*inst.memoryGiB,
+			Region:            "us-east-1",
+			InstanceType:      inst.instanceType,
+			InstanceLifecycle: "ondemand",
+			OperatingSystem:   "Linux",
+		}
+	}
+	// Windows prices include a license and are left out of the fit.
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 1, Region: "us-east-1", InstanceType: "c5.large", InstanceLifecycle: "ondemand", OperatingSystem: "Windows"}
+	close(scrapes)
+
+	e.setPricingMetrics(scrapes)
+
+	vcpu, memory := e.instances.GetNormalizedCost(0.092, "m5.large")
+	if math.Abs(vcpu/memory-7.5) > 1e-6 {
+		t.Errorf("expected fitted ratio 7.5, got %v", vcpu/memory)
+	}
+}
+
+func TestSetPricingMetrics_Currencies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<Envelope><Cube><Cube time="2026-10-15"><Cube currency="USD" rate="1.25"/></Cube></Cube></Envelope>`))
+	}))
+	defer ts.Close()
+	orig := currency.ECBRatesURL
+	currency.ECBRatesURL = ts.URL
+	t.Cleanup(func() { currency.ECBRatesURL = orig })
+
+	e := newTestExporter(nil, WithCurrencies([]string{"USD", "EUR", "GBP"}, currency.NewRates()))
+	e.refreshRates(context.Background())
+
+	scrapes := make(chan provider.ScrapeResult, 1)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.1, Region: "us-east-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.pricingMetrics["ec2"])
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	ec2Family := findMetricFamily(families, "aws_pricing_ec2")
+	if ec2Family == nil {
+		t.Fatal("expected aws_pricing_ec2 metric family")
+	}
+	values := map[string]float64{}
+	for _, m := range ec2Family.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "currency" {
+				values[l.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	// GBP has no rate and is skipped, and counted until reported.
+	if len(values) != 2 || math.Abs(values["USD"]-0.1) > 1e-12 || math.Abs(values["EUR"]-0.08) > 1e-12 {
+		t.Errorf("unexpected currency series: %v", values)
+	}
+	if e.unconverted["GBP"] != 1 || len(e.unconverted) != 1 {
+		t.Errorf("expected one unconverted GBP price, got %v", e.unconverted)
+	}
+	e.reportUnconverted()
+	if len(e.unconverted) != 0 {
+		t.Errorf("expected the count to be reset once reported, got %v", e.unconverted)
+	}
+}
+
+func TestSetPricingMetrics_InternsLabelValues(t *testing.T) {
+	e := newTestExporter(nil, WithCurrencies([]string{"USD"}, currency.NewRates()))
+
+	scrapes := make(chan provider.ScrapeResult, 2)
+	for _, lifecycle := range []string{"spot", "ondemand"} {
+		scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.1, Region: strings.Clone("us-east-1"), InstanceType: strings.Clone("m5.large"), InstanceLifecycle: lifecycle}
+	}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	var labels []prometheus.Labels
+	for _, p := range e.scrapedPrices[regionKey{"aws", "us-east-1"}] {
+		if _, ok := p.labels["currency"]; ok {
+			t.Errorf("recorded labels include currency: %v", p.labels)
+		}
+		labels = append(labels, p.labels)
+	}
+	if len(labels) != 2 {
+		t.Fatalf("expected 2 recorded prices, got %d", len(labels))
+	}
+	if unsafe.StringData(labels[0]["instance_type"]) != unsafe.StringData(labels[1]["instance_type"]) {
+		t.Error("expected the instance_type values to share their storage")
+	}
+}
+
+func TestSetPricingMetrics_PricePrecision(t *testing.T) {
+	e := newTestExporter(nil, WithPricePrecision(4))
+
+	scrapes := make(chan provider.ScrapeResult, 1)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.0123456789, Region: "us-east-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.pricingMetrics["ec2"])
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	ec2Family := findMetricFamily(families, "aws_pricing_ec2")
+	if ec2Family == nil || len(ec2Family.GetMetric()) != 1 {
+		t.Fatal("expected one aws_pricing_ec2 series")
+	}
+	if got := ec2Family.GetMetric()[0].GetGauge().GetValue(); got != 0.0123 {
+		t.Errorf("expected 0.0123, got %v", got)
+	}
+}
+
+func TestSetPricingMetrics_RegionNameLabel(t *testing.T) {
+	e := newTestExporter(nil, WithRegionNameLabel(true))
+
+	scrapes := make(chan provider.ScrapeResult, 2)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.1, Region: "eu-central-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.1, Region: "xx-future-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.pricingMetrics["ec2"])
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	ec2Family := findMetricFamily(families, "aws_pricing_ec2")
+	if ec2Family == nil {
+		t.Fatal("expected aws_pricing_ec2 metric family")
+	}
+	names := map[string]string{}
+	for _, m := range ec2Family.GetMetric() {
+		var region, name string
+		for _, l := range m.GetLabel() {
+			switch l.GetName() {
+			case "region":
+				region = l.GetValue()
+			case "region_name":
+				name = l.GetValue()
+			}
+		}
+		names[region] = name
+	}
+	if want := map[string]string{"eu-central-1": "EU (Frankfurt)", "xx-future-1": ""}; !maps.Equal(names, want) {
+		t.Errorf("region_name by region = %v, want %v", names, want)
+	}
+}
+
+func TestSetPricingMetrics_OpenCost(t *testing.T) {
+	e := newTestExporter(nil, WithMetricsFormat(MetricsFormatOpenCost), func(e *Exporter) {
+		e.azureEnabled = true
+	})
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	for _, scr := range []provider.ScrapeResult{
+		{Name: "ec2", Value: 0.096, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "ondemand", OperatingSystem: "Linux", Memory: "8192", VCpu: "2"},
+		{Name: "ec2", Value: 0.184, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "ondemand", OperatingSystem: "Windows", Memory: "8192", VCpu: "2"},
+		{Name: "ec2", Value: 0.04, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX", Memory: "8192", VCpu: "2"},
+		{Name: "ec2", Value: 0.03, Region: "us-east-1", AvailabilityZone: "us-east-1b", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX", Memory: "8192", VCpu: "2"},
+		{Name: "ec2_vcpu", Value: 0.01, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot"},
+		{Name: "azure_vm", Value: 0.096, Region: "eastus", InstanceType: "Standard_D2s_v5", InstanceLifecycle: "ondemand", OperatingSystem: "Linux", PriceType: azure.PriceTypeConsumption},
+	} {
+		scrapes <- scr
+	}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	for _, m := range e.pricingMetrics {
+		reg.MustRegister(m)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if f := findMetricFamily(families, "aws_pricing_ec2"); f != nil {
+		t.Error("expected no native metrics in opencost format")
+	}
+
+	values := func(name string) map[string]float64 {
+		got := map[string]float64{}
+		family := findMetricFamily(families, name)
+		for _, m := range family.GetMetric() {
+			var key string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "instance_type" || l.GetName() == "instance_lifecycle" {
+					key += l.GetValue() + "/"
+				}
+			}
+			got[key] = m.GetGauge().GetValue()
+		}
+		return got
+	}
+	total := values("node_total_hourly_cost")
+	want := map[string]float64{"ondemand/m5.large/": 0.096, "spot/m5.large/": 0.03, "ondemand/Standard_D2s_v5/": 0.096}
+	if fmt.Sprint(total) != fmt.Sprint(want) {
+		t.Errorf("node_total_hourly_cost = %v, want %v", total, want)
+	}
+	// 2 vCPU and 8 GiB at the default ratio of 7.2: 0.096 / (2*7.2 + 8) per GiB.
+	ram := values("node_ram_hourly_cost")
+	cpu := values("node_cpu_hourly_cost")
+	if len(ram) != 2 || math.Abs(ram["ondemand/m5.large/"]-0.096/22.4) > 1e-12 || math.Abs(cpu["ondemand/m5.large/"]-7.2*0.096/22.4) > 1e-12 {
+		t.Errorf("unexpected split without Azure resources: cpu=%v ram=%v", cpu, ram)
+	}
+}
+
+func TestSetPricingMetrics_OpenCostNodes(t *testing.T) {
+	nodes := []kube.Node{
+		{Name: "node-a", Provider: "aws", InstanceType: "m5.large", Region: "us-east-1"},
+		{Name: "node-b", Provider: "aws", InstanceType: "m5.large", Region: "us-east-1", Labels: map[string]string{kube.LabelKarpenterCapacityType: "spot"}},
+		{Name: "node-c", Provider: "aws", InstanceType: "c5.xlarge", Region: "us-east-1"},
+	}
+	e := newTestExporter(nil, WithMetricsFormat(MetricsFormatOpenCost), WithNodeLister(&mockNodeLister{
+		ListNodesFn: func(ctx context.Context) ([]kube.Node, error) { return nodes, nil },
+	}), func(e *Exporter) {
+		e.instanceFilter.Regexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+	})
+	e.applyClusterNodes(context.Background())
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.096, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "ondemand", OperatingSystem: "Linux"}
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.03, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.pricingMetrics["opencost_node_total"])
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	got := map[string]float64{}
+	for _, m := range findMetricFamily(families, "node_total_hourly_cost").GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "node" {
+				got[l.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	// node-c has no price, so it has no series.
+	if want := map[string]float64{"node-a": 0.096, "node-b": 0.03}; !maps.Equal(got, want) {
+		t.Errorf("node_total_hourly_cost by node = %v, want %v", got, want)
+	}
+}
+
 func TestSetPricingMetrics(t *testing.T) {
 	e := newTestExporter(nil)
 
@@ -378,15 +761,15 @@ func TestDescribe_WithAzure(t *testing.T) {
 		descs = append(descs, d)
 	}
 
-	// 3 AWS pricing gauges + 1 azure_vm + duration + totalScrapes + scrapeErrors = 7
-	if len(descs) != 7 {
-		t.Errorf("expected 7 descriptors with Azure, got %d", len(descs))
+	// 3 AWS pricing gauges + azure_vm + azure_vm_windows_license + duration + totalScrapes + scrapeErrors + 3 worker pool gauges + 3 resource usage gauges + stale + skippedItems + apiErrors = 17
+	if len(descs) != 17 {
+		t.Errorf("expected 17 descriptors with Azure, got %d", len(descs))
 	}
 }
 
 func TestCollect_AzureOnly(t *testing.T) {
 	azureClient := &mockAzureRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]azure.RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
 			return []azure.RetailPriceItem{
 				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
 			}, nil
@@ -418,84 +801,375 @@ func TestCollect_AzureOnly(t *testing.T) {
 	}
 }
 
-func TestCollect_AWSAndAzure(t *testing.T) {
-	awsFactory := newMockFactoryWithInstances()
-
+func TestCollect_StaleIfError(t *testing.T) {
+	var fail bool
 	azureClient := &mockAzureRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]azure.RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			if fail {
+				return nil, fmt.Errorf("service unavailable")
+			}
 			return []azure.RetailPriceItem{
 				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
 			}, nil
 		},
 	}
-
-	e := newTestExporter(awsFactory, func(e *Exporter) {
-		e.lifecycle = []string{"spot"}
-		e.instanceRegexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
 		e.azureEnabled = true
 		e.azureRegions = []string{"eastus"}
 		e.azureOperatingSystems = []string{"Linux"}
-		e.azureInstanceRegexes = []*regexp.Regexp{regexp.MustCompile(".*")}
 		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
 		e.nextScrape = time.Now().Add(-1 * time.Second)
 	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
 
-	ch := make(chan prometheus.Metric, 100)
-	e.Collect(ch)
-	close(ch)
+	gather := func() (price, stale float64) {
+		t.Helper()
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		vm := findMetricFamily(families, "azure_pricing_vm")
+		if vm == nil || len(vm.GetMetric()) != 1 {
+			t.Fatal("expected one azure_pricing_vm series")
+		}
+		staleFamily := findMetricFamily(families, "cloud_pricing_stale")
+		if staleFamily == nil || !hasLabelValue(staleFamily, "region", "eastus") {
+			t.Fatal("expected cloud_pricing_stale for eastus")
+		}
+		return vm.GetMetric()[0].GetGauge().GetValue(), staleFamily.GetMetric()[0].GetGauge().GetValue()
+	}
 
-	count := 0
-	for range ch {
-		count++
+	if price, stale := gather(); price != 0.096 || stale != 0 {
+		t.Errorf("first scrape: got price=%v stale=%v, want 0.096/0", price, stale)
 	}
-	// AWS spot: ec2 + ec2_memory + ec2_vcpu = 3 pricing metrics
-	// Azure: 1 azure_vm metric
-	// Internal: duration + totalScrapes + scrapeErrors = 3
-	// Total: at least 7
-	if count < 7 {
-		t.Errorf("expected at least 7 metrics (AWS + Azure + internal), got %d", count)
+	fail = true
+	if price, stale := gather(); price != 0.096 || stale != 1 {
+		t.Errorf("failed scrape: got price=%v stale=%v, want previous price 0.096/1", price, stale)
+	}
+	fail = false
+	if price, stale := gather(); price != 0.096 || stale != 0 {
+		t.Errorf("recovered scrape: got price=%v stale=%v, want 0.096/0", price, stale)
 	}
 }
 
-func TestCollect_ConcurrentSafety(t *testing.T) {
-	factory := newMockFactoryWithInstances()
-
-	e := newTestExporter(factory, func(e *Exporter) {
-		e.lifecycle = []string{"spot"}
-		e.cache = 0
-		e.nextScrape = time.Now().Add(-1 * time.Second)
+func TestCollect_CircuitBreaker(t *testing.T) {
+	var calls int
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			calls++
+			return nil, fmt.Errorf("timeout")
+		},
+	}
+	e := newTestExporter(nil, WithCircuitBreaker(2, time.Hour), func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
 	})
-
-	var wg sync.WaitGroup
-	for range 10 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			ch := make(chan prometheus.Metric, 100)
-			e.Collect(ch)
-			close(ch)
-			for range ch {
-			}
-		}()
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	gather := func() float64 {
+		t.Helper()
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		open := findMetricFamily(families, "cloud_pricing_circuit_breaker_open")
+		if open == nil || len(open.GetMetric()) != 1 {
+			t.Fatal("expected one cloud_pricing_circuit_breaker_open series")
+		}
+		return open.GetMetric()[0].GetGauge().GetValue()
 	}
-	wg.Wait()
-	// Success: no panic, no data race (verified by -race flag)
-}
-
-func TestSetPricingMetrics_UnknownName(t *testing.T) {
-	e := newTestExporter(nil)
 
-	scrapes := make(chan provider.ScrapeResult, 1)
-	scrapes <- provider.ScrapeResult{
-		Name:         "nonexistent",
-		Value:        1.0,
-		Region:       "us-east-1",
-		InstanceType: "m5.large",
+	if open := gather(); open != 0 || calls != 1 {
+		t.Fatalf("first failure: open=%v calls=%d, want 0/1", open, calls)
+	}
+	if open := gather(); open != 1 || calls != 2 {
+		t.Fatalf("second failure: open=%v calls=%d, want 1/2", open, calls)
+	}
+	if open := gather(); open != 1 || calls != 2 {
+		t.Fatalf("open breaker: open=%v calls=%d, want region skipped", open, calls)
 	}
-	close(scrapes)
 
-	// Should not panic — unknown names are silently dropped with a log warning
-	e.setPricingMetrics(scrapes)
+	// After the cooldown the region is retried once and reopens for twice as long.
+	key := regionKey{"azure", "eastus"}
+	e.breakers[key].openUntil = time.Now().Add(-time.Second)
+	if open := gather(); open != 1 || calls != 3 {
+		t.Fatalf("retry after cooldown: open=%v calls=%d, want 1/3", open, calls)
+	}
+	if remaining := time.Until(e.breakers[key].openUntil); remaining < 119*time.Minute {
+		t.Errorf("expected doubled cooldown of 2h, got %s", remaining)
+	}
+}
+
+func TestCollect_SkipUnauthorizedRegions(t *testing.T) {
+	var azCalls, spotCalls int
+	factory := &mockClientFactory{
+		ec2Client: &mockEC2Client{
+			DescribeAvailabilityZonesFn: func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+				azCalls++
+				return nil, &smithy.GenericAPIError{Code: "OptInRequired"}
+			},
+			DescribeSpotPriceHistoryFn: func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+				spotCalls++
+				return &ec2.DescribeSpotPriceHistoryOutput{}, nil
+			},
+		},
+	}
+	e := newTestExporter(factory, WithSkipUnauthorizedRegions(true), func(e *Exporter) {
+		e.regions = []string{"ap-east-1"}
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	for range 2 {
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		skipped := findMetricFamily(families, "cloud_pricing_region_skipped")
+		if skipped == nil || !hasLabelValue(skipped, "reason", "OptInRequired") {
+			t.Fatal("expected cloud_pricing_region_skipped with reason=OptInRequired")
+		}
+		errFamily := findMetricFamily(families, "aws_pricing_scrape_error")
+		if v := errFamily.GetMetric()[0].GetGauge().GetValue(); v != 0 {
+			t.Errorf("expected skipped region not to count as error, got %v", v)
+		}
+	}
+	if azCalls != 1 || spotCalls != 0 {
+		t.Errorf("expected a single access check and no spot calls, got %d/%d", azCalls, spotCalls)
+	}
+}
+
+func TestCollect_ClusterNodes(t *testing.T) {
+	var mu sync.Mutex
+	var spotInputs []*ec2.DescribeSpotPriceHistoryInput
+	factory := newMockFactoryWithInstances()
+	ec2Client := factory.ec2Client.(*mockEC2Client)
+	spotFn := ec2Client.DescribeSpotPriceHistoryFn
+	ec2Client.DescribeSpotPriceHistoryFn = func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+		mu.Lock()
+		spotInputs = append(spotInputs, params)
+		mu.Unlock()
+		return spotFn(ctx, params, optFns...)
+	}
+	var azureQueries []azure.VMPriceQuery
+	var azureRegions []string
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			azureQueries = append(azureQueries, query)
+			azureRegions = append(azureRegions, region)
+			return nil, nil
+		},
+	}
+	nodes := &mockNodeLister{
+		ListNodesFn: func(ctx context.Context) ([]kube.Node, error) {
+			return []kube.Node{
+				{Name: "a", Provider: "aws", InstanceType: "m5.large", Region: "us-east-1", Zone: "us-east-1a"},
+				{Name: "b", Provider: "aws", InstanceType: "c5.xlarge", Region: "us-east-1", Zone: "us-east-1b"},
+				{Name: "c", Provider: "azure", InstanceType: "Standard_D2s_v5", Region: "westeurope"},
+				{Name: "d", Provider: "kind"},
+			}, nil
+		},
+	}
+	e := newTestExporter(factory, WithNodeLister(nodes), func(e *Exporter) {
+		e.regions = []string{"us-east-1", "eu-west-1"}
+		e.instanceFilter.Regexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus", "westeurope"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+	})
+
+	ch := make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+
+	if len(spotInputs) != 1 {
+		t.Fatalf("expected only us-east-1 to be scraped, got %d spot requests", len(spotInputs))
+	}
+	var types, zones []string
+	for _, f := range spotInputs[0].Filters {
+		switch awssdk.ToString(f.Name) {
+		case "instance-type":
+			types = f.Values
+		case "availability-zone":
+			zones = f.Values
+		}
+	}
+	if fmt.Sprint(types) != "[m5.large c5.xlarge]" || fmt.Sprint(zones) != "[us-east-1a us-east-1b]" {
+		t.Errorf("expected spot request restricted to the node types and zones, got types=%v zones=%v", types, zones)
+	}
+	if fmt.Sprint(azureRegions) != "[westeurope]" || fmt.Sprint(azureQueries[0].InstanceTypes) != "[Standard_D2s_v5]" {
+		t.Errorf("expected Azure restricted to westeurope/Standard_D2s_v5, got %v %v", azureRegions, azureQueries)
+	}
+
+	// A failed listing keeps the previous restriction and counts as an error.
+	nodes.ListNodesFn = func(ctx context.Context) ([]kube.Node, error) { return nil, errors.New("forbidden") }
+	e.nextScrape = time.Now().Add(-1 * time.Second)
+	ch = make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+	if len(spotInputs) != 2 || len(azureRegions) != 2 {
+		t.Errorf("expected the previous restriction to be kept, got %d spot and %d Azure requests", len(spotInputs), len(azureRegions))
+	}
+	if atomic.LoadUint64(&e.errorCount) == 0 {
+		t.Error("expected the failed node listing to count as a scrape error")
+	}
+}
+
+func TestApplyClusterNodes_BaseFilter(t *testing.T) {
+	nodes := []kube.Node{
+		{Name: "a", Provider: "aws", InstanceType: "m5.large", Region: "us-east-1", Zone: "us-east-1a"},
+		{Name: "b", Provider: "aws", InstanceType: "c5.xlarge", Region: "us-east-1", Zone: "us-east-1b"},
+		{Name: "c", Provider: "azure", InstanceType: "Standard_D2s_v5", Region: "westeurope"},
+	}
+	e := newTestExporter(nil, WithNodeLister(&mockNodeLister{
+		ListNodesFn: func(ctx context.Context) ([]kube.Node, error) { return nodes, nil },
+	}), func(e *Exporter) {
+		e.instanceFilter.Regexes = []*regexp.Regexp{regexp.MustCompile("^m5")}
+		e.instanceFilter.AvailabilityZones = []string{"us-east-1a", "us-east-1c"}
+	})
+
+	e.applyClusterNodes(context.Background())
+	if fmt.Sprint(e.instanceFilter.InstanceTypes) != "[m5.large]" || fmt.Sprint(e.instanceFilter.AvailabilityZones) != "[us-east-1a]" {
+		t.Errorf("expected the node types and zones intersected with the filter, got types=%v zones=%v", e.instanceFilter.InstanceTypes, e.instanceFilter.AvailabilityZones)
+	}
+	if !e.inCluster(regionKey{"aws", "us-east-1"}) {
+		t.Error("expected us-east-1 to be scraped")
+	}
+
+	nodes[0].Zone = "us-east-1b"
+	e.applyClusterNodes(context.Background())
+	if e.inCluster(regionKey{"aws", "us-east-1"}) || !e.inCluster(regionKey{"azure", "westeurope"}) {
+		t.Errorf("expected AWS to be skipped when no node zone passes the filter, got regions %v", e.clusterRegions)
+	}
+}
+
+func TestCollect_CancelledContext(t *testing.T) {
+	var ctxErr error
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			ctxErr = ctx.Err()
+			return nil, ctxErr
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e := newTestExporter(nil, WithContext(ctx), func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+	})
+
+	ch := make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+
+	if !errors.Is(ctxErr, context.Canceled) {
+		t.Errorf("expected providers to get the cancelled root context, got %v", ctxErr)
+	}
+}
+
+func TestCollect_AWSAndAzure(t *testing.T) {
+	awsFactory := newMockFactoryWithInstances()
+
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			return []azure.RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+			}, nil
+		},
+	}
+
+	e := newTestExporter(awsFactory, func(e *Exporter) {
+		e.lifecycle = []string{"spot"}
+		e.instanceFilter.Regexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureInstanceRegexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+	})
+
+	ch := make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+
+	count := 0
+	for range ch {
+		count++
+	}
+	// AWS spot: ec2 + ec2_memory + ec2_vcpu = 3 pricing metrics
+	// Azure: 1 azure_vm metric
+	// Internal: duration + totalScrapes + scrapeErrors = 3
+	// Total: at least 7
+	if count < 7 {
+		t.Errorf("expected at least 7 metrics (AWS + Azure + internal), got %d", count)
+	}
+}
+
+func TestCollect_ConcurrentSafety(t *testing.T) {
+	factory := newMockFactoryWithInstances()
+
+	e := newTestExporter(factory, func(e *Exporter) {
+		e.lifecycle = []string{"spot"}
+		e.cache = 0
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch := make(chan prometheus.Metric, 100)
+			e.Collect(ch)
+			close(ch)
+			for range ch {
+			}
+		}()
+	}
+	wg.Wait()
+	// Success: no panic, no data race (verified by -race flag)
+}
+
+func TestSetPricingMetrics_UnknownName(t *testing.T) {
+	e := newTestExporter(nil)
+
+	scrapes := make(chan provider.ScrapeResult, 1)
+	scrapes <- provider.ScrapeResult{
+		Name:         "nonexistent",
+		Value:        1.0,
+		Region:       "us-east-1",
+		InstanceType: "m5.large",
+	}
+	close(scrapes)
+
+	// Should not panic — unknown names are silently dropped with a log warning
+	e.setPricingMetrics(scrapes)
 }
 
 // findMetricFamily returns the named MetricFamily from gathered output, or nil.
@@ -562,6 +1236,53 @@ func TestEndToEnd_SpotPricing(t *testing.T) {
 	}
 }
 
+func TestEndToEnd_SpotPricingMultipleAccounts(t *testing.T) {
+	setupInstancesServer(t)
+	factory := newMockFactoryWithInstances()
+
+	exp, err := NewExporter(
+		[]string{"Linux/UNIX"},
+		[]string{"Linux"},
+		[]string{"us-east-1"},
+		[]string{"spot"},
+		0,
+		[]*regexp.Regexp{regexp.MustCompile(".*")},
+		[]string{},
+		factory,
+		nil,
+		WithAccounts([]aws.Account{
+			{ID: "111111111111", ClientFactory: newMockFactoryWithInstances()},
+			{ID: "222222222222", ClientFactory: newMockFactoryWithInstances()},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(exp); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	ec2Family := findMetricFamily(families, "aws_pricing_ec2")
+	if ec2Family == nil {
+		t.Fatal("expected aws_pricing_ec2 metric family")
+	}
+	// One spot series per account; the default credentials aren't scraped for spot.
+	if len(ec2Family.GetMetric()) != 2 {
+		t.Errorf("expected 2 aws_pricing_ec2 series, got %d", len(ec2Family.GetMetric()))
+	}
+	for _, id := range []string{"111111111111", "222222222222"} {
+		if !hasLabelValue(ec2Family, "account_id", id) {
+			t.Errorf("expected account_id=%s label on aws_pricing_ec2", id)
+		}
+	}
+}
+
 // makeBulkPricingJSON builds a valid bulk pricing JSON string for testing.
 func makeBulkPricingJSON(sku, instanceType, os, priceUSD string) string {
 	resp := aws.BulkPricingResponse{
@@ -607,9 +1328,10 @@ func setupBulkPricingServer(t *testing.T, body string) {
 		w.Write([]byte(body))
 	}))
 	t.Cleanup(ts.Close)
-	orig := aws.BulkPricingURLFormat
+	orig, origIndex := aws.BulkPricingURLFormat, aws.RegionIndexURL
 	aws.BulkPricingURLFormat = ts.URL + "/%s"
-	t.Cleanup(func() { aws.BulkPricingURLFormat = orig })
+	aws.RegionIndexURL = ""
+	t.Cleanup(func() { aws.BulkPricingURLFormat, aws.RegionIndexURL = orig, origIndex })
 }
 
 func makeSavingsPlanRate(instanceType, rate string, durationSeconds int64) savingsplansTypes.SavingsPlanOfferingRate {
@@ -742,7 +1464,7 @@ func TestEndToEnd_SavingsPlanPricing(t *testing.T) {
 
 func TestEndToEnd_AzurePricing(t *testing.T) {
 	azureClient := &mockAzureRetailPricesClient{
-		GetVMPricesFn: func(ctx context.Context, region string, osTypes []string) ([]azure.RetailPriceItem, error) {
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
 			return []azure.RetailPriceItem{
 				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
 			}, nil
@@ -791,3 +1513,1042 @@ func TestEndToEnd_AzurePricing(t *testing.T) {
 		t.Error("expected instance_type=Standard_D2s_v5 on azure_pricing_vm")
 	}
 }
+
+func TestEndToEnd_AzureDetailLabels(t *testing.T) {
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			return []azure.RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+			}, nil
+		},
+	}
+
+	for _, detail := range []bool{false, true} {
+		exp, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, &AzureConfig{
+			Regions:          []string{"eastus"},
+			OperatingSystems: []string{"Linux"},
+			ClientFactory:    &mockAzureClientFactory{client: azureClient},
+			DetailLabels:     detail,
+		})
+		if err != nil {
+			t.Fatalf("NewExporter: %v", err)
+		}
+		reg := prometheus.NewRegistry()
+		if err := reg.Register(exp); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+
+		azureFamily := findMetricFamily(families, "azure_pricing_vm")
+		if azureFamily == nil {
+			t.Fatal("expected azure_pricing_vm metric family")
+		}
+		if got := hasLabelValue(azureFamily, "meter_name", "D2s v5"); got != detail {
+			t.Errorf("detail=%v: meter_name label present=%v", detail, got)
+		}
+		if got := hasLabelValue(azureFamily, "product_name", "Virtual Machines Dv5 Series"); got != detail {
+			t.Errorf("detail=%v: product_name label present=%v", detail, got)
+		}
+	}
+}
+
+func TestBuildPriceIndex(t *testing.T) {
+	e := newTestExporter(nil)
+	if e.Prices() != nil {
+		t.Fatal("expected no price index before the first scrape")
+	}
+	point := func(name string, usd float64, labels prometheus.Labels) pricePoint {
+		return pricePoint{name: name, labels: labels, usd: usd}
+	}
+	e.lastPrices = map[regionKey]map[string]pricePoint{
+		{"aws", "us-east-1"}: {
+			"a": point("ec2", 0.096, prometheus.Labels{"instance_lifecycle": "ondemand", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": "us-east-1a", "operating_system": "Linux"}),
+			"b": point("ec2", 0.184, prometheus.Labels{"instance_lifecycle": "ondemand", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": "us-east-1a", "operating_system": "Windows"}),
+			"c": point("ec2", 0.04, prometheus.Labels{"instance_lifecycle": "spot", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": "us-east-1a", "product_description": "Linux/UNIX"}),
+			"d": point("ec2", 0.03, prometheus.Labels{"instance_lifecycle": "spot", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": "us-east-1b", "product_description": "Linux/UNIX"}),
+			"e": point("ec2", 0.06, prometheus.Labels{"instance_lifecycle": "ondemand", "instance_type": "m5.large", "region": "us-east-1", "operating_system": "Linux", "saving_plan_type": "Compute"}),
+			"f": point("ec2_vcpu", 0.01, prometheus.Labels{"instance_lifecycle": "spot", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": "us-east-1a"}),
+		},
+		{"azure", "eastus"}: {
+			"g": point("azure_vm", 0.096, prometheus.Labels{"instance_lifecycle": "ondemand", "instance_type": "Standard_D2s_v5", "region": "eastus", "operating_system": "Linux", "price_type": azure.PriceTypeConsumption}),
+		},
+	}
+	e.buildPriceIndex()
+
+	tests := []struct {
+		q    PriceQuery
+		want float64
+		ok   bool
+	}{
+		{PriceQuery{"aws", "us-east-1", "us-east-1a", "m5.large", "ondemand"}, 0.096, true},
+		{PriceQuery{"aws", "us-east-1", "", "m5.large", "ondemand"}, 0.096, true},
+		{PriceQuery{"aws", "us-east-1", "us-east-1a", "m5.large", "spot"}, 0.04, true},
+		{PriceQuery{"aws", "us-east-1", "", "m5.large", "spot"}, 0.03, true},
+		{PriceQuery{"aws", "us-east-1", "us-east-1c", "m5.large", "spot"}, 0, false},
+		{PriceQuery{"azure", "eastus", "", "Standard_D2s_v5", "ondemand"}, 0.096, true},
+	}
+	index := e.Prices()
+	for _, tt := range tests {
+		got, ok := index.Lookup(tt.q)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%+v) = %v, %v, want %v, %v", tt.q, got, ok, tt.want, tt.ok)
+		}
+	}
+	if index.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", index.Len())
+	}
+}
+
+func TestSetPricingMetrics_NodeCost(t *testing.T) {
+	e := newTestExporter(nil, WithNodeCost(true))
+
+	scrapes := make(chan provider.ScrapeResult, 10)
+	for _, scr := range []provider.ScrapeResult{
+		{Name: "ec2", Value: 0.096, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "ondemand", OperatingSystem: "Linux"},
+		{Name: "ec2", Value: 0.04, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"},
+		{Name: "ec2", Value: 0.03, Region: "us-east-1", AvailabilityZone: "us-east-1b", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"},
+	} {
+		scrapes <- scr
+	}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	for _, m := range e.pricingMetrics {
+		reg.MustRegister(m)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if findMetricFamily(families, "aws_pricing_ec2") == nil {
+		t.Error("expected native metrics alongside the node cost")
+	}
+	family := findMetricFamily(families, "cloud_pricing_node_hourly_cost")
+	if family == nil {
+		t.Fatal("cloud_pricing_node_hourly_cost not found")
+	}
+	got := map[string]float64{}
+	for _, m := range family.GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["label_node_kubernetes_io_instance_type"] != labels["instance_type"] || labels["label_topology_kubernetes_io_region"] != labels["region"] {
+			t.Errorf("join labels don't repeat instance_type and region: %v", labels)
+		}
+		got[labels["lifecycle"]+"/"+labels["label_karpenter_sh_capacity_type"]] = m.GetGauge().GetValue()
+	}
+	want := map[string]float64{"ondemand/on-demand": 0.096, "spot/spot": 0.03}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("cloud_pricing_node_hourly_cost = %v, want %v", got, want)
+	}
+}
+
+func TestPriceChanges(t *testing.T) {
+	e := newTestExporter(nil, WithPriceChangeNotifier(nil, 20))
+	spot := func(zone string, usd float64) pricePoint {
+		return pricePoint{name: "ec2", usd: usd, labels: prometheus.Labels{"instance_lifecycle": "spot", "instance_type": "m5.large", "region": "us-east-1", "availability_zone": zone, "saving_plan_type": ""}}
+	}
+	vcpu := pricePoint{name: "ec2_vcpu", usd: 0.01, labels: prometheus.Labels{"instance_type": "m5.large"}}
+	key := regionKey{"aws", "us-east-1"}
+	e.lastPrices = map[regionKey]map[string]pricePoint{key: {
+		"a": spot("us-east-1a", 0.03),
+		"b": spot("us-east-1b", 0.03),
+		"c": spot("us-east-1c", 0.03),
+		"v": vcpu,
+	}}
+	vcpu.usd = 0.02
+	e.scrapedPrices = map[regionKey]map[string]pricePoint{key: {
+		"a": spot("us-east-1a", 0.042), // +40%
+		"b": spot("us-east-1b", 0.033), // +10%, below the threshold
+		"c": spot("us-east-1c", 0.015), // -50%
+		"d": spot("us-east-1d", 0.06),  // new series
+		"v": vcpu,                      // not notified
+	}}
+
+	changes := e.priceChanges()
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+	if c := changes[0]; c.Metric != "aws_pricing_ec2" || c.Labels["availability_zone"] != "us-east-1a" || c.OldPrice != 0.03 || c.NewPrice != 0.042 || math.Abs(c.ChangePercent-40) > 1e-9 {
+		t.Errorf("changes[0] = %+v", c)
+	}
+	if c := changes[1]; c.Labels["availability_zone"] != "us-east-1c" || math.Abs(c.ChangePercent+50) > 1e-9 {
+		t.Errorf("changes[1] = %+v", c)
+	}
+	if _, ok := changes[0].Labels["saving_plan_type"]; ok {
+		t.Error("expected empty labels to be omitted")
+	}
+}
+
+func TestSetDerivedMetrics(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+derivedMetrics:
+  - name: spot_ondemand_ratio
+    expr: spot / ondemand
+    on: [instance_type, region]
+    series:
+      spot:
+        metric: aws_pricing_ec2
+        match: {instance_lifecycle: spot}
+      ondemand:
+        metric: aws_pricing_ec2
+        match: {instance_lifecycle: ondemand}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	e := newTestExporter(nil, WithDerivedMetrics(cfg.DerivedMetrics))
+	ec2 := func(lifecycle, instanceType, zone string, usd float64) pricePoint {
+		return pricePoint{name: "ec2", usd: usd, labels: prometheus.Labels{"instance_lifecycle": lifecycle, "instance_type": instanceType, "region": "us-east-1", "availability_zone": zone}}
+	}
+	e.lastPrices = map[regionKey]map[string]pricePoint{{"aws", "us-east-1"}: {
+		"a": ec2("ondemand", "m5.large", "us-east-1a", 0.1),
+		"b": ec2("spot", "m5.large", "us-east-1a", 0.04),
+		"c": ec2("spot", "m5.large", "us-east-1b", 0.03),
+		"d": ec2("spot", "c5.large", "us-east-1a", 0.03), // no on-demand price
+	}}
+	e.setDerivedMetrics()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.derivedMetrics[0].gauge)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "spot_ondemand_ratio")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatalf("expected one spot_ondemand_ratio series, got %v", family)
+	}
+	if !hasLabelValue(family, "instance_type", "m5.large") || math.Abs(family.GetMetric()[0].GetGauge().GetValue()-0.3) > 1e-9 {
+		t.Errorf("spot_ondemand_ratio = %v", family.GetMetric()[0])
+	}
+}
+
+func TestNewExporter_DerivedMetricNameClash(t *testing.T) {
+	cfg, err := config.Parse([]byte("derivedMetrics:\n  - name: aws_pricing_ec2\n    expr: '1'\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, nil, WithDerivedMetrics(cfg.DerivedMetrics)); err == nil {
+		t.Error("expected an error for a derived metric named like a pricing metric")
+	}
+}
+
+func TestCollect_AWSMetrics(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+awsMetrics:
+  - name: aws_pricing_rds_instance
+    serviceCode: AmazonRDS
+    filters: {databaseEngine: PostgreSQL}
+    labels: {instance_type: instanceType, deployment: deploymentOption}
+    unit: Hrs
+  - name: aws_pricing_ec2
+    serviceCode: AmazonEC2
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, nil, WithAWSMetrics(cfg.AWSMetrics[1:])); err == nil {
+		t.Error("expected an error for an AWS metric named like a pricing metric")
+	}
+
+	var filters []string
+	pricingClient := &mockPricingClient{
+		GetProductsFn: func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+			filters = append(filters, *params.ServiceCode)
+			for _, f := range params.Filters {
+				filters = append(filters, *f.Field+"="+*f.Value)
+			}
+			return &pricing.GetProductsOutput{PriceList: []string{`{
+				"product": {"sku": "RDS1", "attributes": {"instanceType": "db.m5.large", "deploymentOption": "Multi-AZ"}},
+				"terms": {"OnDemand": {"RDS1.JRTCKXETXF": {"priceDimensions": {
+					"RDS1.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "beginRange": "0", "pricePerUnit": {"USD": "0.356"}}
+				}}}}
+			}`}}, nil
+		},
+	}
+	e := newTestExporter(&mockClientFactory{ec2Client: &mockEC2Client{}, prClient: pricingClient}, func(e *Exporter) {
+		e.lifecycle = []string{}
+		e.awsMetrics = cfg.AWSMetrics[:1]
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	want := []string{"AmazonRDS", "regionCode=us-east-1", "databaseEngine=PostgreSQL"}
+	if fmt.Sprint(filters) != fmt.Sprint(want) {
+		t.Errorf("GetProducts filters = %v, want %v", filters, want)
+	}
+	family := findMetricFamily(families, "aws_pricing_rds_instance")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatal("expected one aws_pricing_rds_instance series")
+	}
+	if family.GetMetric()[0].GetGauge().GetValue() != 0.356 {
+		t.Errorf("expected 0.356, got %v", family.GetMetric()[0].GetGauge().GetValue())
+	}
+	for label, value := range map[string]string{"region": "us-east-1", "instance_type": "db.m5.large", "deployment": "Multi-AZ"} {
+		if !hasLabelValue(family, label, value) {
+			t.Errorf("expected %s=%s", label, value)
+		}
+	}
+}
+
+func TestCollect_AzureMetrics(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+azureMetrics:
+  - name: azure_pricing_blob_storage
+    filter: serviceName eq 'Storage'
+    labels: {sku: skuName}
+  - name: azure_pricing_typo
+    filter: serviceName eq 'Storage'
+    labels: {sku: sku_name}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, &AzureConfig{}, WithAzureMetrics(cfg.AzureMetrics[1:])); err == nil {
+		t.Error("expected an error for a label from an unknown item field")
+	}
+
+	var fail bool
+	azureClient := &mockAzureRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]azure.RetailPriceItem, error) {
+			if fail {
+				return nil, fmt.Errorf("service unavailable")
+			}
+			return []azure.RetailPriceItem{{RetailPrice: 0.0184, SkuName: "Hot LRS", UnitOfMeasure: "1 GB/Month"}}, nil
+		},
+	}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.azureMetrics = cfg.AzureMetrics[:1]
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	for _, fail = range []bool{false, true} {
+		e.nextScrape = time.Now().Add(-1 * time.Second)
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		family := findMetricFamily(families, "azure_pricing_blob_storage")
+		if family == nil || len(family.GetMetric()) != 1 || family.GetMetric()[0].GetGauge().GetValue() != 0.0184 {
+			t.Fatalf("failing=%v: expected one azure_pricing_blob_storage series of 0.0184", fail)
+		}
+		if !hasLabelValue(family, "sku", "Hot LRS") || !hasLabelValue(family, "region", "eastus") {
+			t.Errorf("unexpected labels %v", family.GetMetric()[0].GetLabel())
+		}
+		if stale := findMetricFamily(families, "cloud_pricing_stale"); !hasLabelValue(stale, "provider", "azure") || hasLabelValue(stale, "provider", "aws") {
+			t.Error("expected the prices to belong to the Azure region")
+		}
+	}
+}
+
+func TestSetPricingMetrics_MetricMapping(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+metricMappings:
+  - metric: aws_pricing_ec2
+    labels: [instance_lifecycle, instance_type, region]
+    rename: {instance_type: type, instance_lifecycle: capacity}
+    scale: 730
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for name, mapping := range map[string]string{
+		"unknown metric": "metricMappings:\n  - metric: aws_pricing_rds\n",
+		"unknown label":  "metricMappings:\n  - metric: aws_pricing_ec2\n    labels: [instance_family]\n",
+		"unknown rename": "metricMappings:\n  - metric: aws_pricing_ec2\n    rename: {family: instance_family}\n",
+		"label twice":    "metricMappings:\n  - metric: aws_pricing_ec2\n    rename: {instance_type: region}\n",
+	} {
+		invalid, err := config.Parse([]byte(mapping))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", name, err)
+		}
+		if _, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, nil, WithMetricMappings(invalid.MetricMappings)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	e := newTestExporter(nil, WithMetricMappings(cfg.MetricMappings))
+	scrapes := make(chan provider.ScrapeResult, 10)
+	for _, scr := range []provider.ScrapeResult{
+		{Name: "ec2", Value: 0.04, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"},
+		{Name: "ec2", Value: 0.03, Region: "us-east-1", AvailabilityZone: "us-east-1b", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"},
+		{Name: "ec2", Value: 0.035, Region: "us-east-1", AvailabilityZone: "us-east-1c", InstanceType: "m5.large", InstanceLifecycle: "spot", ProductDescription: "Linux/UNIX"},
+		{Name: "ec2_vcpu", Value: 0.015, Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large", InstanceLifecycle: "spot"},
+	} {
+		scrapes <- scr
+	}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	for _, m := range e.pricingMetrics {
+		reg.MustRegister(m)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "aws_pricing_ec2")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatal("expected the zones to be merged into one aws_pricing_ec2 series")
+	}
+	m := family.GetMetric()[0]
+	if len(m.GetLabel()) != 3 || !hasLabelValue(family, "type", "m5.large") || !hasLabelValue(family, "capacity", "spot") {
+		t.Errorf("unexpected labels %v", m.GetLabel())
+	}
+	if got := m.GetGauge().GetValue(); math.Abs(got-0.03*730) > 1e-9 {
+		t.Errorf("expected the cheapest zone times 730, got %v", got)
+	}
+	if vcpu := findMetricFamily(families, "aws_pricing_ec2_vcpu"); vcpu == nil || !hasLabelValue(vcpu, "availability_zone", "us-east-1a") {
+		t.Error("expected unmapped metrics to keep their labels")
+	}
+
+	// Recorded prices keep the original labels and values.
+	if len(e.scrapedPrices[regionKey{"aws", "us-east-1"}]) != 4 {
+		t.Errorf("expected 4 recorded prices, got %d", len(e.scrapedPrices[regionKey{"aws", "us-east-1"}]))
+	}
+}
+
+func TestCollect_FakeProvider(t *testing.T) {
+	p, err := fake.New(fake.Config{Regions: 2, InstanceTypes: 15, Volatility: 0.01, Seed: 1})
+	if err != nil {
+		t.Fatalf("fake.New: %v", err)
+	}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = nil
+		e.fake = p
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "fake_pricing_instance")
+	if family == nil || len(family.GetMetric()) != 2*15*2 {
+		t.Fatalf("expected %d fake_pricing_instance series", 2*15*2)
+	}
+	if !hasLabelValue(family, "region", "fake-region-2") || !hasLabelValue(family, "instance_lifecycle", "spot") {
+		t.Error("expected the regions and lifecycles of the fake provider")
+	}
+	stale := findMetricFamily(families, "cloud_pricing_stale")
+	if stale == nil || !hasLabelValue(stale, "provider", "fake") {
+		t.Error("expected cloud_pricing_stale of the fake regions")
+	}
+}
+
+func TestCollect_RefreshStagger(t *testing.T) {
+	p, err := fake.New(fake.Config{Regions: 2, InstanceTypes: 3, Volatility: 0.1, Seed: 1})
+	if err != nil {
+		t.Fatalf("fake.New: %v", err)
+	}
+	e := newTestExporter(nil, WithRefreshStagger(true), func(e *Exporter) {
+		e.regions = nil
+		e.fake = p
+		e.cache = 100
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	gather := func() map[string]float64 {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		family := findMetricFamily(families, "fake_pricing_instance")
+		if family == nil || len(family.GetMetric()) != 2*3*2 {
+			t.Fatalf("expected %d fake_pricing_instance series", 2*3*2)
+		}
+		prices := map[string]float64{}
+		for _, m := range family.GetMetric() {
+			var id string
+			for _, l := range m.GetLabel() {
+				id += l.GetValue() + ","
+			}
+			prices[id] = m.GetGauge().GetValue()
+		}
+		return prices
+	}
+
+	start := time.Now()
+	first := gather()
+	region1, region2 := regionKey{"fake", "fake-region-1"}, regionKey{"fake", "fake-region-2"}
+	due1, due2 := e.refreshDue[region1], e.refreshDue[region2]
+	if d := due1.Sub(start); d < 49*time.Second || d > 51*time.Second {
+		t.Errorf("fake-region-1 due after %s, want 50s", d)
+	}
+	if d := due2.Sub(start); d < 99*time.Second || d > 101*time.Second {
+		t.Errorf("fake-region-2 due after %s, want 100s", d)
+	}
+	if !e.nextScrape.Equal(due1) {
+		t.Errorf("next scrape at %s, want the first due region at %s", e.nextScrape, due1)
+	}
+
+	// Only fake-region-1 is due; fake-region-2 keeps its prices.
+	e.refreshDue[region1] = time.Now().Add(-time.Second)
+	e.nextScrape = e.refreshDue[region1]
+	second := gather()
+	for id, price := range second {
+		refreshed := strings.Contains(id, "fake-region-1")
+		if refreshed == (price == first[id]) {
+			t.Errorf("series %s: price %v, previously %v, refreshed=%v", id, price, first[id], refreshed)
+		}
+	}
+	if due := e.refreshDue[region1]; !due.After(time.Now().Add(98 * time.Second)) {
+		t.Errorf("fake-region-1 due again at %s, want one cache duration later", due)
+	}
+	if !e.refreshDue[region2].Equal(due2) {
+		t.Error("expected the schedule of the deferred fake-region-2 to be kept")
+	}
+}
+
+func TestSetPricingMetrics_Validation(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+validation:
+  rejectZero: true
+  maxChangeFactor: 100
+  rules:
+    - metric: aws_pricing_ec2
+      lifecycle: spot
+      max: 10
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	invalid := cfg.Validation
+	invalid.Rules = []config.PriceRule{{Metric: "aws_pricing_rds", Max: 1}}
+	if _, err := NewExporter(nil, nil, nil, nil, 0, nil, nil, &mockClientFactory{}, nil, WithValidation(invalid)); err == nil {
+		t.Error("expected an error for a rule of an unknown metric")
+	}
+	e, err := NewExporter(nil, nil, []string{"us-east-1"}, nil, 0, nil, nil, &mockClientFactory{}, nil, WithValidation(cfg.Validation), WithInstanceDataSource("embedded"))
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+
+	scrape := func(values map[string]float64) map[string]float64 {
+		scrapes := make(chan provider.ScrapeResult, len(values))
+		for instanceType, value := range values {
+			scrapes <- provider.ScrapeResult{Name: "ec2", Value: value, Region: "us-east-1", InstanceType: instanceType, InstanceLifecycle: "spot"}
+		}
+		close(scrapes)
+		e.resetGauges()
+		e.initRegionErrors()
+		e.setPricingMetrics(scrapes)
+		e.serveStale()
+		exported := make(map[string]float64)
+		for _, p := range e.lastPrices[regionKey{"aws", "us-east-1"}] {
+			exported[p.labels["instance_type"]] = p.usd
+		}
+		return exported
+	}
+
+	got := scrape(map[string]float64{"m5.large": 0.04, "c5.large": 0, "p4d.24xlarge": 12})
+	if len(got) != 1 || got["m5.large"] != 0.04 {
+		t.Errorf("expected only the plausible price to be exported, got %v", got)
+	}
+	got = scrape(map[string]float64{"m5.large": 5, "c5.large": 0.03})
+	if got["m5.large"] != 0.04 || got["c5.large"] != 0.03 {
+		t.Errorf("expected the jump to be replaced by the previous price, got %v", got)
+	}
+	if got = scrape(map[string]float64{"m5.large": 5, "c5.large": 0.03}); got["m5.large"] != 5 {
+		t.Errorf("expected a jump seen in two scrapes in a row to be accepted, got %v", got)
+	}
+	if len(e.jumpedPrices[regionKey{"aws", "us-east-1"}]) != 0 {
+		t.Errorf("expected no jumps to be remembered after an accepted one, got %v", e.jumpedPrices)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.rejectedValues)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "cloud_pricing_rejected_values_total")
+	if family == nil || len(family.GetMetric()) != 3 {
+		t.Fatal("expected rejections of three reasons")
+	}
+	for _, reason := range []string{"zero", "above_max", "jump"} {
+		if !hasLabelValue(family, "reason", reason) {
+			t.Errorf("expected a rejection with reason %s", reason)
+		}
+	}
+
+	e.validation.Action = config.ValidationFlag
+	if got := scrape(map[string]float64{"m5.large": 0.04, "c5.large": 0}); got["c5.large"] != 0 || len(got) != 2 {
+		t.Errorf("expected flagged values to be exported, got %v", got)
+	}
+}
+
+func TestSetPricingMetrics_SkippedItems(t *testing.T) {
+	e := newTestExporter(nil)
+	scrapes := make(chan provider.ScrapeResult, 10)
+	scrapes <- provider.Skipped("aws", "us-east-1", provider.SkipFiltered)
+	scrapes <- provider.Skipped("aws", "us-east-1", provider.SkipFiltered)
+	scrapes <- provider.Skipped("aws", "us-east-1", provider.SkipMissingTerms)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.05, Region: "us-east-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.skippedItems)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "cloud_pricing_skipped_items_total")
+	if family == nil || len(family.GetMetric()) != 4 {
+		t.Fatal("expected a series of every reason of the aws provider")
+	}
+	want := map[string]float64{"filtered": 2, "missing_terms": 1, "unknown_instance_type": 0, "unparsable_price": 0}
+	for _, m := range family.GetMetric() {
+		var reason string
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "reason" {
+				reason = l.GetValue()
+			}
+		}
+		if got := m.GetCounter().GetValue(); got != want[reason] {
+			t.Errorf("skipped items with reason %s = %v, want %v", reason, got, want[reason])
+		}
+	}
+	if len(e.scrapedPrices[regionKey{"aws", "us-east-1"}]) != 1 {
+		t.Error("expected skipped items not to be recorded as prices")
+	}
+}
+
+func TestSetPricingMetrics_APIErrors(t *testing.T) {
+	e := newTestExporter(nil)
+	denied := apierror.Classify("aws", &smithy.OperationError{ServiceID: "EC2", OperationName: "DescribeSpotPriceHistory", Err: &smithy.GenericAPIError{Code: "UnauthorizedOperation"}})
+	scrapes := make(chan provider.ScrapeResult, 10)
+	scrapes <- provider.Failed("us-east-1", denied)
+	scrapes <- provider.Failed("eu-west-1", denied)
+	scrapes <- provider.ScrapeResult{Name: "ec2", Value: 0.05, Region: "us-east-1", InstanceType: "m5.large", InstanceLifecycle: "spot"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.apiErrors)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "cloud_pricing_api_errors_total")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatal("expected a single series of the permission error")
+	}
+	if got := family.GetMetric()[0].GetCounter().GetValue(); got != 2 {
+		t.Errorf("api errors = %v, want 2", got)
+	}
+	for name, want := range map[string]string{"provider": "aws", "category": "permission", "permission": "ec2:DescribeSpotPriceHistory", "hint": "missing ec2:DescribeSpotPriceHistory permission"} {
+		if !hasLabelValue(family, name, want) {
+			t.Errorf("expected label %s=%q", name, want)
+		}
+	}
+	if len(e.scrapedPrices[regionKey{"aws", "us-east-1"}]) != 1 {
+		t.Error("expected failed requests not to be recorded as prices")
+	}
+}
+
+func TestCollect_CloudFrontUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	orig := aws.CloudFrontOfferURL
+	aws.CloudFrontOfferURL = ts.URL
+	defer func() { aws.CloudFrontOfferURL = orig }()
+
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = nil
+		e.cloudFront = true
+		e.httpClient = ts.Client()
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	stale := findMetricFamily(families, "cloud_pricing_stale")
+	if stale == nil || len(stale.GetMetric()) != 1 || !hasLabelValue(stale, "region", aws.CloudFrontRegion) || stale.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Error("expected the failed CloudFront scrape to flag region global as stale")
+	}
+	scrapeErrors := findMetricFamily(families, "aws_pricing_scrape_error")
+	if scrapeErrors == nil || scrapeErrors.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Error("expected the failed CloudFront scrape to be counted")
+	}
+}
+
+func TestCollect_AzureAKS(t *testing.T) {
+	azureClient := &mockAzureRetailPricesClient{
+		GetPricesFn: func(ctx context.Context, filter string) ([]azure.RetailPriceItem, error) {
+			return []azure.RetailPriceItem{
+				{RetailPrice: 0.1, ProductName: "Azure Kubernetes Service", SkuName: "Standard", MeterName: "Standard Uptime SLA", UnitOfMeasure: "1 Hour"},
+			}, nil
+		},
+	}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = nil
+		e.azureEnabled = true
+		e.azureAKS = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	aks := findMetricFamily(families, "azure_pricing_aks_cluster")
+	if aks == nil || len(aks.GetMetric()) != 1 || !hasLabelValue(aks, "tier", azure.AKSTierStandard) || !hasLabelValue(aks, "region", "eastus") {
+		t.Fatalf("expected one azure_pricing_aks_cluster series of the standard tier in eastus, got %v", aks)
+	}
+	if v := aks.GetMetric()[0].GetGauge().GetValue(); v != 0.1 {
+		t.Errorf("expected 0.1, got %v", v)
+	}
+}
+
+func TestWorkerPool_Bounded(t *testing.T) {
+	e := newTestExporter(nil, WithScrapeConcurrency(2))
+	pool := e.newWorkerPool()
+
+	var running, peak, done int32
+	for range 10 {
+		pool.submit(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	pool.wait()
+
+	if done != 10 {
+		t.Errorf("expected 10 tasks to run, got %d", done)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 tasks at once, got %d", peak)
+	}
+	gauge := func(g prometheus.Gauge) float64 {
+		t.Helper()
+		var m dto.Metric
+		if err := g.Write(&m); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		return m.GetGauge().GetValue()
+	}
+	if workers, queued, inFlight := gauge(e.poolWorkers), gauge(e.poolQueued), gauge(e.poolInFlight); workers != 2 || queued != 0 || inFlight != 0 {
+		t.Errorf("got workers=%v queued=%v in flight=%v, want 2/0/0", workers, queued, inFlight)
+	}
+}
+
+func TestReceiveBatch(t *testing.T) {
+	scrapes := make(chan provider.ScrapeResult, 5)
+	for i := range 5 {
+		scrapes <- provider.ScrapeResult{Name: "ec2", Value: float64(i)}
+	}
+	close(scrapes)
+
+	batch := make([]provider.ScrapeResult, 0, 3)
+	var sizes []int
+	for {
+		batch = receiveBatch(scrapes, batch[:0])
+		if len(batch) == 0 {
+			break
+		}
+		sizes = append(sizes, len(batch))
+	}
+	if len(sizes) != 2 || sizes[0] != 3 || sizes[1] != 2 {
+		t.Errorf("expected batches of 3 and 2 results, got %v", sizes)
+	}
+}
+
+func TestSetPricingMetrics_LabelOrder(t *testing.T) {
+	e := newTestExporter(nil)
+	scrapes := make(chan provider.ScrapeResult, 1)
+	scrapes <- provider.ScrapeResult{Name: "ec2_vcpu", Value: 0.02, Region: "us-east-1", InstanceType: "m5.large", InstanceLifecycle: "spot", AvailabilityZone: "us-east-1a"}
+	close(scrapes)
+	e.setPricingMetrics(scrapes)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e.pricingMetrics["ec2_vcpu"])
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	family := findMetricFamily(families, "aws_pricing_ec2_vcpu")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatal("expected one aws_pricing_ec2_vcpu series")
+	}
+	got := map[string]string{}
+	for _, l := range family.GetMetric()[0].GetLabel() {
+		got[l.GetName()] = l.GetValue()
+	}
+	if got["instance_type"] != "m5.large" || got["availability_zone"] != "us-east-1a" || got["instance_lifecycle"] != "spot" || got["saving_plan_duration"] != "0" {
+		t.Errorf("unexpected labels: %v", got)
+	}
+}
+
+func TestCollect_ServesSnapshotDuringScrape(t *testing.T) {
+	var block atomic.Bool
+	started, release := make(chan struct{}), make(chan struct{})
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			if block.Load() {
+				close(started)
+				<-release
+				return nil, fmt.Errorf("service unavailable")
+			}
+			return []azure.RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+			}, nil
+		},
+	}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.cache = 3600
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	vmSeries := func() int {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		return len(findMetricFamily(families, "azure_pricing_vm").GetMetric())
+	}
+
+	if n := vmSeries(); n != 1 {
+		t.Fatalf("first scrape: expected 1 azure_pricing_vm series, got %d", n)
+	}
+
+	block.Store(true)
+	e.nextScrape = time.Now().Add(-time.Second)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = reg.Gather()
+	}()
+	<-started
+	// The second scrape is running; the first one's metrics are served
+	// without waiting for it.
+	if n := vmSeries(); n != 1 {
+		t.Errorf("during scrape: expected the previous azure_pricing_vm series, got %d", n)
+	}
+	close(release)
+	<-done
+}
+
+func TestCollect_ScrapeResourceUsage(t *testing.T) {
+	p, err := fake.New(fake.Config{Regions: 2, InstanceTypes: 50, Volatility: 0.01, Seed: 1})
+	if err != nil {
+		t.Fatalf("fake.New: %v", err)
+	}
+	e := newTestExporter(nil, func(e *Exporter) {
+		e.regions = nil
+		e.fake = p
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, name := range []string{"cloud_pricing_scrape_allocated_bytes", "cloud_pricing_scrape_peak_heap_bytes"} {
+		family := findMetricFamily(families, name)
+		if family == nil || family.GetMetric()[0].GetGauge().GetValue() <= 0 {
+			t.Errorf("expected a positive %s", name)
+		}
+	}
+	if findMetricFamily(families, "cloud_pricing_scrape_goroutines_delta") == nil {
+		t.Error("expected cloud_pricing_scrape_goroutines_delta")
+	}
+}
+
+func TestScrapeEffectiveRates_Cached(t *testing.T) {
+	var calls int
+	fail := false
+	ceClient := &mockCostExplorerClient{
+		GetCostAndUsageFn: func(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+			calls++
+			if fail {
+				return nil, &smithy.GenericAPIError{Code: "ThrottlingException"}
+			}
+			return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []ceTypes.ResultByTime{{Groups: []ceTypes.Group{{
+				Keys: []string{"m5.large", "us-east-1"},
+				Metrics: map[string]ceTypes.MetricValue{
+					"NetAmortizedCost": {Amount: awssdk.String("2")},
+					"UsageQuantity":    {Amount: awssdk.String("40")},
+				},
+			}}}}}, nil
+		},
+	}
+	e := newTestExporter(&mockClientFactory{ceClient: ceClient}, WithEffectiveRates(7*24*time.Hour), func(e *Exporter) {
+		e.instanceFilter.Regexes = []*regexp.Regexp{regexp.MustCompile(".*")}
+	})
+	scrape := func() []provider.ScrapeResult {
+		scrapes := make(chan provider.ScrapeResult, 10)
+		e.scrapeEffectiveRates(context.Background(), []string{"us-east-1"}, scrapes)
+		close(scrapes)
+		var results []provider.ScrapeResult
+		for r := range scrapes {
+			results = append(results, r)
+		}
+		return results
+	}
+
+	for range 2 {
+		if results := scrape(); len(results) != 1 || results[0].Name != "ec2_effective" || results[0].Value != 0.05 {
+			t.Errorf("expected the effective rate, got %+v", results)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected Cost Explorer to be queried once, got %d queries", calls)
+	}
+
+	// Expired rates are queried again; a failed query keeps them.
+	e.effectiveFetched = time.Now().Add(-effectiveRatesRefresh)
+	fail = true
+	results := scrape()
+	if calls != 2 || len(results) != 2 || results[0].Name != provider.FailedName || results[1].Name != "ec2_effective" {
+		t.Errorf("expected the failure and the cached rate, got %d queries and %+v", calls, results)
+	}
+}
+
+func TestRefresh_JoinsRunningRefresh(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			calls.Add(1)
+			<-release
+			return nil, nil
+		},
+	}
+	e := newTestExporter(nil, WithExternalRefresh(), func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+	})
+
+	// Requests timing out while the scrape runs don't queue more scrapes.
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := e.Refresh(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the refresh to time out, got %v", err)
+		}
+		cancel()
+	}
+	e.refreshMu.Lock()
+	done := e.refreshing
+	e.refreshMu.Unlock()
+	close(release)
+	<-done
+	if err := e.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected the timed out refreshes to join the running scrape and one more scrape, got %d", n)
+	}
+}
+
+func TestRefresh_ExternalRefresh(t *testing.T) {
+	release := make(chan struct{})
+	azureClient := &mockAzureRetailPricesClient{
+		GetVMPricesFn: func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
+			<-release
+			return []azure.RetailPriceItem{
+				{RetailPrice: 0.096, ArmRegionName: "eastus", ArmSkuName: "Standard_D2s_v5", ProductName: "Virtual Machines Dv5 Series", MeterName: "D2s v5"},
+			}, nil
+		},
+	}
+	e := newTestExporter(nil, WithExternalRefresh(), func(e *Exporter) {
+		e.regions = []string{}
+		e.lifecycle = []string{}
+		e.azureEnabled = true
+		e.azureRegions = []string{"eastus"}
+		e.azureOperatingSystems = []string{"Linux"}
+		e.azureClientFactory = &mockAzureClientFactory{client: azureClient}
+		e.cache = 3600
+	})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(e); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	vmSeries := func() int {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		return len(findMetricFamily(families, "azure_pricing_vm").GetMetric())
+	}
+
+	// Collect doesn't scrape.
+	if n := vmSeries(); n != 0 {
+		t.Fatalf("expected no azure_pricing_vm series before a refresh, got %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.Refresh(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the refresh to time out, got %v", err)
+	}
+	close(release)
+	if err := e.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if n := vmSeries(); n != 1 {
+		t.Errorf("expected the scrape that timed out to complete in the background, got %d series", n)
+	}
+}
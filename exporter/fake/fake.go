@@ -0,0 +1,113 @@
+// Package fake generates synthetic instance prices for load testing
+// Prometheus ingestion and the exporter itself without cloud API calls.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// MetricName is the name of the scrape results of the fake provider.
+const MetricName = "fake_instance"
+
+// sizes are the sizes of every synthetic instance family, from the cheapest.
+var sizes = []string{"nano", "micro", "small", "medium", "large", "xlarge", "2xlarge", "4xlarge", "8xlarge", "16xlarge"}
+
+// minPrice keeps random-walk prices positive.
+const minPrice = 0.0001
+
+// Config configures the fake provider.
+type Config struct {
+	Regions       int     // synthetic regions, named fake-region-1 to fake-region-N
+	InstanceTypes int     // synthetic instance types per region
+	Volatility    float64 // maximum relative change of a price per scrape, e.g. 0.01 for ±1%
+	Seed          int64   // seed of the initial prices and their walks
+}
+
+// Provider generates an ondemand and a spot price for every instance type of
+// every region, each following a random walk from one scrape to the next.
+type Provider struct {
+	cfg           Config
+	regions       []string
+	instanceTypes []string
+	walks         map[string]*walk // by region
+}
+
+// walk is the price state of a region. Regions are scraped concurrently, so
+// each has its own random source.
+type walk struct {
+	rng      *rand.Rand
+	ondemand []float64 // by instance type
+	spot     []float64
+}
+
+// New returns a Provider generating cfg.Regions × cfg.InstanceTypes × 2
+// series, or an error if cfg is invalid.
+func New(cfg Config) (*Provider, error) {
+	if cfg.Regions < 1 || cfg.InstanceTypes < 1 {
+		return nil, fmt.Errorf("fake provider needs at least one region and instance type, got %d and %d", cfg.Regions, cfg.InstanceTypes)
+	}
+	if cfg.Volatility < 0 || cfg.Volatility >= 1 {
+		return nil, fmt.Errorf("fake provider volatility must be between 0 and 1, got %g", cfg.Volatility)
+	}
+	p := &Provider{
+		cfg:           cfg,
+		regions:       make([]string, cfg.Regions),
+		instanceTypes: make([]string, cfg.InstanceTypes),
+		walks:         make(map[string]*walk, cfg.Regions),
+	}
+	for i := range p.instanceTypes {
+		p.instanceTypes[i] = fmt.Sprintf("f%d.%s", i/len(sizes)+1, sizes[i%len(sizes)])
+	}
+	for i := range p.regions {
+		region := fmt.Sprintf("fake-region-%d", i+1)
+		p.regions[i] = region
+		w := &walk{
+			rng:      rand.New(rand.NewPCG(uint64(cfg.Seed), uint64(i))),
+			ondemand: make([]float64, cfg.InstanceTypes),
+			spot:     make([]float64, cfg.InstanceTypes),
+		}
+		for j := range w.ondemand {
+			// Each size doubles the price of the previous one, like real
+			// families; families and regions differ by up to ±20%.
+			base := 0.005 * math.Pow(2, float64(j%len(sizes)))
+			w.ondemand[j] = base * (0.8 + 0.4*w.rng.Float64())
+			w.spot[j] = w.ondemand[j] * (0.3 + 0.4*w.rng.Float64())
+		}
+		p.walks[region] = w
+	}
+	return p, nil
+}
+
+// Regions returns the names of the synthetic regions.
+func (p *Provider) Regions() []string {
+	return p.regions
+}
+
+// Scrape moves every price of region one step and sends them to scrapes.
+// Scrapes of the same region must not run concurrently.
+func (p *Provider) Scrape(ctx context.Context, region string, scrapes chan<- provider.ScrapeResult) {
+	w := p.walks[region]
+	if w == nil {
+		return
+	}
+	for i, instanceType := range p.instanceTypes {
+		if ctx.Err() != nil {
+			return
+		}
+		w.ondemand[i] = p.step(w.rng, w.ondemand[i])
+		w.spot[i] = math.Min(p.step(w.rng, w.spot[i]), w.ondemand[i])
+		scrapes <- provider.ScrapeResult{Name: MetricName, Value: w.ondemand[i], Region: region, InstanceType: instanceType, InstanceLifecycle: "ondemand"}
+		scrapes <- provider.ScrapeResult{Name: MetricName, Value: w.spot[i], Region: region, InstanceType: instanceType, InstanceLifecycle: "spot"}
+	}
+}
+
+// step returns price changed randomly by up to the configured volatility.
+func (p *Provider) step(rng *rand.Rand, price float64) float64 {
+	price *= 1 + p.cfg.Volatility*(2*rng.Float64()-1)
+	return math.Max(price, minPrice)
+}
@@ -0,0 +1,82 @@
+package fake
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+func scrapeAll(p *Provider) []provider.ScrapeResult {
+	var results []provider.ScrapeResult
+	for _, region := range p.Regions() {
+		scrapes := make(chan provider.ScrapeResult, 2*len(p.instanceTypes))
+		p.Scrape(context.Background(), region, scrapes)
+		close(scrapes)
+		for r := range scrapes {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func TestProvider(t *testing.T) {
+	cfg := Config{Regions: 3, InstanceTypes: 25, Volatility: 0.05, Seed: 7}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	first := scrapeAll(p)
+	if len(first) != 3*25*2 {
+		t.Fatalf("got %d results, want %d", len(first), 3*25*2)
+	}
+	series := make(map[string]bool)
+	for i, r := range first {
+		series[r.Region+"/"+r.InstanceType+"/"+r.InstanceLifecycle] = true
+		if r.Name != MetricName || r.Value <= 0 {
+			t.Errorf("unexpected result %+v", r)
+		}
+		if r.InstanceLifecycle == "spot" && r.Value > first[i-1].Value {
+			t.Errorf("spot price %g of %s above its ondemand price %g", r.Value, r.InstanceType, first[i-1].Value)
+		}
+	}
+	if len(series) != len(first) || !series["fake-region-3/f3.large/spot"] {
+		t.Errorf("expected distinct series of every region and type, got %d", len(series))
+	}
+
+	second := scrapeAll(p)
+	changed := 0
+	for i, r := range second {
+		prev := first[i].Value
+		if r.Value != prev {
+			changed++
+		}
+		if r.InstanceLifecycle == "ondemand" && math.Abs(r.Value/prev-1) > cfg.Volatility+1e-9 {
+			t.Errorf("price of %s moved from %g to %g, more than the volatility", r.InstanceType, prev, r.Value)
+		}
+	}
+	if changed == 0 {
+		t.Error("expected prices to move between scrapes")
+	}
+
+	same, _ := New(cfg)
+	for i, r := range scrapeAll(same) {
+		if r.InstanceType != first[i].InstanceType || r.Value != first[i].Value {
+			t.Fatalf("expected the same seed to generate the same prices, got %+v and %+v", r, first[i])
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Regions: 0, InstanceTypes: 10},
+		{Regions: 1, InstanceTypes: 0},
+		{Regions: 1, InstanceTypes: 1, Volatility: -0.1},
+		{Regions: 1, InstanceTypes: 1, Volatility: 1},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/fake"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// WithFakeProvider exports the synthetic prices of p as fake_pricing_instance,
+// besides any AWS and Azure prices.
+func WithFakeProvider(p *fake.Provider) Option {
+	return func(e *Exporter) {
+		e.fake = p
+	}
+}
+
+// initFakeGauges creates the pricing metric of the fake provider.
+func (e *Exporter) initFakeGauges() {
+	e.newPricingMetric(fake.MetricName, prometheus.GaugeOpts{
+		Namespace: "fake_pricing",
+		Name:      "instance",
+		Help:      "Synthetic price of the instance type, following a random walk; for load testing only.",
+	}, e.priceLabels("instance_lifecycle", "instance_type", "region"))
+}
+
+// scrapeFake scrapes every region of the fake provider.
+func (e *Exporter) scrapeFake(ctx context.Context, now time.Time, pool *workerPool, scrapes chan<- provider.ScrapeResult) {
+	for _, region := range e.fake.Regions() {
+		if !e.regionDue(regionKey{"fake", region}, now) {
+			continue
+		}
+		if !e.breakerAllows(regionKey{"fake", region}, now) {
+			log.Debugf("circuit breaker open, skipping fake prices [region=%s]", region)
+			continue
+		}
+		pool.submit(func() {
+			e.fake.Scrape(ctx, region, scrapes)
+		})
+	}
+}
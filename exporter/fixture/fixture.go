@@ -0,0 +1,305 @@
+// Package fixture records the responses of upstream HTTP requests to a
+// directory and replays them from it, for offline development, deterministic
+// demos and regression tests against real payloads.
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes of the -fixture.mode flag.
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// timestampRE matches dates and times in request bodies, plain or URL
+// encoded, e.g. the StartTime of DescribeSpotPriceHistory. They're ignored
+// when matching requests, so a request for "the last hour" replays.
+var timestampRE = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(T\d{2}(:|%3A)\d{2}(:|%3A)\d{2}(\.\d+)?(Z|[+-]\d{2}(:|%3A)\d{2}|%2B\d{2}%3A\d{2})?)?`)
+
+// redacted replaces credentials in recorded responses.
+const redacted = "REDACTED"
+
+// Credential fields of the JSON (Entra ID, IMDS, ECS) and XML (STS) responses
+// of credential endpoints.
+var (
+	jsonCredentialRE = regexp.MustCompile(`("(?:access_token|refresh_token|id_token|AccessKeyId|SecretAccessKey|Token|SessionToken)"\s*:\s*")[^"]*(")`)
+	xmlCredentialRE  = regexp.MustCompile(`(<(?:AccessKeyId|SecretAccessKey|SessionToken)>)[^<]*(</)`)
+)
+
+// fixture is the metadata of a recorded response; its body is stored next to
+// it with the .body extension.
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// Key returns the file name, without extension, of the fixture of req: a
+// hash of its method, URL and body with timestamps removed. The body of req
+// is restored.
+func Key(req *http.Request) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.String())
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(timestampRE.ReplaceAll(body, nil))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Recorder is an http.RoundTripper that sends requests through Next and
+// writes every complete response to Dir, replacing an earlier recording of
+// the same request.
+type Recorder struct {
+	Dir  string
+	Next http.RoundTripper
+}
+
+// NewRecorder returns a Recorder writing to dir, which is created if missing.
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating fixture directory: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{Dir: dir, Next: next}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := Key(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if isCredentialRequest(req) {
+		return r.recordRedacted(req, resp, key)
+	}
+	tmp, err := os.CreateTemp(r.Dir, key+".*.tmp")
+	if err != nil {
+		log.WithError(err).Errorf("not recording fixture of %s %s", req.Method, req.URL.Redacted())
+		return resp, nil
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		tmp:        tmp,
+		path:       filepath.Join(r.Dir, key),
+		fixture: fixture{
+			Method: req.Method,
+			URL:    req.URL.Redacted(),
+			Status: resp.StatusCode,
+			Header: resp.Header.Clone(),
+		},
+	}
+	return resp, nil
+}
+
+// isCredentialRequest reports whether req fetches credentials: Entra ID
+// tokens, STS, the instance metadata service of EC2 and Azure or the ECS
+// container credentials endpoint.
+func isCredentialRequest(req *http.Request) bool {
+	host := req.URL.Hostname()
+	switch {
+	case host == "169.254.169.254", host == "fd00:ec2::254", host == "169.254.170.2":
+		return true
+	case strings.HasPrefix(host, "login.microsoftonline."), host == "login.chinacloudapi.cn":
+		return true
+	}
+	return strings.HasPrefix(host, "sts.") && strings.Contains(host, ".amazonaws.")
+}
+
+// redactCredentials replaces the credential fields of body. Bodies without
+// any, e.g. an IMDSv2 session token, are replaced entirely.
+func redactCredentials(body []byte) []byte {
+	out := jsonCredentialRE.ReplaceAll(body, []byte("${1}"+redacted+"${2}"))
+	out = xmlCredentialRE.ReplaceAll(out, []byte("${1}"+redacted+"${2}"))
+	if len(body) > 0 && bytes.Equal(out, body) {
+		return []byte(redacted)
+	}
+	return out
+}
+
+// recordRedacted reads the response of a credential request and records it
+// with the credentials redacted, so a fixture directory can be committed. The
+// caller still gets the real response.
+func (r *Recorder) recordRedacted(req *http.Request, resp *http.Response, key string) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	f := fixture{Method: req.Method, URL: req.URL.Redacted(), Status: resp.StatusCode, Header: resp.Header.Clone()}
+	path := filepath.Join(r.Dir, key)
+	err = os.WriteFile(path+".body", redactCredentials(body), 0o644)
+	if err == nil {
+		var meta []byte
+		meta, err = json.MarshalIndent(f, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path+".json", meta, 0o644)
+		}
+	}
+	if err != nil {
+		log.WithError(err).Errorf("failed to record fixture of %s %s", f.Method, f.URL)
+		return resp, nil
+	}
+	log.Debugf("Recorded fixture %s of %s %s with credentials redacted", key, f.Method, f.URL)
+	return resp, nil
+}
+
+// recordingBody copies a response body to a temporary file and stores it as
+// a fixture once the body has been read to the end. Bodies closed early are
+// discarded.
+type recordingBody struct {
+	io.ReadCloser
+	tmp     *os.File
+	path    string
+	fixture fixture
+	failed  bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.failed {
+		if _, werr := b.tmp.Write(p[:n]); werr != nil {
+			b.failed = true
+		}
+	}
+	if err == io.EOF && b.tmp != nil {
+		b.store()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	if b.tmp != nil {
+		_ = b.tmp.Close()
+		_ = os.Remove(b.tmp.Name())
+		b.tmp = nil
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) store() {
+	tmp := b.tmp
+	b.tmp = nil
+	err := tmp.Close()
+	if err == nil && b.failed {
+		err = fmt.Errorf("writing response body")
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path+".body")
+	}
+	if err == nil {
+		var meta []byte
+		meta, err = json.MarshalIndent(b.fixture, "", "  ")
+		if err == nil {
+			err = os.WriteFile(b.path+".json", meta, 0o644)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		log.WithError(err).Errorf("failed to record fixture of %s %s", b.fixture.Method, b.fixture.URL)
+		return
+	}
+	log.Debugf("Recorded fixture %s of %s %s", filepath.Base(b.path), b.fixture.Method, b.fixture.URL)
+}
+
+// Replayer is an http.RoundTripper that serves every request from the
+// fixtures in Dir without sending it. Requests without a fixture fail.
+type Replayer struct {
+	Dir string
+}
+
+// ErrNoFixture is returned for requests that weren't recorded.
+var ErrNoFixture = fmt.Errorf("no recorded fixture")
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := Key(req)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.Dir, key)
+	meta, err := os.ReadFile(path + ".json")
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w of %s %s (%s)", ErrNoFixture, req.Method, req.URL.Redacted(), key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading fixture: %w", err)
+	}
+	var f fixture
+	if err := json.Unmarshal(meta, &f); err != nil {
+		return nil, fmt.Errorf("decoding fixture %s: %w", key, err)
+	}
+	body, err := os.Open(path + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("reading fixture: %w", err)
+	}
+	var size int64 = -1
+	if info, err := body.Stat(); err == nil {
+		size = info.Size()
+	}
+	header := f.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: size,
+		Request:       req,
+	}, nil
+}
+
+// Wrap returns a copy of client whose requests are recorded to or replayed
+// from dir, depending on mode. A nil client is replaced by a default one.
+func Wrap(client *http.Client, mode, dir string) (*http.Client, error) {
+	wrapped := &http.Client{}
+	if client != nil {
+		*wrapped = *client
+	}
+	switch strings.ToLower(mode) {
+	case ModeRecord:
+		rec, err := NewRecorder(dir, wrapped.Transport)
+		if err != nil {
+			return nil, err
+		}
+		wrapped.Transport = rec
+	case ModeReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("fixture directory: %w", err)
+		}
+		wrapped.Transport = &Replayer{Dir: dir}
+	default:
+		return nil, fmt.Errorf("invalid fixture mode %q, must be one of: %s, %s", mode, ModeRecord, ModeReplay)
+	}
+	return wrapped, nil
+}
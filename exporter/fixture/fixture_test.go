@@ -0,0 +1,144 @@
+package fixture
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, `{"path":"`+r.URL.Path+`","body":"`+strings.SplitN(string(body), "&", 2)[0]+`"}`)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	recorder, err := Wrap(srv.Client(), ModeRecord, dir)
+	if err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+	post := func(client *http.Client, body string) (*http.Response, string, error) {
+		resp, err := client.Post(srv.URL+"/prices?page=1", "application/x-www-form-urlencoded", strings.NewReader(body))
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return resp, string(data), err
+	}
+	if _, _, err := post(recorder, "Action=DescribeSpotPriceHistory&StartTime=2026-10-16T10%3A00%3A00Z"); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	// A response that isn't read to the end isn't recorded.
+	resp, err := recorder.Get(srv.URL + "/partial")
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	resp.Body.Close()
+
+	replayer, err := Wrap(nil, ModeReplay, dir)
+	if err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+	resp, body, err := post(replayer, "Action=DescribeSpotPriceHistory&StartTime=2026-10-17T09%3A30%3A00Z")
+	if err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+	if body != `{"path":"/prices","body":"Action=DescribeSpotPriceHistory"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	if requests != 2 {
+		t.Errorf("expected the replay not to reach the server, got %d requests", requests)
+	}
+
+	if _, _, err := post(replayer, "Action=DescribeAvailabilityZones"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("expected ErrNoFixture for another body, got %v", err)
+	}
+	if _, err := replayer.Get(srv.URL + "/partial"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("expected ErrNoFixture for an unread response, got %v", err)
+	}
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(tmps) != 0 {
+		t.Errorf("expected no temporary files, got %v", tmps)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRecorder_RedactsCredentials(t *testing.T) {
+	responses := map[string]string{
+		"https://login.microsoftonline.com/tenant/oauth2/v2.0/token": `{"token_type":"Bearer","expires_in":3599,"access_token":"eyJ0eXAi.secret"}`,
+		"https://sts.us-east-1.amazonaws.com/":                       `<AssumeRoleResponse><Credentials><AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>wJalr/secret</SecretAccessKey><SessionToken>FwoGZX/secret</SessionToken><Expiration>2026-10-16T12:00:00Z</Expiration></Credentials></AssumeRoleResponse>`,
+		"http://169.254.169.254/latest/api/token":                    `AQAEAFfG-secret==`,
+		"https://ec2.us-east-1.amazonaws.com/":                       `{"Token":"not a credential endpoint"}`,
+	}
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(responses[req.URL.String()]))}, nil
+	})
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, next)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	client := &http.Client{Transport: rec}
+
+	for url, want := range responses {
+		resp, err := client.Post(url, "application/x-www-form-urlencoded", strings.NewReader("client_secret=secret"))
+		if err != nil {
+			t.Fatalf("recording %s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("expected the caller to get the real response of %s, got %s", url, body)
+		}
+	}
+
+	bodies, _ := filepath.Glob(filepath.Join(dir, "*.body"))
+	if len(bodies) != len(responses) {
+		t.Fatalf("expected %d fixtures, got %v", len(responses), bodies)
+	}
+	var recorded []string
+	for _, path := range bodies {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, string(data))
+		if strings.Contains(string(data), "secret") || strings.Contains(string(data), "ASIAEXAMPLE") {
+			t.Errorf("credentials recorded in %s: %s", filepath.Base(path), data)
+		}
+	}
+	all := strings.Join(recorded, "\n")
+	for _, want := range []string{`"access_token":"REDACTED"`, "<SessionToken>REDACTED</SessionToken>", "<Expiration>2026-10-16T12:00:00Z</Expiration>", `{"Token":"not a credential endpoint"}`} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected the fixtures to contain %s, got:\n%s", want, all)
+		}
+	}
+}
+
+func TestWrap_Invalid(t *testing.T) {
+	if _, err := Wrap(nil, "live", t.TempDir()); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+	if _, err := Wrap(nil, ModeReplay, filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing replay directory to fail, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package httpclient builds the HTTP client shared by all non-SDK fetches:
+// the AWS bulk pricing files, ec2instances.info, the ECB exchange rates and
+// the Azure APIs.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configures the shared HTTP client. Zero values leave the
+// corresponding limit unset.
+type Options struct {
+	ConnectTimeout   time.Duration // TCP connect and TLS handshake
+	Timeout          time.Duration // whole request including reading the body
+	MaxResponseBytes int64         // larger response bodies fail with ErrResponseTooLarge
+
+	// Proxy is the proxy of all requests, overriding HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY. Nil uses those environment variables.
+	Proxy *url.URL
+	// NoProxy lists hosts reached directly despite Proxy. An entry matches
+	// the host itself and, with a leading dot or not, its subdomains.
+	NoProxy []string
+
+	// RootCAs verifies server certificates instead of the system pool, e.g.
+	// with the CA of a TLS-intercepting proxy. See LoadCABundle.
+	RootCAs *x509.CertPool
+}
+
+// ErrResponseTooLarge is returned while reading a response body larger than
+// Options.MaxResponseBytes.
+var ErrResponseTooLarge = fmt.Errorf("response body too large")
+
+// New returns an HTTP client with the given timeouts and response size limit.
+func New(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != nil {
+		transport.Proxy = proxyFunc(opts.Proxy, opts.NoProxy)
+	}
+	if opts.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = opts.ConnectTimeout
+	}
+	if opts.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: opts.RootCAs, MinVersion: tls.VersionTLS12}
+	}
+	var rt http.RoundTripper = transport
+	if opts.MaxResponseBytes > 0 {
+		rt = &limitedTransport{next: transport, max: opts.MaxResponseBytes}
+	}
+	return &http.Client{Transport: rt, Timeout: opts.Timeout}
+}
+
+// ParseProxy parses a proxy URL, defaulting to the http scheme when it has
+// none, e.g. "proxy.corp:3128".
+func ParseProxy(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// LoadCABundle returns the system certificate pool with the PEM certificates
+// of path added.
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// proxyFunc returns a Transport.Proxy sending every request to proxy except
+// those to a host in noProxy.
+func proxyFunc(proxy *url.URL, noProxy []string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, entry := range noProxy {
+			entry = strings.ToLower(strings.TrimPrefix(entry, "."))
+			if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+				return nil, nil
+			}
+		}
+		return proxy, nil
+	}
+}
+
+// limitedTransport caps the size of response bodies.
+type limitedTransport struct {
+	next http.RoundTripper
+	max  int64
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > t.max {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes from %s, limit %d", ErrResponseTooLarge, resp.ContentLength, req.URL.Host, t.max)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: t.max}
+	return resp, nil
+}
+
+// limitedBody fails reads beyond remaining bytes.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Allow the EOF of a body of exactly the limit.
+		var probe [1]byte
+		if n, err := b.ReadCloser.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
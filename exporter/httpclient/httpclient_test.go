@@ -0,0 +1,161 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew_MaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush() // no Content-Length
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		max     int64
+		wantErr bool
+	}{
+		{"under limit", "/", 200, false},
+		{"exact limit", "/chunked", 100, false},
+		{"content length over limit", "/", 50, true},
+		{"streamed over limit", "/chunked", 50, true},
+		{"unlimited", "/", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(Options{MaxResponseBytes: tt.max})
+			var body []byte
+			resp, err := client.Get(srv.URL + tt.path)
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("expected ErrResponseTooLarge, got %v", err)
+				}
+				return
+			}
+			if err != nil || len(body) != 100 {
+				t.Errorf("expected 100 bytes, got %d (err=%v)", len(body), err)
+			}
+		})
+	}
+}
+
+func TestNew_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := New(Options{Timeout: 20 * time.Millisecond})
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestNew_Proxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer direct.Close()
+
+	proxyURL, err := ParseProxy(strings.TrimPrefix(proxy.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(Options{Proxy: proxyURL, NoProxy: []string{"127.0.0.1"}})
+
+	resp, err := client.Get("http://pricing.example.com/offers/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	resp, err = client.Get(direct.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if len(proxied) != 1 || proxied[0] != "http://pricing.example.com/offers/index.json" {
+		t.Errorf("expected only the example.com request to be proxied, got %v", proxied)
+	}
+}
+
+func TestProxyFunc_NoProxy(t *testing.T) {
+	proxy := &url.URL{Scheme: "http", Host: "proxy:3128"}
+	fn := proxyFunc(proxy, []string{".internal.corp", "ec2instances.info"})
+	tests := []struct {
+		url  string
+		want *url.URL
+	}{
+		{"https://pricing.us-east-1.amazonaws.com/x", proxy},
+		{"https://ec2instances.info/instances.json", nil},
+		{"https://www.ec2instances.info/instances.json", nil},
+		{"https://mirror.internal.corp/x", nil},
+		{"https://internal.corp/x", nil},
+		{"https://notinternal.corp/x", proxy},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		got, _ := fn(req)
+		if got != tt.want {
+			t.Errorf("%s: got proxy %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNew_RootCAs(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if _, err := New(Options{}).Get(srv.URL); err == nil {
+		t.Fatal("expected certificate error without the CA bundle")
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, block, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := LoadCABundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := New(Options{RootCAs: pool}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the CA bundle to be trusted: %v", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestLoadCABundle_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCABundle(path); err == nil {
+		t.Error("expected error for a bundle without certificates")
+	}
+	if _, err := LoadCABundle(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("expected error for a missing bundle")
+	}
+}
@@ -0,0 +1,35 @@
+package exporter
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// labelInterner deduplicates label values. Providers decode the same
+// instance types, zones and descriptions once per product, so without it
+// every series kept by the gauges and the served prices holds its own copy.
+type labelInterner struct {
+	values map[string]string
+}
+
+// reset starts a new scrape, sized for the distinct values of the previous
+// one. Values only used by stale prices are dropped along the way.
+func (in *labelInterner) reset() {
+	in.values = make(map[string]string, len(in.values))
+}
+
+// intern returns the first value equal to s seen since the last reset.
+func (in *labelInterner) intern(s string) string {
+	if v, ok := in.values[s]; ok {
+		return v
+	}
+	if in.values == nil {
+		in.values = make(map[string]string)
+	}
+	in.values[s] = s
+	return s
+}
+
+// internLabels replaces the values of labels with their interned copies.
+func (in *labelInterner) internLabels(labels prometheus.Labels) {
+	for k, v := range labels {
+		labels[k] = in.intern(v)
+	}
+}
@@ -0,0 +1,190 @@
+// Package kube reads the Nodes of the Kubernetes cluster the exporter runs in
+// through the API server's REST API, authenticated with the pod's service
+// account.
+package kube
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/httpclient"
+)
+
+// Well-known node labels, with their deprecated beta fallbacks.
+const (
+	LabelInstanceType     = "node.kubernetes.io/instance-type"
+	LabelInstanceTypeBeta = "beta.kubernetes.io/instance-type"
+	LabelRegion           = "topology.kubernetes.io/region"
+	LabelRegionBeta       = "failure-domain.beta.kubernetes.io/region"
+	LabelZone             = "topology.kubernetes.io/zone"
+	LabelZoneBeta         = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// Node labels of the capacity type of a node or node group.
+const (
+	LabelKarpenterCapacityType = "karpenter.sh/capacity-type"            // "spot" or "on-demand"
+	LabelEKSCapacityType       = "eks.amazonaws.com/capacityType"        // "SPOT" or "ON_DEMAND"
+	LabelAKSPriority           = "kubernetes.azure.com/scalesetpriority" // "spot"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Node is the pricing-relevant part of a Kubernetes Node.
+type Node struct {
+	Name         string
+	Provider     string // "aws", "azure" or another providerID scheme; empty if unknown
+	InstanceType string
+	Region       string
+	Zone         string
+	Labels       map[string]string
+}
+
+// NodeLister lists the Nodes of a cluster.
+type NodeLister interface {
+	ListNodes(ctx context.Context) ([]Node, error)
+}
+
+// nodeList is a page of the core/v1 Node list API.
+type nodeList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			ProviderID string `json:"providerID"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// Client lists Nodes over the Kubernetes REST API.
+type Client struct {
+	client    *http.Client
+	baseURL   string // overridable for tests
+	tokenPath string // re-read on every request, bound tokens are rotated
+}
+
+// NewInClusterClient returns a Client for the API server of the cluster the
+// exporter runs in, using the pod's service account token and CA. opts
+// configures the HTTP client, e.g. its timeouts; its RootCAs are replaced by
+// the cluster CA.
+func NewInClusterClient(opts httpclient.Options) (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	caPEM, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in service account CA")
+	}
+	opts.RootCAs = pool
+	// The API server is always reached directly.
+	opts.Proxy = nil
+	opts.NoProxy = nil
+	return &Client{
+		client:    httpclient.New(opts),
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenPath: serviceAccountDir + "/token",
+	}, nil
+}
+
+// ListNodes returns all Nodes of the cluster.
+func (c *Client) ListNodes(ctx context.Context) ([]Node, error) {
+	var nodes []Node
+	next := ""
+	for {
+		query := url.Values{"limit": {"500"}}
+		if next != "" {
+			query.Set("continue", next)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/nodes?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		if c.tokenPath != "" {
+			token, err := os.ReadFile(c.tokenPath)
+			if err != nil {
+				return nil, fmt.Errorf("reading service account token: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("listing nodes: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("kubernetes API returned status %d listing nodes", resp.StatusCode)
+		}
+		var page nodeList
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding node list: %w", err)
+		}
+
+		for _, item := range page.Items {
+			labels := item.Metadata.Labels
+			nodes = append(nodes, Node{
+				Name:         item.Metadata.Name,
+				Provider:     providerOf(item.Spec.ProviderID),
+				InstanceType: label(labels, LabelInstanceType, LabelInstanceTypeBeta),
+				Region:       label(labels, LabelRegion, LabelRegionBeta),
+				Zone:         label(labels, LabelZone, LabelZoneBeta),
+				Labels:       labels,
+			})
+		}
+		next = page.Metadata.Continue
+		if next == "" {
+			return nodes, nil
+		}
+	}
+}
+
+// providerOf returns the scheme of a providerID, e.g. "aws" for
+// "aws:///us-east-1a/i-0123".
+func providerOf(providerID string) string {
+	scheme, _, ok := strings.Cut(providerID, "://")
+	if !ok {
+		return ""
+	}
+	return scheme
+}
+
+// Lifecycle returns the instance_lifecycle of a node from its capacity type
+// labels, "ondemand" if it has none.
+func Lifecycle(labels map[string]string) string {
+	switch {
+	case strings.EqualFold(labels[LabelKarpenterCapacityType], "spot"),
+		strings.EqualFold(labels[LabelEKSCapacityType], "spot"),
+		strings.EqualFold(labels[LabelAKSPriority], "spot"):
+		return "spot"
+	}
+	return "ondemand"
+}
+
+// label returns the first non-empty value of keys in labels.
+func label(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/httpclient"
+)
+
+func TestClient_ListNodes(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("tok\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/nodes" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("continue") == "" {
+			_, _ = w.Write([]byte(`{"metadata": {"continue": "page2"}, "items": [
+				{"metadata": {"name": "a", "labels": {"node.kubernetes.io/instance-type": "m5.large", "topology.kubernetes.io/region": "us-east-1", "topology.kubernetes.io/zone": "us-east-1a"}},
+				 "spec": {"providerID": "aws:///us-east-1a/i-0123"}}
+			]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"metadata": {}, "items": [
+			{"metadata": {"name": "b", "labels": {"beta.kubernetes.io/instance-type": "Standard_D2s_v5", "failure-domain.beta.kubernetes.io/region": "eastus"}},
+			 "spec": {"providerID": "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/b"}},
+			{"metadata": {"name": "c"}, "spec": {}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	client := &Client{client: srv.Client(), baseURL: srv.URL, tokenPath: tokenPath}
+	nodes, err := client.ListNodes(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes across both pages, got %d", len(nodes))
+	}
+	want := []Node{
+		{Name: "a", Provider: "aws", InstanceType: "m5.large", Region: "us-east-1", Zone: "us-east-1a"},
+		{Name: "b", Provider: "azure", InstanceType: "Standard_D2s_v5", Region: "eastus"},
+		{Name: "c"},
+	}
+	for i, w := range want {
+		got := nodes[i]
+		got.Labels = nil
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("node %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestClient_ListNodesError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	client := &Client{client: srv.Client(), baseURL: srv.URL}
+	if _, err := client.ListNodes(context.Background()); err == nil {
+		t.Error("expected error on 403")
+	}
+}
+
+func TestNewInClusterClient_OutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := NewInClusterClient(httpclient.Options{}); err == nil {
+		t.Error("expected error outside a cluster")
+	}
+}
@@ -0,0 +1,194 @@
+// Package kubecost writes the scraped on-demand prices in Kubecost's custom
+// pricing CSV format, to a local file or an S3 object, so Kubecost can price
+// nodes (CSV_PATH) where it can't reach the cloud pricing APIs itself.
+package kubecost
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	s3sdk "github.com/aws/aws-sdk-go-v2/service/s3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+)
+
+const (
+	// timestampFormat is the EndTimestamp layout Kubecost parses.
+	timestampFormat = "2006-01-02 15:04:05 UTC"
+	// instanceTypeField matches the rows to nodes by their instance type label.
+	instanceTypeField = "metadata.labels.node.kubernetes.io/instance-type"
+	// retryInterval is how often writing is retried until the first scrape.
+	retryInterval = time.Minute
+)
+
+var header = []string{"EndTimestamp", "InstanceID", "Region", "AssetClass", "InstanceIDField", "InstanceType", "MarketPriceHourly", "Version"}
+
+// PriceSource provides the written prices.
+type PriceSource interface {
+	Prices() *exporter.PriceIndex
+}
+
+// S3Putter wraps the call used to write the CSV to S3.
+type S3Putter interface {
+	PutObject(ctx context.Context, params *s3sdk.PutObjectInput, optFns ...func(*s3sdk.Options)) (*s3sdk.PutObjectOutput, error)
+}
+
+// Encode writes a node row per provider region and instance type with the
+// cheapest Linux on-demand (AWS) or consumption (Azure) price of the index.
+// Rows are sorted by region and instance type.
+func Encode(w io.Writer, index *exporter.PriceIndex, now time.Time) error {
+	type row struct {
+		region, instanceType string
+		price                float64
+	}
+	var rows []row
+	index.Each(func(q exporter.PriceQuery, price float64) {
+		if q.Zone != "" || q.Lifecycle != "ondemand" || (q.Provider != "aws" && q.Provider != "azure") {
+			return
+		}
+		rows = append(rows, row{q.Region, q.InstanceType, price})
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].region != rows[j].region {
+			return rows[i].region < rows[j].region
+		}
+		return rows[i].instanceType < rows[j].instanceType
+	})
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	end := now.UTC().Format(timestampFormat)
+	for _, r := range rows {
+		record := []string{end, "", r.region, "node", instanceTypeField, r.instanceType, strconv.FormatFloat(r.price, 'f', -1, 64), ""}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Writer periodically writes the prices of the last scrape to a destination.
+type Writer struct {
+	prices PriceSource
+	dest   string
+	bucket string
+	key    string
+	s3     S3Putter
+	now    func() time.Time
+}
+
+// NewWriter returns a Writer of prices to dest, a local file path or an
+// s3://bucket/key URL written with client (which may be nil for local paths).
+func NewWriter(prices PriceSource, dest string, client S3Putter) (*Writer, error) {
+	w := &Writer{prices: prices, dest: dest, now: time.Now}
+	bucket, key, isS3, err := ParseS3URL(dest)
+	if err != nil {
+		return nil, err
+	}
+	if isS3 {
+		if client == nil {
+			return nil, fmt.Errorf("no S3 client to write %s", dest)
+		}
+		w.bucket, w.key, w.s3 = bucket, key, client
+	}
+	return w, nil
+}
+
+// ParseS3URL splits an s3://bucket/key URL, isS3 is false for other paths.
+func ParseS3URL(dest string) (bucket, key string, isS3 bool, err error) {
+	if !strings.HasPrefix(dest, "s3://") {
+		return "", "", false, nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", "", true, fmt.Errorf("invalid S3 URL %q: %w", dest, err)
+	}
+	key = strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", true, fmt.Errorf("invalid S3 URL %q, expected s3://bucket/key", dest)
+	}
+	return u.Host, key, true, nil
+}
+
+// Run writes the prices every interval until ctx is cancelled. Until the
+// first scrape it retries every minute instead.
+func (w *Writer) Run(ctx context.Context, interval time.Duration) {
+	for {
+		wait := interval
+		written, err := w.Write(ctx)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to write Kubecost pricing CSV [dest=%s]", w.dest)
+		} else if !written {
+			log.Debug("No prices scraped yet, not writing Kubecost pricing CSV")
+			wait = min(interval, retryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Write writes the prices of the last scrape once, written is false before
+// the first scrape.
+func (w *Writer) Write(ctx context.Context) (written bool, err error) {
+	index := w.prices.Prices()
+	if index == nil {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, index, w.now()); err != nil {
+		return false, err
+	}
+	if w.s3 != nil {
+		_, err = w.s3.PutObject(ctx, &s3sdk.PutObjectInput{
+			Bucket:      &w.bucket,
+			Key:         &w.key,
+			Body:        bytes.NewReader(buf.Bytes()),
+			ContentType: awssdk.String("text/csv"),
+		})
+		if err != nil {
+			return false, fmt.Errorf("writing s3://%s/%s: %w", w.bucket, w.key, err)
+		}
+	} else if err := writeFile(w.dest, buf.Bytes()); err != nil {
+		return false, err
+	}
+	log.Debugf("Wrote Kubecost pricing CSV [dest=%s, bytes=%d]", w.dest, buf.Len())
+	return true, nil
+}
+
+// writeFile replaces path atomically, so readers never see a partial file.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,144 @@
+package kubecost
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	s3sdk "github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter"
+)
+
+type staticPrices struct {
+	index *exporter.PriceIndex
+}
+
+func (s staticPrices) Prices() *exporter.PriceIndex { return s.index }
+
+type fakeS3 struct {
+	input *s3sdk.PutObjectInput
+	body  []byte
+	err   error
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3sdk.PutObjectInput, optFns ...func(*s3sdk.Options)) (*s3sdk.PutObjectOutput, error) {
+	f.input = params
+	f.body, _ = io.ReadAll(params.Body)
+	return &s3sdk.PutObjectOutput{}, f.err
+}
+
+var testIndex = exporter.NewPriceIndex(map[exporter.PriceQuery]float64{
+	{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "ondemand"}: 0.096,
+	{Provider: "aws", Region: "us-east-1", Zone: "us-east-1a", InstanceType: "m5.large", Lifecycle: "spot"}:     0.035,
+	{Provider: "aws", Region: "eu-west-1", InstanceType: "c5.xlarge", Lifecycle: "ondemand"}:                    0.192,
+	{Provider: "azure", Region: "eastus", InstanceType: "Standard_D2s_v5", Lifecycle: "ondemand"}:               0.096,
+})
+
+const wantCSV = `EndTimestamp,InstanceID,Region,AssetClass,InstanceIDField,InstanceType,MarketPriceHourly,Version
+2024-05-01 12:00:00 UTC,,eastus,node,metadata.labels.node.kubernetes.io/instance-type,Standard_D2s_v5,0.096,
+2024-05-01 12:00:00 UTC,,eu-west-1,node,metadata.labels.node.kubernetes.io/instance-type,c5.xlarge,0.192,
+2024-05-01 12:00:00 UTC,,us-east-1,node,metadata.labels.node.kubernetes.io/instance-type,m5.large,0.096,
+`
+
+var testTime = time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testIndex, testTime); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != wantCSV {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", buf.String(), wantCSV)
+	}
+}
+
+func TestWriter_LocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.csv")
+	src := &staticPrices{}
+	w, err := NewWriter(src, path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.now = func() time.Time { return testTime }
+
+	written, err := w.Write(context.Background())
+	if err != nil || written {
+		t.Fatalf("expected nothing written before the first scrape, got %v, %v", written, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file before the first scrape, got %v", err)
+	}
+
+	src.index = testIndex
+	if written, err := w.Write(context.Background()); err != nil || !written {
+		t.Fatalf("expected the CSV to be written, got %v, %v", written, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	if string(data) != wantCSV {
+		t.Errorf("unexpected CSV:\n%s", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestWriter_S3(t *testing.T) {
+	client := &fakeS3{}
+	w, err := NewWriter(staticPrices{testIndex}, "s3://pricing-bucket/kubecost/pricing.csv", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.now = func() time.Time { return testTime }
+
+	if written, err := w.Write(context.Background()); err != nil || !written {
+		t.Fatalf("expected the CSV to be written, got %v, %v", written, err)
+	}
+	if *client.input.Bucket != "pricing-bucket" || *client.input.Key != "kubecost/pricing.csv" {
+		t.Errorf("unexpected destination s3://%s/%s", *client.input.Bucket, *client.input.Key)
+	}
+	if string(client.body) != wantCSV {
+		t.Errorf("unexpected CSV:\n%s", client.body)
+	}
+
+	client.err = errors.New("access denied")
+	if _, err := w.Write(context.Background()); err == nil {
+		t.Error("expected the S3 error to be returned")
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		dest        string
+		bucket, key string
+		isS3, err   bool
+	}{
+		{"/var/configs/pricing.csv", "", "", false, false},
+		{"s3://bucket/pricing.csv", "bucket", "pricing.csv", true, false},
+		{"s3://bucket/a/b.csv", "bucket", "a/b.csv", true, false},
+		{"s3://bucket", "", "", true, true},
+		{"s3://bucket/prefix/", "", "", true, true},
+		{"s3:///pricing.csv", "", "", true, true},
+	}
+	for _, tt := range tests {
+		bucket, key, isS3, err := ParseS3URL(tt.dest)
+		if bucket != tt.bucket || key != tt.key || isS3 != tt.isS3 || (err != nil) != tt.err {
+			t.Errorf("ParseS3URL(%q) = %q, %q, %v, %v", tt.dest, bucket, key, isS3, err)
+		}
+	}
+}
+
+func TestNewWriter_S3WithoutClient(t *testing.T) {
+	if _, err := NewWriter(staticPrices{}, "s3://bucket/pricing.csv", nil); err == nil {
+		t.Error("expected an error without an S3 client")
+	}
+}
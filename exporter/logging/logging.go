@@ -0,0 +1,155 @@
+// Package logging gives the noisy parts of the exporter loggers of their own,
+// so their level can be set apart from the global one (e.g. debug logs of
+// the AWS spot prices only) and the debug messages they log per price item
+// can be sampled.
+package logging
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Module is the logger of a part of the exporter. Its level is the one
+// configured for its name, else for the closest parent name ("aws" for
+// "aws.spot"), else the level of the standard logger.
+type Module struct {
+	*log.Entry
+	name    string
+	logger  *log.Logger
+	sampled atomic.Uint64 // calls of SampledDebugf
+}
+
+var (
+	mu          sync.Mutex
+	modules     []*Module
+	levels      map[string]log.Level // configured levels by module name
+	sampleEvery atomic.Uint64        // log 1 in sampleEvery sampled messages; 0 and 1 = all
+)
+
+// New returns the logger of the module name, e.g. "aws.spot". Modules are
+// declared as package variables, before Configure is called.
+func New(name string) *Module {
+	logger := log.New()
+	m := &Module{Entry: log.NewEntry(logger).WithField("module", name), name: name, logger: logger}
+	mu.Lock()
+	defer mu.Unlock()
+	modules = append(modules, m)
+	m.apply()
+	return m
+}
+
+// Configure sets the levels of the modules named in spec, comma separated
+// name=level pairs such as "aws.spot=debug,azure=warn", and has
+// SampledDebugf log one message in every (0 or 1 logs all). Modules log to
+// the output, with the formatter and hooks, of the standard logger, so it
+// must be set up first.
+func Configure(spec string, every uint64) error {
+	parsed, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	levels = parsed
+	sampleEvery.Store(every)
+	for _, m := range modules {
+		m.apply()
+	}
+	return nil
+}
+
+// ParseLevels parses comma separated name=level pairs of known modules or
+// their parents.
+func ParseLevels(spec string) (map[string]log.Level, error) {
+	parsed := make(map[string]log.Level)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("module log level %q is not of the form module=level", pair)
+		}
+		name = strings.TrimSpace(name)
+		if !known(name) {
+			return nil, fmt.Errorf("unknown log module %q. Available modules: %s", name, strings.Join(Names(), ", "))
+		}
+		level, err := log.ParseLevel(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("log level of module %q: %w", name, err)
+		}
+		parsed[name] = level
+	}
+	return parsed, nil
+}
+
+// Names returns the names of the modules and their parents, sorted.
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for _, m := range modules {
+		for name := m.name; name != ""; name = parent(name) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// known reports whether name is a module or the parent of one.
+func known(name string) bool {
+	return slices.Contains(Names(), name)
+}
+
+// parent returns the parent module name of name, "" for top-level modules.
+func parent(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// apply sets up the logger of m from the standard logger and the configured
+// levels. mu must be held.
+func (m *Module) apply() {
+	std := log.StandardLogger()
+	m.logger.SetOutput(std.Out)
+	m.logger.SetFormatter(std.Formatter)
+	m.logger.ReplaceHooks(std.Hooks)
+	m.logger.SetLevel(std.GetLevel())
+	for name := m.name; name != ""; name = parent(name) {
+		if level, ok := levels[name]; ok {
+			m.logger.SetLevel(level)
+			break
+		}
+	}
+}
+
+// SampledDebugf logs a debug message of a single price item, such as a price
+// or a skipped instance type. Only 1 in the configured number of such
+// messages of the module is logged, so debug logging stays usable when a
+// scrape handles hundreds of thousands of items.
+func (m *Module) SampledDebugf(format string, args ...interface{}) {
+	if !m.logger.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+	n := m.sampled.Add(1)
+	every := sampleEvery.Load()
+	if every <= 1 {
+		m.Debugf(format, args...)
+		return
+	}
+	if (n-1)%every == 0 {
+		m.WithField("sample_rate", every).Debugf(format, args...)
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	testSpot     = New("test.spot")
+	testOnDemand = New("test.ondemand")
+)
+
+// capture sends the standard logger and the modules to a buffer at level
+// until the test ends.
+func capture(t *testing.T, level log.Level) *bytes.Buffer {
+	t.Helper()
+	std := log.StandardLogger()
+	out, prevLevel := std.Out, std.GetLevel()
+	var buf bytes.Buffer
+	std.SetOutput(&buf)
+	std.SetLevel(level)
+	t.Cleanup(func() {
+		std.SetOutput(out)
+		std.SetLevel(prevLevel)
+		if err := Configure("", 1); err != nil {
+			t.Error(err)
+		}
+	})
+	return &buf
+}
+
+func TestConfigure_ModuleLevels(t *testing.T) {
+	buf := capture(t, log.InfoLevel)
+	if err := Configure("test.spot=debug", 1); err != nil {
+		t.Fatal(err)
+	}
+	testSpot.Debugf("spot debug")
+	testOnDemand.Debugf("ondemand debug")
+	testOnDemand.Infof("ondemand info")
+
+	out := buf.String()
+	if !strings.Contains(out, "spot debug") || !strings.Contains(out, "module=test.spot") {
+		t.Errorf("expected the debug message of test.spot, got %q", out)
+	}
+	if strings.Contains(out, "ondemand debug") {
+		t.Errorf("test.ondemand should follow the global info level, got %q", out)
+	}
+	if !strings.Contains(out, "ondemand info") {
+		t.Errorf("expected the info message of test.ondemand, got %q", out)
+	}
+}
+
+func TestConfigure_ParentLevel(t *testing.T) {
+	buf := capture(t, log.DebugLevel)
+	if err := Configure("test=warn,test.spot=debug", 1); err != nil {
+		t.Fatal(err)
+	}
+	testSpot.Debugf("spot debug")
+	testOnDemand.Infof("ondemand info")
+	testOnDemand.Warnf("ondemand warn")
+
+	out := buf.String()
+	if !strings.Contains(out, "spot debug") {
+		t.Errorf("test.spot=debug should override test=warn, got %q", out)
+	}
+	if strings.Contains(out, "ondemand info") || !strings.Contains(out, "ondemand warn") {
+		t.Errorf("test.ondemand should log at test's warn level, got %q", out)
+	}
+}
+
+func TestSampledDebugf(t *testing.T) {
+	buf := capture(t, log.DebugLevel)
+	if err := Configure("", 10); err != nil {
+		t.Fatal(err)
+	}
+	testSpot.sampled.Store(0)
+	for range 25 {
+		testSpot.SampledDebugf("price item")
+	}
+	if got := strings.Count(buf.String(), "price item"); got != 3 {
+		t.Errorf("expected 3 of 25 messages sampled 1 in 10, got %d", got)
+	}
+	if !strings.Contains(buf.String(), "sample_rate=10") {
+		t.Errorf("expected the sample rate on sampled messages, got %q", buf.String())
+	}
+}
+
+func TestSampledDebugf_Disabled(t *testing.T) {
+	buf := capture(t, log.InfoLevel)
+	testSpot.sampled.Store(0)
+	testSpot.SampledDebugf("price item")
+	if buf.Len() != 0 || testSpot.sampled.Load() != 0 {
+		t.Errorf("debug messages shouldn't be counted or logged at info level, got %q", buf.String())
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels(" test.spot = debug , test=error,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels["test.spot"] != log.DebugLevel || levels["test"] != log.ErrorLevel || len(levels) != 2 {
+		t.Errorf("unexpected levels: %v", levels)
+	}
+
+	for _, spec := range []string{"test.spot", "gcp=debug", "test.spot=loud"} {
+		if _, err := ParseLevels(spec); err == nil {
+			t.Errorf("ParseLevels(%q): expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+)
+
+// metricMapping changes the labels and values a pricing metric is exported
+// with. Prices are recorded (for stale serving, derived metrics, the price
+// index and notifications) before the mapping is applied.
+type metricMapping struct {
+	keep   map[string]bool // nil = all labels
+	rename map[string]string
+	scale  float64
+	set    map[string]float64 // values exported during the current scrape, by series
+}
+
+// WithMetricMappings exports the pricing metrics named in mappings with their
+// labels and values changed as described.
+func WithMetricMappings(mappings []config.MetricMapping) Option {
+	return func(e *Exporter) {
+		e.mappingConfig = mappings
+	}
+}
+
+// mapLabelNames returns the exported label names of a pricing metric with the
+// exported name fqName, and registers its mapping if it has one. Invalid
+// mappings are reported by NewExporter.
+func (e *Exporter) mapLabelNames(name, fqName string, labels []string) []string {
+	for _, cfg := range e.mappingConfig {
+		if cfg.Metric != fqName {
+			continue
+		}
+		m := &metricMapping{rename: cfg.Rename, scale: cfg.Scale}
+		if m.scale == 0 {
+			m.scale = 1
+		}
+		known := make(map[string]bool, len(labels))
+		for _, label := range labels {
+			known[label] = true
+		}
+		if len(cfg.Labels) > 0 {
+			m.keep = make(map[string]bool, len(cfg.Labels))
+			for _, label := range cfg.Labels {
+				if !known[label] {
+					e.mappingErr = fmt.Errorf("metric mapping of %q keeps unknown label %q", fqName, label)
+					return labels
+				}
+				m.keep[label] = true
+			}
+		}
+		for from := range cfg.Rename {
+			if !known[from] {
+				e.mappingErr = fmt.Errorf("metric mapping of %q renames unknown label %q", fqName, from)
+				return labels
+			}
+		}
+
+		mapped := make([]string, 0, len(labels))
+		seen := make(map[string]bool, len(labels))
+		for _, label := range labels {
+			if !m.keeps(label) {
+				continue
+			}
+			out := m.labelName(label)
+			if seen[out] {
+				e.mappingErr = fmt.Errorf("metric mapping of %q exports label %q twice", fqName, out)
+				return labels
+			}
+			seen[out] = true
+			mapped = append(mapped, out)
+		}
+		if e.mappings == nil {
+			e.mappings = make(map[string]*metricMapping)
+		}
+		e.mappings[name] = m
+		return mapped
+	}
+	return labels
+}
+
+// keeps reports whether a label is exported. The currency label is always
+// kept, since each currency is a series of its own.
+func (m *metricMapping) keeps(label string) bool {
+	return m.keep == nil || m.keep[label] || label == "currency"
+}
+
+// labelName returns the exported name of a label.
+func (m *metricMapping) labelName(label string) string {
+	if to, ok := m.rename[label]; ok {
+		return to
+	}
+	return label
+}
+
+// export sets the series of a pricing metric to value, applying its mapping.
+// Series that become identical because labels were dropped are exported with
+// the lowest value.
+func (e *Exporter) export(name string, labels prometheus.Labels, value float64) {
+	m := e.mappings[name]
+	if m == nil {
+		e.pricingMetrics[name].WithLabelValues(e.orderedValues(name, labels)...).Set(value)
+		return
+	}
+	mapped := make(prometheus.Labels, len(labels))
+	for label, v := range labels {
+		if !m.keeps(label) {
+			continue
+		}
+		mapped[m.labelName(label)] = v
+	}
+	id := seriesID(name, mapped)
+	if prev, ok := m.set[id]; ok && prev <= value {
+		return
+	}
+	if m.set == nil {
+		m.set = make(map[string]float64)
+	}
+	m.set[id] = value
+	e.pricingMetrics[name].WithLabelValues(e.orderedValues(name, mapped)...).Set(value)
+}
+
+// orderedValues returns the values of labels in the order of the exported
+// label names of the pricing metric name, so the series is looked up without
+// matching label names. Missing labels are empty. The slice is reused by the
+// next call.
+func (e *Exporter) orderedValues(name string, labels prometheus.Labels) []string {
+	e.valueBuf = e.valueBuf[:0]
+	for _, label := range e.labelOrder[name] {
+		e.valueBuf = append(e.valueBuf, labels[label])
+	}
+	return e.valueBuf
+}
@@ -0,0 +1,158 @@
+// Package metadata detects the cloud provider, region and availability zone
+// of the VM the exporter runs on from the instance metadata services of AWS
+// (IMDSv2) and Azure.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEndpoint = "http://169.254.169.254"
+	// Timeout bounds a detection, the metadata services answer within
+	// milliseconds on a VM and are unreachable elsewhere.
+	Timeout = 2 * time.Second
+)
+
+// Location is where the exporter runs.
+type Location struct {
+	Provider string // "aws" or "azure"
+	Region   string // e.g. "eu-west-1" or "westeurope"
+	Zone     string // e.g. "eu-west-1a" or "westeurope-1"; empty if not zonal
+}
+
+// Detector queries the instance metadata services.
+type Detector struct {
+	client   *http.Client
+	endpoint string // overridable for tests
+}
+
+// NewDetector returns a Detector. Metadata requests never use a proxy.
+func NewDetector() *Detector {
+	return &Detector{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Timeout: Timeout}).DialContext,
+			},
+			Timeout: Timeout,
+		},
+		endpoint: defaultEndpoint,
+	}
+}
+
+// Detect queries the AWS and Azure metadata services concurrently and returns
+// the location reported by the one that answers.
+func (d *Detector) Detect(ctx context.Context) (Location, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	type result struct {
+		loc Location
+		err error
+	}
+	results := make(chan result, 2)
+	go func() {
+		loc, err := d.detectAWS(ctx)
+		results <- result{loc, err}
+	}()
+	go func() {
+		loc, err := d.detectAzure(ctx)
+		results <- result{loc, err}
+	}()
+	var errs []error
+	for range 2 {
+		r := <-results
+		if r.err == nil {
+			return r.loc, nil
+		}
+		errs = append(errs, r.err)
+	}
+	return Location{}, fmt.Errorf("no instance metadata service found: %w", errors.Join(errs...))
+}
+
+// detectAWS reads the placement of an EC2 instance through IMDSv2.
+func (d *Detector) detectAWS(ctx context.Context) (Location, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, d.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Location{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := d.get(req)
+	if err != nil {
+		return Location{}, fmt.Errorf("aws: requesting IMDSv2 token: %w", err)
+	}
+
+	placement := func(path string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/latest/meta-data/placement/"+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		return d.get(req)
+	}
+	loc := Location{Provider: "aws"}
+	if loc.Region, err = placement("region"); err != nil {
+		return Location{}, fmt.Errorf("aws: reading region: %w", err)
+	}
+	if loc.Zone, err = placement("availability-zone"); err != nil {
+		return Location{}, fmt.Errorf("aws: reading availability zone: %w", err)
+	}
+	return loc, nil
+}
+
+// detectAzure reads the location of an Azure VM.
+func (d *Detector) detectAzure(ctx context.Context) (Location, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/metadata/instance/compute?api-version=2021-02-01", nil)
+	if err != nil {
+		return Location{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := d.get(req)
+	if err != nil {
+		return Location{}, fmt.Errorf("azure: reading instance metadata: %w", err)
+	}
+	var compute struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+	if err := json.Unmarshal([]byte(body), &compute); err != nil {
+		return Location{}, fmt.Errorf("azure: decoding instance metadata: %w", err)
+	}
+	if compute.Location == "" {
+		return Location{}, errors.New("azure: instance metadata has no location")
+	}
+	loc := Location{Provider: "azure", Region: compute.Location}
+	if compute.Zone != "" {
+		loc.Zone = compute.Location + "-" + compute.Zone
+	}
+	return loc, nil
+}
+
+// get sends req and returns its trimmed body, failing on non-200 responses.
+func (d *Detector) get(req *http.Request) (string, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	value := strings.TrimSpace(string(body))
+	if value == "" {
+		return "", errors.New("empty response")
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestDetector(t *testing.T, handler http.HandlerFunc) *Detector {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	d := NewDetector()
+	d.endpoint = srv.URL
+	return d
+}
+
+func TestDetect_AWS(t *testing.T) {
+	d := newTestDetector(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte("token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte("eu-west-1"))
+		case r.URL.Path == "/latest/meta-data/placement/availability-zone":
+			_, _ = w.Write([]byte("eu-west-1b"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	loc, err := d.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if want := (Location{"aws", "eu-west-1", "eu-west-1b"}); loc != want {
+		t.Errorf("Detect() = %+v, want %+v", loc, want)
+	}
+}
+
+func TestDetect_Azure(t *testing.T) {
+	d := newTestDetector(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"location":"westeurope","zone":"2","vmSize":"Standard_D2s_v5"}`))
+	})
+	loc, err := d.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if want := (Location{"azure", "westeurope", "westeurope-2"}); loc != want {
+		t.Errorf("Detect() = %+v, want %+v", loc, want)
+	}
+}
+
+func TestDetect_NotOnCloud(t *testing.T) {
+	d := newTestDetector(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if loc, err := d.Detect(context.Background()); err == nil {
+		t.Errorf("Detect() = %+v, want error", loc)
+	}
+}
@@ -4,18 +4,23 @@ import (
 	"context"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
 )
 
 // mockEC2Client implements aws.EC2Client for testing.
 type mockEC2Client struct {
-	DescribeSpotPriceHistoryFn  func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error)
-	DescribeAvailabilityZonesFn func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+	DescribeSpotPriceHistoryFn      func(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error)
+	DescribeAvailabilityZonesFn     func(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+	DescribeInstanceTypeOfferingsFn func(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error)
+	DescribeInstanceTypesFn         func(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
 }
 
 func (m *mockEC2Client) DescribeSpotPriceHistory(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
@@ -26,6 +31,14 @@ func (m *mockEC2Client) DescribeAvailabilityZones(ctx context.Context, params *e
 	return m.DescribeAvailabilityZonesFn(ctx, params, optFns...)
 }
 
+func (m *mockEC2Client) DescribeInstanceTypeOfferings(ctx context.Context, params *ec2.DescribeInstanceTypeOfferingsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+	return m.DescribeInstanceTypeOfferingsFn(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	return m.DescribeInstanceTypesFn(ctx, params, optFns...)
+}
+
 // mockSavingsPlansClient implements aws.SavingsPlansAPI for testing.
 type mockSavingsPlansClient struct {
 	DescribeSavingsPlansOfferingRatesFn func(ctx context.Context, params *savingsplans.DescribeSavingsPlansOfferingRatesInput, optFns ...func(*savingsplans.Options)) (*savingsplans.DescribeSavingsPlansOfferingRatesOutput, error)
@@ -35,12 +48,27 @@ func (m *mockSavingsPlansClient) DescribeSavingsPlansOfferingRates(ctx context.C
 	return m.DescribeSavingsPlansOfferingRatesFn(ctx, params, optFns...)
 }
 
+// mockPricingClient implements aws.PricingAPI for testing.
+type mockPricingClient struct {
+	GetProductsFn func(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error)
+}
+
+func (m *mockPricingClient) GetProducts(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+	return m.GetProductsFn(ctx, params, optFns...)
+}
+
 // mockClientFactory implements aws.ClientFactory for testing.
 type mockClientFactory struct {
 	ec2Client aws.EC2Client
 	ec2Err    error
 	spClient  aws.SavingsPlansAPI
 	spErr     error
+	s3Client  aws.S3API
+	s3Err     error
+	prClient  aws.PricingAPI
+	prErr     error
+	ceClient  aws.CostExplorerAPI
+	ceErr     error
 }
 
 func (f *mockClientFactory) NewEC2Client(region string) (aws.EC2Client, error) {
@@ -51,27 +79,73 @@ func (f *mockClientFactory) NewSavingsPlansClient() (aws.SavingsPlansAPI, error)
 	return f.spClient, f.spErr
 }
 
+func (f *mockClientFactory) NewS3Client(region string) (aws.S3API, error) {
+	return f.s3Client, f.s3Err
+}
+
+func (f *mockClientFactory) NewPricingClient() (aws.PricingAPI, error) {
+	return f.prClient, f.prErr
+}
+
+func (f *mockClientFactory) NewCostExplorerClient() (aws.CostExplorerAPI, error) {
+	return f.ceClient, f.ceErr
+}
+
+// mockCostExplorerClient implements aws.CostExplorerAPI for testing.
+type mockCostExplorerClient struct {
+	GetCostAndUsageFn func(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+}
+
+func (m *mockCostExplorerClient) GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	return m.GetCostAndUsageFn(ctx, params, optFns...)
+}
+
 // mockAzureRetailPricesClient implements azure.RetailPricesClient for testing.
 type mockAzureRetailPricesClient struct {
-	GetVMPricesFn func(ctx context.Context, region string, osTypes []string) ([]azure.RetailPriceItem, error)
+	GetVMPricesFn func(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error)
+	GetPricesFn   func(ctx context.Context, filter string) ([]azure.RetailPriceItem, error)
 }
 
-func (m *mockAzureRetailPricesClient) GetVMPrices(ctx context.Context, region string, osTypes []string) ([]azure.RetailPriceItem, error) {
+func (m *mockAzureRetailPricesClient) GetVMPrices(ctx context.Context, region string, query azure.VMPriceQuery) ([]azure.RetailPriceItem, error) {
 	if m.GetVMPricesFn != nil {
-		return m.GetVMPricesFn(ctx, region, osTypes)
+		return m.GetVMPricesFn(ctx, region, query)
+	}
+	return nil, nil
+}
+
+func (m *mockAzureRetailPricesClient) GetPrices(ctx context.Context, filter string) ([]azure.RetailPriceItem, error) {
+	if m.GetPricesFn != nil {
+		return m.GetPricesFn(ctx, filter)
 	}
 	return nil, nil
 }
 
 // mockAzureClientFactory implements azure.ClientFactory for testing.
 type mockAzureClientFactory struct {
-	client azure.RetailPricesClient
+	client    azure.RetailPricesClient
+	skuClient azure.ResourceSKUsClient
 }
 
 func (f *mockAzureClientFactory) NewRetailPricesClient() azure.RetailPricesClient {
 	return f.client
 }
 
+func (f *mockAzureClientFactory) NewResourceSKUsClient() azure.ResourceSKUsClient {
+	return f.skuClient
+}
+
+// mockNodeLister implements kube.NodeLister for testing.
+type mockNodeLister struct {
+	ListNodesFn func(ctx context.Context) ([]kube.Node, error)
+}
+
+func (m *mockNodeLister) ListNodes(ctx context.Context) ([]kube.Node, error) {
+	if m.ListNodesFn != nil {
+		return m.ListNodesFn(ctx)
+	}
+	return nil, nil
+}
+
 // newTestExporter creates an Exporter with pre-populated instances for testing,
 // bypassing the NewExporter constructor (which calls InstanceStore.Load via the factory).
 func newTestExporter(factory aws.ClientFactory, opts ...func(*Exporter)) *Exporter {
@@ -83,6 +157,7 @@ func newTestExporter(factory aws.ClientFactory, opts ...func(*Exporter)) *Export
 		cache:               0,
 		clientFactory:       factory,
 		instances:           newTestInstanceStore(),
+		precision:           -1,
 		nextScrape:          time.Now(),
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: "aws_pricing",
@@ -99,6 +174,11 @@ func newTestExporter(factory aws.ClientFactory, opts ...func(*Exporter)) *Export
 			Name:      "scrape_error",
 			Help:      "The scrape error status.",
 		}),
+		stale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "cloud_pricing",
+			Name:      "stale",
+			Help:      "Whether the last scrape of the region failed and its previous prices are served (1) or not (0).",
+		}, []string{"provider", "region"}),
 	}
 	for _, opt := range opts {
 		opt(e)
@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nodeCostLabels are the labels of cloud_pricing_node_hourly_cost. The
+// label_* labels repeat instance_type, region and lifecycle under the names
+// kube-state-metrics gives the well-known node labels in kube_node_labels,
+// so both can be joined without label_replace.
+var nodeCostLabels = []string{
+	"provider", "instance_type", "region", "lifecycle",
+	"label_node_kubernetes_io_instance_type",
+	"label_topology_kubernetes_io_region",
+	"label_karpenter_sh_capacity_type",
+}
+
+// karpenterCapacityTypes maps instance lifecycles to the values of the
+// karpenter.sh/capacity-type node label.
+var karpenterCapacityTypes = map[string]string{
+	"ondemand": "on-demand",
+	"spot":     "spot",
+}
+
+// initNodeCostGauge creates the cloud_pricing_node_hourly_cost gauge.
+func (e *Exporter) initNodeCostGauge() {
+	e.newPricingMetric("node_hourly_cost", prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "node_hourly_cost",
+		Help:      "Hourly cost of a node of the instance type (cheapest Linux price of its region), labelled for joins with kube_node_labels.",
+	}, e.priceLabels(nodeCostLabels...))
+}
+
+// setNodeCostMetrics sets cloud_pricing_node_hourly_cost from the prices
+// collected for the OpenCost metric set.
+func (e *Exporter) setNodeCostMetrics(prices map[openCostKey]openCostPrice) {
+	for key, price := range prices {
+		labels := prometheus.Labels{
+			"provider":                               key.provider,
+			"instance_type":                          key.instanceType,
+			"region":                                 key.region,
+			"lifecycle":                              key.lifecycle,
+			"label_node_kubernetes_io_instance_type": key.instanceType,
+			"label_topology_kubernetes_io_region":    key.region,
+			"label_karpenter_sh_capacity_type":       karpenterCapacityTypes[key.lifecycle],
+		}
+		e.recordPrice(key.region, "node_hourly_cost", labels, price.total)
+		e.setPrice("node_hourly_cost", labels, price.total)
+	}
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// applyClusterNodes restricts the scrape to the regions, zones and instance
+// types of the cluster's AWS and Azure Nodes. When listing fails the previous
+// restriction is kept, or none before the first successful listing.
+func (e *Exporter) applyClusterNodes(ctx context.Context) {
+	if e.nodeLister == nil {
+		return
+	}
+	nodes, err := e.nodeLister.ListNodes(ctx)
+	if err != nil {
+		log.WithError(err).Error("error while listing cluster nodes, keeping the previous node restriction")
+		atomic.AddUint64(&e.errorCount, 1)
+		return
+	}
+	if e.baseFilter == nil {
+		base := e.instanceFilter
+		e.baseFilter = &base
+	}
+
+	regions := make(map[regionKey]bool)
+	var awsTypes, awsZones, azureTypes []string
+	allAWSTypes, allAWSZones, allAzureTypes := false, false, false
+	for _, node := range nodes {
+		if node.Region == "" || (node.Provider != "aws" && node.Provider != "azure") {
+			continue
+		}
+		regions[regionKey{node.Provider, node.Region}] = true
+		switch node.Provider {
+		case "aws":
+			// Without the label the node's type or zone is unknown, so that
+			// dimension can't be restricted.
+			allAWSTypes = allAWSTypes || node.InstanceType == ""
+			allAWSZones = allAWSZones || node.Zone == ""
+			awsTypes = appendUnique(awsTypes, node.InstanceType)
+			awsZones = appendUnique(awsZones, node.Zone)
+		case "azure":
+			allAzureTypes = allAzureTypes || node.InstanceType == ""
+			azureTypes = appendUnique(azureTypes, node.InstanceType)
+		}
+	}
+	if len(regions) == 0 {
+		log.Warnf("none of the %d cluster nodes runs on AWS or Azure, skipping all regions", len(nodes))
+	}
+
+	// The cluster's types and zones narrow the configured filters. Empty
+	// lists mean all types or zones, so if no type or zone of the cluster
+	// passes them there's nothing to scrape on AWS.
+	filter := *e.baseFilter
+	awsNone := false
+	if !allAWSTypes && len(awsTypes) > 0 {
+		awsTypes = slices.DeleteFunc(awsTypes, func(t string) bool { return !filter.MatchName(t) })
+		awsNone = len(awsTypes) == 0
+		filter.InstanceTypes = awsTypes
+	}
+	if !allAWSZones && len(awsZones) > 0 {
+		awsZones = slices.DeleteFunc(awsZones, func(az string) bool { return !filter.MatchZone(az) })
+		awsNone = awsNone || len(awsZones) == 0
+		filter.AvailabilityZones = awsZones
+	}
+	if awsNone {
+		log.Warn("none of the instance types or zones of the cluster's AWS nodes pass the configured filters, skipping all AWS regions")
+		maps.DeleteFunc(regions, func(key regionKey, _ bool) bool { return key.provider == "aws" })
+	}
+	e.instanceFilter = filter
+	e.azureInstanceTypes = nil
+	if !allAzureTypes {
+		e.azureInstanceTypes = azureTypes
+	}
+	e.clusterRegions = regions
+	e.clusterNodes = nodes
+	log.Debugf("restricted scrape to cluster nodes [nodes=%d, regions=%d, aws_types=%v, aws_zones=%v, azure_types=%v]", len(nodes), len(regions), filter.InstanceTypes, filter.AvailabilityZones, e.azureInstanceTypes)
+}
+
+// inCluster reports whether the cluster has nodes in the region, or true
+// when the scrape isn't restricted to cluster nodes.
+func (e *Exporter) inCluster(key regionKey) bool {
+	return e.clusterRegions == nil || e.clusterRegions[key]
+}
+
+// awsScrapeRegions returns the AWS regions scraped this time.
+func (e *Exporter) awsScrapeRegions() []string {
+	if e.clusterRegions == nil {
+		return e.regions
+	}
+	regions := make([]string, 0, len(e.regions))
+	for _, region := range e.regions {
+		if e.inCluster(regionKey{"aws", region}) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// appendUnique appends v to s unless it's empty or already in s.
+func appendUnique(s []string, v string) []string {
+	if v == "" || slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
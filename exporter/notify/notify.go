@@ -0,0 +1,176 @@
+// Package notify delivers price changes detected between scrapes to
+// external receivers such as webhooks, Alertmanager and Slack.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Webhook payload formats.
+const (
+	FormatJSON         = "json"
+	FormatAlertmanager = "alertmanager"
+	FormatSlack        = "slack"
+)
+
+// Change is a price that changed between two scrapes.
+type Change struct {
+	Metric        string            `json:"metric"`         // exported metric name, e.g. "aws_pricing_ec2"
+	Labels        map[string]string `json:"labels"`         // labels of the series, empty ones omitted
+	OldPrice      float64           `json:"old_price"`      // USD per hour
+	NewPrice      float64           `json:"new_price"`      // USD per hour
+	ChangePercent float64           `json:"change_percent"` // relative to OldPrice, negative for drops
+}
+
+// Notifier delivers the price changes of a scrape.
+type Notifier interface {
+	Notify(ctx context.Context, changes []Change) error
+}
+
+// jsonPayload is the body of FormatJSON webhooks.
+type jsonPayload struct {
+	Time             time.Time `json:"time"`
+	ThresholdPercent float64   `json:"threshold_percent"`
+	Changes          []Change  `json:"changes"`
+}
+
+// alert is an alert of the Alertmanager v2 API.
+type alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+// Webhook POSTs price changes to a URL.
+type Webhook struct {
+	url       string
+	format    string
+	threshold float64
+	client    *http.Client
+	now       func() time.Time // overridable for tests
+}
+
+// NewWebhook returns a Webhook posting to rawURL in format. threshold is the
+// change percentage that triggered notifications, included in the payload.
+// client defaults to http.DefaultClient.
+func NewWebhook(rawURL, format string, threshold float64, client *http.Client) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		// The URL isn't quoted, it may hold a token.
+		return nil, errors.New("invalid webhook URL: must be an http or https URL with a host")
+	}
+	switch format {
+	case FormatJSON, FormatAlertmanager, FormatSlack:
+	default:
+		return nil, fmt.Errorf("invalid webhook format %q: must be %s, %s or %s", format, FormatJSON, FormatAlertmanager, FormatSlack)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Webhook{url: rawURL, format: format, threshold: threshold, client: client, now: time.Now}, nil
+}
+
+// Notify posts changes in a single request.
+func (w *Webhook) Notify(ctx context.Context, changes []Change) error {
+	var payload any
+	switch w.format {
+	case FormatAlertmanager:
+		payload = w.alerts(changes)
+	case FormatSlack:
+		payload = w.slackMessage(changes)
+	default:
+		payload = jsonPayload{Time: w.now().UTC(), ThresholdPercent: w.threshold, Changes: changes}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding webhook payload: %w", err)
+	}
+	return post(ctx, w.client, w.url, body)
+}
+
+// alerts returns an alert per change. Alertmanager resolves them after its
+// resolve_timeout as they aren't sent again.
+func (w *Webhook) alerts(changes []Change) []alert {
+	now := w.now().UTC()
+	alerts := make([]alert, 0, len(changes))
+	for _, c := range changes {
+		labels := map[string]string{"alertname": "CloudPriceChange", "metric": c.Metric}
+		for k, v := range c.Labels {
+			labels[k] = v
+		}
+		alerts = append(alerts, alert{
+			Labels: labels,
+			Annotations: map[string]string{
+				"summary":        Summary(c),
+				"old_price":      strconv.FormatFloat(c.OldPrice, 'f', -1, 64),
+				"new_price":      strconv.FormatFloat(c.NewPrice, 'f', -1, 64),
+				"change_percent": strconv.FormatFloat(c.ChangePercent, 'f', 1, 64),
+			},
+			StartsAt: now,
+		})
+	}
+	return alerts
+}
+
+// Summary describes a change in one line, e.g. "m5.large spot in eu-west-1a
+// jumped 40.0% (0.03 -> 0.042 USD/h)".
+func Summary(c Change) string {
+	subject := c.Labels["instance_type"]
+	if subject == "" {
+		subject = c.Metric
+	}
+	if lifecycle := c.Labels["instance_lifecycle"]; lifecycle != "" {
+		subject += " " + lifecycle
+	}
+	if where := c.Labels["availability_zone"]; where != "" {
+		subject += " in " + where
+	} else if where := c.Labels["region"]; where != "" {
+		subject += " in " + where
+	}
+	verb := "jumped"
+	if c.ChangePercent < 0 {
+		verb = "dropped"
+	}
+	return fmt.Sprintf("%s %s %.1f%% (%g -> %g USD/h)", subject, verb, math.Abs(c.ChangePercent), c.OldPrice, c.NewPrice)
+}
+
+// post sends a JSON body, failing on non-2xx responses. Its errors don't
+// include webhookURL, which is the credential of webhooks with a token in the
+// path such as Slack's.
+func post(ctx context.Context, client *http.Client, webhookURL string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", withoutURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting webhook: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// withoutURL returns the cause of err if it's a *url.Error, whose message
+// includes the URL.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
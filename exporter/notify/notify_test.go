@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testChange = Change{
+	Metric:        "aws_pricing_ec2",
+	Labels:        map[string]string{"instance_type": "m5.large", "instance_lifecycle": "spot", "region": "eu-west-1", "availability_zone": "eu-west-1a"},
+	OldPrice:      0.03,
+	NewPrice:      0.042,
+	ChangePercent: 40,
+}
+
+func newTestWebhook(t *testing.T, format string, handler http.HandlerFunc) *Webhook {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	w, err := NewWebhook(srv.URL+"/hook", format, 20, srv.Client())
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	w.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return w
+}
+
+func TestWebhook_JSON(t *testing.T) {
+	var got jsonPayload
+	w := newTestWebhook(t, FormatJSON, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/hook" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+	})
+	if err := w.Notify(context.Background(), []Change{testChange}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got.ThresholdPercent != 20 || len(got.Changes) != 1 || got.Changes[0].NewPrice != 0.042 || got.Changes[0].Labels["instance_type"] != "m5.large" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestWebhook_Alertmanager(t *testing.T) {
+	var got []alert
+	w := newTestWebhook(t, FormatAlertmanager, func(rw http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+	})
+	if err := w.Notify(context.Background(), []Change{testChange}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(got))
+	}
+	a := got[0]
+	if a.Labels["alertname"] != "CloudPriceChange" || a.Labels["metric"] != "aws_pricing_ec2" || a.Labels["availability_zone"] != "eu-west-1a" {
+		t.Errorf("labels = %v", a.Labels)
+	}
+	if a.Annotations["old_price"] != "0.03" || a.Annotations["new_price"] != "0.042" || a.Annotations["change_percent"] != "40.0" {
+		t.Errorf("annotations = %v", a.Annotations)
+	}
+	if !a.StartsAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("startsAt = %v", a.StartsAt)
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	w := newTestWebhook(t, FormatJSON, func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	})
+	if err := w.Notify(context.Background(), []Change{testChange}); err == nil {
+		t.Error("expected an error for a 502 response")
+	}
+}
+
+func TestWebhook_ErrorOmitsURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	hookURL := srv.URL + "/services/T000/B000/secret-token"
+	srv.Close()
+	w, err := NewWebhook(hookURL, FormatSlack, 20, nil)
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	err = w.Notify(context.Background(), []Change{testChange})
+	if err == nil {
+		t.Fatal("expected an error for an unreachable webhook")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error leaks the webhook URL: %v", err)
+	}
+	if _, err := NewWebhook("ftp://example.com/secret-token", FormatJSON, 10, nil); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("expected an error without the URL, got %v", err)
+	}
+}
+
+func TestNewWebhook_Invalid(t *testing.T) {
+	if _, err := NewWebhook("ftp://example.com", FormatJSON, 10, nil); err == nil {
+		t.Error("expected an error for a non-HTTP URL")
+	}
+	if _, err := NewWebhook("https://example.com", "xml", 10, nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	if got, want := Summary(testChange), "m5.large spot in eu-west-1a jumped 40.0% (0.03 -> 0.042 USD/h)"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	drop := Change{Metric: "azure_pricing_vm", Labels: map[string]string{"instance_type": "Standard_D2s_v5", "region": "eastus"}, OldPrice: 0.1, NewPrice: 0.05, ChangePercent: -50}
+	if got, want := Summary(drop), "Standard_D2s_v5 in eastus dropped 50.0% (0.1 -> 0.05 USD/h)"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
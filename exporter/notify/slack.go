@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxSlackLines bounds the changes listed in a Slack message, the rest are
+// counted in its last line.
+const maxSlackLines = 50
+
+// slackPayload is the body of a Slack incoming webhook message.
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// slackMessage returns the FormatSlack message of changes: a heading and one
+// Summary per change, biggest changes first.
+func (w *Webhook) slackMessage(changes []Change) slackPayload {
+	sorted := make([]Change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i].ChangePercent) > math.Abs(sorted[j].ChangePercent)
+	})
+
+	var b strings.Builder
+	noun := "prices"
+	if len(changes) == 1 {
+		noun = "price"
+	}
+	fmt.Fprintf(&b, "*%d cloud %s changed by %g%% or more*", len(changes), noun, w.threshold)
+	for i, c := range sorted {
+		if i == maxSlackLines {
+			fmt.Fprintf(&b, "\n…and %d more", len(sorted)-maxSlackLines)
+			break
+		}
+		icon := ":chart_with_upwards_trend:"
+		if c.ChangePercent < 0 {
+			icon = ":chart_with_downwards_trend:"
+		}
+		fmt.Fprintf(&b, "\n%s %s", icon, Summary(c))
+	}
+	return slackPayload{Text: b.String()}
+}
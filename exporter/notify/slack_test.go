@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebhook_Slack(t *testing.T) {
+	var got slackPayload
+	w := newTestWebhook(t, FormatSlack, func(rw http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+	})
+	drop := Change{Metric: "azure_pricing_vm", Labels: map[string]string{"instance_type": "Standard_D2s_v5", "region": "eastus"}, OldPrice: 0.1, NewPrice: 0.05, ChangePercent: -50}
+	if err := w.Notify(context.Background(), []Change{testChange, drop}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	want := "*2 cloud prices changed by 20% or more*\n" +
+		":chart_with_downwards_trend: Standard_D2s_v5 in eastus dropped 50.0% (0.1 -> 0.05 USD/h)\n" +
+		":chart_with_upwards_trend: m5.large spot in eu-west-1a jumped 40.0% (0.03 -> 0.042 USD/h)"
+	if got.Text != want {
+		t.Errorf("text = %q, want %q", got.Text, want)
+	}
+}
+
+func TestSlackMessage_Truncated(t *testing.T) {
+	w := &Webhook{threshold: 10}
+	var changes []Change
+	for i := range maxSlackLines + 5 {
+		changes = append(changes, Change{Metric: "aws_pricing_ec2", Labels: map[string]string{"instance_type": fmt.Sprintf("t%d", i)}, OldPrice: 1, NewPrice: 2, ChangePercent: 100})
+	}
+	text := w.slackMessage(changes).Text
+	if lines := strings.Count(text, "\n"); lines != maxSlackLines+1 {
+		t.Errorf("got %d lines after the heading, want %d", lines, maxSlackLines+1)
+	}
+	if !strings.HasSuffix(text, "…and 5 more") {
+		t.Errorf("expected the omitted changes to be counted, got %q", text[len(text)-40:])
+	}
+}
@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+)
+
+// Metric formats.
+const (
+	MetricsFormatNative   = "native"
+	MetricsFormatOpenCost = "opencost"
+	MetricsFormatBoth     = "both"
+)
+
+// openCostMetrics maps the internal pricing metric names of the OpenCost
+// metric set to their exported names.
+var openCostMetrics = map[string]string{
+	"opencost_node_total": "node_total_hourly_cost",
+	"opencost_node_cpu":   "node_cpu_hourly_cost",
+	"opencost_node_ram":   "node_ram_hourly_cost",
+}
+
+// openCostKey identifies a node price of the OpenCost metric set.
+type openCostKey struct {
+	provider, instanceType, region, lifecycle string
+}
+
+// openCostPrice is the hourly price of a node and its per-vCPU and per-GiB
+// split. hasSplit is false when the node's resources are unknown.
+type openCostPrice struct {
+	total, cpu, ram float64
+	hasSplit        bool
+}
+
+// initOpenCostGauges creates the gauges of the OpenCost metric set.
+func (e *Exporter) initOpenCostGauges() {
+	help := map[string]string{
+		"opencost_node_total": "Hourly cost of a node of the instance type (cheapest Linux price of its region).",
+		"opencost_node_cpu":   "Hourly cost of one vCPU of a node of the instance type.",
+		"opencost_node_ram":   "Hourly cost of one GiB of memory of a node of the instance type.",
+	}
+	for name, exported := range openCostMetrics {
+		e.newPricingMetric(name, prometheus.GaugeOpts{
+			Name: exported,
+			Help: help[name],
+		}, e.priceLabels("node", "provider", "instance_type", "region", "instance_lifecycle"))
+	}
+}
+
+// addOpenCostSample keeps the cheapest Linux on-demand, spot or Azure
+// consumption price of every instance type, region and lifecycle, across
+// availability zones and accounts.
+func (e *Exporter) addOpenCostSample(prices map[openCostKey]openCostPrice, scr provider.ScrapeResult) {
+	var key openCostKey
+	switch {
+	case scr.Name == "ec2" && scr.SavingPlanType == "" && scr.InstanceLifecycle == "ondemand" && scr.OperatingSystem == "Linux",
+		scr.Name == "ec2" && scr.InstanceLifecycle == "spot" && scr.ProductDescription == "Linux/UNIX":
+		key = openCostKey{"aws", scr.InstanceType, scr.Region, scr.InstanceLifecycle}
+	case scr.Name == "azure_vm" && scr.OperatingSystem == "Linux" && scr.PriceType == azure.PriceTypeConsumption:
+		key = openCostKey{"azure", scr.InstanceType, scr.Region, scr.InstanceLifecycle}
+	default:
+		return
+	}
+	if existing, ok := prices[key]; ok && existing.total <= scr.Value {
+		return
+	}
+	price := openCostPrice{total: scr.Value}
+	vcpu, vcpuErr := strconv.Atoi(scr.VCpu)
+	memoryMiB, memErr := strconv.ParseFloat(scr.Memory, 64)
+	if vcpuErr == nil && memErr == nil && vcpu > 0 && memoryMiB > 0 {
+		price.cpu, price.ram = aws.SplitCost(scr.Value, int32(vcpu), memoryMiB/1024, e.cpuMemRatio())
+		price.hasSplit = true
+	}
+	prices[key] = price
+}
+
+// setOpenCostMetrics sets the OpenCost metric set from the collected prices.
+// With a node lister there's one series per cluster node, labelled with its
+// name like OpenCost's own; otherwise one per instance type with an empty
+// node label.
+func (e *Exporter) setOpenCostMetrics(prices map[openCostKey]openCostPrice) {
+	if e.nodeLister == nil {
+		for key, price := range prices {
+			e.setOpenCostPrice("", key, price)
+		}
+		return
+	}
+	for _, node := range e.clusterNodes {
+		if node.InstanceType == "" || node.Region == "" {
+			continue
+		}
+		key := openCostKey{node.Provider, node.InstanceType, node.Region, kube.Lifecycle(node.Labels)}
+		if price, ok := prices[key]; ok {
+			e.setOpenCostPrice(node.Name, key, price)
+		}
+	}
+}
+
+// setOpenCostPrice sets the OpenCost series of a node.
+func (e *Exporter) setOpenCostPrice(node string, key openCostKey, price openCostPrice) {
+	values := map[string]float64{"opencost_node_total": price.total}
+	if price.hasSplit {
+		values["opencost_node_cpu"] = price.cpu
+		values["opencost_node_ram"] = price.ram
+	}
+	for name, value := range values {
+		labels := prometheus.Labels{
+			"node":               node,
+			"provider":           key.provider,
+			"instance_type":      key.instanceType,
+			"region":             key.region,
+			"instance_lifecycle": key.lifecycle,
+		}
+		e.recordPrice(key.region, name, labels, value)
+		e.setPrice(name, labels, value)
+	}
+}
+
+// cpuMemRatio returns the CPU-to-memory cost ratio of the instance store.
+func (e *Exporter) cpuMemRatio() float64 {
+	if e.instances == nil {
+		return aws.CpuMemRelation
+	}
+	return e.instances.CPUMemRatio()
+}
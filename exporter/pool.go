@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithScrapeConcurrency limits the fetches of a scrape (a region, account,
+// CloudFront or the spot data feed) running at the same time to workers, all
+// providers included. 0 runs every fetch at once.
+func WithScrapeConcurrency(workers int) Option {
+	return func(e *Exporter) {
+		e.scrapeConcurrency = workers
+	}
+}
+
+// initPoolGauges creates the gauges of the scrape worker pool.
+func (e *Exporter) initPoolGauges() {
+	e.poolWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_workers",
+		Help:      "Workers started by the last scrape to fetch regions, accounts and other sources.",
+	})
+	e.poolQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_queue_depth",
+		Help:      "Fetches of the current scrape waiting for a worker.",
+	})
+	e.poolInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_fetches_in_flight",
+		Help:      "Fetches of the current scrape running.",
+	})
+}
+
+// workerPool runs the fetches of a scrape on up to size workers, started as
+// fetches are submitted.
+type workerPool struct {
+	size    int // 0 = a worker per fetch
+	workers int
+	tasks   chan func()
+	pending sync.WaitGroup
+
+	started  prometheus.Gauge
+	queued   prometheus.Gauge
+	inFlight prometheus.Gauge
+}
+
+// newWorkerPool returns the pool of a scrape.
+func (e *Exporter) newWorkerPool() *workerPool {
+	e.poolWorkers.Set(0)
+	return &workerPool{
+		size:     e.scrapeConcurrency,
+		tasks:    make(chan func()),
+		started:  e.poolWorkers,
+		queued:   e.poolQueued,
+		inFlight: e.poolInFlight,
+	}
+}
+
+// submit queues task, blocking while every worker is busy. It must only be
+// called from the goroutine that calls wait.
+func (p *workerPool) submit(task func()) {
+	p.pending.Add(1)
+	p.queued.Inc()
+	if p.size <= 0 || p.workers < p.size {
+		p.workers++
+		p.started.Inc()
+		go p.work()
+	}
+	p.tasks <- task
+}
+
+// work runs queued tasks until the pool is closed.
+func (p *workerPool) work() {
+	for task := range p.tasks {
+		p.queued.Dec()
+		p.inFlight.Inc()
+		task()
+		p.inFlight.Dec()
+		p.pending.Done()
+	}
+}
+
+// wait waits for the submitted tasks and stops the workers.
+func (p *workerPool) wait() {
+	p.pending.Wait()
+	close(p.tasks)
+}
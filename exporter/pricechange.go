@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/notify"
+)
+
+// notifyTimeout bounds the delivery of the changes of a scrape.
+const notifyTimeout = 30 * time.Second
+
+// notifiedMetrics are the pricing metrics whose changes are notified. The
+// OpenCost node price is only notified when the native metrics aren't
+// exported, to notify every change once.
+var notifiedMetrics = map[string]bool{
+	"ec2":                 true,
+	"azure_vm":            true,
+	"opencost_node_total": true,
+}
+
+// priceChanges returns the prices of the current scrape that changed by at
+// least the notification threshold since the previous scrape of their region.
+// It must be called before serveStale replaces the previous prices.
+func (e *Exporter) priceChanges() []notify.Change {
+	var changes []notify.Change
+	for key, current := range e.scrapedPrices {
+		previous := e.lastPrices[key]
+		for id, p := range current {
+			if !notifiedMetrics[p.name] || (p.name == "opencost_node_total" && e.metricsFormat != MetricsFormatOpenCost) {
+				continue
+			}
+			old, ok := previous[id]
+			if !ok || old.usd <= 0 {
+				continue
+			}
+			percent := (p.usd - old.usd) / old.usd * 100
+			if math.Abs(percent) < e.notifyThreshold {
+				continue
+			}
+			labels := make(map[string]string, len(p.labels))
+			for k, v := range p.labels {
+				if v != "" {
+					labels[k] = v
+				}
+			}
+			changes = append(changes, notify.Change{
+				Metric:        e.metricNames[p.name],
+				Labels:        labels,
+				OldPrice:      old.usd,
+				NewPrice:      p.usd,
+				ChangePercent: percent,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Metric != changes[j].Metric {
+			return changes[i].Metric < changes[j].Metric
+		}
+		return seriesID("", changes[i].Labels) < seriesID("", changes[j].Labels)
+	})
+	return changes
+}
+
+// notifyPriceChanges delivers the price changes of the current scrape in the
+// background, so slow receivers don't hold up scrapes.
+func (e *Exporter) notifyPriceChanges() {
+	changes := e.priceChanges()
+	if len(changes) == 0 {
+		return
+	}
+	log.Infof("%d prices changed by at least %g%%, notifying", len(changes), e.notifyThreshold)
+	go func() {
+		ctx, cancel := context.WithTimeout(e.rootContext(), notifyTimeout)
+		defer cancel()
+		if err := e.notifier.Notify(ctx, changes); err != nil {
+			log.WithError(err).Error("error while notifying price changes")
+			e.notifyFailures.Inc()
+		}
+	}()
+}
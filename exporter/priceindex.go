@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+)
+
+// PriceQuery identifies the hourly Linux price of an instance type. An empty
+// Zone matches the cheapest zone of the region.
+type PriceQuery struct {
+	Provider     string // "aws" or "azure"
+	Region       string
+	Zone         string
+	InstanceType string
+	Lifecycle    string // "ondemand", "spot" or "lowpriority"
+}
+
+// PriceIndex holds the cheapest Linux on-demand, spot and Azure consumption
+// prices of the last scrape, including stale prices still served, for
+// lookups outside of Prometheus scrapes. It is immutable once built.
+type PriceIndex struct {
+	prices map[PriceQuery]float64
+}
+
+// Lookup returns the hourly USD price matching q.
+func (p *PriceIndex) Lookup(q PriceQuery) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	price, ok := p.prices[q]
+	return price, ok
+}
+
+// Len returns the number of indexed prices.
+func (p *PriceIndex) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.prices)
+}
+
+// Each calls fn for every indexed price, zone-level and region-level
+// (empty Zone) alike.
+func (p *PriceIndex) Each(fn func(q PriceQuery, price float64)) {
+	if p == nil {
+		return
+	}
+	for q, price := range p.prices {
+		fn(q, price)
+	}
+}
+
+// Prices returns the price index of the last scrape, or nil before the first
+// one. It doesn't block while a scrape is running.
+func (e *Exporter) Prices() *PriceIndex {
+	return e.priceIndex.Load()
+}
+
+// NewPriceIndex returns an index of prices, adding the cheapest zone of each
+// region as the price of the region (empty Zone) where it isn't given.
+func NewPriceIndex(prices map[PriceQuery]float64) *PriceIndex {
+	index := &PriceIndex{prices: make(map[PriceQuery]float64, len(prices))}
+	for q, price := range prices {
+		index.add(q, price)
+		if q.Zone != "" {
+			q.Zone = ""
+			if _, ok := prices[q]; !ok {
+				index.add(q, price)
+			}
+		}
+	}
+	return index
+}
+
+// buildPriceIndex indexes the prices currently served.
+func (e *Exporter) buildPriceIndex() {
+	prices := make(map[PriceQuery]float64)
+	for key, points := range e.lastPrices {
+		for _, p := range points {
+			q, ok := indexQuery(key.provider, p.name, p.labels)
+			if !ok {
+				continue
+			}
+			if existing, ok := prices[q]; !ok || p.usd < existing {
+				prices[q] = p.usd
+			}
+		}
+	}
+	e.priceIndex.Store(NewPriceIndex(prices))
+}
+
+// add keeps the cheaper of price and the indexed price of q.
+func (p *PriceIndex) add(q PriceQuery, price float64) {
+	if existing, ok := p.prices[q]; !ok || price < existing {
+		p.prices[q] = price
+	}
+}
+
+// indexQuery returns the index key of a served price, ok is false for prices
+// that aren't indexed (other operating systems, savings plans, reservations
+// and derived metrics).
+func indexQuery(provider, name string, labels prometheus.Labels) (PriceQuery, bool) {
+	q := PriceQuery{
+		Provider:     provider,
+		Region:       labels["region"],
+		InstanceType: labels["instance_type"],
+		Lifecycle:    labels["instance_lifecycle"],
+	}
+	switch {
+	case name == "ec2" && labels["saving_plan_type"] == "" &&
+		((q.Lifecycle == "ondemand" && labels["operating_system"] == "Linux") ||
+			(q.Lifecycle == "spot" && labels["product_description"] == "Linux/UNIX")):
+		q.Zone = labels["availability_zone"]
+	case name == "azure_vm" && labels["operating_system"] == "Linux" && labels["price_type"] == azure.PriceTypeConsumption:
+	case name == "opencost_node_total":
+	default:
+		return PriceQuery{}, false
+	}
+	return q, true
+}
@@ -1,6 +1,10 @@
 package provider
 
-import "regexp"
+import (
+	"regexp"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+)
 
 // ScrapeResult is the universal metric record produced by all cloud providers.
 type ScrapeResult struct {
@@ -15,8 +19,47 @@ type ScrapeResult struct {
 	SavingPlanOption   string
 	SavingPlanDuration int
 	SavingPlanType     string
+	LicenseModel       string // on-demand licenseModel, e.g. "License Included", "Bring your own license"
+	OfferingClass      string // reserved instance offering class: standard or convertible
+	OfferingType       string // reserved instance purchase option, e.g. "No Upfront"
+	LeaseLength        string // reserved instance lease contract length, e.g. "1yr"
 	Memory             string
 	VCpu               string
+	Statistic          string            // aggregation statistic (min, avg, max) for aggregated series
+	AccountID          string            // AWS account of account-specific data when scraping multiple accounts
+	PriceType          string            // Azure retail price type, e.g. "Consumption", "DevTestConsumption"
+	ConstrainedVCpu    string            // active vCPUs of Azure constrained-core sizes, e.g. "4" for Standard_E8-4s_v5
+	MeterName          string            // Azure billing meter, e.g. "D2s v5"
+	ProductName        string            // Azure billing product, e.g. "Virtual Machines Dsv5 Series"
+	Labels             map[string]string // labels of metrics declared in the configuration file
+}
+
+// SkippedName is the Name of the scrape results reporting a skipped item of
+// a provider response instead of a price; see Skipped.
+const SkippedName = "skipped"
+
+// Reasons items of provider responses are skipped for.
+const (
+	SkipFiltered            = "filtered"              // excluded by the instance type filters
+	SkipUnknownInstanceType = "unknown_instance_type" // missing from the instance data the filters need
+	SkipUnparsablePrice     = "unparsable_price"
+	SkipMissingTerms        = "missing_terms" // no price for the requested terms, e.g. no on-demand USD price
+)
+
+// Skipped returns the scrape result reporting that an item of a response of
+// provider (e.g. "aws") was skipped for reason.
+func Skipped(provider, region, reason string) ScrapeResult {
+	return ScrapeResult{Name: SkippedName, Region: region, Labels: map[string]string{"provider": provider, "reason": reason}}
+}
+
+// FailedName is the Name of the scrape results reporting a failed API
+// request instead of a price; see Failed.
+const FailedName = "failed"
+
+// Failed returns the scrape result reporting that a request of a scrape of
+// region failed with err.
+func Failed(region string, err *apierror.Error) ScrapeResult {
+	return ScrapeResult{Name: FailedName, Region: region, Labels: map[string]string{"provider": err.Provider, "category": string(err.Category), "permission": err.Missing(), "hint": err.Hint()}}
 }
 
 // Contains reports whether v is present in elems.
@@ -0,0 +1,256 @@
+// Package regionname maps the human-readable names of AWS and Azure regions,
+// such as "Frankfurt", "N. Virginia" or the locations of the pricing files
+// ("EU (Frankfurt)", "US East (N. Virginia)", "EU West"), to region codes and
+// back.
+package regionname
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// region is a region of a provider and the names it's known by.
+type region struct {
+	code    string
+	name    string   // display name, exported as the region_name label
+	aliases []string // other names, e.g. the city or the pricing file location
+}
+
+// awsRegions are the AWS regions. name is the location of the Price List
+// files, which the console shows too; "EU" locations are also known as
+// "Europe".
+var awsRegions = []region{
+	{"us-east-1", "US East (N. Virginia)", []string{"N. Virginia", "Virginia"}},
+	{"us-east-2", "US East (Ohio)", []string{"Ohio"}},
+	{"us-west-1", "US West (N. California)", []string{"N. California", "California"}},
+	{"us-west-2", "US West (Oregon)", []string{"Oregon"}},
+	{"af-south-1", "Africa (Cape Town)", []string{"Cape Town"}},
+	{"ap-east-1", "Asia Pacific (Hong Kong)", []string{"Hong Kong"}},
+	{"ap-east-2", "Asia Pacific (Taipei)", []string{"Taipei"}},
+	{"ap-south-1", "Asia Pacific (Mumbai)", []string{"Mumbai"}},
+	{"ap-south-2", "Asia Pacific (Hyderabad)", []string{"Hyderabad"}},
+	{"ap-northeast-1", "Asia Pacific (Tokyo)", []string{"Tokyo"}},
+	{"ap-northeast-2", "Asia Pacific (Seoul)", []string{"Seoul"}},
+	{"ap-northeast-3", "Asia Pacific (Osaka)", []string{"Osaka"}},
+	{"ap-southeast-1", "Asia Pacific (Singapore)", []string{"Singapore"}},
+	{"ap-southeast-2", "Asia Pacific (Sydney)", []string{"Sydney"}},
+	{"ap-southeast-3", "Asia Pacific (Jakarta)", []string{"Jakarta"}},
+	{"ap-southeast-4", "Asia Pacific (Melbourne)", []string{"Melbourne"}},
+	{"ap-southeast-5", "Asia Pacific (Malaysia)", []string{"Malaysia"}},
+	{"ap-southeast-7", "Asia Pacific (Thailand)", []string{"Thailand"}},
+	{"ca-central-1", "Canada (Central)", []string{"Montreal"}},
+	{"ca-west-1", "Canada West (Calgary)", []string{"Calgary"}},
+	{"eu-central-1", "EU (Frankfurt)", []string{"Europe (Frankfurt)", "Frankfurt"}},
+	{"eu-central-2", "EU (Zurich)", []string{"Europe (Zurich)", "Zurich"}},
+	{"eu-west-1", "EU (Ireland)", []string{"Europe (Ireland)", "Ireland"}},
+	{"eu-west-2", "EU (London)", []string{"Europe (London)", "London"}},
+	{"eu-west-3", "EU (Paris)", []string{"Europe (Paris)", "Paris"}},
+	{"eu-south-1", "EU (Milan)", []string{"Europe (Milan)", "Milan"}},
+	{"eu-south-2", "EU (Spain)", []string{"Europe (Spain)", "Spain"}},
+	{"eu-north-1", "EU (Stockholm)", []string{"Europe (Stockholm)", "Stockholm"}},
+	{"il-central-1", "Israel (Tel Aviv)", []string{"Tel Aviv"}},
+	{"me-south-1", "Middle East (Bahrain)", []string{"Bahrain"}},
+	{"me-central-1", "Middle East (UAE)", []string{"UAE"}},
+	{"mx-central-1", "Mexico (Central)", []string{"Mexico"}},
+	{"sa-east-1", "South America (Sao Paulo)", []string{"Sao Paulo", "São Paulo"}},
+	{"us-gov-east-1", "AWS GovCloud (US-East)", []string{"GovCloud East"}},
+	{"us-gov-west-1", "AWS GovCloud (US-West)", []string{"GovCloud West", "GovCloud (US)"}},
+	{"cn-north-1", "China (Beijing)", []string{"Beijing"}},
+	{"cn-northwest-1", "China (Ningxia)", []string{"Ningxia"}},
+}
+
+// azureRegions are the Azure regions. name is the display name of the
+// region; the alias is the location of the Retail Prices API items.
+var azureRegions = []region{
+	{"eastus", "East US", []string{"US East"}},
+	{"eastus2", "East US 2", []string{"US East 2"}},
+	{"centralus", "Central US", []string{"US Central"}},
+	{"northcentralus", "North Central US", []string{"US North Central"}},
+	{"southcentralus", "South Central US", []string{"US South Central"}},
+	{"westcentralus", "West Central US", []string{"US West Central"}},
+	{"westus", "West US", []string{"US West"}},
+	{"westus2", "West US 2", []string{"US West 2"}},
+	{"westus3", "West US 3", []string{"US West 3"}},
+	{"canadacentral", "Canada Central", []string{"CA Central"}},
+	{"canadaeast", "Canada East", []string{"CA East"}},
+	{"brazilsouth", "Brazil South", []string{"BR South"}},
+	{"mexicocentral", "Mexico Central", []string{"MX Central"}},
+	{"northeurope", "North Europe", []string{"EU North"}},
+	{"westeurope", "West Europe", []string{"EU West"}},
+	{"uksouth", "UK South", nil},
+	{"ukwest", "UK West", nil},
+	{"francecentral", "France Central", []string{"FR Central"}},
+	{"germanywestcentral", "Germany West Central", []string{"DE West Central"}},
+	{"italynorth", "Italy North", []string{"IT North"}},
+	{"norwayeast", "Norway East", []string{"NO East"}},
+	{"polandcentral", "Poland Central", []string{"PL Central"}},
+	{"spaincentral", "Spain Central", []string{"ES Central"}},
+	{"swedencentral", "Sweden Central", []string{"SE Central"}},
+	{"switzerlandnorth", "Switzerland North", []string{"CH North"}},
+	{"eastasia", "East Asia", []string{"AP East"}},
+	{"southeastasia", "Southeast Asia", []string{"AP Southeast"}},
+	{"australiaeast", "Australia East", []string{"AU East"}},
+	{"australiasoutheast", "Australia Southeast", []string{"AU Southeast"}},
+	{"australiacentral", "Australia Central", []string{"AU Central"}},
+	{"centralindia", "Central India", []string{"IN Central"}},
+	{"southindia", "South India", []string{"IN South"}},
+	{"westindia", "West India", []string{"IN West"}},
+	{"japaneast", "Japan East", []string{"JA East"}},
+	{"japanwest", "Japan West", []string{"JA West"}},
+	{"koreacentral", "Korea Central", []string{"KR Central"}},
+	{"koreasouth", "Korea South", []string{"KR South"}},
+	{"israelcentral", "Israel Central", []string{"IL Central"}},
+	{"qatarcentral", "Qatar Central", []string{"QA Central"}},
+	{"uaenorth", "UAE North", []string{"AE North"}},
+	{"southafricanorth", "South Africa North", []string{"ZA North"}},
+}
+
+var (
+	byProvider = map[string][]region{"aws": awsRegions, "azure": azureRegions}
+	codes      = map[string]map[string]string{"aws": index(awsRegions), "azure": index(azureRegions)} // by provider and folded name
+	names      = displayNames(awsRegions, azureRegions)                                               // by code
+)
+
+// index returns the codes of regions by their folded codes, names and
+// aliases.
+func index(regions []region) map[string]string {
+	m := make(map[string]string, 3*len(regions))
+	for _, r := range regions {
+		m[fold(r.code)] = r.code
+		m[fold(r.name)] = r.code
+		for _, alias := range r.aliases {
+			m[fold(alias)] = r.code
+		}
+	}
+	return m
+}
+
+// displayNames returns the display names of the regions of every provider by
+// code. Codes don't collide across providers.
+func displayNames(providers ...[]region) map[string]string {
+	m := make(map[string]string)
+	for _, regions := range providers {
+		for _, r := range regions {
+			m[r.code] = r.name
+		}
+	}
+	return m
+}
+
+// fold returns s lower-cased without spaces and punctuation, so names match
+// regardless of how they're written: "N. Virginia", "n virginia" and
+// "nvirginia" are the same. Accents are kept.
+func fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// Code returns the code of the region of provider ("aws" or "azure") known
+// as name: its code, display name, city or pricing file location. Names it
+// doesn't know are returned unchanged, so regions newer than this package
+// can still be configured by code.
+func Code(provider, name string) string {
+	if code, ok := codes[provider][fold(name)]; ok {
+		return code
+	}
+	return name
+}
+
+// Codes returns the codes of the regions of provider known as names; see
+// Code.
+func Codes(provider string, names []string) []string {
+	if len(names) == 0 {
+		return names
+	}
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = Code(provider, name)
+	}
+	return out
+}
+
+// Name returns the display name of the region code of any provider, e.g.
+// "EU (Frankfurt)" for eu-central-1 or "West Europe" for westeurope, or ""
+// if the region is unknown.
+func Name(code string) string {
+	return names[code]
+}
+
+// Known reports whether code is the code of a region of provider.
+func Known(provider, code string) bool {
+	for _, r := range byProvider[provider] {
+		if r.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error listing the codes that aren't regions of
+// provider, each with the closest region as a suggestion if one is close
+// enough to be a typo. Providers without a region list are never invalid.
+func Validate(provider string, codes []string) error {
+	if _, ok := byProvider[provider]; !ok {
+		return nil
+	}
+	var errs []error
+	for _, code := range codes {
+		if Known(provider, code) {
+			continue
+		}
+		if suggestion := Suggest(provider, code); suggestion != "" {
+			errs = append(errs, fmt.Errorf("unknown %s region %q, did you mean %s?", provider, code, suggestion))
+		} else {
+			errs = append(errs, fmt.Errorf("unknown %s region %q", provider, code))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Suggest returns the code of the region of provider whose code, name or
+// alias is closest to name, or "" if none is within a few typos of it.
+func Suggest(provider, name string) string {
+	folded := fold(name)
+	best, bestDistance := "", 0
+	for _, r := range byProvider[provider] {
+		for _, known := range append([]string{r.code, r.name}, r.aliases...) {
+			d := distance(folded, fold(known))
+			if best == "" || d < bestDistance {
+				best, bestDistance = r.code, d
+			}
+		}
+	}
+	if bestDistance > max(2, len(folded)/3) {
+		return ""
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance of a and b in bytes.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
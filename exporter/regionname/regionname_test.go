@@ -0,0 +1,108 @@
+package regionname
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		provider, name, want string
+	}{
+		{"aws", "eu-central-1", "eu-central-1"},
+		{"aws", "Frankfurt", "eu-central-1"},
+		{"aws", "frankfurt", "eu-central-1"},
+		{"aws", "EU (Frankfurt)", "eu-central-1"},
+		{"aws", "Europe (Frankfurt)", "eu-central-1"},
+		{"aws", "N. Virginia", "us-east-1"},
+		{"aws", "US East (N. Virginia)", "us-east-1"},
+		{"aws", "Canada (Central)", "ca-central-1"},
+		{"aws", "US-EAST-2", "us-east-2"},
+		{"azure", "West Europe", "westeurope"},
+		{"azure", "EU West", "westeurope"},
+		{"azure", "westeurope", "westeurope"},
+		{"azure", "Canada Central", "canadacentral"},
+		{"azure", "Frankfurt", "Frankfurt"},     // unknown to Azure
+		{"aws", "xx-future-1", "xx-future-1"},   // unknown code kept
+		{"gcp", "europe-west1", "europe-west1"}, // unknown provider
+	}
+	for _, tt := range tests {
+		if got := Code(tt.provider, tt.name); got != tt.want {
+			t.Errorf("Code(%q, %q) = %q, want %q", tt.provider, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCodes(t *testing.T) {
+	got := Codes("aws", []string{"Ireland", "us-west-2", "Tokyo"})
+	if want := []string{"eu-west-1", "us-west-2", "ap-northeast-1"}; !slices.Equal(got, want) {
+		t.Errorf("Codes = %v, want %v", got, want)
+	}
+	if got := Codes("aws", nil); got != nil {
+		t.Errorf("Codes(nil) = %v, want nil", got)
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := Name("eu-central-1"); got != "EU (Frankfurt)" {
+		t.Errorf("Name(eu-central-1) = %q", got)
+	}
+	if got := Name("eastus2"); got != "East US 2" {
+		t.Errorf("Name(eastus2) = %q", got)
+	}
+	if got := Name("xx-future-1"); got != "" {
+		t.Errorf("Name(xx-future-1) = %q, want empty", got)
+	}
+}
+
+// Every name must identify a single region of its provider.
+func TestNamesUnambiguous(t *testing.T) {
+	for provider, regions := range map[string][]region{"aws": awsRegions, "azure": azureRegions} {
+		seen := map[string]string{}
+		for _, r := range regions {
+			for _, name := range append([]string{r.code, r.name}, r.aliases...) {
+				if code, ok := seen[fold(name)]; ok && code != r.code {
+					t.Errorf("%s: %q names both %s and %s", provider, name, code, r.code)
+				}
+				seen[fold(name)] = r.code
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate("aws", []string{"us-east-1", "eu-central-1"}); err != nil {
+		t.Errorf("Validate(known) = %v", err)
+	}
+	if err := Validate("gcp", []string{"europe-west1"}); err != nil {
+		t.Errorf("Validate(unknown provider) = %v", err)
+	}
+
+	err := Validate("aws", []string{"eu-wset-1", "us-east-1", "mars-north-1"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "unknown aws region \"eu-wset-1\", did you mean eu-west-1?\nunknown aws region \"mars-north-1\""
+	if err.Error() != want {
+		t.Errorf("Validate = %q, want %q", err, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		provider, name, want string
+	}{
+		{"aws", "us-eats-1", "us-east-1"},
+		{"aws", "eu-west1", "eu-west-1"},
+		{"aws", "Frankfrut", "eu-central-1"},
+		{"azure", "westeurop", "westeurope"},
+		{"azure", "eastus4", "eastus"},
+		{"aws", "mars-north-1", ""},
+		{"gcp", "europe-west1", ""},
+	}
+	for _, tt := range tests {
+		if got := Suggest(tt.provider, tt.name); got != tt.want {
+			t.Errorf("Suggest(%q, %q) = %q, want %q", tt.provider, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WithRefreshStagger refreshes regions on a round-robin schedule spread over
+// the cache duration instead of refreshing every region when the cache
+// expires. Every region is still refreshed once per cache duration, but the
+// pricing API calls and the CPU they cost are smoothed over it. The prices of
+// regions that aren't due are served from their last refresh.
+func WithRefreshStagger(enabled bool) Option {
+	return func(e *Exporter) {
+		e.refreshStagger = enabled
+	}
+}
+
+// regionDue reports whether key is due for a refresh. Regions that aren't
+// are deferred to a later scrape. Every region is due without staggering.
+func (e *Exporter) regionDue(key regionKey, now time.Time) bool {
+	if !e.refreshStagger {
+		return true
+	}
+	if due, ok := e.refreshDue[key]; !ok || !now.Before(due) {
+		return true
+	}
+	if e.deferredRegions == nil {
+		e.deferredRegions = make(map[regionKey]bool)
+	}
+	e.deferredRegions[key] = true
+	return false
+}
+
+// dueRegions returns the regions of provider that are due for a refresh.
+func (e *Exporter) dueRegions(provider string, regions []string, now time.Time) []string {
+	if !e.refreshStagger {
+		return regions
+	}
+	due := make([]string, 0, len(regions))
+	for _, region := range regions {
+		if e.regionDue(regionKey{provider, region}, now) {
+			due = append(due, region)
+		}
+	}
+	return due
+}
+
+// scheduleRefreshes sets when the regions refreshed by the scrape started at
+// now are due again and schedules the next scrape for the first of them.
+// Regions refreshed for the first time are spread evenly over the cache
+// duration; afterwards each is due one cache duration after its previous
+// refresh was, so the spread is kept.
+func (e *Exporter) scheduleRefreshes(now time.Time) {
+	if !e.refreshStagger {
+		return
+	}
+	if e.refreshDue == nil {
+		e.refreshDue = make(map[regionKey]time.Time)
+	}
+	var added []regionKey
+	for key := range e.regionErrors {
+		if e.deferredRegions[key] {
+			continue
+		}
+		due, ok := e.refreshDue[key]
+		if !ok {
+			added = append(added, key)
+			continue
+		}
+		ttl := e.cacheTTL()
+		if ttl <= 0 {
+			e.refreshDue[key] = now
+			continue
+		}
+		for !due.After(now) {
+			due = due.Add(ttl)
+		}
+		e.refreshDue[key] = due
+	}
+	sort.Slice(added, func(i, j int) bool {
+		if added[i].provider != added[j].provider {
+			return added[i].provider < added[j].provider
+		}
+		return added[i].region < added[j].region
+	})
+	for i, key := range added {
+		e.refreshDue[key] = now.Add(e.cacheTTL() * time.Duration(i+1) / time.Duration(len(added)))
+	}
+
+	var next time.Time
+	for key, due := range e.refreshDue {
+		if _, ok := e.regionErrors[key]; !ok {
+			continue // no longer scraped, e.g. Azure was disabled
+		}
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	if !next.IsZero() {
+		e.nextScrape = next
+	}
+	log.Debugf("refreshed %d regions, deferred %d, next refresh at %s", len(e.regionErrors)-len(e.deferredRegions), len(e.deferredRegions), e.nextScrape.Format(time.RFC3339))
+}
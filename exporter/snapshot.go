@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricSnapshot holds the pricing and derived metrics of a completed
+// scrape. Scrapes set their metrics on fresh gauges and publish them as a
+// new snapshot once done, so Collect never serves a partially set scrape.
+type metricSnapshot struct {
+	pricing []*prometheus.GaugeVec
+	derived []*prometheus.GaugeVec
+}
+
+// resetGauges replaces the pricing and derived metrics with empty ones for
+// the next scrape to set, leaving the published snapshot untouched.
+func (e *Exporter) resetGauges() {
+	for name, opts := range e.metricOpts {
+		e.pricingMetrics[name] = prometheus.NewGaugeVec(opts, e.labelOrder[name])
+	}
+	for _, m := range e.mappings {
+		m.set = nil
+	}
+	for _, d := range e.derivedMetrics {
+		d.gauge = d.newGauge()
+	}
+}
+
+// publishSnapshot makes the metrics set by the current scrape the ones
+// Collect serves.
+func (e *Exporter) publishSnapshot() {
+	s := &metricSnapshot{
+		pricing: make([]*prometheus.GaugeVec, 0, len(e.pricingMetrics)),
+		derived: make([]*prometheus.GaugeVec, 0, len(e.derivedMetrics)),
+	}
+	for _, m := range e.pricingMetrics {
+		s.pricing = append(s.pricing, m)
+	}
+	for _, d := range e.derivedMetrics {
+		s.derived = append(s.derived, d.gauge)
+	}
+	e.snapshot.Store(s)
+}
+
+// lockForScrape locks e.mu to check whether a scrape is due, and reports
+// whether it did. While another scrape runs it doesn't wait if a snapshot
+// has been published already, so concurrent collectors are served the
+// previous scrape's metrics right away.
+func (e *Exporter) lockForScrape() bool {
+	if e.mu.TryLock() {
+		return true
+	}
+	if e.snapshot.Load() != nil {
+		return false
+	}
+	e.mu.Lock()
+	return true
+}
+
+// collectSnapshot collects the metrics of the published snapshot.
+func (e *Exporter) collectSnapshot(ch chan<- prometheus.Metric) {
+	s := e.snapshot.Load()
+	if s == nil {
+		return
+	}
+	for _, m := range s.pricing {
+		m.Collect(ch)
+	}
+	for _, m := range s.derived {
+		m.Collect(ch)
+	}
+}
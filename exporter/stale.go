@@ -0,0 +1,136 @@
+package exporter
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+)
+
+// regionKey identifies a region of a provider, e.g. {"aws", "us-east-1"}.
+type regionKey struct {
+	provider string
+	region   string
+}
+
+// pricePoint is a price set during a scrape. The prices of each region are
+// kept until its next scrape, so they can be served again if that one fails.
+type pricePoint struct {
+	name   string
+	labels prometheus.Labels
+	usd    float64
+}
+
+// metricProvider returns the provider a pricing metric belongs to, taken
+// from its provider label if it has one.
+func metricProvider(name string, labels prometheus.Labels) string {
+	if p := labels["provider"]; p != "" {
+		return p
+	}
+	if strings.HasPrefix(name, "azure_") {
+		return "azure"
+	}
+	if strings.HasPrefix(name, "fake_") {
+		return "fake"
+	}
+	return "aws"
+}
+
+// seriesID returns a key identifying the series of name with labels.
+func seriesID(name string, labels prometheus.Labels) string {
+	keys := make([]string, 0, len(labels))
+	size := len(name)
+	for k, v := range labels {
+		keys = append(keys, k)
+		size += len(k) + len(v) + 2
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.Grow(size)
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// initRegionErrors creates a zeroed error counter for every scraped region.
+func (e *Exporter) initRegionErrors() {
+	e.skippedRegions = nil
+	e.deferredRegions = nil
+	e.regionErrors = make(map[regionKey]*uint64, len(e.regions)+len(e.azureRegions))
+	for _, region := range e.regions {
+		e.regionErrors[regionKey{"aws", region}] = new(uint64)
+	}
+	if e.azureEnabled {
+		for _, region := range e.azureRegions {
+			e.regionErrors[regionKey{"azure", region}] = new(uint64)
+		}
+	}
+	if e.cloudFront {
+		e.regionErrors[regionKey{"aws", aws.CloudFrontRegion}] = new(uint64)
+	}
+	if e.fake != nil {
+		for _, region := range e.fake.Regions() {
+			e.regionErrors[regionKey{"fake", region}] = new(uint64)
+		}
+	}
+}
+
+// recordPrice remembers a price set during the current scrape. It keeps
+// labels, which must not be modified afterwards.
+func (e *Exporter) recordPrice(region, name string, labels prometheus.Labels, usd float64) {
+	if e.scrapedPrices == nil {
+		e.scrapedPrices = make(map[regionKey]map[string]pricePoint, len(e.lastPrices))
+	}
+	key := regionKey{metricProvider(name, labels), region}
+	points, ok := e.scrapedPrices[key]
+	if !ok {
+		points = make(map[string]pricePoint, len(e.lastPrices[key]))
+		e.scrapedPrices[key] = points
+	}
+	points[seriesID(name, labels)] = pricePoint{name: name, labels: labels, usd: usd}
+}
+
+// serveStale restores the previous prices of every region whose scrape had
+// errors or was skipped, since resetGauges cleared them, and flags it in
+// cloud_pricing_stale. Prices that were scraped successfully despite the
+// errors take precedence. The prices of regions deferred by the refresh
+// schedule are restored too, keeping their flag.
+func (e *Exporter) serveStale() {
+	if e.lastPrices == nil {
+		e.lastPrices = make(map[regionKey]map[string]pricePoint)
+	}
+	for key, errs := range e.regionErrors {
+		current := e.scrapedPrices[key]
+		if current == nil {
+			current = make(map[string]pricePoint)
+		}
+		if e.deferredRegions[key] {
+			for _, p := range e.lastPrices[key] {
+				e.setPrice(p.name, p.labels, p.usd)
+			}
+			continue
+		}
+		stale := 0.0
+		if atomic.LoadUint64(errs) > 0 || e.skippedRegions[key] {
+			stale = 1
+			for id, p := range e.lastPrices[key] {
+				if _, ok := current[id]; ok {
+					continue
+				}
+				e.setPrice(p.name, p.labels, p.usd)
+				current[id] = p
+			}
+		}
+		e.stale.WithLabelValues(key.provider, key.region).Set(stale)
+		e.lastPrices[key] = current
+	}
+	e.scrapedPrices = nil
+}
@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// usageSampleInterval is how often the heap and goroutines are sampled during
+// a scrape.
+const usageSampleInterval = 100 * time.Millisecond
+
+// Runtime metrics read by scrapeUsage.
+const (
+	metricHeapAllocs  = "/gc/heap/allocs:bytes"
+	metricHeapObjects = "/memory/classes/heap/objects:bytes"
+)
+
+// initUsageGauges creates the gauges of the resources used by the last
+// scrape.
+func (e *Exporter) initUsageGauges() {
+	e.scrapeAllocated = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_allocated_bytes",
+		Help:      "Heap memory allocated by the exporter during the last scrape.",
+	})
+	e.scrapePeakHeap = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_peak_heap_bytes",
+		Help:      "Highest heap memory in use by the exporter sampled during the last scrape.",
+	})
+	e.scrapeGoroutines = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cloud_pricing",
+		Name:      "scrape_goroutines_delta",
+		Help:      "Highest number of goroutines sampled during the last scrape minus the number before it.",
+	})
+}
+
+// scrapeUsage samples the memory and goroutines used by a scrape.
+type scrapeUsage struct {
+	samples         []metrics.Sample
+	startAllocs     uint64
+	startGoroutines int
+	peakHeap        uint64
+	peakGoroutines  int
+	stop            chan struct{}
+	done            chan struct{}
+}
+
+// startUsage starts sampling the resources used by a scrape until finish is
+// called.
+func startUsage() *scrapeUsage {
+	u := &scrapeUsage{
+		samples:         []metrics.Sample{{Name: metricHeapAllocs}, {Name: metricHeapObjects}},
+		startGoroutines: runtime.NumGoroutine(),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	u.startAllocs = u.sample()
+	go func() {
+		defer close(u.done)
+		ticker := time.NewTicker(usageSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-u.stop:
+				return
+			case <-ticker.C:
+				u.sample()
+			}
+		}
+	}()
+	return u
+}
+
+// sample records the heap in use and the goroutines if they're the highest
+// so far, and returns the bytes allocated since the program started.
+func (u *scrapeUsage) sample() uint64 {
+	metrics.Read(u.samples)
+	var allocs uint64
+	if u.samples[0].Value.Kind() == metrics.KindUint64 {
+		allocs = u.samples[0].Value.Uint64()
+	}
+	if u.samples[1].Value.Kind() == metrics.KindUint64 {
+		u.peakHeap = max(u.peakHeap, u.samples[1].Value.Uint64())
+	}
+	u.peakGoroutines = max(u.peakGoroutines, runtime.NumGoroutine())
+	return allocs
+}
+
+// finish stops sampling and sets the usage gauges of e.
+func (u *scrapeUsage) finish(e *Exporter) {
+	close(u.stop)
+	<-u.done
+	allocs := u.sample()
+	e.scrapeAllocated.Set(float64(allocs - u.startAllocs))
+	e.scrapePeakHeap.Set(float64(u.peakHeap))
+	e.scrapeGoroutines.Set(float64(u.peakGoroutines - u.startGoroutines))
+}
@@ -0,0 +1,184 @@
+package exporter
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/config"
+)
+
+// Reasons of cloud_pricing_rejected_values_total.
+const (
+	rejectZero     = "zero"
+	rejectBelowMin = "below_min"
+	rejectAboveMax = "above_max"
+	rejectJump     = "jump"
+)
+
+// WithValidation rejects implausible pricing metric values as v describes.
+func WithValidation(v config.Validation) Option {
+	return func(e *Exporter) {
+		e.validation = v
+	}
+}
+
+// initValidation creates cloud_pricing_rejected_values_total and checks that
+// the metrics of the rules exist.
+func (e *Exporter) initValidation(exported map[string]bool) error {
+	for i, r := range e.validation.Rules {
+		if r.Metric != "" && !exported[r.Metric] {
+			return fmt.Errorf("validation rule %d: no such pricing metric %q", i+1, r.Metric)
+		}
+	}
+	e.rejectedValues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cloud_pricing",
+		Name:      "rejected_values_total",
+		Help:      "Total scraped values rejected by the validation rules, by metric and reason.",
+	}, []string{"provider", "metric", "reason"})
+	return nil
+}
+
+// rejection groups the values rejected in a scrape for its log message.
+type rejection struct {
+	metric, reason string
+}
+
+// rejectionSample is the count of the values of a rejection and the first of
+// them, logged as an example.
+type rejectionSample struct {
+	count        int
+	usd          float64
+	region       string
+	instanceType string
+}
+
+// validatePrice returns the USD value to export for a series of a pricing
+// metric and false if none should be. Rejected values are counted and, with
+// the drop action, replaced by the series' value of the last scrape.
+func (e *Exporter) validatePrice(name, region string, labels prometheus.Labels, usd float64) (float64, bool) {
+	if e.rejectedValues == nil || name == "instance_type_offered" {
+		return usd, true
+	}
+	key := regionKey{metricProvider(name, labels), region}
+	id := seriesID(name, labels)
+	prev, hasPrev := e.lastPrices[key][id]
+	reason := e.rejectReason(name, labels, usd, prev.usd, hasPrev)
+	if reason == rejectJump {
+		// The exported value stays at the old level while jumps are
+		// dropped, so a jump is accepted as the new level once the previous
+		// scrape saw it too.
+		if jumped, ok := e.jumpedPrices[key][id]; ok && !e.isJump(usd, jumped) {
+			reason = ""
+		} else {
+			e.recordJump(key, id, usd)
+		}
+	}
+	if reason == "" {
+		return usd, true
+	}
+	fqName := e.metricNames[name]
+	e.rejectedValues.WithLabelValues(key.provider, fqName, reason).Inc()
+	e.recordRejection(fqName, reason, region, labels["instance_type"], usd)
+	if e.validation.Action == config.ValidationFlag {
+		return usd, true
+	}
+	return prev.usd, hasPrev
+}
+
+// rejectReason returns why usd is implausible, or "" if it isn't.
+func (e *Exporter) rejectReason(name string, labels prometheus.Labels, usd, prev float64, hasPrev bool) string {
+	v := e.validation
+	if v.RejectZero && usd <= 0 {
+		return rejectZero
+	}
+	for _, r := range v.Rules {
+		if r.Metric != "" && r.Metric != e.metricNames[name] {
+			continue
+		}
+		if r.Lifecycle != "" && r.Lifecycle != labels["instance_lifecycle"] {
+			continue
+		}
+		if usd < r.Min {
+			return rejectBelowMin
+		}
+		if r.Max > 0 && usd > r.Max {
+			return rejectAboveMax
+		}
+	}
+	if hasPrev && e.isJump(usd, prev) {
+		return rejectJump
+	}
+	return ""
+}
+
+// isJump reports whether usd changed from prev by more than the maximum
+// change factor, up or down.
+func (e *Exporter) isJump(usd, prev float64) bool {
+	factor := e.validation.MaxChangeFactor
+	return factor > 0 && prev > 0 && usd > 0 && math.Max(usd/prev, prev/usd) > factor
+}
+
+// recordJump remembers a value of the series id rejected as a jump in the
+// current scrape.
+func (e *Exporter) recordJump(key regionKey, id string, usd float64) {
+	if e.scrapedJumps == nil {
+		e.scrapedJumps = make(map[regionKey]map[string]float64)
+	}
+	if e.scrapedJumps[key] == nil {
+		e.scrapedJumps[key] = make(map[string]float64)
+	}
+	e.scrapedJumps[key][id] = usd
+}
+
+// recordRejection counts a rejected value for the log message of its metric
+// and reason.
+func (e *Exporter) recordRejection(metric, reason, region, instanceType string, usd float64) {
+	log.Debugf("Rejected implausible value %g of %s [region=%s, instance_type=%s, reason=%s]", usd, metric, region, instanceType, reason)
+	if e.rejections == nil {
+		e.rejections = make(map[rejection]*rejectionSample)
+	}
+	r := rejection{metric, reason}
+	sample, ok := e.rejections[r]
+	if !ok {
+		sample = &rejectionSample{usd: usd, region: region, instanceType: instanceType}
+		e.rejections[r] = sample
+	}
+	sample.count++
+}
+
+// finishValidation logs one warning per metric and reason of the values
+// rejected in the scrape and keeps the jumps of the scraped regions for the
+// next scrape. The jumps of regions deferred by the refresh schedule are
+// kept until they are scraped again.
+func (e *Exporter) finishValidation() {
+	rejections := make([]rejection, 0, len(e.rejections))
+	for r := range e.rejections {
+		rejections = append(rejections, r)
+	}
+	slices.SortFunc(rejections, func(a, b rejection) int {
+		return cmp.Or(cmp.Compare(a.metric, b.metric), cmp.Compare(a.reason, b.reason))
+	})
+	for _, r := range rejections {
+		s := e.rejections[r]
+		log.Warnf("Rejected %d implausible values of %s [reason=%s, action=%s, e.g. value=%g, region=%s, instance_type=%s]", s.count, r.metric, r.reason, e.validation.Action, s.usd, s.region, s.instanceType)
+	}
+	e.rejections = nil
+
+	for key := range e.jumpedPrices {
+		if !e.deferredRegions[key] {
+			delete(e.jumpedPrices, key)
+		}
+	}
+	for key, jumps := range e.scrapedJumps {
+		if e.jumpedPrices == nil {
+			e.jumpedPrices = make(map[regionKey]map[string]float64)
+		}
+		e.jumpedPrices[key] = jumps
+	}
+	e.scrapedJumps = nil
+}
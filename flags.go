@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// flagAliases maps the flag names from before flags were namespaced by
+// provider and concern (-aws.regions, -web.listen-address, ...) to their
+// current names. The old names keep working, with a deprecation warning, but
+// aren't listed by -help.
+var flagAliases = map[string]string{
+	"listen-address":            "web.listen-address",
+	"metrics-path":              "web.metrics-path",
+	"log-level":                 "log.level",
+	"scrape-concurrency":        "scrape.concurrency",
+	"scrape-timeout":            "scrape.timeout",
+	"grpc-expander-address":     "grpc-expander.address",
+	"grpc-expander-tls-cert":    "grpc-expander.tls-cert",
+	"grpc-expander-tls-key":     "grpc-expander.tls-key",
+	"notify-webhook-url":        "notify.webhook-url",
+	"notify-webhook-format":     "notify.webhook-format",
+	"notify-threshold-percent":  "notify.threshold-percent",
+	"kubecost-csv-path":         "kubecost.csv-path",
+	"kubecost-csv-interval":     "kubecost.csv-interval",
+	"kubecost-csv-s3-region":    "kubecost.csv-s3-region",
+	"circuit-breaker-failures":  "circuit-breaker.failures",
+	"circuit-breaker-cooldown":  "circuit-breaker.cooldown",
+	"http-connect-timeout":      "http.connect-timeout",
+	"http-timeout":              "http.timeout",
+	"http-max-response-mb":      "http.max-response-mb",
+	"http-proxy":                "http.proxy",
+	"no-proxy":                  "http.no-proxy",
+	"ca-bundle":                 "http.ca-bundle",
+	"fixture-mode":              "fixture.mode",
+	"fixture-dir":               "fixture.dir",
+	"aws-enabled":               "aws.enabled",
+	"regions":                   "aws.regions",
+	"regions-exclude":           "aws.regions-exclude",
+	"skip-unauthorized-regions": "aws.skip-unauthorized-regions",
+	"aws-assume-role-arns":      "aws.assume-role-arns",
+	"aws-endpoint-url":          "aws.endpoint-url",
+	"aws-retry-mode":            "aws.retry-mode",
+	"aws-retry-max-attempts":    "aws.retry-max-attempts",
+	"aws-pricing-api-path":      "aws.pricing-api-path",
+	"product-descriptions":      "aws.product-descriptions",
+	"operating-systems":         "aws.operating-systems",
+	"instance-regexes":          "aws.instance-regexes",
+	"availability-zones":        "aws.availability-zones",
+	"instance-type-offerings":   "aws.instance-type-offerings",
+	"lifecycle":                 "aws.lifecycle",
+	"spot-aggregation":          "aws.spot-aggregation",
+	"spot-history-window":       "aws.spot-history-window",
+	"spot-source":               "aws.spot-source",
+	"spot-feed-bucket":          "aws.spot-feed-bucket",
+	"spot-feed-prefix":          "aws.spot-feed-prefix",
+	"spot-feed-region":          "aws.spot-feed-region",
+	"spot-page-size":            "aws.spot-page-size",
+	"ondemand-per-region":       "aws.ondemand-per-region",
+	"ondemand-backend":          "aws.ondemand-backend",
+	"pricing-page-size":         "aws.pricing-page-size",
+	"mac-hosts":                 "aws.mac-hosts",
+	"local-storage-price":       "aws.local-storage-price",
+	"aws-dynamodb-enabled":      "aws.dynamodb-enabled",
+	"aws-opensearch-enabled":    "aws.opensearch-enabled",
+	"aws-rds-enabled":           "aws.rds-enabled",
+	"aws-cloudfront-enabled":    "aws.cloudfront-enabled",
+	"aws-managed-surcharges":    "aws.managed-surcharges",
+	"effective-rates-window":    "aws.effective-rates-window",
+	"burstable-utilization":     "aws.burstable-utilization",
+	"aws-cpu-memory-ratio":      "aws.cpu-memory-ratio",
+	"aws-cpu-memory-regression": "aws.cpu-memory-regression",
+	"saving-plan-types":         "aws.saving-plan-types",
+	"saving-plan-page-size":     "aws.saving-plan-page-size",
+	"saving-plan-page-delay":    "aws.saving-plan-page-delay",
+	"instance-families":         "aws.instance-families",
+	"instance-refresh-interval": "aws.instance-refresh-interval",
+	"instance-data-source":      "aws.instance-data-source",
+	"architectures":             "aws.architectures",
+	"min-vcpu":                  "aws.min-vcpu",
+	"max-vcpu":                  "aws.max-vcpu",
+	"min-memory-gb":             "aws.min-memory-gb",
+	"max-memory-gb":             "aws.max-memory-gb",
+	"azure-enabled":             "azure.enabled",
+	"azure-regions":             "azure.regions",
+	"azure-operating-systems":   "azure.operating-systems",
+	"azure-lifecycle":           "azure.lifecycle",
+	"azure-price-types":         "azure.price-types",
+	"azure-detail-labels":       "azure.detail-labels",
+	"azure-rate-limit":          "azure.rate-limit",
+	"azure-rate-burst":          "azure.rate-burst",
+	"azure-max-attempts":        "azure.max-attempts",
+	"azure-instance-regexes":    "azure.instance-regexes",
+	"azure-aks-enabled":         "azure.aks-enabled",
+	"azure-cosmosdb-enabled":    "azure.cosmosdb-enabled",
+	"azure-storage-enabled":     "azure.storage-enabled",
+	"azure-netapp-files":        "azure.netapp-files",
+	"azure-functions-enabled":   "azure.functions-enabled",
+	"fake-regions":              "fake.regions",
+	"fake-instance-types":       "fake.instance-types",
+	"fake-volatility":           "fake.volatility",
+	"fake-seed":                 "fake.seed",
+}
+
+// registerFlagAliases registers every alias of aliases on fs as another name
+// of the flag it stands for, and hides the aliases from the usage message of
+// fs.
+func registerFlagAliases(fs *flag.FlagSet, aliases map[string]string) {
+	for alias, name := range aliases {
+		f := fs.Lookup(name)
+		if f == nil {
+			panic(fmt.Sprintf("alias -%s of undefined flag -%s", alias, name))
+		}
+		fs.Var(f.Value, alias, fmt.Sprintf("Deprecated alias of -%s", name))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+		visible.SetOutput(fs.Output())
+		fs.VisitAll(func(f *flag.Flag) {
+			if _, ok := aliases[f.Name]; ok {
+				return
+			}
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		})
+		visible.PrintDefaults()
+	}
+}
+
+// canonicalFlagName returns the current name of the flag set as name.
+func canonicalFlagName(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// warnDeprecatedFlags logs the aliases of aliases set on the command line of
+// fs, with the names replacing them.
+func warnDeprecatedFlags(fs *flag.FlagSet, aliases map[string]string) {
+	var used []string
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := aliases[f.Name]; ok {
+			used = append(used, f.Name)
+		}
+	})
+	sort.Strings(used)
+	for _, alias := range used {
+		log.Warnf("Flag -%s is deprecated and will be removed, use -%s", alias, aliases[alias])
+	}
+}
@@ -9,12 +9,15 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,33 +25,148 @@ import (
 
 	"github.com/jz-wilson/cloud-price-exporter/exporter"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/awspricing"
 	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	appconfig "github.com/jz-wilson/cloud-price-exporter/exporter/config"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/currency"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/expander"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/fake"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/fixture"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/httpclient"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kube"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/kubecost"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/logging"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/metadata"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/notify"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/regionname"
 )
 
 var (
-	addr                = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
-	metricsPath         = flag.String("metrics-path", "/metrics", "path to metrics endpoint")
-	rawLevel            = flag.String("log-level", "info", "log level")
-	productDescriptions = flag.String("product-descriptions", "Linux/UNIX", "Comma separated list of product descriptions, used to filter spot instances. Accepted values: Linux/UNIX, SUSE Linux, Windows, Linux/UNIX (Amazon VPC), SUSE Linux (Amazon VPC), Windows (Amazon VPC)")
-	operatingSystems    = flag.String("operating-systems", "Linux", "Comma separated list of operating systems, used to filter ondemand instances. Accepted values: Linux, RHEL, SUSE, Windows")
+	addr                = flag.String("web.listen-address", ":8080", "The address to listen on for HTTP requests.")
+	metricsPath         = flag.String("web.metrics-path", "/metrics", "path to metrics endpoint")
+	configPath          = flag.String("web.config-path", "/config", "Path serving the effective configuration as JSON: flag values, scraped regions, AWS, Azure and proxy environment variables and the -config-file content, with secrets redacted (empty = disabled)")
+	rawLevel            = flag.String("log.level", "info", "log level")
+	moduleLevels        = flag.String("log.module-levels", "", "Comma separated module=level pairs overriding -log.level for the logs of a module: aws (all of AWS), aws.spot, aws.ondemand or azure, e.g. aws.spot=debug (defaults to *none*)")
+	debugSample         = flag.Uint64("log.debug-sample", 1, "Log 1 in this many debug messages of single price items (prices, skipped instance types) per module, so debug logs stay readable at scale")
+	productDescriptions = flag.String("aws.product-descriptions", "Linux/UNIX", "Comma separated list of product descriptions, used to filter spot instances. Accepted values: Linux/UNIX, SUSE Linux, Windows, Red Hat Enterprise Linux, and their (Amazon VPC) variants")
+	operatingSystems    = flag.String("aws.operating-systems", "Linux", "Comma separated list of operating systems, used to filter ondemand instances. Accepted values: Linux, RHEL, SUSE, Windows")
 	cache               = flag.Int("cache", 0, "How long should the results be cached, in seconds (defaults to *0*)")
-	instanceRegexes     = flag.String("instance-regexes", "", "Comma separated list of instance types regexes (defaults to *all*)")
+	configFile          = flag.String("config-file", "", "YAML configuration file declaring derived metrics, metrics of other AWS and Azure services, metric mappings and price validation rules (defaults to *none*)")
+	cacheJitter         = flag.Float64("cache-jitter", 0, "Fraction (0-1) of -cache by which each cache expiry varies randomly, so replicas with the same -cache don't scrape at the same instant, e.g. 0.1 (defaults to *0*, no jitter)")
+	scrapeConcurrency   = flag.Int("scrape.concurrency", 16, "Maximum fetches of a scrape (a region, account, CloudFront or the spot data feed) running at the same time across all providers; 0 = unbounded")
+	scrapeTimeout       = flag.Duration("scrape.timeout", 0, "How long a metrics request waits for a due scrape when Prometheus sends no X-Prometheus-Scrape-Timeout-Seconds header; the previous scrape's prices are served once it passes (defaults to *0*, wait for the scrape)")
+	refreshStagger      = flag.Bool("refresh-stagger", false, "Refresh regions round-robin, spread evenly over -cache, instead of all at once when the cache expires; regions that aren't due serve their last prices")
+	regionNameLabel     = flag.Bool("region-name-label", false, "Add a region_name label with the display name of the region, e.g. \"EU (Frankfurt)\" or \"West Europe\", to every pricing metric with a region label")
+	metricsFormat       = flag.String("metrics-format", "native", "Exported metric set: native (per-provider metrics), opencost (node_total_hourly_cost, node_cpu_hourly_cost and node_ram_hourly_cost per instance type and region, for use as an OpenCost pricing source) or both")
+	expanderAddr        = flag.String("grpc-expander.address", "", "Address to serve the Cluster Autoscaler gRPC expander on, e.g. :8443; picks the node groups whose scale-up costs the least per hour at the prices of the last scrape (defaults to *none*, disabled)")
+	expanderTLSCert     = flag.String("grpc-expander.tls-cert", "", "PEM certificate file of the gRPC expander; plaintext HTTP/2 if unset")
+	expanderTLSKey      = flag.String("grpc-expander.tls-key", "", "PEM private key file of -grpc-expander.tls-cert")
+	awsPricingAPIPath   = flag.String("aws.pricing-api-path", "", "Serve the scraped AWS Linux on-demand prices through a Pricing Query API (GetProducts) compatible endpoint at this path, e.g. /aws-pricing, for AWS_ENDPOINT_URL_PRICING of Karpenter in regions without Pricing API access (defaults to *none*, disabled)")
+	nodeHourlyCost      = flag.Bool("node-hourly-cost", false, "Export cloud_pricing_node_hourly_cost, the cheapest Linux price per instance type, region and lifecycle, with label_* labels joining kube-state-metrics kube_node_labels")
+	notifyWebhookURL    = flag.String("notify.webhook-url", "", "URL to POST price changes of at least -notify.threshold-percent between scrapes to, e.g. http://alertmanager:9093/api/v2/alerts (defaults to *none*, disabled)")
+	notifyWebhookFile   = flag.String("notify.webhook-url-file", "", "File holding the URL of -notify.webhook-url, e.g. a mounted Secret, keeping it out of the command line")
+	notifyWebhookFormat = flag.String("notify.webhook-format", "json", "Payload format of -notify.webhook-url: json, alertmanager (Alertmanager v2 alerts API) or slack (Slack incoming webhook message)")
+	notifyThreshold     = flag.Float64("notify.threshold-percent", 20, "Minimum change of a price in percent, up or down, between two scrapes that is notified")
+	kubecostCSVPath     = flag.String("kubecost.csv-path", "", "Write the scraped Linux on-demand prices as a Kubecost custom pricing CSV (CSV_PATH) to this local file or s3://bucket/key every -kubecost.csv-interval (defaults to *none*, disabled)")
+	kubecostCSVInterval = flag.Duration("kubecost.csv-interval", time.Hour, "How often to write -kubecost.csv-path")
+	kubecostCSVRegion   = flag.String("kubecost.csv-s3-region", "us-east-1", "Region of the -kubecost.csv-path S3 bucket")
+	kubernetesNodes     = flag.Bool("kubernetes-nodes", false, "Restrict every scrape to the regions, availability zones and instance types of the AWS and Azure Nodes of the Kubernetes cluster the exporter runs in; requires permission to list nodes")
+	instanceRegexes     = flag.String("aws.instance-regexes", "", "Comma separated list of instance types regexes (defaults to *all*)")
+	breakerFailures     = flag.Int("circuit-breaker.failures", 0, "Consecutive failed scrapes after which a provider region is skipped for -circuit-breaker.cooldown, serving its last prices (defaults to *0*, disabled)")
+	breakerCooldown     = flag.Duration("circuit-breaker.cooldown", 5*time.Minute, "How long a region is skipped once its circuit breaker opens; doubles each time it fails again, up to 6h")
+	httpConnectTimeout  = flag.Duration("http.connect-timeout", 10*time.Second, "Connect and TLS handshake timeout of non-SDK HTTP requests (bulk pricing files, ec2instances.info, exchange rates, Azure APIs)")
+	httpTimeout         = flag.Duration("http.timeout", 10*time.Minute, "Total timeout of a non-SDK HTTP request including reading the response; bulk pricing files of large regions are hundreds of MB (0 = none)")
+	httpMaxResponseMB   = flag.Int64("http.max-response-mb", 0, "Maximum response size of a non-SDK HTTP request in MiB (defaults to *0*, unlimited)")
+	httpProxy           = flag.String("http.proxy", "", "Proxy URL of all outbound HTTP(S) requests, e.g. http://proxy.corp:3128, overriding HTTP_PROXY/HTTPS_PROXY (defaults to *the environment*)")
+	noProxy             = flag.String("http.no-proxy", "", "Comma separated list of hosts or domains reached without -http.proxy (defaults to *none*)")
+	autoDetectRegion    = flag.Bool("auto-detect-region", false, "When neither -aws.regions nor -azure.regions is set, detect the AWS or Azure VM the exporter runs on from its instance metadata service and scrape only its provider and region")
+	validateRegions     = flag.Bool("validate-regions", true, "Fail at startup on configured AWS and Azure regions the exporter doesn't know, suggesting the closest one; disable to scrape regions newer than the exporter")
+	fixtureMode         = flag.String("fixture.mode", "", "record: write the responses of all upstream pricing requests to -fixture.dir; replay: serve every such request from -fixture.dir without network access (defaults to *none*, live requests)")
+	fixtureDir          = flag.String("fixture.dir", "fixtures", "Directory of the fixtures of -fixture.mode")
+	caBundle            = flag.String("http.ca-bundle", "", "PEM file of CA certificates trusted in addition to the system ones by all outbound HTTPS requests, e.g. of a TLS-intercepting proxy (defaults to *none*)")
 
 	// AWS flags
-	awsEnabled      = flag.Bool("aws-enabled", true, "Enable AWS EC2 pricing")
-	regions         = flag.String("regions", "", "Comma separated list of AWS regions to get pricing for (defaults to *all*)")
-	lifecycle       = flag.String("lifecycle", "", "Comma separated list of Lifecycles (spot or ondemand) to get pricing for (defaults to *all*)")
-	savingPlanTypes = flag.String("saving-plan-types", "", "Comma separated list of saving plans types (defaults to *none)")
+	awsEnabled            = flag.Bool("aws.enabled", true, "Enable AWS EC2 pricing")
+	regions               = flag.String("aws.regions", "", "Comma separated list of AWS regions to get pricing for, by code (eu-central-1), name (Frankfurt) or pricing file location (EU (Frankfurt)) (defaults to *all*)")
+	skipUnauthorized      = flag.Bool("aws.skip-unauthorized-regions", false, "Check every AWS region with ec2:DescribeAvailabilityZones before its first scrape and skip it from then on if the credentials aren't authorized (opt-in regions, SCP denials), exporting cloud_pricing_region_skipped instead of scrape errors")
+	regionsExclude        = flag.String("aws.regions-exclude", "", "Comma separated list of AWS regions to drop from the region list, typically used with auto-discovery (defaults to *none*)")
+	assumeRoleARNs        = flag.String("aws.assume-role-arns", "", "Comma separated list of IAM role ARNs to assume for scraping spot and savings plan data per member account, labelled with account_id (defaults to *none*, the default credentials' account only)")
+	awsEndpointURL        = flag.String("aws.endpoint-url", "", "Override the endpoint of all AWS API clients, e.g. http://localhost:4566 for LocalStack; AWS_ENDPOINT_URL is honored too (defaults to *none*)")
+	awsRetryMode          = flag.String("aws.retry-mode", "", "AWS SDK retry mode: standard or adaptive (client-side rate limiting, recommended when scraping many regions) (defaults to the SDK default, standard)")
+	awsRetryMaxAttempts   = flag.Int("aws.retry-max-attempts", 0, "Maximum attempts per AWS API call including the first (defaults to the SDK default, 3)")
+	availabilityZones     = flag.String("aws.availability-zones", "", "Comma separated list of AWS availability zones to emit spot and ondemand series for (defaults to *all*)")
+	instanceTypeOfferings = flag.Bool("aws.instance-type-offerings", false, "Export aws_ec2_instance_type_offered per instance type and availability zone from DescribeInstanceTypeOfferings, requires ec2:DescribeInstanceTypeOfferings")
+	lifecycle             = flag.String("aws.lifecycle", "", "Comma separated list of Lifecycles (spot, ondemand or reserved) to get pricing for (defaults to spot,ondemand)")
+	spotAggregation       = flag.String("aws.spot-aggregation", "none", "Spot price aggregation: none (one series per AZ) or region (per-region min/avg/max series)")
+	spotHistoryWindow     = flag.Duration("aws.spot-history-window", 0, "How far back to query spot price history, e.g. 1h; the newest price per instance type and AZ is exported (defaults to *0*, current prices only)")
+	spotSource            = flag.String("aws.spot-source", "api", "Spot price source: api (DescribeSpotPriceHistory) or feed (the account's spot data feed in S3)")
+	spotFeedBucket        = flag.String("aws.spot-feed-bucket", "", "S3 bucket of the spot data feed, required with -aws.spot-source=feed")
+	spotFeedPrefix        = flag.String("aws.spot-feed-prefix", "", "Key prefix of the spot data feed files")
+	spotFeedRegion        = flag.String("aws.spot-feed-region", "us-east-1", "Region of the spot data feed bucket")
+	ondemandPerRegion     = flag.Bool("aws.ondemand-per-region", false, "Emit a single ondemand series per region (empty availability_zone) instead of one per AZ; spot series stay per AZ")
+	ondemandBackend       = flag.String("aws.ondemand-backend", "bulk", "On-demand price source: bulk (public bulk pricing file, no credentials) or api (Pricing Query API, requires pricing:GetProducts)")
+	macHosts              = flag.Bool("aws.mac-hosts", false, "Export mac1/mac2 dedicated host prices and their 24-hour minimum allocation cost; read from the bulk pricing file with the ondemand or reserved lifecycle")
+	localStorage          = flag.Bool("aws.local-storage-price", false, "Export the hourly price per GiB of instance store (NVMe/HDD) of types with local disks, derived from the on-demand Linux price difference to the equivalent type without them; read from the bulk pricing file with the ondemand lifecycle")
+	dynamoDBEnabled       = flag.Bool("aws.dynamodb-enabled", false, "Export the DynamoDB provisioned capacity, on-demand request and storage prices of every AWS region as aws_pricing_dynamodb_*, read from the public AmazonDynamoDB offer files")
+	openSearchEnabled     = flag.Bool("aws.opensearch-enabled", false, "Export the OpenSearch Service instance and storage prices of every AWS region as aws_pricing_opensearch_*, read from the public AmazonES offer files")
+	rdsEnabled            = flag.Bool("aws.rds-enabled", false, "Export the RDS service group of every AWS region, Aurora instance and Aurora Serverless v2 ACU prices as aws_pricing_rds_aurora_*, read from the public AmazonRDS offer files")
+	cloudFrontEnabled     = flag.Bool("aws.cloudfront-enabled", false, "Export the CloudFront per-GB data transfer and per-request prices of every edge location group as aws_pricing_cloudfront_*, read from the public AmazonCloudFront offer file")
+	managedSurcharges     = flag.String("aws.managed-surcharges", "", "Comma separated list of managed services whose hourly surcharge per EC2 instance type is exported as aws_pricing_ec2_managed_surcharge, read from their public offer files. Accepted values: emr (EMR on EC2), eks (EKS Auto Mode) (defaults to *none*)")
+	effectiveRatesWindow  = flag.Duration("aws.effective-rates-window", 0, "Export aws_pricing_ec2_effective from Cost Explorer over this trailing window, e.g. 168h; billed per request, requires ce:GetCostAndUsage (defaults to *0*, disabled)")
+	burstableUtilization  = flag.Float64("aws.burstable-utilization", 0, "Assumed average CPU utilization in percent used to export the unlimited-mode effective price of t2/t3/t3a/t4g instances (defaults to *0*, disabled)")
+	cpuMemoryRatio        = flag.Float64("aws.cpu-memory-ratio", aws.CpuMemRelation, "CPU-to-memory cost ratio used to split EC2 prices into aws_pricing_ec2_vcpu and aws_pricing_ec2_memory: one vCPU costs as much as this many GB of memory")
+	currencies            = flag.String("currencies", "", "Comma separated list of ISO 4217 currency codes (e.g. USD,EUR,GBP) to emit every price in, distinguished by a currency label; converted from USD with the ECB daily reference rates (defaults to *USD only, no currency label*)")
+	pricePrecision        = flag.Int("price-precision", -1, "Round every price to this many decimal places before exporting it, e.g. 6 (defaults to *-1*, unrounded)")
+	cpuMemoryRegression   = flag.Bool("aws.cpu-memory-regression", false, "Fit the CPU-to-memory cost ratio to each scrape's Linux on-demand prices by least squares instead of using -aws.cpu-memory-ratio (which then only applies until the first fit). Requires the ondemand lifecycle")
+	savingPlanTypes       = flag.String("aws.saving-plan-types", "", "Comma separated list of saving plans types (defaults to *none)")
+	savingPlanPageSize    = flag.Int("aws.saving-plan-page-size", 0, "MaxResults per DescribeSavingsPlansOfferingRates request, up to 1000 (defaults to *100*)")
+	spotPageSize          = flag.Int("aws.spot-page-size", 0, "MaxResults per DescribeSpotPriceHistory request, up to 1000, to save round trips in large regions (defaults to *100*)")
+	pricingPageSize       = flag.Int("aws.pricing-page-size", 0, "MaxResults per Pricing Query API (GetProducts) request of -aws.ondemand-backend=api and awsMetrics, up to 100 (defaults to *100*)")
+	savingPlanPageDelay   = flag.Duration("aws.saving-plan-page-delay", 0, "Delay between savings plan page requests, e.g. 200ms, to avoid API throttling (defaults to *none*)")
+	instanceFamilies      = flag.String("aws.instance-families", "", "Comma separated list of AWS instance families, e.g. m5,c6g, applied server-side to spot and savings plan requests (defaults to *all*)")
+	instanceRefresh       = flag.Duration("aws.instance-refresh-interval", 0, "How often to reload instance specifications (vCPU, memory) from ec2instances.info, e.g. 24h (defaults to *0*, loaded once at startup)")
+	instanceDataSource    = flag.String("aws.instance-data-source", "http", "Source of instance specifications (vCPU, memory): http (ec2instances.info), api (EC2 DescribeInstanceTypes, requires ec2:DescribeInstanceTypes) or embedded (bundled snapshot)")
+	architectures         = flag.String("aws.architectures", "", "Comma separated list of AWS instance architectures to export. Accepted values: x86_64, arm64, i386, x86_64_mac, arm64_mac (defaults to *all*)")
+	minVCpu               = flag.Int("aws.min-vcpu", 0, "Minimum vCPU count of exported AWS instance types (defaults to *no limit*)")
+	maxVCpu               = flag.Int("aws.max-vcpu", 0, "Maximum vCPU count of exported AWS instance types (defaults to *no limit*)")
+	minMemoryGB           = flag.Float64("aws.min-memory-gb", 0, "Minimum memory in GiB of exported AWS instance types (defaults to *no limit*)")
+	maxMemoryGB           = flag.Float64("aws.max-memory-gb", 0, "Maximum memory in GiB of exported AWS instance types (defaults to *no limit*)")
 
 	// Azure flags
-	azureEnabled          = flag.Bool("azure-enabled", true, "Enable Azure VM on-demand pricing")
-	azureRegions          = flag.String("azure-regions", "", "Comma separated list of Azure regions (required when azure-enabled)")
-	azureOperatingSystems = flag.String("azure-operating-systems", "Linux", "Comma separated list of Azure OS types: Linux, Windows")
-	azureInstanceRegexes  = flag.String("azure-instance-regexes", "", "Comma separated list of Azure instance type regexes (defaults to *all*)")
+	azureEnabled          = flag.Bool("azure.enabled", true, "Enable Azure VM on-demand pricing")
+	azureRegions          = flag.String("azure.regions", "", "Comma separated list of Azure regions, by code (westeurope), display name (West Europe) or Retail Prices API location (EU West) (required when azure-enabled)")
+	azureOperatingSystems = flag.String("azure.operating-systems", "Linux", "Comma separated list of Azure OS types: Linux, Windows")
+	azureLifecycle        = flag.String("azure.lifecycle", "ondemand", "Comma separated list of Azure VM lifecycles: ondemand, spot, lowpriority (Batch Low Priority meters)")
+	azurePriceTypes       = flag.String("azure.price-types", "Consumption", "Comma separated list of Azure retail price types: Consumption, DevTestConsumption")
+	azureDetailLabels     = flag.Bool("azure.detail-labels", false, "Add meter_name and product_name labels to azure_pricing_vm for reconciling prices against Azure invoices")
+	azureRateLimit        = flag.Float64("azure.rate-limit", 0, "Maximum Azure Retail Prices API requests per second, shared by all regions; Retry-After responses pause all regions regardless (defaults to *0*, unlimited)")
+	azureRateBurst        = flag.Int("azure.rate-burst", 1, "Requests allowed at once above -azure.rate-limit")
+	azureMaxAttempts      = flag.Int("azure.max-attempts", 3, "Attempts per Azure Retail Prices API request including the first, retried on errors, 429 and 5xx responses")
+	azureInstanceRegexes  = flag.String("azure.instance-regexes", "", "Comma separated list of Azure instance type regexes (defaults to *all*)")
+	azureAKSEnabled       = flag.Bool("azure.aks-enabled", false, "Export the hourly AKS cluster fee of the Standard and Premium tiers of every Azure region as azure_pricing_aks_cluster")
+	azureCosmosDBEnabled  = flag.Bool("azure.cosmosdb-enabled", false, "Export the Cosmos DB service group of every Azure region, provisioned throughput, serverless request unit and storage prices as azure_pricing_cosmosdb_*")
+	azureStorageEnabled   = flag.Bool("azure.storage-enabled", false, "Export the storage service group of every Azure region, Azure Files storage prices by tier and redundancy as azure_pricing_files_storage_gb_month")
+	azureNetAppFiles      = flag.Bool("azure.netapp-files", false, "Add the Azure NetApp Files capacity prices by service level to the storage service group as azure_pricing_netapp_files_capacity_gib_hour (requires -azure.storage-enabled)")
+	azureFunctionsEnabled = flag.Bool("azure.functions-enabled", false, "Export the Functions Premium plan SKU prices and consumption plan execution prices of every Azure region as azure_pricing_functions_*")
+
+	// Fake provider flags
+	fakeRegions       = flag.Int("fake.regions", 0, "Export synthetic random-walk prices of this many regions as fake_pricing_instance, for load testing without cloud API calls (defaults to *0*, disabled)")
+	fakeInstanceTypes = flag.Int("fake.instance-types", 1000, "Synthetic instance types per -fake.regions region; each has an ondemand and a spot series")
+	fakeVolatility    = flag.Float64("fake.volatility", 0.01, "Maximum relative change of a synthetic price per scrape, e.g. 0.01 for ±1%")
+	fakeSeed          = flag.Int64("fake.seed", 1, "Seed of the synthetic prices; the same seed generates the same prices")
 )
 
 func main() {
-	flag.Parse()
+	args := os.Args[1:]
+	selfTestMode := len(args) > 0 && args[0] == selfTestCommand
+	if selfTestMode {
+		args = args[1:]
+	}
+	registerFlagAliases(flag.CommandLine, flagAliases)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		log.Fatal(err)
+	}
 	parsedLevel, err := log.ParseLevel(*rawLevel)
 	if err != nil {
 		log.WithError(err).Warnf("Couldn't parse log level, using default: %s", log.GetLevel())
@@ -56,17 +174,130 @@ func main() {
 		log.SetLevel(parsedLevel)
 		log.Debugf("Set log level to %s", parsedLevel)
 	}
+	if err = logging.Configure(*moduleLevels, *debugSample); err != nil {
+		log.Fatal(err)
+	}
+	warnDeprecatedFlags(flag.CommandLine, flagAliases)
 
-	log.Infof("Starting Cloud Price exporter. [log-level=%s, aws-enabled=%v, regions=%s, azure-enabled=%v, azure-regions=%s, cache=%d]", *rawLevel, *awsEnabled, *regions, *azureEnabled, *azureRegions, *cache)
+	log.Infof("Starting Cloud Price exporter. [log.level=%s, aws.enabled=%v, aws.regions=%s, azure.enabled=%v, azure.regions=%s, cache=%d]", *rawLevel, *awsEnabled, *regions, *azureEnabled, *azureRegions, *cache)
 
-	if !*awsEnabled && !*azureEnabled {
-		log.Fatal("At least one provider must be enabled (--aws-enabled or --azure-enabled)")
+	regionsDetected := false
+	if *autoDetectRegion && *fixtureMode != fixture.ModeReplay {
+		explicit := map[string]string{}
+		flag.Visit(func(f *flag.Flag) { explicit[canonicalFlagName(f.Name)] = f.Value.String() })
+		if _, ok := explicit["aws.regions"]; !ok {
+			if _, ok := explicit["azure.regions"]; !ok {
+				loc, err := metadata.NewDetector().Detect(context.Background())
+				if err != nil {
+					log.WithError(err).Debug("Couldn't detect the cloud the exporter runs on, keeping the default regions")
+				} else {
+					log.Infof("Detected %s region %s [zone=%s], scraping only it", loc.Provider, loc.Region, loc.Zone)
+					regionsDetected = true
+					for name, value := range locationFlags(loc, explicit) {
+						if err := flag.Set(name, value); err != nil {
+							log.Fatal(err)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if !*awsEnabled && !*azureEnabled && *fakeRegions == 0 {
+		log.Fatal("At least one provider must be enabled (--aws.enabled, --azure.enabled or --fake.regions)")
+	}
+	if err = validateMetricsFormat(*metricsFormat); err != nil {
+		log.Fatal(err)
+	}
+	if err = validateCurrencies(splitAndTrim(*currencies)); err != nil {
+		log.Fatal(err)
+	}
+	if *pricePrecision > 15 {
+		log.Fatalf("price-precision must be at most 15 decimal places, got %d", *pricePrecision)
+	}
+	if *cacheJitter < 0 || *cacheJitter > 1 {
+		log.Fatalf("cache-jitter must be between 0 and 1, got %v", *cacheJitter)
+	}
+	if *scrapeTimeout < 0 {
+		log.Fatalf("scrape.timeout must not be negative, got %s", *scrapeTimeout)
+	}
+	if *scrapeConcurrency < 0 {
+		log.Fatalf("scrape.concurrency must not be negative, got %d", *scrapeConcurrency)
+	}
+	if *breakerFailures < 0 {
+		log.Fatalf("circuit-breaker.failures must not be negative, got %d", *breakerFailures)
+	}
+	if *breakerFailures > 0 && *breakerCooldown <= 0 {
+		log.Fatalf("circuit-breaker.cooldown must be positive, got %s", *breakerCooldown)
+	}
+	if (*expanderTLSCert == "") != (*expanderTLSKey == "") {
+		log.Fatal("grpc-expander.tls-cert and grpc-expander.tls-key must be set together")
+	}
+	if *kubecostCSVPath != "" && *kubecostCSVInterval <= 0 {
+		log.Fatalf("kubecost.csv-interval must be positive, got %s", *kubecostCSVInterval)
+	}
+	if *httpConnectTimeout < 0 || *httpTimeout < 0 || *httpMaxResponseMB < 0 {
+		log.Fatal("http.connect-timeout, http.timeout and http.max-response-mb must not be negative")
+	}
+	httpOpts := httpclient.Options{
+		ConnectTimeout:   *httpConnectTimeout,
+		Timeout:          *httpTimeout,
+		MaxResponseBytes: *httpMaxResponseMB << 20,
+		NoProxy:          splitAndTrim(*noProxy),
+	}
+	if *httpProxy != "" {
+		httpOpts.Proxy, err = httpclient.ParseProxy(*httpProxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Sending outbound requests through proxy %s", httpOpts.Proxy.Redacted())
+	}
+	if *caBundle != "" {
+		httpOpts.RootCAs, err = httpclient.LoadCABundle(*caBundle)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	httpClient := httpclient.New(httpOpts)
+	// The AWS SDK has its own timeouts and retries; only share the proxy and CAs.
+	var sdkHTTPClient *http.Client
+	if httpOpts.Proxy != nil || httpOpts.RootCAs != nil {
+		sdkHTTPClient = httpclient.New(httpclient.Options{ConnectTimeout: httpOpts.ConnectTimeout, Proxy: httpOpts.Proxy, NoProxy: httpOpts.NoProxy, RootCAs: httpOpts.RootCAs})
+	}
+	if selfTestMode {
+		if runSelfTest(os.Stdout, httpClient, sdkHTTPClient) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	// Notifications are never recorded or replayed.
+	webhookClient := httpClient
+	var sdkCredentials awssdk.CredentialsProvider
+	if *fixtureMode != "" {
+		httpClient, err = fixture.Wrap(httpClient, *fixtureMode, *fixtureDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if sdkHTTPClient == nil {
+			sdkHTTPClient = httpclient.New(httpclient.Options{ConnectTimeout: httpOpts.ConnectTimeout})
+		}
+		sdkHTTPClient, err = fixture.Wrap(sdkHTTPClient, *fixtureMode, *fixtureDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *fixtureMode == fixture.ModeReplay {
+			// Requests are still signed, but never sent.
+			sdkCredentials = credentials.NewStaticCredentialsProvider("replay", "replay", "")
+		}
+		log.Infof("Fixture mode %s [dir=%s]", *fixtureMode, *fixtureDir)
 	}
 
 	// --- AWS setup ---
 	var reg []string
 	var pds, oss, lc, spt []string
 	var instRegCompiled []*regexp.Regexp
+	var accounts []aws.Account
+	clientFactory := aws.SDKClientFactory{Endpoint: *awsEndpointURL, HTTPClient: sdkHTTPClient, Credentials: sdkCredentials}
 
 	if *awsEnabled {
 		if len(*regions) == 0 {
@@ -76,6 +307,15 @@ func main() {
 				log.WithError(err).Errorf("error while initializing aws client to list available regions")
 				return
 			}
+			if *awsEndpointURL != "" {
+				cfg.BaseEndpoint = awssdk.String(*awsEndpointURL)
+			}
+			if sdkHTTPClient != nil {
+				cfg.HTTPClient = sdkHTTPClient
+			}
+			if sdkCredentials != nil {
+				cfg.Credentials = sdkCredentials
+			}
 
 			ec2Svc := ec2.NewFromConfig(cfg)
 			var r *ec2.DescribeRegionsOutput
@@ -89,8 +329,20 @@ func main() {
 				reg = append(reg, *region.RegionName)
 			}
 		} else {
-			reg = splitAndTrim(*regions)
+			reg = regionname.Codes("aws", splitAndTrim(*regions))
+		}
+		excluded := regionname.Codes("aws", splitAndTrim(*regionsExclude))
+		if *validateRegions && !regionsDetected {
+			// Discovered regions exist, only check the configured ones.
+			configured := excluded
+			if len(*regions) > 0 {
+				configured = append(slices.Clip(reg), excluded...)
+			}
+			if err = regionname.Validate("aws", configured); err != nil {
+				log.Fatal(err)
+			}
 		}
+		reg = excludeRegions(reg, excluded)
 
 		pds = splitAndTrim(*productDescriptions)
 		oss = splitAndTrim(*operatingSystems)
@@ -112,6 +364,85 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		if *savingPlanPageSize < 0 || *savingPlanPageSize > int(aws.MaxSavingPlanResultsPerPage) {
+			log.Fatalf("aws.saving-plan-page-size must be between 0 and %d, got %d", aws.MaxSavingPlanResultsPerPage, *savingPlanPageSize)
+		}
+		if *spotPageSize < 0 || *spotPageSize > int(aws.MaxSpotResultsPerPage) {
+			log.Fatalf("aws.spot-page-size must be between 0 and %d, got %d", aws.MaxSpotResultsPerPage, *spotPageSize)
+		}
+		if *pricingPageSize < 0 || *pricingPageSize > int(aws.MaxPricingResultsPerPage) {
+			log.Fatalf("aws.pricing-page-size must be between 0 and %d, got %d", aws.MaxPricingResultsPerPage, *pricingPageSize)
+		}
+		err = validateArchitectures(splitAndTrim(*architectures))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = validateSpotAggregation(*spotAggregation)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *cpuMemoryRatio <= 0 {
+			log.Fatalf("aws.cpu-memory-ratio must be positive, got %g", *cpuMemoryRatio)
+		}
+		if *cpuMemoryRegression && !provider.Contains(lc, "ondemand") {
+			log.Fatal("aws.cpu-memory-regression requires the ondemand lifecycle")
+		}
+		if *burstableUtilization < 0 || *burstableUtilization > 100 {
+			log.Fatalf("aws.burstable-utilization must be between 0 and 100, got %g", *burstableUtilization)
+		}
+		err = validateOnDemandBackend(*ondemandBackend)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *macHosts && *ondemandBackend != aws.OnDemandBackendBulk {
+			log.Fatalf("aws.mac-hosts requires aws.ondemand-backend '%s'", aws.OnDemandBackendBulk)
+		}
+		if *localStorage && (*ondemandBackend != aws.OnDemandBackendBulk || !provider.Contains(lc, "ondemand")) {
+			log.Fatalf("aws.local-storage-price requires the ondemand lifecycle and aws.ondemand-backend '%s'", aws.OnDemandBackendBulk)
+		}
+		err = validateManagedSurcharges(splitAndTrim(*managedSurcharges))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = validateSpotSource(*spotSource, *spotFeedBucket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *effectiveRatesWindow != 0 && *effectiveRatesWindow < 24*time.Hour {
+			log.Fatalf("aws.effective-rates-window must be at least 24h, got %s", *effectiveRatesWindow)
+		}
+		err = validateInstanceDataSource(*instanceDataSource)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *instanceRefresh < 0 {
+			log.Fatalf("aws.instance-refresh-interval must not be negative, got %s", *instanceRefresh)
+		}
+		if *spotHistoryWindow < 0 {
+			log.Fatalf("aws.spot-history-window must not be negative, got %s", *spotHistoryWindow)
+		}
+		err = validateResourceBounds(*minVCpu, *maxVCpu, *minMemoryGB, *maxMemoryGB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *awsRetryMode != "" {
+			clientFactory.RetryMode, err = awssdk.ParseRetryMode(*awsRetryMode)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *awsRetryMaxAttempts < 0 {
+			log.Fatalf("aws.retry-max-attempts must not be negative, got %d", *awsRetryMaxAttempts)
+		}
+		clientFactory.RetryMaxAttempts = *awsRetryMaxAttempts
+		for _, roleARN := range splitAndTrim(*assumeRoleARNs) {
+			var account aws.Account
+			account, err = aws.NewAssumeRoleAccount(clientFactory, roleARN)
+			if err != nil {
+				log.Fatal(err)
+			}
+			accounts = append(accounts, account)
+		}
 	}
 
 	instReg := splitAndTrim(*instanceRegexes)
@@ -127,15 +458,29 @@ func main() {
 
 	// --- Azure setup ---
 	var azureCfg *exporter.AzureConfig
+	var azureReg []string
 	if *azureEnabled {
-		azureReg := splitAndTrim(*azureRegions)
+		azureReg = regionname.Codes("azure", splitAndTrim(*azureRegions))
+		if *validateRegions && !regionsDetected {
+			if err = regionname.Validate("azure", azureReg); err != nil {
+				log.Fatal(err)
+			}
+		}
 		if len(azureReg) == 0 {
-			log.Warn("Azure enabled but no --azure-regions specified, skipping Azure")
+			log.Warn("Azure enabled but no --azure.regions specified, skipping Azure")
 		} else {
 			azureOSS := splitAndTrim(*azureOperatingSystems)
 			if len(azureOSS) == 0 {
 				azureOSS = []string{"Linux"}
 			}
+			azurePT := splitAndTrim(*azurePriceTypes)
+			if err = validateAzurePriceTypes(azurePT); err != nil {
+				log.Fatal(err)
+			}
+			azureLC := splitAndTrim(*azureLifecycle)
+			if err = validateAzureLifecycles(azureLC); err != nil {
+				log.Fatal(err)
+			}
 			azureInstReg := splitAndTrim(*azureInstanceRegexes)
 			if len(azureInstReg) == 0 {
 				azureInstReg = []string{".*"}
@@ -145,23 +490,178 @@ func main() {
 			if err != nil {
 				log.Fatalf("invalid azure instance regex: %v", err)
 			}
+			azureFactory := azure.NewDefaultClientFactory()
+			azureFactory.SetHTTPClient(httpClient)
+			if *azureRateLimit < 0 || *azureRateBurst < 1 || *azureMaxAttempts < 1 {
+				log.Fatal("azure.rate-limit must not be negative, azure.rate-burst and azure.max-attempts must be at least 1")
+			}
+			azureFactory.SetRateLimit(*azureRateLimit, *azureRateBurst)
+			azureFactory.SetMaxAttempts(*azureMaxAttempts)
+			if creds, ok := azure.CredentialsFromEnv(); ok {
+				log.Infof("Azure credentials found, adding memory/vcpu labels from the Resource SKUs API [subscription=%s]", creds.SubscriptionID)
+				azureFactory.SetCredentials(creds)
+			}
 			azureCfg = &exporter.AzureConfig{
 				Regions:          azureReg,
 				OperatingSystems: azureOSS,
+				PriceTypes:       azurePT,
+				Lifecycles:       azureLC,
+				DetailLabels:     *azureDetailLabels,
 				InstanceRegexes:  azureInstRegCompiled,
-				ClientFactory:    azure.NewDefaultClientFactory(),
+				ClientFactory:    azureFactory,
 			}
 		}
 	}
 
-	exp, err := exporter.NewExporter(pds, oss, reg, lc, *cache, instRegCompiled, spt, &aws.SDKClientFactory{}, azureCfg)
+	opts := []exporter.Option{
+		exporter.WithResourceBounds(int32(*minVCpu), int32(*maxVCpu), *minMemoryGB, *maxMemoryGB),
+		exporter.WithInstanceFamilies(splitAndTrim(*instanceFamilies)),
+		exporter.WithInstanceDataSource(*instanceDataSource),
+		exporter.WithInstanceRefresh(*instanceRefresh),
+		exporter.WithArchitectures(splitAndTrim(*architectures)),
+		exporter.WithAvailabilityZones(splitAndTrim(*availabilityZones)),
+		exporter.WithInstanceTypeOfferings(*instanceTypeOfferings),
+		exporter.WithSpotAggregation(*spotAggregation),
+		exporter.WithSpotHistoryWindow(*spotHistoryWindow),
+		exporter.WithOnDemandPerRegion(*ondemandPerRegion),
+		exporter.WithOnDemandBackend(*ondemandBackend),
+		exporter.WithMacHosts(*macHosts),
+		exporter.WithLocalStorage(*localStorage),
+		exporter.WithDynamoDB(*dynamoDBEnabled),
+		exporter.WithOpenSearch(*openSearchEnabled),
+		exporter.WithRDS(*rdsEnabled),
+		exporter.WithCloudFront(*awsEnabled && *cloudFrontEnabled),
+		exporter.WithManagedSurcharges(splitAndTrim(*managedSurcharges)),
+		exporter.WithAzureAKS(*azureAKSEnabled),
+		exporter.WithAzureFunctions(*azureFunctionsEnabled),
+		exporter.WithAzureCosmosDB(*azureCosmosDBEnabled),
+		exporter.WithAzureStorage(*azureStorageEnabled),
+		exporter.WithAzureNetAppFiles(*azureNetAppFiles),
+		exporter.WithEffectiveRates(*effectiveRatesWindow),
+		exporter.WithSavingPlanPaging(int32(*savingPlanPageSize), *savingPlanPageDelay),
+		exporter.WithSpotPageSize(int32(*spotPageSize)),
+		exporter.WithPricingPageSize(int32(*pricingPageSize)),
+		exporter.WithBurstableUtilization(*burstableUtilization / 100),
+		exporter.WithCPUMemRatio(*cpuMemoryRatio),
+		exporter.WithPricePrecision(*pricePrecision),
+		exporter.WithRegionNameLabel(*regionNameLabel),
+		exporter.WithCircuitBreaker(*breakerFailures, *breakerCooldown),
+		exporter.WithSkipUnauthorizedRegions(*skipUnauthorized),
+		exporter.WithHTTPClient(httpClient),
+		exporter.WithCacheJitter(*cacheJitter),
+		exporter.WithRefreshStagger(*refreshStagger),
+		exporter.WithScrapeConcurrency(*scrapeConcurrency),
+		exporter.WithExternalRefresh(),
+		exporter.WithMetricsFormat(*metricsFormat),
+		exporter.WithNodeCost(*nodeHourlyCost),
+	}
+	if *fakeRegions > 0 {
+		fakeProvider, err := fake.New(fake.Config{Regions: *fakeRegions, InstanceTypes: *fakeInstanceTypes, Volatility: *fakeVolatility, Seed: *fakeSeed})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Exporting synthetic prices [regions=%d, instance-types=%d, series=%d]", *fakeRegions, *fakeInstanceTypes, 2*(*fakeRegions)*(*fakeInstanceTypes))
+		opts = append(opts, exporter.WithFakeProvider(fakeProvider))
+	}
+	var fileConfig *appconfig.Config
+	if *configFile != "" {
+		cfg, err := appconfig.Load(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fileConfig = cfg
+		opts = append(opts, exporter.WithDerivedMetrics(cfg.DerivedMetrics), exporter.WithAWSMetrics(cfg.AWSMetrics), exporter.WithAzureMetrics(cfg.AzureMetrics), exporter.WithMetricMappings(cfg.MetricMappings), exporter.WithValidation(cfg.Validation))
+	}
+	webhookURL := *notifyWebhookURL
+	if *notifyWebhookFile != "" {
+		if webhookURL != "" {
+			log.Fatal("notify.webhook-url and notify.webhook-url-file are mutually exclusive")
+		}
+		data, err := os.ReadFile(*notifyWebhookFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		webhookURL = strings.TrimSpace(string(data))
+	}
+	if webhookURL != "" {
+		if *notifyThreshold <= 0 {
+			log.Fatalf("notify.threshold-percent must be positive, got %g", *notifyThreshold)
+		}
+		webhook, err := notify.NewWebhook(webhookURL, *notifyWebhookFormat, *notifyThreshold, webhookClient)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, exporter.WithPriceChangeNotifier(webhook, *notifyThreshold))
+	}
+	if *kubernetesNodes {
+		nodeClient, err := kube.NewInClusterClient(httpOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Restricting scrapes to the regions, zones and instance types of the cluster's nodes")
+		opts = append(opts, exporter.WithNodeLister(nodeClient))
+	}
+	if len(accounts) > 0 {
+		opts = append(opts, exporter.WithAccounts(accounts))
+	}
+	if *cpuMemoryRegression {
+		opts = append(opts, exporter.WithCPUMemRegression())
+	}
+	if codes := splitAndTrim(*currencies); len(codes) > 0 {
+		rates, err := loadRates(httpClient, codes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, exporter.WithCurrencies(codes, rates))
+	}
+	if *spotSource == aws.SpotSourceFeed {
+		opts = append(opts, exporter.WithSpotFeed(aws.SpotFeedConfig{Bucket: *spotFeedBucket, Prefix: *spotFeedPrefix, Region: *spotFeedRegion}))
+	}
+
+	// Cancelled on shutdown to abort in-flight scrapes.
+	ctx, cancelScrapes := context.WithCancel(context.Background())
+	defer cancelScrapes()
+	opts = append(opts, exporter.WithContext(ctx))
+
+	exp, err := exporter.NewExporter(pds, oss, reg, lc, *cache, instRegCompiled, spt, &clientFactory, azureCfg, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	prometheus.MustRegister(exp)
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	http.Handle(*metricsPath, metricsHandler(exp, promhttp.Handler(), *scrapeTimeout))
 	http.HandleFunc("/", rootHandler)
+	if *configPath != "" {
+		handler, err := configHandler(newEffectiveConfig(flag.CommandLine, flagAliases, reg, azureReg, os.Environ(), fileConfig))
+		if err != nil {
+			log.Fatal(err)
+		}
+		http.Handle(*configPath, handler)
+	}
+	if *awsPricingAPIPath != "" {
+		path := "/" + strings.Trim(*awsPricingAPIPath, "/")
+		pricingHandler := awspricing.NewHandler(exp)
+		http.Handle(path, pricingHandler)
+		http.Handle(path+"/", pricingHandler)
+		log.Infof("Serving AWS Pricing API compatible endpoint [path=%s]", path)
+	}
+
+	if *kubecostCSVPath != "" {
+		var s3Client aws.S3API
+		if _, _, isS3, err := kubecost.ParseS3URL(*kubecostCSVPath); err != nil {
+			log.Fatal(err)
+		} else if isS3 {
+			if s3Client, err = clientFactory.NewS3Client(*kubecostCSVRegion); err != nil {
+				log.Fatal(err)
+			}
+		}
+		writer, err := kubecost.NewWriter(exp, *kubecostCSVPath, s3Client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Writing Kubecost custom pricing CSV [dest=%s, interval=%s]", *kubecostCSVPath, *kubecostCSVInterval)
+		go writer.Run(ctx, *kubecostCSVInterval)
+	}
 
 	srv := &http.Server{
 		Addr:         *addr,
@@ -170,13 +670,44 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	var expanderSrv *http.Server
+	if *expanderAddr != "" {
+		expanderSrv = &http.Server{
+			Addr:        *expanderAddr,
+			Handler:     expander.NewHandler(exp),
+			ReadTimeout: 30 * time.Second,
+			IdleTimeout: 5 * time.Minute,
+		}
+		expanderSrv.Protocols = new(http.Protocols)
+		expanderSrv.Protocols.SetHTTP2(true)
+		expanderSrv.Protocols.SetUnencryptedHTTP2(true)
+		go func() {
+			log.Infof("Starting Cluster Autoscaler gRPC expander [address=%s]", *expanderAddr)
+			var err error
+			if *expanderTLSCert != "" {
+				err = expanderSrv.ListenAndServeTLS(*expanderTLSCert, *expanderTLSKey)
+			} else {
+				err = expanderSrv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	go func() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 		sig := <-sigCh
 		log.Infof("Received %s, shutting down...", sig)
+		cancelScrapes()
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
+		if expanderSrv != nil {
+			if err := expanderSrv.Shutdown(ctx); err != nil {
+				log.WithError(err).Error("error during gRPC expander shutdown")
+			}
+		}
 		if err := srv.Shutdown(ctx); err != nil {
 			log.WithError(err).Error("error during server shutdown")
 		}
@@ -188,6 +719,25 @@ func main() {
 	}
 }
 
+// locationFlags returns the flag values restricting the exporter to the
+// detected provider and region: the other provider is disabled unless it was
+// enabled explicitly. explicit maps the flags set on the command line to
+// their values; nothing changes if the detected provider was disabled.
+func locationFlags(loc metadata.Location, explicit map[string]string) map[string]string {
+	enabledFlag, regionsFlag, otherFlag := "aws.enabled", "aws.regions", "azure.enabled"
+	if loc.Provider == "azure" {
+		enabledFlag, regionsFlag, otherFlag = "azure.enabled", "azure.regions", "aws.enabled"
+	}
+	if explicit[enabledFlag] == "false" {
+		return nil
+	}
+	values := map[string]string{regionsFlag: loc.Region}
+	if _, ok := explicit[otherFlag]; !ok {
+		values[otherFlag] = "false"
+	}
+	return values
+}
+
 func splitAndTrim(str string) []string {
 	if str == "" {
 		return []string{}
@@ -199,12 +749,39 @@ func splitAndTrim(str string) []string {
 	return parts
 }
 
+// excludeRegions returns regions without any entry listed in excluded.
+func excludeRegions(regions, excluded []string) []string {
+	if len(excluded) == 0 {
+		return regions
+	}
+	kept := make([]string, 0, len(regions))
+	for _, region := range regions {
+		if provider.Contains(excluded, region) {
+			log.Debugf("Excluding region %s", region)
+			continue
+		}
+		kept = append(kept, region)
+	}
+	return kept
+}
+
+// spotProductDescriptions lists the product descriptions accepted by
+// DescribeSpotPriceHistory.
+var spotProductDescriptions = []string{
+	"Linux/UNIX",
+	"SUSE Linux",
+	"Windows",
+	"Red Hat Enterprise Linux",
+	"Linux/UNIX (Amazon VPC)",
+	"SUSE Linux (Amazon VPC)",
+	"Windows (Amazon VPC)",
+	"Red Hat Enterprise Linux (Amazon VPC)",
+}
+
 func validateProductDesc(pds []string) error {
 	for _, desc := range pds {
-		if desc != "Linux/UNIX" && desc != "Linux/UNIX (Amazon VPC)" &&
-			desc != "SUSE Linux" && desc != "SUSE Linux (Amazon VPC)" &&
-			desc != "Windows" && desc != "Windows (Amazon VPC)" {
-			return fmt.Errorf("product description '%s' is not recognized. Available product descriptions: Linux/UNIX, SUSE Linux, Windows, Linux/UNIX (Amazon VPC), SUSE Linux (Amazon VPC), Windows (Amazon VPC)", desc)
+		if !provider.Contains(spotProductDescriptions, desc) {
+			return fmt.Errorf("product description '%s' is not recognized. Available product descriptions: %s", desc, strings.Join(spotProductDescriptions, ", "))
 		}
 	}
 	return nil
@@ -234,14 +811,190 @@ func validateSavingPlanTypes(spt []string) error {
 	return nil
 }
 
+func validateArchitectures(archs []string) error {
+	for _, arch := range archs {
+		if arch != "x86_64" &&
+			arch != "arm64" &&
+			arch != "i386" &&
+			arch != "x86_64_mac" &&
+			arch != "arm64_mac" {
+			return fmt.Errorf("architecture '%s' is not recognized. Available architectures: x86_64, arm64, i386, x86_64_mac, arm64_mac", arch)
+		}
+	}
+	return nil
+}
+
+func validateSpotAggregation(mode string) error {
+	if mode != aws.SpotAggregationNone && mode != aws.SpotAggregationRegion {
+		return fmt.Errorf("spot aggregation '%s' is not recognized. Available modes: none, region", mode)
+	}
+	return nil
+}
+
+func validateMetricsFormat(format string) error {
+	switch format {
+	case exporter.MetricsFormatNative, exporter.MetricsFormatOpenCost, exporter.MetricsFormatBoth:
+		return nil
+	}
+	return fmt.Errorf("metrics format '%s' is not recognized. Available formats: native, opencost, both", format)
+}
+
+func validateOnDemandBackend(backend string) error {
+	if backend != aws.OnDemandBackendBulk && backend != aws.OnDemandBackendAPI {
+		return fmt.Errorf("ondemand backend '%s' is not recognized. Available backends: %s, %s", backend, aws.OnDemandBackendBulk, aws.OnDemandBackendAPI)
+	}
+	return nil
+}
+
+func validateManagedSurcharges(services []string) error {
+	for _, service := range services {
+		if !provider.Contains(aws.ManagedServices, service) {
+			return fmt.Errorf("managed service '%s' is not recognized. Available services: %s", service, strings.Join(aws.ManagedServices, ", "))
+		}
+	}
+	return nil
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+func validateCurrencies(codes []string) error {
+	for _, code := range codes {
+		if !currencyCode.MatchString(code) {
+			return fmt.Errorf("currency '%s' is not an ISO 4217 code, e.g. USD, EUR, GBP", code)
+		}
+	}
+	return nil
+}
+
+// loadRates loads the exchange rates of codes at startup. Codes without an ECB
+// reference rate are an error; while the feed is unreachable, prices in other
+// currencies than USD are exported once a scrape has loaded the rates.
+func loadRates(httpClient *http.Client, codes []string) (*currency.Rates, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rates := currency.NewRates()
+	if err := rates.Load(ctx, httpClient); err != nil {
+		log.WithError(err).Warnf("Couldn't load exchange rates at startup, retrying on every scrape [currencies=%s]", strings.Join(codes, ","))
+		return rates, nil
+	}
+	var missing []string
+	for _, code := range codes {
+		if !rates.Has(code) {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("currencies %s have no ECB reference rate", strings.Join(missing, ", "))
+	}
+	return rates, nil
+}
+
+func validateAzurePriceTypes(priceTypes []string) error {
+	for _, priceType := range priceTypes {
+		if priceType != azure.PriceTypeConsumption && priceType != azure.PriceTypeDevTestConsumption {
+			return fmt.Errorf("azure price type '%s' is not recognized. Available price types: %s, %s", priceType, azure.PriceTypeConsumption, azure.PriceTypeDevTestConsumption)
+		}
+	}
+	return nil
+}
+
+func validateAzureLifecycles(lifecycles []string) error {
+	for _, lifecycle := range lifecycles {
+		switch lifecycle {
+		case azure.LifecycleOnDemand, azure.LifecycleSpot, azure.LifecycleLowPriority:
+		default:
+			return fmt.Errorf("azure lifecycle '%s' is not recognized. Available lifecycles: %s, %s, %s", lifecycle, azure.LifecycleOnDemand, azure.LifecycleSpot, azure.LifecycleLowPriority)
+		}
+	}
+	return nil
+}
+
+func validateInstanceDataSource(source string) error {
+	switch source {
+	case aws.InstanceDataSourceHTTP, aws.InstanceDataSourceAPI, aws.InstanceDataSourceEmbedded:
+		return nil
+	}
+	return fmt.Errorf("instance data source '%s' is not recognized. Available sources: %s, %s, %s", source, aws.InstanceDataSourceHTTP, aws.InstanceDataSourceAPI, aws.InstanceDataSourceEmbedded)
+}
+
+func validateSpotSource(source, bucket string) error {
+	switch source {
+	case aws.SpotSourceAPI:
+		return nil
+	case aws.SpotSourceFeed:
+		if bucket == "" {
+			return fmt.Errorf("aws.spot-feed-bucket is required with aws.spot-source '%s'", source)
+		}
+		return nil
+	}
+	return fmt.Errorf("spot source '%s' is not recognized. Available sources: %s, %s", source, aws.SpotSourceAPI, aws.SpotSourceFeed)
+}
+
+func validateResourceBounds(minVCpu, maxVCpu int, minMemoryGB, maxMemoryGB float64) error {
+	if minVCpu < 0 || maxVCpu < 0 || minMemoryGB < 0 || maxMemoryGB < 0 {
+		return fmt.Errorf("vCPU and memory bounds must not be negative")
+	}
+	if maxVCpu > 0 && minVCpu > maxVCpu {
+		return fmt.Errorf("aws.min-vcpu (%d) is greater than aws.max-vcpu (%d)", minVCpu, maxVCpu)
+	}
+	if maxMemoryGB > 0 && minMemoryGB > maxMemoryGB {
+		return fmt.Errorf("aws.min-memory-gb (%g) is greater than aws.max-memory-gb (%g)", minMemoryGB, maxMemoryGB)
+	}
+	return nil
+}
+
+// scrapeTimeoutMargin is the part of the Prometheus scrape timeout left to
+// render and send the metrics.
+const scrapeTimeoutMargin = 500 * time.Millisecond
+
+// scrapeDeadline returns how long a metrics request may wait for a scrape:
+// the timeout Prometheus sent in X-Prometheus-Scrape-Timeout-Seconds less
+// scrapeTimeoutMargin (or half of it, if it's shorter), else fallback. 0 =
+// no limit.
+func scrapeDeadline(r *http.Request, fallback time.Duration) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return fallback
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout <= 2*scrapeTimeoutMargin {
+		return timeout / 2
+	}
+	return timeout - scrapeTimeoutMargin
+}
+
+// metricsHandler refreshes exp before next serves its metrics, waiting for a
+// due scrape no longer than scrapeDeadline allows. Past that the metrics of
+// the previous scrape are served, so Prometheus doesn't time out and drop
+// the target while the scrape completes in the background.
+func metricsHandler(exp *exporter.Exporter, next http.Handler, fallback time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if d := scrapeDeadline(r, fallback); d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		if err := exp.Refresh(ctx); err != nil {
+			log.WithError(err).Warn("scrape not complete within the scrape timeout, serving the previous prices")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	safePath := html.EscapeString(*metricsPath)
+	links := `<p><a href="` + safePath + `">Metrics</a></p>`
+	if *configPath != "" {
+		links += `
+		<p><a href="` + html.EscapeString(*configPath) + `">Configuration</a></p>`
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`<html>
 		<head><title>Cloud Price Exporter</title></head>
 		<body>
 		<h1>Cloud Price Exporter</h1>
-		<p><a href="` + safePath + `">Metrics</a></p>
+		` + links + `
 		</body>
 		</html>
 	`))
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jz-wilson/cloud-price-exporter/exporter/apierror"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/aws"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/azure"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/provider"
+	"github.com/jz-wilson/cloud-price-exporter/exporter/regionname"
+)
+
+// selfTestCommand is the subcommand checking that the exporter can reach
+// what its configuration needs, e.g. in a deployment pipeline.
+const selfTestCommand = "selftest"
+
+// Results of a self test check.
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// selfTestTimeout bounds every check of a self test.
+const selfTestTimeout = 30 * time.Second
+
+// azureSelfTestSKU is the VM size priced in every Azure region, queried to
+// check the Retail Prices API with a single small page.
+const azureSelfTestSKU = "Standard_D2s_v3"
+
+// checkResult is the outcome of one self test check.
+type checkResult struct {
+	Provider string
+	Check    string
+	Status   string // checkPass, checkFail or checkSkip
+	Detail   string
+}
+
+// selfTest runs checks and collects their results.
+type selfTest struct {
+	timeout time.Duration
+	results []checkResult
+}
+
+// run runs check, bounded by t.timeout. A failed check's detail is its error
+// classified for provider, i.e. with the remediation hint.
+func (t *selfTest) run(prov, name string, check func(ctx context.Context) (string, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	detail, err := check(ctx)
+	result := checkResult{Provider: prov, Check: name, Status: checkPass, Detail: detail}
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = apierror.Classify(prov, err).Error()
+	}
+	t.results = append(t.results, result)
+}
+
+// skip records a check that the configuration doesn't need.
+func (t *selfTest) skip(prov, name, reason string) {
+	t.results = append(t.results, checkResult{Provider: prov, Check: name, Status: checkSkip, Detail: reason})
+}
+
+// failed returns the number of failed checks.
+func (t *selfTest) failed() int {
+	n := 0
+	for _, r := range t.results {
+		if r.Status == checkFail {
+			n++
+		}
+	}
+	return n
+}
+
+// report writes the results as a table followed by a summary line.
+func (t *selfTest) report(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tCHECK\tRESULT\tDETAIL")
+	counts := map[string]int{}
+	for _, r := range t.results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Provider, r.Check, r.Status, r.Detail)
+		counts[r.Status]++
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", counts[checkPass], counts[checkFail], counts[checkSkip])
+}
+
+// checkEndpoint requests the headers of the public endpoint url.
+func checkEndpoint(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", &apierror.StatusError{API: url, StatusCode: resp.StatusCode}
+	}
+	return fmt.Sprintf("%s (%d)", url, resp.StatusCode), nil
+}
+
+// ec2Probe is the cheapest form of an EC2 call an enabled feature makes in
+// every region.
+type ec2Probe struct {
+	call  string
+	check func(ctx context.Context, client aws.EC2Client) error
+}
+
+// awsEC2Probes returns the EC2 calls the enabled features make per region
+// with the exporter's own credentials. Spot prices of -aws.assume-role-arns
+// accounts are read with the roles' credentials and aren't probed.
+func awsEC2Probes(lifecycles []string) []ec2Probe {
+	var probes []ec2Probe
+	if provider.Contains(lifecycles, "spot") && *spotSource == aws.SpotSourceAPI && *assumeRoleARNs == "" {
+		probes = append(probes, ec2Probe{"DescribeSpotPriceHistory", func(ctx context.Context, client aws.EC2Client) error {
+			return aws.CheckSpotAccess(ctx, client)
+		}})
+	}
+	if *instanceTypeOfferings {
+		probes = append(probes, ec2Probe{"DescribeInstanceTypeOfferings", func(ctx context.Context, client aws.EC2Client) error {
+			return aws.CheckOfferingsAccess(ctx, client)
+		}})
+	}
+	if *skipUnauthorized {
+		probes = append(probes, ec2Probe{"DescribeAvailabilityZones", func(ctx context.Context, client aws.EC2Client) error {
+			return aws.CheckRegionAccess(ctx, client)
+		}})
+	}
+	return probes
+}
+
+// awsCredentialFeatures returns the enabled AWS features that call AWS APIs
+// and so need credentials.
+func awsCredentialFeatures(lifecycles []string) []string {
+	var features []string
+	if provider.Contains(lifecycles, "spot") {
+		features = append(features, "spot lifecycle")
+	}
+	if *savingPlanTypes != "" {
+		features = append(features, "aws.saving-plan-types")
+	}
+	if *ondemandBackend == aws.OnDemandBackendAPI {
+		features = append(features, "aws.ondemand-backend=api")
+	}
+	if *instanceDataSource == aws.InstanceDataSourceAPI {
+		features = append(features, "aws.instance-data-source=api")
+	}
+	if *effectiveRatesWindow > 0 {
+		features = append(features, "aws.effective-rates-window")
+	}
+	if *instanceTypeOfferings {
+		features = append(features, "aws.instance-type-offerings")
+	}
+	if *regions == "" {
+		features = append(features, "region discovery")
+	}
+	return features
+}
+
+// runSelfTest checks, per enabled provider and configured region, that the
+// credentials resolve and one cheap API call succeeds, and that the public
+// pricing endpoints the configuration reads are reachable. It writes the
+// report to w and returns the number of failed checks.
+func runSelfTest(w io.Writer, httpClient, sdkHTTPClient *http.Client) int {
+	t := &selfTest{timeout: selfTestTimeout}
+	if *awsEnabled {
+		selfTestAWS(t, httpClient, sdkHTTPClient)
+	}
+	if *azureEnabled {
+		selfTestAzure(t, httpClient)
+	}
+	t.report(w)
+	return t.failed()
+}
+
+func selfTestAWS(t *selfTest, httpClient, sdkHTTPClient *http.Client) {
+	lc := splitAndTrim(*lifecycle)
+	if len(lc) == 0 {
+		lc = []string{"spot", "ondemand"}
+	}
+	reg := excludeRegions(regionname.Codes("aws", splitAndTrim(*regions)), regionname.Codes("aws", splitAndTrim(*regionsExclude)))
+	clientFactory := aws.SDKClientFactory{Endpoint: *awsEndpointURL, HTTPClient: sdkHTTPClient}
+	credentialRegion := "us-east-1"
+	if len(reg) > 0 {
+		credentialRegion = reg[0]
+	}
+
+	features := awsCredentialFeatures(lc)
+	probes := awsEC2Probes(lc)
+	credentialsFailed := false
+	if len(features) == 0 {
+		t.skip("aws", "credentials", "not needed, no enabled feature calls AWS APIs")
+	} else {
+		t.run("aws", "credentials", func(ctx context.Context) (string, error) {
+			source, err := clientFactory.CheckCredentials(ctx, credentialRegion)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s, needed by %s", source, strings.Join(features, ", ")), nil
+		})
+		credentialsFailed = t.results[len(t.results)-1].Status == checkFail
+		for _, roleARN := range splitAndTrim(*assumeRoleARNs) {
+			account, err := aws.NewAssumeRoleAccount(clientFactory, roleARN)
+			t.run("aws", "assume role "+roleARN, func(ctx context.Context) (string, error) {
+				if err != nil {
+					return "", err
+				}
+				return account.ClientFactory.(*aws.SDKClientFactory).CheckCredentials(ctx, credentialRegion)
+			})
+		}
+	}
+
+	if *validateRegions {
+		t.run("aws", "region names", func(context.Context) (string, error) {
+			return strings.Join(reg, ", "), regionname.Validate("aws", reg)
+		})
+	}
+	switch {
+	case len(features) == 0:
+		// Without credentials the exporter makes no regional API calls.
+	case len(probes) == 0:
+		t.skip("aws", "ec2 regions", "no enabled feature calls EC2 in every region")
+	case credentialsFailed:
+		t.skip("aws", "ec2 regions", "no credentials")
+	case len(reg) == 0:
+		t.skip("aws", "ec2 regions", "regions are discovered at startup, set -aws.regions to check them")
+	default:
+		for _, region := range reg {
+			t.run("aws", "ec2 "+region, func(ctx context.Context) (string, error) {
+				client, err := clientFactory.NewEC2Client(region)
+				if err != nil {
+					return "", err
+				}
+				calls := make([]string, 0, len(probes))
+				for _, probe := range probes {
+					if err := probe.check(ctx, client); err != nil {
+						return "", err
+					}
+					calls = append(calls, probe.call)
+				}
+				return strings.Join(calls, ", "), nil
+			})
+		}
+	}
+
+	if *ondemandBackend == aws.OnDemandBackendBulk && (provider.Contains(lc, "ondemand") || provider.Contains(lc, "reserved")) {
+		t.run("aws", "bulk pricing", func(ctx context.Context) (string, error) {
+			return checkEndpoint(ctx, httpClient, aws.RegionIndexURL)
+		})
+	} else {
+		t.skip("aws", "bulk pricing", "not read, the ondemand and reserved lifecycles are off or aws.ondemand-backend is api")
+	}
+	if *instanceDataSource == aws.InstanceDataSourceHTTP {
+		t.run("aws", "ec2instances.info", func(ctx context.Context) (string, error) {
+			return checkEndpoint(ctx, httpClient, aws.EC2InstancesInfoURL)
+		})
+	} else {
+		t.skip("aws", "ec2instances.info", "not read, aws.instance-data-source is "+*instanceDataSource)
+	}
+}
+
+func selfTestAzure(t *selfTest, httpClient *http.Client) {
+	azureReg := regionname.Codes("azure", splitAndTrim(*azureRegions))
+	if len(azureReg) == 0 {
+		t.skip("azure", "retail prices", "no -azure.regions set")
+		return
+	}
+	if *validateRegions {
+		t.run("azure", "region names", func(context.Context) (string, error) {
+			return strings.Join(azureReg, ", "), regionname.Validate("azure", azureReg)
+		})
+	}
+	azureFactory := azure.NewDefaultClientFactory()
+	azureFactory.SetHTTPClient(httpClient)
+	azureFactory.SetMaxAttempts(1)
+	if creds, ok := azure.CredentialsFromEnv(); ok {
+		azureFactory.SetCredentials(creds)
+		t.run("azure", "credentials", func(ctx context.Context) (string, error) {
+			if err := azureFactory.CheckCredentials(ctx); err != nil {
+				return "", err
+			}
+			return "token for subscription " + creds.SubscriptionID, nil
+		})
+	} else {
+		t.skip("azure", "credentials", "not set, retail prices need none")
+	}
+	client := azureFactory.NewRetailPricesClient()
+	for _, region := range azureReg {
+		t.run("azure", "retail prices "+region, func(ctx context.Context) (string, error) {
+			filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and armRegionName eq '%s' and armSkuName eq '%s'", region, azureSelfTestSKU)
+			items, err := client.GetPrices(ctx, filter)
+			if err != nil {
+				return "", err
+			}
+			if len(items) == 0 {
+				return "", fmt.Errorf("no %s prices, is %s an Azure region?", azureSelfTestSKU, region)
+			}
+			return fmt.Sprintf("%d %s prices", len(items), azureSelfTestSKU), nil
+		})
+	}
+}
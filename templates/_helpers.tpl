@@ -63,32 +63,280 @@ Renders one flag per line (no leading dash prefix duplication).
 Used by deployment.yaml for both direct args and sidecarWait shell wrapper.
 */}}
 {{- define "cloud-price-exporter.cliArgs" -}}
--listen-address=:{{ .Values.service.port }}
--log-level={{ .Values.exporter.logLevel }}
+-web.listen-address=:{{ .Values.service.port }}
+-log.level={{ .Values.exporter.logLevel }}
+{{- if .Values.exporter.logModuleLevels }}
+-log.module-levels={{ .Values.exporter.logModuleLevels }}
+{{- end }}
+{{- if .Values.exporter.logDebugSample }}
+-log.debug-sample={{ .Values.exporter.logDebugSample }}
+{{- end }}
+{{- if hasKey .Values.exporter "configPath" }}
+-web.config-path={{ .Values.exporter.configPath }}
+{{- end }}
 -cache={{ .Values.exporter.cache }}
+{{- if .Values.config }}
+-config-file=/etc/cloud-price-exporter/config/config.yaml
+{{- end }}
+{{- if .Values.exporter.cacheJitter }}
+-cache-jitter={{ .Values.exporter.cacheJitter }}
+{{- end }}
+{{- if .Values.exporter.refreshStagger }}
+-refresh-stagger=true
+{{- end }}
+{{- if hasKey .Values.exporter "scrapeConcurrency" }}
+-scrape.concurrency={{ .Values.exporter.scrapeConcurrency }}
+{{- end }}
+{{- if .Values.exporter.scrapeTimeout }}
+-scrape.timeout={{ .Values.exporter.scrapeTimeout }}
+{{- end }}
+{{- if and (hasKey .Values.exporter "pricePrecision") (ge (int .Values.exporter.pricePrecision) 0) }}
+-price-precision={{ .Values.exporter.pricePrecision }}
+{{- end }}
+{{- if .Values.exporter.regionNameLabel }}
+-region-name-label=true
+{{- end }}
+{{- if .Values.exporter.metricsFormat }}
+-metrics-format={{ .Values.exporter.metricsFormat }}
+{{- end }}
+{{- if hasKey .Values.exporter "autoDetectRegion" }}
+-auto-detect-region={{ .Values.exporter.autoDetectRegion }}
+{{- end }}
+{{- if hasKey .Values.exporter "validateRegions" }}
+-validate-regions={{ .Values.exporter.validateRegions }}
+{{- end }}
+{{- if .Values.exporter.nodeHourlyCost }}
+-node-hourly-cost=true
+{{- end }}
+{{- if or .Values.exporter.notify.webhookUrl .Values.exporter.notify.webhookUrlSecret }}
+{{- if .Values.exporter.notify.webhookUrlSecret }}
+-notify.webhook-url-file=/etc/cloud-price-exporter/notify/{{ .Values.exporter.notify.webhookUrlSecretKey }}
+{{- else }}
+-notify.webhook-url={{ .Values.exporter.notify.webhookUrl }}
+{{- end }}
+-notify.webhook-format={{ .Values.exporter.notify.webhookFormat }}
+-notify.threshold-percent={{ .Values.exporter.notify.thresholdPercent }}
+{{- end }}
+{{- if .Values.exporter.kubernetesNodes }}
+-kubernetes-nodes=true
+{{- end }}
+{{- if .Values.exporter.circuitBreakerFailures }}
+-circuit-breaker.failures={{ .Values.exporter.circuitBreakerFailures }}
+{{- if .Values.exporter.circuitBreakerCooldown }}
+-circuit-breaker.cooldown={{ .Values.exporter.circuitBreakerCooldown }}
+{{- end }}
+{{- end }}
+{{- if .Values.exporter.httpConnectTimeout }}
+-http.connect-timeout={{ .Values.exporter.httpConnectTimeout }}
+{{- end }}
+{{- if .Values.exporter.httpTimeout }}
+-http.timeout={{ .Values.exporter.httpTimeout }}
+{{- end }}
+{{- if .Values.exporter.httpMaxResponseMB }}
+-http.max-response-mb={{ .Values.exporter.httpMaxResponseMB }}
+{{- end }}
+{{- if .Values.exporter.httpProxy }}
+-http.proxy={{ .Values.exporter.httpProxy }}
+{{- end }}
+{{- if .Values.exporter.noProxy }}
+-http.no-proxy={{ .Values.exporter.noProxy }}
+{{- end }}
+{{- if .Values.exporter.caBundle.configMap }}
+-http.ca-bundle=/etc/cloud-price-exporter/ca/{{ .Values.exporter.caBundle.key }}
+{{- end }}
+{{- if .Values.exporter.awsPricingApiPath }}
+-aws.pricing-api-path={{ .Values.exporter.awsPricingApiPath }}
+{{- end }}
+{{- if .Values.exporter.kubecostCsv.path }}
+-kubecost.csv-path={{ .Values.exporter.kubecostCsv.path }}
+-kubecost.csv-interval={{ .Values.exporter.kubecostCsv.interval }}
+-kubecost.csv-s3-region={{ .Values.exporter.kubecostCsv.s3Region }}
+{{- end }}
+{{- if .Values.exporter.grpcExpander.port }}
+-grpc-expander.address=:{{ .Values.exporter.grpcExpander.port }}
+{{- if .Values.exporter.grpcExpander.tlsSecret }}
+-grpc-expander.tls-cert=/etc/cloud-price-exporter/expander-tls/tls.crt
+-grpc-expander.tls-key=/etc/cloud-price-exporter/expander-tls/tls.key
+{{- end }}
+{{- end }}
+{{- if .Values.exporter.currencies }}
+-currencies={{ .Values.exporter.currencies }}
+{{- end }}
 {{- if .Values.exporter.instanceRegexes }}
--instance-regexes={{ .Values.exporter.instanceRegexes }}
+-aws.instance-regexes={{ .Values.exporter.instanceRegexes }}
 {{- end }}
--aws-enabled={{ .Values.exporter.aws.enabled }}
+-aws.enabled={{ .Values.exporter.aws.enabled }}
 {{- if .Values.exporter.aws.enabled }}
--lifecycle={{ .Values.exporter.aws.lifecycle }}
--product-descriptions={{ .Values.exporter.aws.productDescriptions }}
--operating-systems={{ .Values.exporter.aws.operatingSystems }}
+-aws.lifecycle={{ .Values.exporter.aws.lifecycle }}
+-aws.spot-aggregation={{ .Values.exporter.aws.spotAggregation }}
+-aws.ondemand-per-region={{ .Values.exporter.aws.ondemandPerRegion }}
+{{- if .Values.exporter.aws.cpuMemoryRatio }}
+-aws.cpu-memory-ratio={{ .Values.exporter.aws.cpuMemoryRatio }}
+{{- end }}
+{{- if .Values.exporter.aws.cpuMemoryRegression }}
+-aws.cpu-memory-regression={{ .Values.exporter.aws.cpuMemoryRegression }}
+{{- end }}
+{{- if .Values.exporter.aws.burstableUtilization }}
+-aws.burstable-utilization={{ .Values.exporter.aws.burstableUtilization }}
+{{- end }}
+-aws.product-descriptions={{ .Values.exporter.aws.productDescriptions }}
+-aws.operating-systems={{ .Values.exporter.aws.operatingSystems }}
 {{- if .Values.exporter.aws.regions }}
--regions={{ .Values.exporter.aws.regions }}
+-aws.regions={{ .Values.exporter.aws.regions }}
+{{- end }}
+{{- if .Values.exporter.aws.skipUnauthorizedRegions }}
+-aws.skip-unauthorized-regions={{ .Values.exporter.aws.skipUnauthorizedRegions }}
+{{- end }}
+{{- if .Values.exporter.aws.regionsExclude }}
+-aws.regions-exclude={{ .Values.exporter.aws.regionsExclude }}
+{{- end }}
+{{- if .Values.exporter.aws.assumeRoleArns }}
+-aws.assume-role-arns={{ .Values.exporter.aws.assumeRoleArns }}
+{{- end }}
+{{- if .Values.exporter.aws.endpointUrl }}
+-aws.endpoint-url={{ .Values.exporter.aws.endpointUrl }}
+{{- end }}
+{{- if .Values.exporter.aws.retryMode }}
+-aws.retry-mode={{ .Values.exporter.aws.retryMode }}
+{{- end }}
+{{- if .Values.exporter.aws.retryMaxAttempts }}
+-aws.retry-max-attempts={{ .Values.exporter.aws.retryMaxAttempts }}
+{{- end }}
+{{- if .Values.exporter.aws.ondemandBackend }}
+-aws.ondemand-backend={{ .Values.exporter.aws.ondemandBackend }}
+{{- end }}
+{{- if .Values.exporter.aws.localStoragePrice }}
+-aws.local-storage-price={{ .Values.exporter.aws.localStoragePrice }}
+{{- end }}
+{{- if .Values.exporter.aws.macHosts }}
+-aws.mac-hosts={{ .Values.exporter.aws.macHosts }}
+{{- end }}
+{{- if .Values.exporter.aws.dynamodbEnabled }}
+-aws.dynamodb-enabled={{ .Values.exporter.aws.dynamodbEnabled }}
+{{- end }}
+{{- if .Values.exporter.aws.opensearchEnabled }}
+-aws.opensearch-enabled={{ .Values.exporter.aws.opensearchEnabled }}
+{{- end }}
+{{- if .Values.exporter.aws.rdsEnabled }}
+-aws.rds-enabled={{ .Values.exporter.aws.rdsEnabled }}
+{{- end }}
+{{- if .Values.exporter.aws.cloudfrontEnabled }}
+-aws.cloudfront-enabled={{ .Values.exporter.aws.cloudfrontEnabled }}
+{{- end }}
+{{- if .Values.exporter.aws.managedSurcharges }}
+-aws.managed-surcharges={{ .Values.exporter.aws.managedSurcharges }}
+{{- end }}
+{{- if .Values.exporter.aws.effectiveRatesWindow }}
+-aws.effective-rates-window={{ .Values.exporter.aws.effectiveRatesWindow }}
+{{- end }}
+{{- if .Values.exporter.aws.spotSource }}
+-aws.spot-source={{ .Values.exporter.aws.spotSource }}
+{{- end }}
+{{- if .Values.exporter.aws.spotFeedBucket }}
+-aws.spot-feed-bucket={{ .Values.exporter.aws.spotFeedBucket }}
+{{- end }}
+{{- if .Values.exporter.aws.spotFeedPrefix }}
+-aws.spot-feed-prefix={{ .Values.exporter.aws.spotFeedPrefix }}
+{{- end }}
+{{- if .Values.exporter.aws.spotFeedRegion }}
+-aws.spot-feed-region={{ .Values.exporter.aws.spotFeedRegion }}
+{{- end }}
+{{- if .Values.exporter.aws.spotHistoryWindow }}
+-aws.spot-history-window={{ .Values.exporter.aws.spotHistoryWindow }}
 {{- end }}
 {{- if .Values.exporter.aws.savingPlanTypes }}
--saving-plan-types={{ .Values.exporter.aws.savingPlanTypes }}
+-aws.saving-plan-types={{ .Values.exporter.aws.savingPlanTypes }}
+{{- end }}
+{{- if .Values.exporter.aws.savingPlanPageSize }}
+-aws.saving-plan-page-size={{ .Values.exporter.aws.savingPlanPageSize }}
+{{- end }}
+{{- if .Values.exporter.aws.savingPlanPageDelay }}
+-aws.saving-plan-page-delay={{ .Values.exporter.aws.savingPlanPageDelay }}
+{{- end }}
+{{- if .Values.exporter.aws.spotPageSize }}
+-aws.spot-page-size={{ .Values.exporter.aws.spotPageSize }}
+{{- end }}
+{{- if .Values.exporter.aws.pricingPageSize }}
+-aws.pricing-page-size={{ .Values.exporter.aws.pricingPageSize }}
+{{- end }}
+{{- if .Values.exporter.aws.availabilityZones }}
+-aws.availability-zones={{ .Values.exporter.aws.availabilityZones }}
+{{- end }}
+{{- if .Values.exporter.aws.instanceTypeOfferings }}
+-aws.instance-type-offerings={{ .Values.exporter.aws.instanceTypeOfferings }}
+{{- end }}
+{{- if .Values.exporter.aws.instanceFamilies }}
+-aws.instance-families={{ .Values.exporter.aws.instanceFamilies }}
 {{- end }}
+{{- if .Values.exporter.aws.instanceDataSource }}
+-aws.instance-data-source={{ .Values.exporter.aws.instanceDataSource }}
 {{- end }}
--azure-enabled={{ .Values.exporter.azure.enabled }}
+{{- if .Values.exporter.aws.instanceRefreshInterval }}
+-aws.instance-refresh-interval={{ .Values.exporter.aws.instanceRefreshInterval }}
+{{- end }}
+{{- if .Values.exporter.aws.architectures }}
+-aws.architectures={{ .Values.exporter.aws.architectures }}
+{{- end }}
+{{- if .Values.exporter.aws.minVCpu }}
+-aws.min-vcpu={{ .Values.exporter.aws.minVCpu }}
+{{- end }}
+{{- if .Values.exporter.aws.maxVCpu }}
+-aws.max-vcpu={{ .Values.exporter.aws.maxVCpu }}
+{{- end }}
+{{- if .Values.exporter.aws.minMemoryGB }}
+-aws.min-memory-gb={{ .Values.exporter.aws.minMemoryGB }}
+{{- end }}
+{{- if .Values.exporter.aws.maxMemoryGB }}
+-aws.max-memory-gb={{ .Values.exporter.aws.maxMemoryGB }}
+{{- end }}
+{{- end }}
+-azure.enabled={{ .Values.exporter.azure.enabled }}
 {{- if .Values.exporter.azure.enabled }}
 {{- if .Values.exporter.azure.regions }}
--azure-regions={{ .Values.exporter.azure.regions }}
+-azure.regions={{ .Values.exporter.azure.regions }}
+{{- end }}
+-azure.operating-systems={{ .Values.exporter.azure.operatingSystems }}
+{{- if .Values.exporter.azure.lifecycle }}
+-azure.lifecycle={{ .Values.exporter.azure.lifecycle }}
+{{- end }}
+{{- if .Values.exporter.azure.priceTypes }}
+-azure.price-types={{ .Values.exporter.azure.priceTypes }}
+{{- end }}
+{{- if .Values.exporter.azure.detailLabels }}
+-azure.detail-labels={{ .Values.exporter.azure.detailLabels }}
 {{- end }}
--azure-operating-systems={{ .Values.exporter.azure.operatingSystems }}
 {{- if .Values.exporter.azure.instanceRegexes }}
--azure-instance-regexes={{ .Values.exporter.azure.instanceRegexes }}
+-azure.instance-regexes={{ .Values.exporter.azure.instanceRegexes }}
+{{- end }}
+{{- if .Values.exporter.azure.rateLimit }}
+-azure.rate-limit={{ .Values.exporter.azure.rateLimit }}
+{{- end }}
+{{- if .Values.exporter.azure.rateBurst }}
+-azure.rate-burst={{ .Values.exporter.azure.rateBurst }}
+{{- end }}
+{{- if .Values.exporter.azure.maxAttempts }}
+-azure.max-attempts={{ .Values.exporter.azure.maxAttempts }}
+{{- end }}
+{{- if .Values.exporter.azure.aksEnabled }}
+-azure.aks-enabled={{ .Values.exporter.azure.aksEnabled }}
+{{- end }}
+{{- if .Values.exporter.azure.functionsEnabled }}
+-azure.functions-enabled={{ .Values.exporter.azure.functionsEnabled }}
+{{- end }}
+{{- if .Values.exporter.azure.cosmosdbEnabled }}
+-azure.cosmosdb-enabled={{ .Values.exporter.azure.cosmosdbEnabled }}
+{{- end }}
+{{- if .Values.exporter.azure.storageEnabled }}
+-azure.storage-enabled={{ .Values.exporter.azure.storageEnabled }}
+{{- end }}
+{{- if .Values.exporter.azure.netappFiles }}
+-azure.netapp-files={{ .Values.exporter.azure.netappFiles }}
+{{- end }}
 {{- end }}
+{{- if .Values.exporter.fake.regions }}
+-fake.regions={{ .Values.exporter.fake.regions }}
+-fake.instance-types={{ .Values.exporter.fake.instanceTypes }}
+-fake.volatility={{ .Values.exporter.fake.volatility }}
+-fake.seed={{ .Values.exporter.fake.seed }}
 {{- end }}
 {{- end -}}